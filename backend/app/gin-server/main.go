@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -17,13 +19,14 @@ import (
 	"github.com/yoockh/yoospeak/internal/api/handlers"
 	"github.com/yoockh/yoospeak/internal/api/middleware"
 	"github.com/yoockh/yoospeak/internal/api/routes"
+	"github.com/yoockh/yoospeak/internal/audio"
 	"github.com/yoockh/yoospeak/internal/cache"
 	"github.com/yoockh/yoospeak/internal/logger"
 	mongorepo "github.com/yoockh/yoospeak/internal/repositories/mongo"
 	pgrepo "github.com/yoockh/yoospeak/internal/repositories/postgres"
 	"github.com/yoockh/yoospeak/internal/services"
 
-	llmprov "github.com/yoockh/yoospeak/internal/providers/llm"
+	embprov "github.com/yoockh/yoospeak/internal/providers/embeddings"
 	sttprov "github.com/yoockh/yoospeak/internal/providers/stt"
 	storagepkg "github.com/yoockh/yoospeak/internal/storage"
 	"github.com/yoockh/yoospeak/internal/workers"
@@ -42,6 +45,8 @@ func main() {
 	// Init PostgreSQL
 	if err := config.InitPostgres(); err != nil {
 		l.WithError(err).Error("PostgreSQL init failed")
+	} else if err := config.EnsurePostgresMigrations(); err != nil {
+		l.WithError(err).Error("PostgreSQL migrations error")
 	}
 	// Init Redis
 	if err := config.InitRedis(); err != nil {
@@ -64,19 +69,18 @@ func main() {
 		l.Warn("MongoDB not available - some features will be disabled")
 	}
 
-	// GCS uploader (optional for CV upload)
-	var gcsUp *storagepkg.GCSUploader
-	bucket := os.Getenv("GCS_BUCKET")
-	if bucket != "" {
-		baseCtx := context.Background()
-		var err error
-		gcsUp, err = storagepkg.NewGCSUploader(baseCtx, bucket)
-		if err != nil {
-			l.WithError(err).Error("GCS uploader init failed")
-		}
-		if gcsUp != nil {
-			defer gcsUp.Close()
-		}
+	// Object storage for CV uploads: STORAGE_BACKEND=gcs | s3 | local. Unlike the
+	// databases this is configuration, not a service that may come up later.
+	if err := config.InitStorage(); err != nil {
+		l.WithError(err).Fatal("Storage init failed")
+	}
+	if config.Storage != nil {
+		defer config.Storage.Close()
+	}
+
+	// Upload scanning: SCANNER=none | clamav (PDF active-content check always on)
+	if err := config.InitScanner(); err != nil {
+		l.WithError(err).Error("Scanner init failed")
 	}
 
 	// Repos
@@ -86,35 +90,118 @@ func main() {
 	profileRepo := pgrepo.NewProfileRepo(config.PostgresDB)
 	convoRepo := pgrepo.NewConversationRepo(config.PostgresDB)
 	cvRepo := pgrepo.NewCVFileRepo(config.PostgresDB)
+	cvChunkRepo := pgrepo.NewCVChunkRepo(config.PostgresDB)
+	usageRepo := pgrepo.NewUsageRepo(config.PostgresDB)
 
 	// Cache (optional)
 	redisCache := cache.NewRedisCache(config.RedisClient)
 
+	// Async embedding / CV extraction jobs (optional: needs Redis)
+	var embedJobs services.EmbeddingJobs
+	var cvJobs services.CVExtractionJobs
+	if config.RedisClient != nil {
+		embedJobs = workers.NewEmbeddingQueue(config.RedisClient, "embed:stream")
+		cvJobs = workers.NewCVExtractionQueue(config.RedisClient, "cv:stream")
+	}
+
+	// Embeddings provider (optional): EMBEDDINGS_PROVIDER=vertex (default) | local
+	var embP embprov.Provider
+	switch os.Getenv("EMBEDDINGS_PROVIDER") {
+	case "local":
+		embP = embprov.NewLocal(embprov.Dimensions)
+	default:
+		projectID := os.Getenv("VERTEX_PROJECT_ID")
+		location := os.Getenv("VERTEX_LOCATION")
+		if projectID != "" && location != "" {
+			var err error
+			embP, err = embprov.NewVertexEmbeddings(context.Background(), projectID, location, os.Getenv("VERTEX_EMBEDDING_MODEL"))
+			if err != nil {
+				l.WithError(err).Error("Embeddings init failed")
+				embP = nil
+			}
+		}
+	}
+
+	// LLM (coach answers in the audio worker, CV parsing in the API): LLM_PROVIDER=vertex | openai | ollama
+	llmP, err := config.NewLLM(context.Background())
+	if err != nil {
+		l.WithError(err).Error("LLM init failed")
+		llmP = nil
+	}
+
 	// Services
 	sessionSvc := services.NewSessionService(sessionRepo)
 	bufferSvc := services.NewBufferService(bufferRepo, 24*time.Hour)
 	profileSvc := services.NewProfileServiceWithCache(profileRepo, redisCache, 5*time.Minute)
-	convoSvc := services.NewConversationService(convoRepo)
-	cvSvc := services.NewCVFileService(cvRepo, gcsUp)
+	convoSvc := services.NewConversationServiceWithEmbeddings(convoRepo, embP)
+	usageSvc := services.NewUsageService(usageRepo, config.UsagePricing())
+	cvSvc := services.NewCVFileService(cvRepo, config.Storage, profileSvc, cvChunkRepo, embedJobs, config.Scanner)
+
+	var proposalCache cache.Cache
+	if config.RedisClient != nil {
+		proposalCache = redisCache
+	}
+	cvParseSvc := services.NewCVParseService(profileSvc, llmP, proposalCache)
+
+	var cvRetrieval services.CVRetrievalService
+	if embP != nil && config.PostgresDB != nil {
+		cvRetrieval = services.NewCVRetrievalService(embP, cvChunkRepo)
+	}
+
+	// Per-user plan quotas (optional: QUOTA_ENABLED=true, needs Redis; admin overrides need PostgreSQL)
+	var quotaSvc services.QuotaService
+	if config.QuotaEnabled() {
+		quotaCfg, err := config.QuotaConfig()
+		switch {
+		case err != nil:
+			l.WithError(err).Error("Quota config invalid - quotas disabled")
+		case config.RedisClient == nil:
+			l.Warn("Redis not available - quotas disabled")
+		default:
+			var overrides pgrepo.QuotaOverrideRepo
+			if config.PostgresDB != nil {
+				overrides = pgrepo.NewQuotaOverrideRepo(config.PostgresDB)
+			}
+			quotaSvc = services.NewQuotaServiceWithCache(config.RedisClient, quotaCfg, overrides, redisCache, time.Minute)
+		}
+	}
 
 	// Handlers
 	sessionH := handlers.NewSessionHandler(sessionSvc)
-	profileH := handlers.NewProfileHandler(profileSvc)
-	convoH := handlers.NewConversationHandler(convoSvc)
 	wsH := handlers.NewWSHandler(sessionSvc, bufferSvc, config.RedisClient)
-	cvH := handlers.NewCVHandler(cvSvc)
+	var quotaH *handlers.QuotaHandler
+	if quotaSvc != nil {
+		sessionH = handlers.NewSessionHandlerWithQuota(sessionSvc, quotaSvc)
+		wsH = handlers.NewWSHandlerWithQuota(sessionSvc, bufferSvc, config.RedisClient, quotaSvc)
+		quotaH = handlers.NewQuotaHandler(quotaSvc)
+	}
+	profileH := handlers.NewProfileHandler(profileSvc, embedJobs)
+	convoH := handlers.NewConversationHandler(convoSvc)
+	cvH := handlers.NewCVHandler(cvSvc, cvJobs)
+	cvParseH := handlers.NewCVParseHandler(cvParseSvc)
+	usageH := handlers.NewUsageHandler(usageSvc)
 
 	// Gin
 	r := gin.New()
 	r.Use(gin.Recovery())
 	r.Use(middleware.RequestLogger(l))
 
+	// local storage serves its own signed URLs
+	var filesH http.Handler
+	if ls, ok := config.Storage.(*storagepkg.LocalStore); ok {
+		filesH = http.StripPrefix("/files", ls.Handler())
+	}
+
 	routes.RegisterRoutes(r, routes.Deps{
 		Session:      sessionH,
 		Profile:      profileH,
 		Conversation: convoH,
 		WS:           wsH,
 		CV:           cvH,
+		CVParse:      cvParseH,
+		Usage:        usageH,
+		Quota:        quotaH,
+		Files:        filesH,
 	})
 
 	port := os.Getenv("PORT")
@@ -130,39 +217,115 @@ func main() {
 
 	// Optional: start workers in same process
 	var sttP sttprov.Provider
-	var llmP llmprov.Provider
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	if os.Getenv("RUN_WORKERS") == "1" {
 		var err error
 
-		sttP, err = sttprov.NewGoogleSpeech(ctx)
+		// STT_PROVIDER=google (default) | openai (any OpenAI-compatible /audio/transcriptions server)
+		switch os.Getenv("STT_PROVIDER") {
+		case "openai":
+			if baseURL := os.Getenv("STT_OPENAI_BASE_URL"); baseURL != "" {
+				sttP = sttprov.NewOpenAITranscriber(baseURL, os.Getenv("STT_OPENAI_MODEL"), os.Getenv("STT_OPENAI_API_KEY"))
+			} else {
+				err = errors.New("STT_PROVIDER=openai requires STT_OPENAI_BASE_URL")
+			}
+		default:
+			sttP, err = sttprov.NewGoogleSpeech(ctx)
+		}
 		if err != nil {
 			l.WithError(err).Error("STT init failed")
-		} else {
-			projectID := os.Getenv("VERTEX_PROJECT_ID")
-			location := os.Getenv("VERTEX_LOCATION")
-			model := os.Getenv("VERTEX_GEMINI_MODEL")
-			if projectID != "" && location != "" {
-				llmP, err = llmprov.NewVertexGemini(ctx, projectID, location, model)
-				if err != nil {
-					l.WithError(err).Error("LLM init failed")
-				} else if config.RedisClient != nil {
-					pool := &workers.AudioWorkerPool{
-						Redis:      config.RedisClient,
-						Buffers:    bufferSvc,
-						NumWorkers: 5,
-						STT:        sttP,
-						LLM:        llmP,
-						Logger:     l,
-						Stream:     "audio:stream",
-						Group:      "audio-workers",
-					}
-					if err := pool.Start(ctx); err != nil {
-						l.WithError(err).Error("Workers start failed")
-					}
+		} else if llmP == nil {
+			l.Error("LLM not configured (LLM_PROVIDER); audio workers not started")
+		} else if config.RedisClient != nil {
+			pool := &workers.AudioWorkerPool{
+				Redis:      config.RedisClient,
+				Buffers:    bufferSvc,
+				NumWorkers: 5,
+				STT:        sttP,
+				LLM:        llmP,
+				Logger:     l,
+				Stream:     "audio:stream",
+				Group:      "audio-workers",
+
+				// prompt context + turn persistence
+				Sessions:          sessionSvc,
+				Profiles:          profileSvc,
+				CVRetrieval:       cvRetrieval,
+				Conversations:     convoSvc,
+				Embeddings:        embedJobs,
+				PromptTokenBudget: 3000,
+				LLMOptions:        config.LLMOptions(),
+
+				MaxAttempts:      5,
+				DeadLetterStream: "audio:stream:dlq",
+
+				// reclaim entries left behind by preempted workers
+				ClaimInterval: 30 * time.Second,
+				ClaimMinIdle:  2 * time.Minute,
+				MaxDeliveries: 3,
+
+				// answer once per utterance (is_final or this much silence)
+				UtteranceTimeout: 3 * time.Second,
+
+				// per-session ordering (default); one replica reads at a time, the others stand by.
+				// AUDIO_ORDERED=0 spreads chunks over all replicas at the cost of late chunks
+				Ordered: os.Getenv("AUDIO_ORDERED") != "0",
+
+				// STT_STREAMING=1: one recognition stream per utterance with interim results
+				StreamingSTT: os.Getenv("STT_STREAMING") == "1",
+			}
+			// VAD=1: skip silent chunks, trim silence, close utterances after VAD_END_OF_UTTERANCE_MS of silence
+			if os.Getenv("VAD") == "1" {
+				pool.VAD = audio.NewVAD()
+				if v, err := strconv.ParseFloat(os.Getenv("VAD_ENERGY_THRESHOLD"), 64); err == nil && v > 0 {
+					pool.VAD.EnergyThreshold = v
 				}
+				if ms, err := strconv.Atoi(os.Getenv("VAD_END_OF_UTTERANCE_MS")); err == nil {
+					pool.EndOfUtteranceSilence = time.Duration(ms) * time.Millisecond
+				}
+			}
+			// STT seconds and LLM tokens per chunk, priced into usage_records
+			if config.PostgresDB != nil {
+				pool.Usage = usageSvc
+			}
+			// ...and counted against the daily audio/token quotas
+			if quotaSvc != nil {
+				pool.Quota = quotaSvc
+			}
+			if err := pool.Start(ctx); err != nil {
+				l.WithError(err).Error("Workers start failed")
+			}
+		}
+
+		// Embedding worker
+		if config.RedisClient != nil && config.PostgresDB != nil && embP != nil {
+			embedPool := &workers.EmbeddingWorkerPool{
+				Redis:      config.RedisClient,
+				Embeddings: services.NewEmbeddingService(embP, convoRepo, profileSvc, cvRetrieval),
+				NumWorkers: 2,
+				Logger:     l,
+				Stream:     "embed:stream",
+				Group:      "embed-workers",
+			}
+			if err := embedPool.Start(ctx); err != nil {
+				l.WithError(err).Error("Embedding workers start failed")
+			}
+		}
+
+		// CV text extraction worker (reads uploads back from storage)
+		if config.RedisClient != nil && config.PostgresDB != nil && config.Storage != nil {
+			cvPool := &workers.CVExtractionWorkerPool{
+				Redis:      config.RedisClient,
+				Extraction: services.NewCVExtractionService(cvRepo, config.Storage, profileSvc, embedJobs),
+				NumWorkers: 1,
+				Logger:     l,
+				Stream:     "cv:stream",
+				Group:      "cv-workers",
+			}
+			if err := cvPool.Start(ctx); err != nil {
+				l.WithError(err).Error("CV extraction workers start failed")
 			}
 		}
 	}
@@ -192,6 +355,9 @@ func main() {
 	if sttP != nil {
 		_ = sttP.Close()
 	}
+	if embP != nil {
+		_ = embP.Close()
+	}
 	if config.RedisClient != nil {
 		_ = config.RedisClient.Close()
 	}
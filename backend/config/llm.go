@@ -0,0 +1,65 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/yoockh/yoospeak/internal/providers/llm"
+)
+
+// NewLLM builds the chat model from LLM_PROVIDER:
+//
+//	vertex - VERTEX_PROJECT_ID, VERTEX_LOCATION, VERTEX_GEMINI_MODEL (default when VERTEX_* is set)
+//	openai - LLM_OPENAI_BASE_URL, LLM_OPENAI_MODEL, LLM_OPENAI_API_KEY (any OpenAI-compatible server)
+//	ollama - OLLAMA_BASE_URL, OLLAMA_MODEL
+//
+// It returns nil, nil when no provider is configured.
+func NewLLM(ctx context.Context) (llm.Provider, error) {
+	provider := strings.ToLower(os.Getenv("LLM_PROVIDER"))
+	if provider == "" && os.Getenv("VERTEX_PROJECT_ID") != "" && os.Getenv("VERTEX_LOCATION") != "" {
+		provider = "vertex"
+	}
+
+	switch provider {
+	case "":
+		return nil, nil
+
+	case "vertex":
+		projectID, location := os.Getenv("VERTEX_PROJECT_ID"), os.Getenv("VERTEX_LOCATION")
+		if projectID == "" || location == "" {
+			return nil, fmt.Errorf("LLM_PROVIDER=vertex requires VERTEX_PROJECT_ID and VERTEX_LOCATION")
+		}
+		v, err := llm.NewVertexGemini(ctx, projectID, location, os.Getenv("VERTEX_GEMINI_MODEL"))
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+
+	case "openai":
+		baseURL := os.Getenv("LLM_OPENAI_BASE_URL")
+		if baseURL == "" {
+			baseURL = "https://api.openai.com/v1"
+		}
+		return llm.NewOpenAIChat(baseURL, os.Getenv("LLM_OPENAI_MODEL"), os.Getenv("LLM_OPENAI_API_KEY")), nil
+
+	case "ollama":
+		return llm.NewOllama(os.Getenv("OLLAMA_BASE_URL"), os.Getenv("OLLAMA_MODEL")), nil
+	}
+	return nil, fmt.Errorf("unknown LLM_PROVIDER %q (use vertex, openai or ollama)", provider)
+}
+
+// LLMOptions reads the coach's generation parameters from LLM_TEMPERATURE and
+// LLM_MAX_TOKENS; unset or invalid values keep the provider's defaults.
+func LLMOptions() llm.Options {
+	var o llm.Options
+	if t, err := strconv.ParseFloat(os.Getenv("LLM_TEMPERATURE"), 32); err == nil && t >= 0 {
+		o.Temperature = llm.Float32(float32(t))
+	}
+	if n, err := strconv.Atoi(os.Getenv("LLM_MAX_TOKENS")); err == nil && n > 0 {
+		o.MaxTokens = n
+	}
+	return o
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// postgresMigrations are idempotent statements applied on startup, in order.
+// Base tables are owned by Supabase; only additive changes live here.
+var postgresMigrations = []string{
+	`CREATE EXTENSION IF NOT EXISTS vector`,
+
+	// conversation_logs: ANN index for semantic search (cosine distance); searches
+	// scan it iteratively, which needs pgvector 0.8 or later
+	`CREATE INDEX IF NOT EXISTS conversation_logs_embedding_hnsw
+		ON conversation_logs USING hnsw (embedding vector_cosine_ops)`,
+	`CREATE INDEX IF NOT EXISTS conversation_logs_user_ts
+		ON conversation_logs (user_id, timestamp DESC)`,
+
+	// cv_chunks: CV passages embedded for retrieval-augmented answers
+	`CREATE TABLE IF NOT EXISTS cv_chunks (
+		id          uuid PRIMARY KEY,
+		user_id     uuid NOT NULL,
+		chunk_index integer NOT NULL,
+		content     text NOT NULL,
+		embedding   vector(768),
+		created_at  timestamptz NOT NULL DEFAULT now(),
+		UNIQUE (user_id, chunk_index)
+	)`,
+	// A user has a few dozen chunks, so retrieval is an exact scan of the user's
+	// rows. A global ANN index would filter by user after the scan and can come
+	// back short of k (or empty) for users whose chunks are not near the top.
+	`DROP INDEX IF EXISTS cv_chunks_embedding_hnsw`,
+	`CREATE INDEX IF NOT EXISTS cv_chunks_user ON cv_chunks (user_id)`,
+
+	// cv_files: async text extraction status
+	`ALTER TABLE cv_files
+		ADD COLUMN IF NOT EXISTS extraction_status text NOT NULL DEFAULT 'pending',
+		ADD COLUMN IF NOT EXISTS extraction_error  text NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS extracted_at      timestamptz`,
+
+	// cv_files: active CV per user + extracted text kept for re-activation
+	`ALTER TABLE cv_files
+		ADD COLUMN IF NOT EXISTS is_active      boolean NOT NULL DEFAULT false,
+		ADD COLUMN IF NOT EXISTS extracted_text text NOT NULL DEFAULT ''`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS cv_files_one_active
+		ON cv_files (user_id) WHERE is_active`,
+	`CREATE INDEX IF NOT EXISTS cv_files_user_upload
+		ON cv_files (user_id, upload_at DESC)`,
+	// profiles: which cv_files row cv_text came from
+	`ALTER TABLE profiles ADD COLUMN IF NOT EXISTS cv_file_id uuid`,
+	// cv_files: upload scan outcome (rows from before scanning are 'unscanned')
+	`ALTER TABLE cv_files
+		ADD COLUMN IF NOT EXISTS scan_status text NOT NULL DEFAULT 'unscanned',
+		ADD COLUMN IF NOT EXISTS scan_threat text NOT NULL DEFAULT ''`,
+
+	// usage_records: per-call STT/LLM usage and cost, one row per (session, chunk, kind)
+	`CREATE TABLE IF NOT EXISTS usage_records (
+		id                uuid PRIMARY KEY,
+		user_id           uuid NOT NULL,
+		session_id        uuid NOT NULL,
+		chunk_index       bigint NOT NULL,
+		kind              text NOT NULL,
+		audio_seconds     double precision NOT NULL DEFAULT 0,
+		prompt_tokens     bigint NOT NULL DEFAULT 0,
+		completion_tokens bigint NOT NULL DEFAULT 0,
+		estimated         boolean NOT NULL DEFAULT false,
+		cost_micro_usd    bigint NOT NULL DEFAULT 0,
+		created_at        timestamptz NOT NULL DEFAULT now(),
+		UNIQUE (session_id, chunk_index, kind)
+	)`,
+	`CREATE INDEX IF NOT EXISTS usage_records_user_created
+		ON usage_records (user_id, created_at DESC)`,
+	`CREATE INDEX IF NOT EXISTS usage_records_created
+		ON usage_records (created_at)`,
+
+	// quota_overrides: admin changes to a user's plan limits (NULL = plan default)
+	`CREATE TABLE IF NOT EXISTS quota_overrides (
+		user_id               uuid PRIMARY KEY,
+		plan                  text NOT NULL DEFAULT '',
+		audio_minutes_per_day bigint,
+		sessions_per_day      bigint,
+		llm_tokens_per_day    bigint,
+		note                  text NOT NULL DEFAULT '',
+		updated_by            text NOT NULL DEFAULT '',
+		updated_at            timestamptz NOT NULL DEFAULT now()
+	)`,
+}
+
+func EnsurePostgresMigrations() error {
+	if PostgresDB == nil {
+		return errors.New("PostgresDB is nil; call InitPostgres() first")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	for i, stmt := range postgresMigrations {
+		if err := PostgresDB.WithContext(ctx).Exec(stmt).Error; err != nil {
+			return fmt.Errorf("postgres migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
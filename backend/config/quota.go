@@ -0,0 +1,54 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yoockh/yoospeak/internal/models"
+	"github.com/yoockh/yoospeak/internal/services"
+)
+
+// defaultQuotaPlans apply when QUOTA_PLANS is unset.
+var defaultQuotaPlans = services.QuotaPlans{
+	"free": {AudioMinutesPerDay: 30, SessionsPerDay: 5, LLMTokensPerDay: 50_000},
+	"pro":  {AudioMinutesPerDay: 300, SessionsPerDay: 50, LLMTokensPerDay: 1_000_000},
+}
+
+// QuotaEnabled reports whether per-user quotas are enforced (QUOTA_ENABLED=true).
+func QuotaEnabled() bool {
+	return os.Getenv("QUOTA_ENABLED") == "true"
+}
+
+// QuotaConfig reads the plan table:
+//
+//	QUOTA_PLANS        - JSON, e.g. {"free":{"audio_minutes_per_day":30,"sessions_per_day":5,"llm_tokens_per_day":50000}};
+//	                     limits left out or 0 are unlimited (default: free and pro above)
+//	QUOTA_DEFAULT_PLAN - plan of users whose token names none or an unknown one (default "free")
+func QuotaConfig() (services.QuotaConfig, error) {
+	cfg := services.QuotaConfig{
+		Plans:       defaultQuotaPlans,
+		DefaultPlan: strings.ToLower(strings.TrimSpace(os.Getenv("QUOTA_DEFAULT_PLAN"))),
+	}
+	if raw := os.Getenv("QUOTA_PLANS"); raw != "" {
+		var plans map[string]models.QuotaLimits
+		if err := json.Unmarshal([]byte(raw), &plans); err != nil {
+			return cfg, fmt.Errorf("QUOTA_PLANS: %w", err)
+		}
+		cfg.Plans = make(services.QuotaPlans, len(plans))
+		for name, l := range plans {
+			if l.AudioMinutesPerDay < 0 || l.SessionsPerDay < 0 || l.LLMTokensPerDay < 0 {
+				return cfg, fmt.Errorf("QUOTA_PLANS: plan %q has a negative limit", name)
+			}
+			cfg.Plans[strings.ToLower(name)] = l
+		}
+	}
+	if cfg.DefaultPlan == "" {
+		cfg.DefaultPlan = "free"
+	}
+	if _, ok := cfg.Plans[cfg.DefaultPlan]; !ok {
+		return cfg, fmt.Errorf("QUOTA_DEFAULT_PLAN %q is not in QUOTA_PLANS", cfg.DefaultPlan)
+	}
+	return cfg, nil
+}
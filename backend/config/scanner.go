@@ -0,0 +1,48 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/yoockh/yoospeak/internal/scanner"
+)
+
+// Scanner checks CV uploads before they are stored. The PDF active-content
+// check always runs; SCANNER adds a malware scanner on top:
+//
+//	none   - no malware scanning (default)
+//	clamav - clamd at CLAMAV_ADDR ("host:port" or "unix:/path/to/clamd.ctl", default localhost:3310)
+var Scanner scanner.Scanner = scanner.PDFActiveContent{}
+
+func InitScanner() error {
+	switch mode := strings.ToLower(os.Getenv("SCANNER")); mode {
+	case "", "none":
+		Scanner = scanner.PDFActiveContent{}
+
+	case "clamav":
+		addr := os.Getenv("CLAMAV_ADDR")
+		if addr == "" {
+			addr = "localhost:3310"
+		}
+		network := "tcp"
+		if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+			network, addr = "unix", path
+		}
+		clam := scanner.NewClamAV(network, addr)
+		// configured either way: uploads fail closed while clamd is unreachable
+		Scanner = scanner.Chain{scanner.PDFActiveContent{}, clam}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := clam.Ping(ctx); err != nil {
+			return fmt.Errorf("clamav at %s: %w", addr, err)
+		}
+
+	default:
+		return fmt.Errorf("unknown SCANNER %q (use none or clamav)", mode)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/yoockh/yoospeak/internal/storage"
+)
+
+// Storage is the object store for CV uploads (nil when none is configured).
+var Storage storage.Backend
+
+// InitStorage selects the backend from STORAGE_BACKEND:
+//
+//	gcs   - GCS_BUCKET, GCS_SIGNING_KEY_FILE or GCS_SIGNING_EMAIL (default when GCS_BUCKET is set)
+//	s3    - S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY, S3_SECRET_KEY, S3_REGION, S3_USE_SSL, S3_CREATE_BUCKET
+//	local - STORAGE_LOCAL_DIR, STORAGE_PUBLIC_URL, STORAGE_SIGNING_SECRET (development only)
+//
+// With neither STORAGE_BACKEND nor GCS_BUCKET set it fails rather than
+// falling back to local disk.
+func InitStorage() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	backend := strings.ToLower(os.Getenv("STORAGE_BACKEND"))
+	if backend == "" {
+		if os.Getenv("GCS_BUCKET") == "" {
+			return fmt.Errorf("STORAGE_BACKEND is not set (use gcs, s3 or local)")
+		}
+		backend = "gcs"
+	}
+
+	switch backend {
+	case "gcs":
+		bucket := os.Getenv("GCS_BUCKET")
+		if bucket == "" {
+			return fmt.Errorf("STORAGE_BACKEND=gcs requires GCS_BUCKET")
+		}
+		s, err := storage.NewGCSUploader(context.Background(), bucket, storage.GCSSigning{
+			KeyFile:             os.Getenv("GCS_SIGNING_KEY_FILE"),
+			ServiceAccountEmail: os.Getenv("GCS_SIGNING_EMAIL"),
+		})
+		if err != nil {
+			return err
+		}
+		Storage = s
+
+	case "s3":
+		s, err := storage.NewS3Store(ctx, storage.S3Config{
+			Endpoint:     os.Getenv("S3_ENDPOINT"),
+			Region:       os.Getenv("S3_REGION"),
+			Bucket:       os.Getenv("S3_BUCKET"),
+			AccessKey:    os.Getenv("S3_ACCESS_KEY"),
+			SecretKey:    os.Getenv("S3_SECRET_KEY"),
+			UseSSL:       storage.UseSSL(os.Getenv("S3_USE_SSL")),
+			CreateBucket: os.Getenv("S3_CREATE_BUCKET") == "true",
+		})
+		if err != nil {
+			return err
+		}
+		Storage = s
+
+	case "local":
+		dir := os.Getenv("STORAGE_LOCAL_DIR")
+		if dir == "" {
+			dir = "./data/storage"
+		}
+		publicURL := os.Getenv("STORAGE_PUBLIC_URL")
+		if publicURL == "" {
+			port := os.Getenv("PORT")
+			if port == "" {
+				port = "8080"
+			}
+			publicURL = "http://localhost:" + port + "/files"
+		}
+		// a fixed secret keeps issued links valid across restarts and replicas
+		secret := []byte(os.Getenv("STORAGE_SIGNING_SECRET"))
+		if len(secret) == 0 {
+			return fmt.Errorf("STORAGE_BACKEND=local requires STORAGE_SIGNING_SECRET")
+		}
+		s, err := storage.NewLocalStore(dir, publicURL, secret)
+		if err != nil {
+			return err
+		}
+		Storage = s
+
+	default:
+		return fmt.Errorf("unknown STORAGE_BACKEND %q (use gcs, s3 or local)", backend)
+	}
+	return nil
+}
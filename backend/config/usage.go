@@ -0,0 +1,31 @@
+package config
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/yoockh/yoospeak/internal/services"
+)
+
+// UsagePricing reads the prices usage is charged at, in USD:
+//
+//	PRICE_STT_PER_MINUTE_USD    - per minute of billed audio
+//	PRICE_LLM_INPUT_PER_1M_USD  - per million prompt tokens
+//	PRICE_LLM_OUTPUT_PER_1M_USD - per million completion tokens
+//
+// Unset or invalid prices are 0: usage is still recorded, at no cost.
+func UsagePricing() services.Pricing {
+	return services.Pricing{
+		STTPerMinute:        envPrice("PRICE_STT_PER_MINUTE_USD"),
+		LLMInputPerMillion:  envPrice("PRICE_LLM_INPUT_PER_1M_USD"),
+		LLMOutputPerMillion: envPrice("PRICE_LLM_OUTPUT_PER_1M_USD"),
+	}
+}
+
+func envPrice(key string) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil || v < 0 {
+		return 0
+	}
+	return v
+}
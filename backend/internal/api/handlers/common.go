@@ -41,3 +41,10 @@ func requireUserID(c *gin.Context) (string, bool) {
 	writeError(c, utils.E(utils.CodeUnauthorized, "Auth", "unauthorized", nil))
 	return "", false
 }
+
+// planOf is the billing plan from the token ("" when it names none).
+func planOf(c *gin.Context) string {
+	s, _ := c.Get("plan")
+	plan, _ := s.(string)
+	return plan
+}
@@ -3,9 +3,14 @@ package handlers
 import (
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	pgrepo "github.com/yoockh/yoospeak/internal/repositories/postgres"
 	"github.com/yoockh/yoospeak/internal/services"
+	"github.com/yoockh/yoospeak/internal/utils"
 )
 
 type ConversationHandler struct {
@@ -47,3 +52,77 @@ func (h *ConversationHandler) ListBySession(c *gin.Context) {
 		"conversations": rows,
 	})
 }
+
+// Search: GET /conversation/search?q=...&session_id=&role=user|assistant&from=&to=&limit=
+// from/to accept RFC3339 or YYYY-MM-DD (a date-only 'to' includes that whole day).
+func (h *ConversationHandler) Search(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		writeError(c, utils.E(utils.CodeInvalidArgument, "ConversationHandler.Search", "missing query parameter 'q'", nil))
+		return
+	}
+
+	f := pgrepo.ConversationSearchFilter{
+		SessionID: c.Query("session_id"),
+		Role:      c.Query("role"),
+		Limit:     10,
+	}
+	if f.SessionID != "" {
+		if _, err := uuid.Parse(f.SessionID); err != nil {
+			writeError(c, utils.E(utils.CodeInvalidArgument, "ConversationHandler.Search", "session_id must be a uuid", err))
+			return
+		}
+	}
+	if f.Role != "" && f.Role != "user" && f.Role != "assistant" {
+		writeError(c, utils.E(utils.CodeInvalidArgument, "ConversationHandler.Search", "role must be 'user' or 'assistant'", nil))
+		return
+	}
+	if s := c.Query("limit"); s != "" {
+		if n, err := strconv.Atoi(s); err == nil && n > 0 && n <= 50 {
+			f.Limit = n
+		}
+	}
+
+	var err error
+	if f.From, err = parseTimeParam(c.Query("from"), false); err != nil {
+		writeError(c, utils.E(utils.CodeInvalidArgument, "ConversationHandler.Search", "invalid 'from' (use RFC3339 or YYYY-MM-DD)", err))
+		return
+	}
+	if f.To, err = parseTimeParam(c.Query("to"), true); err != nil {
+		writeError(c, utils.E(utils.CodeInvalidArgument, "ConversationHandler.Search", "invalid 'to' (use RFC3339 or YYYY-MM-DD)", err))
+		return
+	}
+
+	rows, err := h.svc.Search(c.Request.Context(), userID, q, f)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query":   q,
+		"results": rows,
+	})
+}
+
+func parseTimeParam(s string, endOfDay bool) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
@@ -1,24 +1,25 @@
 package handlers
 
 import (
-	"bytes"
 	"io"
 	"net/http"
-	"path/filepath"
-	"strings"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/yoockh/yoospeak/internal/cvtext"
 	"github.com/yoockh/yoospeak/internal/services"
 	"github.com/yoockh/yoospeak/internal/utils"
 )
 
 type CVHandler struct {
-	svc services.CVFileService
+	svc      services.CVFileService
+	extracts services.CVExtractionJobs // optional
 }
 
-func NewCVHandler(svc services.CVFileService) *CVHandler {
-	return &CVHandler{svc: svc}
+func NewCVHandler(svc services.CVFileService, extracts services.CVExtractionJobs) *CVHandler {
+	return &CVHandler{svc: svc, extracts: extracts}
 }
 
 func (h *CVHandler) Upload(c *gin.Context) {
@@ -34,11 +35,6 @@ func (h *CVHandler) Upload(c *gin.Context) {
 	}
 
 	// basic validation
-	ext := strings.ToLower(filepath.Ext(fh.Filename))
-	if ext != ".pdf" {
-		writeError(c, utils.E(utils.CodeInvalidArgument, "CVHandler.Upload", "only .pdf is allowed", nil))
-		return
-	}
 	if fh.Size <= 0 || fh.Size > 10<<20 {
 		writeError(c, utils.E(utils.CodeInvalidArgument, "CVHandler.Upload", "file too large (max 10MB)", nil))
 		return
@@ -51,23 +47,74 @@ func (h *CVHandler) Upload(c *gin.Context) {
 	}
 	defer file.Close()
 
-	// sniff content type (read 512 bytes)
-	head := make([]byte, 512)
-	n, _ := file.Read(head)
-	head = head[:n]
-	ct := http.DetectContentType(head)
-	if ct != "application/pdf" {
-		writeError(c, utils.E(utils.CodeInvalidArgument, "CVHandler.Upload", "invalid content type (must be pdf)", nil))
+	// identify the format from content (magic bytes / zip structure), not the extension
+	format, err := cvtext.Detect(file, fh.Size, fh.Filename)
+	if err != nil {
+		writeError(c, utils.E(utils.CodeInvalidArgument, "CVHandler.Upload", "unsupported file type (pdf, docx, txt or md)", err))
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		writeError(c, utils.E(utils.CodeInternal, "CVHandler.Upload", "failed to read upload", err))
+		return
+	}
+
+	objectName := "cv/" + userID + "/" + uuid.NewString() + format.Ext()
+
+	row, err := h.svc.Upload(c.Request.Context(), userID, fh.Filename, int(fh.Size), format.MimeType(), objectName, file)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	// extract text into the profile asynchronously (best-effort)
+	if h.extracts != nil {
+		_ = h.extracts.EnqueueCVExtraction(c.Request.Context(), row.ID)
+	}
+
+	c.JSON(http.StatusOK, row)
+}
+
+// List: GET /cv?limit=20&offset=0
+func (h *CVHandler) List(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
 		return
 	}
 
-	// re-compose stream: head + remaining file
-	reader := bytes.NewReader(head)
-	r := &readJoin{a: reader, b: file}
+	limit, offset := 20, 0
+	if s := c.Query("limit"); s != "" {
+		if n, err := strconv.Atoi(s); err == nil && n > 0 && n <= 100 {
+			limit = n
+		}
+	}
+	if s := c.Query("offset"); s != "" {
+		if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+			offset = n
+		}
+	}
 
-	objectName := "cv/" + userID + "/" + uuid.NewString() + ".pdf"
+	rows, total, err := h.svc.List(c.Request.Context(), userID, limit, offset)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":  rows,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// Get: GET /cv/:id
+func (h *CVHandler) Get(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
 
-	row, err := h.svc.Upload(c.Request.Context(), userID, fh.Filename, int(fh.Size), "application/pdf", objectName, r)
+	row, err := h.svc.Get(c.Request.Context(), userID, c.Param("id"))
 	if err != nil {
 		writeError(c, err)
 		return
@@ -76,14 +123,59 @@ func (h *CVHandler) Upload(c *gin.Context) {
 	c.JSON(http.StatusOK, row)
 }
 
-type readJoin struct {
-	a *bytes.Reader
-	b io.Reader
+// Activate: POST /cv/:id/activate
+func (h *CVHandler) Activate(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	row, err := h.svc.Activate(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, row)
 }
 
-func (r *readJoin) Read(p []byte) (int, error) {
-	if r.a != nil && r.a.Len() > 0 {
-		return r.a.Read(p)
+// Delete: DELETE /cv/:id
+func (h *CVHandler) Delete(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.svc.Delete(c.Request.Context(), userID, c.Param("id")); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Download: GET /cv/:id/download
+// Redirects to a short-lived signed URL; ?redirect=false returns it as JSON instead.
+func (h *CVHandler) Download(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	const ttl = 5 * time.Minute
+	u, err := h.svc.DownloadURL(c.Request.Context(), userID, c.Param("id"), ttl)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	if c.Query("redirect") == "false" {
+		c.JSON(http.StatusOK, gin.H{
+			"url":        u,
+			"expires_at": time.Now().Add(ttl).UTC(),
+		})
+		return
 	}
-	return r.b.Read(p)
+	c.Redirect(http.StatusFound, u)
 }
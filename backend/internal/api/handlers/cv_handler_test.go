@@ -0,0 +1,146 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/yoockh/yoospeak/internal/api/handlers"
+	"github.com/yoockh/yoospeak/internal/models"
+	pgrepo "github.com/yoockh/yoospeak/internal/repositories/postgres"
+	"github.com/yoockh/yoospeak/internal/services"
+	"github.com/yoockh/yoospeak/internal/storage"
+	"github.com/yoockh/yoospeak/internal/utils"
+)
+
+// memCVFiles is an in-memory CVFileRepository; only what Download reads is implemented.
+type memCVFiles struct {
+	pgrepo.CVFileRepository
+
+	mu   sync.Mutex
+	rows map[string]models.CVFile
+}
+
+func (m *memCVFiles) GetByID(ctx context.Context, id string) (*models.CVFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	row, ok := m.rows[id]
+	if !ok {
+		return nil, utils.ErrNotFound
+	}
+	return &row, nil
+}
+
+// memStore is a storage.Backend holding object names only; signed URLs point at a fake host.
+type memStore struct {
+	mu      sync.Mutex
+	objects map[string]bool
+}
+
+func (s *memStore) Upload(ctx context.Context, name, contentType string, r io.Reader) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[name] = true
+	return name, nil
+}
+
+func (s *memStore) SignedGetURL(ctx context.Context, name string, ttl time.Duration) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.objects[name] {
+		return "", storage.ErrObjectNotFound
+	}
+	return "https://store.test/" + name + "?sig=ok", nil
+}
+
+func (s *memStore) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return nil, storage.ErrObjectNotFound
+}
+
+func (s *memStore) Delete(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, name)
+	return nil
+}
+
+func (s *memStore) Close() error { return nil }
+
+func TestCVDownload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	owner, other := uuid.NewString(), uuid.NewString()
+	cv := func(path, scan string) models.CVFile {
+		return models.CVFile{ID: uuid.NewString(), UserID: owner, FileName: "cv.pdf", FilePath: path, ScanStatus: scan}
+	}
+	stored, gone, quarantined := cv("cv/a.pdf", services.ScanClean), cv("cv/gone.pdf", services.ScanClean), cv("quarantine/b.pdf", services.ScanQuarantined)
+	repo := &memCVFiles{rows: map[string]models.CVFile{stored.ID: stored, gone.ID: gone, quarantined.ID: quarantined}}
+	store := &memStore{objects: map[string]bool{stored.FilePath: true, quarantined.FilePath: true}}
+	h := handlers.NewCVHandler(services.NewCVFileService(repo, store, nil, nil, nil, nil), nil)
+
+	get := func(userID, path string) *httptest.ResponseRecorder {
+		r := gin.New()
+		r.GET("/cv/:id/download", func(c *gin.Context) { c.Set("user_id", userID) }, h.Download)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	t.Run("owner is redirected to a signed url", func(t *testing.T) {
+		w := get(owner, "/cv/"+stored.ID+"/download")
+		if w.Code != http.StatusFound || w.Header().Get("Location") != "https://store.test/cv/a.pdf?sig=ok" {
+			t.Fatalf("download = %d, Location %q", w.Code, w.Header().Get("Location"))
+		}
+		if w.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("Cache-Control = %q, want no-store", w.Header().Get("Cache-Control"))
+		}
+	})
+
+	t.Run("owner gets the url as json", func(t *testing.T) {
+		w := get(owner, "/cv/"+stored.ID+"/download?redirect=false")
+		var body struct {
+			URL       string    `json:"url"`
+			ExpiresAt time.Time `json:"expires_at"`
+		}
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &body) != nil {
+			t.Fatalf("download = %d %s", w.Code, w.Body)
+		}
+		if body.URL != "https://store.test/cv/a.pdf?sig=ok" || !body.ExpiresAt.After(time.Now()) {
+			t.Errorf("body = %+v", body)
+		}
+	})
+
+	for _, tc := range []struct {
+		name   string
+		userID string
+		id     string
+		status int
+		code   utils.Code
+	}{
+		{"another user's cv", other, stored.ID, http.StatusNotFound, utils.CodeNotFound},
+		{"unknown cv", owner, uuid.NewString(), http.StatusNotFound, utils.CodeNotFound},
+		{"stored object missing", owner, gone.ID, http.StatusNotFound, utils.CodeNotFound},
+		{"quarantined cv", owner, quarantined.ID, http.StatusForbidden, utils.CodeForbidden},
+		{"malformed id", owner, "not-a-uuid", http.StatusBadRequest, utils.CodeInvalidArgument},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := get(tc.userID, "/cv/"+tc.id+"/download")
+			var apiErr handlers.APIError
+			_ = json.Unmarshal(w.Body.Bytes(), &apiErr)
+			if w.Code != tc.status || apiErr.Code != tc.code {
+				t.Errorf("download = %d %s, want %d %s", w.Code, w.Body, tc.status, tc.code)
+			}
+			if loc := w.Header().Get("Location"); loc != "" {
+				t.Errorf("redirected to %q", loc)
+			}
+		})
+	}
+}
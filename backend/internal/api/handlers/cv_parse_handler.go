@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoockh/yoospeak/internal/services"
+	"github.com/yoockh/yoospeak/internal/utils"
+)
+
+type CVParseHandler struct {
+	svc services.CVParseService
+}
+
+func NewCVParseHandler(svc services.CVParseService) *CVParseHandler {
+	return &CVParseHandler{svc: svc}
+}
+
+// Propose: POST /profile/cv/parse
+// Parses the profile's CV text and returns a proposal with the changes it would make.
+func (h *CVParseHandler) Propose(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	prop, err := h.svc.Propose(c.Request.Context(), userID)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, prop)
+}
+
+type ApplyCVProposalRequest struct {
+	// Fields to accept: skills, experience, education. Empty = every changed field.
+	Fields []string `json:"fields,omitempty"`
+}
+
+// Apply: POST /profile/cv/parse/:proposal_id/apply
+func (h *CVParseHandler) Apply(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req ApplyCVProposalRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			writeError(c, utils.E(utils.CodeInvalidArgument, "CVParseHandler.Apply", "invalid request body", err))
+			return
+		}
+	}
+
+	p, err := h.svc.Apply(c.Request.Context(), userID, c.Param("proposal_id"), req.Fields)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, p)
+}
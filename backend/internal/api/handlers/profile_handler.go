@@ -13,11 +13,12 @@ import (
 )
 
 type ProfileHandler struct {
-	svc services.ProfileService
+	svc    services.ProfileService
+	embeds services.EmbeddingJobs // optional
 }
 
-func NewProfileHandler(svc services.ProfileService) *ProfileHandler {
-	return &ProfileHandler{svc: svc}
+func NewProfileHandler(svc services.ProfileService, embeds services.EmbeddingJobs) *ProfileHandler {
+	return &ProfileHandler{svc: svc, embeds: embeds}
 }
 
 func (h *ProfileHandler) Me(c *gin.Context) {
@@ -82,6 +83,7 @@ func (h *ProfileHandler) Update(c *gin.Context) {
 	}
 	if req.CVText != nil {
 		existing.CVText = *req.CVText
+		existing.CVFileID = nil // typed in, no longer tied to an uploaded file
 	}
 	if req.Skills != nil {
 		existing.Skills = *req.Skills
@@ -103,5 +105,10 @@ func (h *ProfileHandler) Update(c *gin.Context) {
 		return
 	}
 
+	// re-embed CV asynchronously (best-effort)
+	if req.CVText != nil && h.embeds != nil {
+		_ = h.embeds.EnqueueProfileCV(c.Request.Context(), userID)
+	}
+
 	c.JSON(http.StatusOK, existing)
 }
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yoockh/yoospeak/internal/models"
+	"github.com/yoockh/yoospeak/internal/services"
+	"github.com/yoockh/yoospeak/internal/utils"
+)
+
+type QuotaHandler struct {
+	svc services.QuotaService
+}
+
+func NewQuotaHandler(svc services.QuotaService) *QuotaHandler {
+	return &QuotaHandler{svc: svc}
+}
+
+// writeQuotaError is writeError plus, for QUOTA_EXCEEDED, a Retry-After
+// header pointing at the daily reset.
+func writeQuotaError(c *gin.Context, err error) {
+	if utils.IsCode(err, utils.CodeQuotaExceeded) {
+		secs := int(time.Until(services.QuotaResetsAt(time.Now())).Seconds()) + 1
+		c.Header("Retry-After", strconv.Itoa(secs))
+	}
+	writeError(c, err)
+}
+
+// Me: GET /quota/me — the caller's plan, limits and today's usage.
+func (h *QuotaHandler) Me(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	st, err := h.svc.Status(c.Request.Context(), userID, planOf(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, st)
+}
+
+// Get: GET /admin/quota/:user_id — the user's status as the default plan (or
+// their override) sees it; the plan in the user's own token is not known here.
+func (h *QuotaHandler) Get(c *gin.Context) {
+	userID, ok := quotaUserParam(c, "QuotaHandler.Get")
+	if !ok {
+		return
+	}
+
+	st, err := h.svc.Status(c.Request.Context(), userID, "")
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, st)
+}
+
+// SetQuotaOverrideRequest replaces the user's override; omitted limits keep the plan's.
+type SetQuotaOverrideRequest struct {
+	Plan               string `json:"plan"`
+	AudioMinutesPerDay *int64 `json:"audio_minutes_per_day"`
+	SessionsPerDay     *int64 `json:"sessions_per_day"`
+	LLMTokensPerDay    *int64 `json:"llm_tokens_per_day"`
+	Note               string `json:"note"`
+}
+
+// SetOverride: PUT /admin/quota/:user_id
+func (h *QuotaHandler) SetOverride(c *gin.Context) {
+	const op = "QuotaHandler.SetOverride"
+
+	adminID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+	userID, ok := quotaUserParam(c, op)
+	if !ok {
+		return
+	}
+
+	var req SetQuotaOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, utils.E(utils.CodeInvalidArgument, op, "invalid request body", err))
+		return
+	}
+
+	o := &models.QuotaOverride{
+		UserID:             userID,
+		Plan:               req.Plan,
+		AudioMinutesPerDay: req.AudioMinutesPerDay,
+		SessionsPerDay:     req.SessionsPerDay,
+		LLMTokensPerDay:    req.LLMTokensPerDay,
+		Note:               req.Note,
+		UpdatedBy:          adminID,
+	}
+	if err := h.svc.SetOverride(c.Request.Context(), o); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, o)
+}
+
+// DeleteOverride: DELETE /admin/quota/:user_id — back to the plan's limits.
+func (h *QuotaHandler) DeleteOverride(c *gin.Context) {
+	userID, ok := quotaUserParam(c, "QuotaHandler.DeleteOverride")
+	if !ok {
+		return
+	}
+
+	if err := h.svc.DeleteOverride(c.Request.Context(), userID); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func quotaUserParam(c *gin.Context, op string) (string, bool) {
+	userID := c.Param("user_id")
+	if _, err := uuid.Parse(userID); err != nil {
+		writeError(c, utils.E(utils.CodeInvalidArgument, op, "user_id must be a uuid", err))
+		return "", false
+	}
+	return userID, true
+}
@@ -0,0 +1,125 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/yoockh/yoospeak/internal/api/handlers"
+	"github.com/yoockh/yoospeak/internal/cache"
+	"github.com/yoockh/yoospeak/internal/models"
+	"github.com/yoockh/yoospeak/internal/services"
+	"github.com/yoockh/yoospeak/internal/utils"
+)
+
+// memOverrides is an in-memory QuotaOverrideRepo.
+type memOverrides struct {
+	mu   sync.Mutex
+	rows map[string]models.QuotaOverride
+}
+
+func (m *memOverrides) Get(ctx context.Context, userID string) (*models.QuotaOverride, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, ok := m.rows[userID]
+	if !ok {
+		return nil, utils.ErrNotFound
+	}
+	return &o, nil
+}
+
+func (m *memOverrides) Upsert(ctx context.Context, o *models.QuotaOverride) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rows[o.UserID] = *o
+	return nil
+}
+
+func (m *memOverrides) Delete(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.rows[userID]; !ok {
+		return utils.ErrNotFound
+	}
+	delete(m.rows, userID)
+	return nil
+}
+
+const quotaUser = "0b6f1c9e-4a8e-4f8a-9d36-2f1c7c1f0a11"
+
+func TestSessionStartQuotaAndAdminOverride(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	quota := services.NewQuotaServiceWithCache(rdb, services.QuotaConfig{
+		Plans: services.QuotaPlans{
+			"free": {SessionsPerDay: 1},
+			"pro":  {SessionsPerDay: 3},
+		},
+		DefaultPlan: "free",
+	}, &memOverrides{rows: map[string]models.QuotaOverride{}}, cache.NewRedisCache(rdb), 0)
+	sessionH := handlers.NewSessionHandlerWithQuota(&memSessions{sessions: map[string]*models.Session{}}, quota)
+	quotaH := handlers.NewQuotaHandler(quota)
+
+	as := func(plan string) gin.HandlerFunc {
+		return func(c *gin.Context) { c.Set("user_id", quotaUser); c.Set("plan", plan) }
+	}
+	r := gin.New()
+	r.POST("/session/start", as(""), sessionH.Start)
+	r.GET("/quota/me", as(""), quotaH.Me)
+	r.PUT("/admin/quota/:user_id", as(""), quotaH.SetOverride)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	start := func() *httptest.ResponseRecorder {
+		return do(http.MethodPost, "/session/start", `{"type":"interview","language":"en"}`)
+	}
+
+	if w := start(); w.Code != http.StatusOK {
+		t.Fatalf("first start = %d %s", w.Code, w.Body)
+	}
+	w := start()
+	var apiErr handlers.APIError
+	_ = json.Unmarshal(w.Body.Bytes(), &apiErr)
+	if w.Code != http.StatusTooManyRequests || apiErr.Code != utils.CodeQuotaExceeded {
+		t.Fatalf("second start = %d %s, want 429 QUOTA_EXCEEDED", w.Code, w.Body)
+	}
+	if secs, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || secs <= 0 || secs > 86400 {
+		t.Errorf("Retry-After = %q", w.Header().Get("Retry-After"))
+	}
+
+	// an admin moves the user to pro: the cached "no override" is dropped at once
+	if w := do(http.MethodPut, "/admin/quota/"+quotaUser, `{"plan":"pro","note":"trial"}`); w.Code != http.StatusOK {
+		t.Fatalf("set override = %d %s", w.Code, w.Body)
+	}
+	if w := start(); w.Code != http.StatusOK {
+		t.Fatalf("start after override = %d %s", w.Code, w.Body)
+	}
+
+	var st services.QuotaStatus
+	if w := do(http.MethodGet, "/quota/me", ""); w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &st) != nil {
+		t.Fatalf("quota/me = %d %s", w.Code, w.Body)
+	}
+	if st.Plan != "pro" || st.Limits.SessionsPerDay != 3 || st.Used.Sessions != 2 || st.Override == nil || st.Override.UpdatedBy != quotaUser {
+		t.Errorf("status = %+v", st)
+	}
+
+	// an unknown plan is rejected rather than silently falling back
+	if w := do(http.MethodPut, "/admin/quota/"+quotaUser, `{"plan":"gold"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown plan = %d %s", w.Code, w.Body)
+	}
+}
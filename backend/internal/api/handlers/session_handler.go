@@ -10,13 +10,19 @@ import (
 )
 
 type SessionHandler struct {
-	svc services.SessionService
+	svc   services.SessionService
+	quota services.QuotaService
 }
 
 func NewSessionHandler(svc services.SessionService) *SessionHandler {
 	return &SessionHandler{svc: svc}
 }
 
+// NewSessionHandlerWithQuota counts every started session against the user's daily quota.
+func NewSessionHandlerWithQuota(svc services.SessionService, quota services.QuotaService) *SessionHandler {
+	return &SessionHandler{svc: svc, quota: quota}
+}
+
 type StartSessionRequest struct {
 	Type     string                 `json:"type" binding:"required"`     // interview|casual
 	Language string                 `json:"language" binding:"required"` // id|en
@@ -41,6 +47,13 @@ func (h *SessionHandler) Start(c *gin.Context) {
 		return
 	}
 
+	if h.quota != nil {
+		if err := h.quota.StartSession(c.Request.Context(), userID, planOf(c)); err != nil {
+			writeQuotaError(c, err)
+			return
+		}
+	}
+
 	sess, err := h.svc.Start(c.Request.Context(), userID, req.Type, req.Language, req.Metadata)
 	if err != nil {
 		writeError(c, err)
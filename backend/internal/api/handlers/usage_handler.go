@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yoockh/yoospeak/internal/models"
+	pgrepo "github.com/yoockh/yoospeak/internal/repositories/postgres"
+	"github.com/yoockh/yoospeak/internal/services"
+	"github.com/yoockh/yoospeak/internal/utils"
+)
+
+type UsageHandler struct {
+	svc services.UsageService
+}
+
+func NewUsageHandler(svc services.UsageService) *UsageHandler {
+	return &UsageHandler{svc: svc}
+}
+
+// Me: GET /usage/me?from=&to= — the caller's usage and cost, in total and per session.
+// from/to accept RFC3339 or YYYY-MM-DD (a date-only 'to' includes that whole day).
+func (h *UsageHandler) Me(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	from, err := parseTimeParam(c.Query("from"), false)
+	if err != nil {
+		writeError(c, utils.E(utils.CodeInvalidArgument, "UsageHandler.Me", "invalid 'from' (use RFC3339 or YYYY-MM-DD)", err))
+		return
+	}
+	to, err := parseTimeParam(c.Query("to"), true)
+	if err != nil {
+		writeError(c, utils.E(utils.CodeInvalidArgument, "UsageHandler.Me", "invalid 'to' (use RFC3339 or YYYY-MM-DD)", err))
+		return
+	}
+
+	out, err := h.svc.Me(c.Request.Context(), userID, from, to)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// Aggregate: GET /admin/usage?group_by=user|session|day|kind&user_id=&from=&to=&limit=
+func (h *UsageHandler) Aggregate(c *gin.Context) {
+	const op = "UsageHandler.Aggregate"
+
+	groupBy := c.DefaultQuery("group_by", pgrepo.UsageGroupByUser)
+	f := pgrepo.UsageFilter{UserID: c.Query("user_id"), Limit: 100}
+	if s := c.Query("limit"); s != "" {
+		if n, err := strconv.Atoi(s); err == nil && n > 0 && n <= 1000 {
+			f.Limit = n
+		}
+	}
+	if f.UserID != "" {
+		if _, err := uuid.Parse(f.UserID); err != nil {
+			writeError(c, utils.E(utils.CodeInvalidArgument, op, "user_id must be a uuid", err))
+			return
+		}
+	}
+
+	var err error
+	if f.From, err = parseTimeParam(c.Query("from"), false); err != nil {
+		writeError(c, utils.E(utils.CodeInvalidArgument, op, "invalid 'from' (use RFC3339 or YYYY-MM-DD)", err))
+		return
+	}
+	if f.To, err = parseTimeParam(c.Query("to"), true); err != nil {
+		writeError(c, utils.E(utils.CodeInvalidArgument, op, "invalid 'to' (use RFC3339 or YYYY-MM-DD)", err))
+		return
+	}
+
+	rows, err := h.svc.Aggregate(c.Request.Context(), f, groupBy)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	if rows == nil {
+		rows = []models.UsageGroup{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"group_by": groupBy,
+		"from":     f.From,
+		"to":       f.To,
+		"rows":     rows,
+	})
+}
@@ -2,15 +2,19 @@ package handlers
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/redis/go-redis/v9"
+	"github.com/yoockh/yoospeak/internal/audio"
 	"github.com/yoockh/yoospeak/internal/services"
 	"github.com/yoockh/yoospeak/internal/utils"
 )
@@ -19,6 +23,7 @@ type WSHandler struct {
 	sessions services.SessionService
 	buffers  services.BufferService
 	redis    *redis.Client
+	quota    services.QuotaService
 	upgrader websocket.Upgrader
 }
 
@@ -33,6 +38,13 @@ func NewWSHandler(sessions services.SessionService, buffers services.BufferServi
 	}
 }
 
+// NewWSHandlerWithQuota rejects audio chunks once the user's daily quota is used up.
+func NewWSHandlerWithQuota(sessions services.SessionService, buffers services.BufferService, rdb *redis.Client, quota services.QuotaService) *WSHandler {
+	h := NewWSHandler(sessions, buffers, rdb)
+	h.quota = quota
+	return h
+}
+
 type wsClientMsg struct {
 	Type        string `json:"type"`
 	SessionID   string `json:"session_id"`
@@ -41,9 +53,32 @@ type wsClientMsg struct {
 	AudioURL    string `json:"audio_url"`
 	IsFinal     bool   `json:"is_final"`
 
+	// start: declares the audio format of the chunks that follow (default linear16, 16 kHz, mono)
+	AudioFormat *audio.Format `json:"audio_format"`
+
 	// pause/resume/end_session -> no fields
 }
 
+// audioURLEstimate is reserved of the audio quota for a chunk sent by URL,
+// whose length is only known once the worker fetches it.
+const audioURLEstimate = 30 * time.Second
+
+// chunkEstimate is what a chunk reserves of the audio quota until the worker
+// settles it with the length it actually transcribed.
+func chunkEstimate(format audio.Format, audioBase64 string) time.Duration {
+	if audioBase64 == "" {
+		return audioURLEstimate
+	}
+	if i := strings.Index(audioBase64, ","); i >= 0 {
+		audioBase64 = audioBase64[i+1:] // strip data:...;base64,
+	}
+	b, err := base64.StdEncoding.DecodeString(audioBase64)
+	if err != nil {
+		return audioURLEstimate // the worker refuses it and releases the reservation
+	}
+	return audio.EstimateDuration(format, b)
+}
+
 type wsConn struct {
 	c  *websocket.Conn
 	mu sync.Mutex
@@ -80,6 +115,7 @@ func (h *WSHandler) SessionWS(c *gin.Context) {
 	}
 
 	sessionLang := sess.Language
+	plan := planOf(c)
 
 	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -109,6 +145,8 @@ func (h *WSHandler) SessionWS(c *gin.Context) {
 			return nil
 		})
 
+		format := audio.Default
+
 		for {
 			_, data, rerr := conn.ReadMessage()
 			if rerr != nil {
@@ -122,6 +160,20 @@ func (h *WSHandler) SessionWS(c *gin.Context) {
 			}
 
 			switch msg.Type {
+			case "start":
+				if msg.AudioFormat == nil {
+					_ = wc.writeText([]byte(`{"type":"error","code":"INVALID_ARGUMENT","message":"audio_format required"}`))
+					continue
+				}
+				if err := msg.AudioFormat.Validate(); err != nil {
+					b, _ := json.Marshal(map[string]any{"type": "error", "code": "INVALID_ARGUMENT", "message": err.Error()})
+					_ = wc.writeText(b)
+					continue
+				}
+				format = *msg.AudioFormat
+				b, _ := json.Marshal(map[string]any{"type": "status", "status": "ready", "message": "audio format accepted", "audio_format": format})
+				_ = wc.writeText(b)
+
 			case "audio_chunk":
 				// validate minimal
 				if msg.ChunkIndex <= 0 {
@@ -143,9 +195,32 @@ func (h *WSHandler) SessionWS(c *gin.Context) {
 					continue
 				}
 
+				// quota: the chunk is dropped, the session stays open (limits reset daily).
+				// An admitted chunk holds a reservation until the worker settles it.
+				admitted := false
+				if h.quota != nil {
+					if err := h.quota.AdmitAudio(ctx, userID, plan, sessionID, msg.ChunkIndex, chunkEstimate(format, msg.AudioBase64)); err != nil {
+						code, message := utils.CodeInternal, "quota check failed"
+						var ae *utils.AppError
+						if errors.As(err, &ae) {
+							code, message = ae.Code, ae.Message
+						}
+						b, _ := json.Marshal(map[string]any{"type": "error", "code": code, "message": message, "chunk_index": msg.ChunkIndex})
+						_ = wc.writeText(b)
+						continue
+					}
+					admitted = true
+				}
+				release := func() {
+					if admitted {
+						_ = h.quota.SettleAudio(ctx, userID, sessionID, msg.ChunkIndex, 0)
+					}
+				}
+
 				// insert Mongo realtime_buffer (pending)
 				_, err := h.buffers.InsertAudioChunk(ctx, sessionID, msg.ChunkIndex, audioURLPtr, audioBase64Ptr)
 				if err != nil {
+					release()
 					_ = wc.writeText([]byte(`{"type":"error","code":"INTERNAL","message":"failed to insert buffer"}`))
 					continue
 				}
@@ -153,6 +228,7 @@ func (h *WSHandler) SessionWS(c *gin.Context) {
 				// push to Redis Stream: audio:stream
 				fields := map[string]any{
 					"session_id":  sessionID,
+					"user_id":     userID, // usage accounting
 					"chunk_index": strconv.FormatInt(msg.ChunkIndex, 10),
 					"is_final":    strconv.FormatBool(msg.IsFinal),
 					"ts_unix":     strconv.FormatInt(time.Now().UTC().Unix(), 10),
@@ -164,11 +240,15 @@ func (h *WSHandler) SessionWS(c *gin.Context) {
 				if audioURLPtr != nil {
 					fields["audio_url"] = *audioURLPtr
 				}
+				for k, v := range format.Fields() {
+					fields[k] = v
+				}
 
 				if err := h.redis.XAdd(ctx, &redis.XAddArgs{
 					Stream: "audio:stream",
 					Values: fields,
 				}).Err(); err != nil {
+					release()
 					_ = wc.writeText([]byte(`{"type":"error","code":"UNAVAILABLE","message":"failed to enqueue audio"}`))
 					continue
 				}
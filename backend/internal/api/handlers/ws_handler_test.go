@@ -0,0 +1,518 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+
+	"github.com/yoockh/yoospeak/internal/api/handlers"
+	"github.com/yoockh/yoospeak/internal/models"
+	"github.com/yoockh/yoospeak/internal/providers/llm"
+	llmfake "github.com/yoockh/yoospeak/internal/providers/llm/fake"
+	sttfake "github.com/yoockh/yoospeak/internal/providers/stt/fake"
+	"github.com/yoockh/yoospeak/internal/services"
+	"github.com/yoockh/yoospeak/internal/utils"
+	"github.com/yoockh/yoospeak/internal/workers"
+)
+
+// memSessions is an in-memory SessionService holding one session per id.
+type memSessions struct {
+	mu       sync.Mutex
+	sessions map[string]*models.Session
+}
+
+func (m *memSessions) Start(ctx context.Context, userID, typ, language string, md models.SessionMetadata) (*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := &models.Session{
+		SessionID: fmt.Sprintf("sess-%d", len(m.sessions)+1),
+		UserID:    userID,
+		Type:      typ,
+		Language:  language,
+		Status:    "active",
+		Metadata:  md,
+		CreatedAt: time.Now().UTC(),
+	}
+	m.sessions[s.SessionID] = s
+	cp := *s
+	return &cp, nil
+}
+
+func (m *memSessions) Get(ctx context.Context, sessionID string) (*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[sessionID]
+	if !ok {
+		return nil, utils.E(utils.CodeNotFound, "memSessions.Get", "session not found", nil)
+	}
+	cp := *s
+	return &cp, nil
+}
+
+func (m *memSessions) End(ctx context.Context, sessionID string) (*models.Session, error) {
+	return m.Get(ctx, sessionID)
+}
+
+func (m *memSessions) SetStatus(ctx context.Context, sessionID, status string) error { return nil }
+
+// memBuffers is an in-memory BufferService.
+type memBuffers struct {
+	mu   sync.Mutex
+	rows map[int64]*models.RealtimeBuffer
+}
+
+func (m *memBuffers) row(chunkIndex int64) *models.RealtimeBuffer {
+	if m.rows == nil {
+		m.rows = map[int64]*models.RealtimeBuffer{}
+	}
+	r, ok := m.rows[chunkIndex]
+	if !ok {
+		r = &models.RealtimeBuffer{ChunkIndex: chunkIndex}
+		m.rows[chunkIndex] = r
+	}
+	return r
+}
+
+func (m *memBuffers) InsertAudioChunk(ctx context.Context, sessionID string, chunkIndex int64, audioURL, audioBase64 *string) (*models.RealtimeBuffer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.row(chunkIndex)
+	r.SessionID, r.STTStatus, r.LLMStatus = sessionID, "pending", "pending"
+	return r, nil
+}
+
+func (m *memBuffers) MarkSTT(ctx context.Context, sessionID string, chunkIndex int64, rawText string, confidence float64, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.row(chunkIndex)
+	r.RawText, r.STTConfidence, r.STTStatus = rawText, confidence, status
+	return nil
+}
+
+func (m *memBuffers) MarkLLM(ctx context.Context, sessionID string, chunkIndex int64, response string, status string, processingMS int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.row(chunkIndex)
+	r.LLMResponse, r.LLMStatus = response, status
+	return nil
+}
+
+func (m *memBuffers) MarkUtterance(ctx context.Context, sessionID string, chunkIndex int64, start, end int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.row(chunkIndex)
+	r.UtteranceStart, r.UtteranceEnd = start, end
+	return nil
+}
+
+func (m *memBuffers) MarkVAD(ctx context.Context, sessionID string, chunkIndex int64, v models.VADDecision) error {
+	return nil
+}
+
+func (m *memBuffers) MarkUsage(ctx context.Context, sessionID string, chunkIndex int64, u models.ChunkUsage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.row(chunkIndex)
+	if r.Usage == nil {
+		r.Usage = &models.ChunkUsage{}
+	}
+	if u.STT != nil {
+		r.Usage.STT = u.STT
+	}
+	if u.LLM != nil {
+		r.Usage.LLM = u.LLM
+	}
+	return nil
+}
+
+func (m *memBuffers) ListBySession(ctx context.Context, sessionID string, limit int64) ([]models.RealtimeBuffer, error) {
+	return nil, nil
+}
+
+func (m *memBuffers) RecentTranscripts(ctx context.Context, sessionID string, beforeChunk int64, limit int64) ([]models.RealtimeBuffer, error) {
+	return nil, nil
+}
+
+// memUsage prices records like UsageService and, like usage_records, keeps
+// one per (session, chunk, kind).
+type memUsage struct {
+	services.UsageService
+	pricing services.Pricing
+
+	mu   sync.Mutex
+	recs map[string]models.UsageRecord
+}
+
+func (m *memUsage) Record(ctx context.Context, rec *models.UsageRecord) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rec.CostMicroUSD = m.pricing.CostMicroUSD(rec)
+	key := fmt.Sprintf("%s/%d/%s", rec.SessionID, rec.ChunkIndex, rec.Kind)
+	if _, ok := m.recs[key]; ok {
+		return false, nil
+	}
+	m.recs[key] = *rec
+	return true, nil
+}
+
+func (m *memUsage) records() map[string]models.UsageRecord {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return maps.Clone(m.recs)
+}
+
+type e2e struct {
+	t       *testing.T
+	conn    *websocket.Conn
+	buffers *memBuffers
+	usage   *memUsage
+	llm     *llmfake.Provider
+	quota   services.QuotaService
+}
+
+const sessionID = "sess-1"
+
+// startE2E wires WSHandler and an AudioWorkerPool to one miniredis, with fake
+// STT/LLM, and connects a WS client to the session.
+func startE2E(t *testing.T, sttP *sttfake.Provider, llmP *llmfake.Provider) *e2e {
+	t.Helper()
+	return startE2EWithQuota(t, sttP, llmP, nil)
+}
+
+// startE2EWithQuota is startE2E with quotas enforced on the same miniredis
+// when cfg is set.
+func startE2EWithQuota(t *testing.T, sttP *sttfake.Provider, llmP *llmfake.Provider, cfg *services.QuotaConfig) *e2e {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	sessions := &memSessions{sessions: map[string]*models.Session{
+		sessionID: {SessionID: sessionID, UserID: "user-1", Type: "interview", Language: "en"},
+	}}
+	buffers := &memBuffers{}
+	usage := &memUsage{
+		pricing: services.Pricing{STTPerMinute: 0.6, LLMInputPerMillion: 1, LLMOutputPerMillion: 2},
+		recs:    map[string]models.UsageRecord{},
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	pool := &workers.AudioWorkerPool{
+		Redis:          rdb,
+		Buffers:        buffers,
+		NumWorkers:     2,
+		Ordered:        true,
+		STT:            sttP,
+		LLM:            llmP,
+		Sessions:       sessions,
+		Usage:          usage,
+		Logger:         logger,
+		Stream:         "audio:stream",
+		Group:          "audio-workers",
+		RetryBaseDelay: 10 * time.Millisecond,
+		RetryMaxDelay:  20 * time.Millisecond,
+		MaxAttempts:    3,
+		// no silence flush during the test; utterances end with is_final
+		UtteranceTimeout: time.Minute,
+	}
+	wsH := handlers.NewWSHandler(sessions, buffers, rdb)
+	var quota services.QuotaService
+	if cfg != nil {
+		quota = services.NewQuotaService(rdb, *cfg, nil)
+		pool.Quota = quota
+		wsH = handlers.NewWSHandlerWithQuota(sessions, buffers, rdb, quota)
+	}
+	if err := pool.Start(ctx); err != nil {
+		t.Fatalf("pool start: %v", err)
+	}
+
+	r := gin.New()
+	r.GET("/ws/session/:session_id", func(c *gin.Context) { c.Set("user_id", "user-1") }, wsH.SessionWS)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws/session/"+sessionID, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	// the handler subscribes after the upgrade; don't send before it listens
+	deadline := time.Now().Add(2 * time.Second)
+	for mr.PubSubNumSub("session:" + sessionID + ":response")["session:"+sessionID+":response"] == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("handler never subscribed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	return &e2e{t: t, conn: conn, buffers: buffers, usage: usage, llm: llmP, quota: quota}
+}
+
+func (e *e2e) send(v map[string]any) {
+	e.t.Helper()
+	if err := e.conn.WriteJSON(v); err != nil {
+		e.t.Fatalf("write: %v", err)
+	}
+}
+
+func (e *e2e) sendChunk(index int64, audio string, final bool) {
+	e.send(map[string]any{
+		"type":         "audio_chunk",
+		"chunk_index":  index,
+		"audio_base64": base64.StdEncoding.EncodeToString([]byte(audio)),
+		"is_final":     final,
+	})
+}
+
+type wsEvent struct {
+	Type         string `json:"type"`
+	Code         string `json:"code"`
+	Status       string `json:"status"`
+	Message      string `json:"message"`
+	ChunkIndex   int64  `json:"chunk_index"`
+	Text         string `json:"text"`
+	Chunk        string `json:"chunk"`
+	FullResponse string `json:"full_response"`
+}
+
+// label renders an event compactly: "status:processing:stt processing:1", "llm_chunk:2:Good ".
+func (ev wsEvent) label() string {
+	switch ev.Type {
+	case "status":
+		return fmt.Sprintf("status:%s:%s:%d", ev.Status, ev.Message, ev.ChunkIndex)
+	case "stt_result":
+		return fmt.Sprintf("stt_result:%d:%s", ev.ChunkIndex, ev.Text)
+	case "llm_chunk":
+		return fmt.Sprintf("llm_chunk:%d:%s", ev.ChunkIndex, ev.Chunk)
+	case "llm_complete":
+		return fmt.Sprintf("llm_complete:%d:%s", ev.ChunkIndex, ev.FullResponse)
+	case "error":
+		return fmt.Sprintf("error:%s:%d", ev.Code, ev.ChunkIndex)
+	}
+	return ev.Type
+}
+
+// readUntil collects events until one renders as last and the handler's
+// queued ack for chunk has arrived too (it can come late, see assertSequence).
+func (e *e2e) readUntil(chunk int64, last string) []string {
+	e.t.Helper()
+	ack := fmt.Sprintf("status:processing:audio chunk queued:%d", chunk)
+	var got []string
+	var seenLast, seenAck bool
+	_ = e.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for !seenLast || !seenAck {
+		var ev wsEvent
+		if err := e.conn.ReadJSON(&ev); err != nil {
+			e.t.Fatalf("read after %q: %v", got, err)
+		}
+		l := ev.label()
+		got = append(got, l)
+		seenLast = seenLast || l == last
+		seenAck = seenAck || l == ack
+	}
+	return got
+}
+
+// assertSequence compares the worker's messages in order. The handler's
+// "audio chunk queued" ack is published after the chunk is enqueued, so it
+// races the worker; it must be there exactly once but may land anywhere.
+func assertSequence(t *testing.T, got, want []string) {
+	t.Helper()
+	var acks []string
+	var rest []string
+	for _, m := range got {
+		if strings.HasPrefix(m, "status:processing:audio chunk queued:") {
+			acks = append(acks, m)
+			continue
+		}
+		rest = append(rest, m)
+	}
+	if len(acks) != 1 {
+		t.Fatalf("want exactly one queued ack, got %q", acks)
+	}
+	got = rest
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("message sequence mismatch\n got:\n  %s\nwant:\n  %s", strings.Join(got, "\n  "), strings.Join(want, "\n  "))
+	}
+}
+
+func lastMessage(r llm.Request) string {
+	if len(r.Messages) == 0 {
+		return ""
+	}
+	return r.Messages[len(r.Messages)-1].Content
+}
+
+func TestSessionWSEndToEnd(t *testing.T) {
+	sttP := &sttfake.Provider{Respond: func(c sttfake.Call) sttfake.Response {
+		if string(c.Audio) == "a1" {
+			return sttfake.Response{Text: "I led a team", Confidence: 0.9, BilledSeconds: 1.5}
+		}
+		return sttfake.Response{Text: "of five engineers", Confidence: 0.9}
+	}}
+	llmP := llmfake.New(llmfake.Response{
+		Chunks: []string{"Good ", "use of ", "numbers."},
+		Usage:  &llm.Usage{PromptTokens: 300, CompletionTokens: 12},
+	})
+	e := startE2E(t, sttP, llmP)
+
+	e.sendChunk(1, "a1", false)
+	assertSequence(t, e.readUntil(1, "status:done:chunk transcribed:1"), []string{
+		"status:processing:stt processing:1",
+		"stt_result:1:I led a team",
+		"status:done:chunk transcribed:1",
+	})
+
+	e.sendChunk(2, "a2", true)
+	assertSequence(t, e.readUntil(2, "status:done:chunk processed:2"), []string{
+		"status:processing:stt processing:2",
+		"stt_result:2:of five engineers",
+		"status:processing:llm processing:2",
+		"llm_chunk:2:Good ",
+		"llm_chunk:2:use of ",
+		"llm_chunk:2:numbers.",
+		"llm_complete:2:Good use of numbers.",
+		"status:done:chunk processed:2",
+	})
+
+	// the whole utterance reached the coach as the user turn, and the answer is on its last chunk
+	reqs := llmP.Requests()
+	if len(reqs) != 1 || lastMessage(reqs[0]) != "I led a team of five engineers" || reqs[0].System == "" {
+		t.Errorf("requests = %+v", reqs)
+	}
+	e.buffers.mu.Lock()
+	defer e.buffers.mu.Unlock()
+	if r := e.buffers.rows[2]; r.LLMStatus != "done" || r.LLMResponse != "Good use of numbers." || r.UtteranceStart != 1 || r.UtteranceEnd != 2 {
+		t.Errorf("chunk 2 buffer = %+v", r)
+	}
+	if r := e.buffers.rows[1]; r.LLMStatus != "aggregated" || r.RawText != "I led a team" {
+		t.Errorf("chunk 1 buffer = %+v", r)
+	}
+
+	// usage: billed STT seconds where the provider reported them, the audio's
+	// duration otherwise; the answer's tokens on the chunk that closed the utterance
+	if u := e.buffers.rows[1].Usage; u == nil || u.STT == nil || *u.STT != (models.STTUsage{AudioSeconds: 1.5, CostMicroUSD: 15000}) || u.LLM != nil {
+		t.Errorf("chunk 1 usage = %+v", u)
+	}
+	if u := e.buffers.rows[2].Usage; u == nil || u.STT == nil || !u.STT.Estimated || u.LLM == nil ||
+		*u.LLM != (models.LLMUsage{PromptTokens: 300, CompletionTokens: 12, CostMicroUSD: 324}) {
+		t.Errorf("chunk 2 usage = %+v", u)
+	}
+	recs := e.usage.records()
+	if len(recs) != 3 || recs[sessionID+"/2/llm"].UserID != "user-1" || recs[sessionID+"/1/stt"].CostMicroUSD != 15000 {
+		t.Errorf("usage records = %+v", recs)
+	}
+}
+
+func TestSessionWSRetriesFailedLLMStream(t *testing.T) {
+	sttP := &sttfake.Provider{Default: sttfake.Response{Text: "hello", Confidence: 0.8}}
+	llmP := llmfake.New(
+		llmfake.Response{Chunks: []string{"Hel"}, Err: errors.New("stream reset")},
+		llmfake.Response{Chunks: []string{"Hello ", "there."}},
+	)
+	e := startE2E(t, sttP, llmP)
+
+	e.sendChunk(1, "a1", true)
+	assertSequence(t, e.readUntil(1, "status:done:chunk processed:1"), []string{
+		"status:processing:stt processing:1",
+		"stt_result:1:hello",
+		"status:processing:llm processing:1",
+		"llm_chunk:1:Hel",
+		"status:retrying:llm failed:1",
+		// the retry resumes the closed utterance: no second transcription, no doubled text
+		"status:processing:llm processing:1",
+		"llm_chunk:1:Hello ",
+		"llm_chunk:1:there.",
+		"llm_complete:1:Hello there.",
+		"status:done:chunk processed:1",
+	})
+
+	if reqs := llmP.Requests(); len(reqs) != 2 || len(reqs[1].Messages) != 1 || lastMessage(reqs[1]) != "hello" {
+		t.Errorf("requests = %+v", reqs)
+	}
+	if n := len(sttP.Calls()); n != 1 {
+		t.Errorf("chunk transcribed %d times, want 1", n)
+	}
+	// the failed stream is not billed
+	if recs := e.usage.records(); len(recs) != 2 || !recs[sessionID+"/1/llm"].Estimated {
+		t.Errorf("usage records = %+v", recs)
+	}
+}
+
+func TestSessionWSDeadLettersRejectedAudio(t *testing.T) {
+	sttP := sttfake.New(sttfake.Response{Err: utils.E(utils.CodeInvalidArgument, "fake", "unsupported audio", nil)})
+	llmP := llmfake.New()
+	e := startE2E(t, sttP, llmP)
+
+	e.sendChunk(1, "garbage!", true)
+	assertSequence(t, e.readUntil(1, "status:failed:stt failed:1"), []string{
+		"status:processing:stt processing:1",
+		"status:failed:stt failed:1",
+	})
+
+	if n := len(sttP.Calls()); n != 1 {
+		t.Errorf("rejected audio was transcribed %d times, want 1 (no retries)", n)
+	}
+	if len(llmP.Requests()) != 0 {
+		t.Errorf("llm was called for a failed chunk")
+	}
+}
+
+func TestSessionWSRejectsChunksOverQuota(t *testing.T) {
+	sttP := &sttfake.Provider{Default: sttfake.Response{Text: "hello", Confidence: 0.8}}
+	llmP := llmfake.New(llmfake.Response{
+		Chunks: []string{"Hi."},
+		Usage:  &llm.Usage{PromptTokens: 80, CompletionTokens: 30},
+	})
+	e := startE2EWithQuota(t, sttP, llmP, &services.QuotaConfig{
+		Plans:       services.QuotaPlans{"free": {LLMTokensPerDay: 100}},
+		DefaultPlan: "free",
+	})
+
+	e.sendChunk(1, "a1", true)
+	e.readUntil(1, "status:done:chunk processed:1")
+
+	// the answer's 110 tokens used up the day's 100; the next chunk never reaches the worker
+	st, err := e.quota.Status(context.Background(), "user-1", "")
+	if err != nil || st.Used.LLMTokens != 110 || st.Plan != "free" {
+		t.Fatalf("status = %+v, %v", st, err)
+	}
+	e.sendChunk(2, "a2", true)
+	_ = e.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var ev wsEvent
+	if err := e.conn.ReadJSON(&ev); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if got := ev.label(); got != "error:QUOTA_EXCEEDED:2" {
+		t.Fatalf("got %q (%s), want quota error for chunk 2", got, ev.Message)
+	}
+	if n := len(sttP.Calls()); n != 1 {
+		t.Errorf("stt called %d times, want 1", n)
+	}
+	e.buffers.mu.Lock()
+	defer e.buffers.mu.Unlock()
+	if _, ok := e.buffers.rows[2]; ok {
+		t.Errorf("rejected chunk was buffered")
+	}
+}
@@ -106,16 +106,24 @@ func JWTAuth() gin.HandlerFunc {
 
 		// Default role: "user" (app-level role)
 		appRole := "user"
+		// Billing plan ({"plan":"pro"} in app_metadata); empty means the default plan.
+		plan := ""
 		if claims.AppMetadata != nil {
 			if v, ok := claims.AppMetadata["role"]; ok {
 				if s, ok := v.(string); ok && s != "" {
 					appRole = s
 				}
 			}
+			if v, ok := claims.AppMetadata["plan"]; ok {
+				if s, ok := v.(string); ok {
+					plan = strings.ToLower(strings.TrimSpace(s))
+				}
+			}
 		}
 
 		c.Set("user_id", userID)
 		c.Set("role", appRole)
+		c.Set("plan", plan)
 		c.Next()
 	}
 }
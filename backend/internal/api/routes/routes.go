@@ -1,6 +1,8 @@
 package routes
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
 	"github.com/yoockh/yoospeak/internal/api/handlers"
 	"github.com/yoockh/yoospeak/internal/api/middleware"
@@ -12,12 +14,23 @@ type Deps struct {
 	Conversation *handlers.ConversationHandler
 	WS           *handlers.WSHandler
 	CV           *handlers.CVHandler
+	CVParse      *handlers.CVParseHandler
+	Usage        *handlers.UsageHandler
+	// Quota is nil when quotas are disabled.
+	Quota *handlers.QuotaHandler
+	// Files serves signed download URLs of the local storage backend (nil otherwise).
+	Files http.Handler
 }
 
 func RegisterRoutes(r *gin.Engine, d Deps) {
 	r.GET("/ping", func(c *gin.Context) { c.JSON(200, gin.H{"message": "pong"}) })
 	r.GET("/health", func(c *gin.Context) { c.JSON(200, gin.H{"status": "healthy"}) })
 
+	// public: access is granted by the URL signature, not the JWT
+	if d.Files != nil {
+		r.GET("/files/*path", gin.WrapH(d.Files))
+	}
+
 	auth := r.Group("/")
 	auth.Use(middleware.JWTAuth())
 
@@ -27,13 +40,29 @@ func RegisterRoutes(r *gin.Engine, d Deps) {
 	auth.POST("/session/:session_id/end", d.Session.End)
 	auth.GET("/profile/me", d.Profile.Me)
 	auth.PUT("/profile/update", d.Profile.Update)
+	auth.POST("/profile/cv/parse", d.CVParse.Propose)
+	auth.POST("/profile/cv/parse/:proposal_id/apply", d.CVParse.Apply)
+	auth.GET("/conversation/search", d.Conversation.Search)
 	auth.GET("/conversation/:session_id", d.Conversation.ListBySession)
 	auth.POST("/cv/upload", d.CV.Upload)
+	auth.GET("/cv", d.CV.List)
+	auth.GET("/cv/:id", d.CV.Get)
+	auth.DELETE("/cv/:id", d.CV.Delete)
+	auth.POST("/cv/:id/activate", d.CV.Activate)
+	auth.GET("/cv/:id/download", d.CV.Download)
 	auth.GET("/ws/session/:session_id", d.WS.SessionWS)
+	auth.GET("/usage/me", d.Usage.Me)
+	if d.Quota != nil {
+		auth.GET("/quota/me", d.Quota.Me)
+	}
 
-	// admin routes (contoh)
+	// admin routes
 	admin := auth.Group("/admin")
 	admin.Use(middleware.RequireAdmin())
-	_ = admin
-	// admin.GET("/stats", ...)
+	admin.GET("/usage", d.Usage.Aggregate)
+	if d.Quota != nil {
+		admin.GET("/quota/:user_id", d.Quota.Get)
+		admin.PUT("/quota/:user_id", d.Quota.SetOverride)
+		admin.DELETE("/quota/:user_id", d.Quota.DeleteOverride)
+	}
 }
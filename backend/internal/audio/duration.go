@@ -0,0 +1,125 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+// Bitrate floors for compressed audio whose length cannot be read from the
+// data. They sit below what speech is ever encoded at, so the estimate errs
+// long: usage and quota are over- rather than under-counted.
+const (
+	opusMinBitrate = 6000 // bits/s, the lowest Opus speech mode
+	flacMinRatio   = 4    // FLAC rarely compresses speech below a quarter of PCM
+)
+
+// EstimateDuration returns the playing time of one chunk. PCM is exact; Ogg
+// Opus is read from page granule positions and FLAC from STREAMINFO when the
+// chunk carries them. Everything else falls back to a bitrate floor, never 0,
+// so unknown audio is not free.
+func EstimateDuration(f Format, data []byte) time.Duration {
+	if len(data) == 0 {
+		return 0
+	}
+	var d time.Duration
+	switch f.Encoding {
+	case Linear16, MuLaw:
+		d = f.Duration(len(data))
+	case WAV:
+		if wf, pcm, err := ParseWAV(data); err == nil {
+			d = wf.Duration(len(pcm))
+		}
+	case OggOpus:
+		d, _ = oggOpusDuration(data)
+	case FLAC:
+		var ok bool
+		if d, ok = flacDuration(data); !ok {
+			rate := f.SampleRateHz
+			if rate <= 0 {
+				rate = TargetSampleRate
+			}
+			d = bitsDuration(len(data), rate*max(f.Channels, 1)*16/flacMinRatio)
+		}
+	}
+	if d <= 0 {
+		d = bitsDuration(len(data), opusMinBitrate)
+	}
+	return d
+}
+
+func bitsDuration(n, bitsPerSecond int) time.Duration {
+	return time.Duration(int64(n) * 8 * int64(time.Second) / int64(bitsPerSecond))
+}
+
+// oggOpusDuration reads the granule positions (48 kHz samples) of the Ogg
+// pages in data. A chunk starting the stream counts from the OpusHead
+// pre-skip; a later chunk from its first page, plus that page's own length
+// taken as the average over the rest.
+func oggOpusDuration(data []byte) (time.Duration, bool) {
+	var granules []int64
+	preSkip, head := int64(0), false
+	for off := 0; ; {
+		i := bytes.Index(data[off:], []byte("OggS"))
+		if i < 0 {
+			break
+		}
+		off += i
+		if off+27 > len(data) {
+			break
+		}
+		nseg := int(data[off+26])
+		if off+27+nseg > len(data) {
+			break
+		}
+		bodyLen := 0
+		for _, l := range data[off+27 : off+27+nseg] {
+			bodyLen += int(l)
+		}
+		body := data[off+27+nseg : min(off+27+nseg+bodyLen, len(data))]
+		if bytes.HasPrefix(body, []byte("OpusHead")) && len(body) >= 12 {
+			head = true
+			preSkip = int64(binary.LittleEndian.Uint16(body[10:12]))
+		}
+		if g := int64(binary.LittleEndian.Uint64(data[off+6 : off+14])); g >= 0 && !bytes.HasPrefix(body, []byte("Opus")) {
+			granules = append(granules, g)
+		}
+		off += 27 + nseg + bodyLen
+		if off >= len(data) {
+			break
+		}
+	}
+
+	var samples int64
+	switch {
+	case head && len(granules) > 0:
+		samples = granules[len(granules)-1] - preSkip
+	case len(granules) >= 2:
+		span := granules[len(granules)-1] - granules[0]
+		samples = span + span/int64(len(granules)-1)
+	default:
+		return 0, false
+	}
+	if samples <= 0 {
+		return 0, false
+	}
+	return time.Duration(samples) * time.Second / 48000, true
+}
+
+// flacDuration reads total samples and sample rate from the STREAMINFO block
+// of a chunk that starts the FLAC stream. Encoders that do not know the
+// length up front write 0 samples, which is reported as unknown.
+func flacDuration(data []byte) (time.Duration, bool) {
+	// "fLaC", block header (4 bytes), then STREAMINFO: rate is 20 bits at
+	// byte 10 of the block, total samples the low 36 bits of bytes 13-17.
+	if len(data) < 8+18 || string(data[:4]) != "fLaC" || data[4]&0x7F != 0 {
+		return 0, false
+	}
+	si := data[8:]
+	rate := int64(si[10])<<12 | int64(si[11])<<4 | int64(si[12])>>4
+	total := int64(si[13]&0x0F)<<32 | int64(binary.BigEndian.Uint32(si[14:18]))
+	if rate == 0 || total == 0 {
+		return 0, false
+	}
+	return time.Duration(total) * time.Second / time.Duration(rate), true
+}
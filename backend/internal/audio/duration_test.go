@@ -0,0 +1,101 @@
+package audio_test
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/yoockh/yoospeak/internal/audio"
+)
+
+// oggPage is one Ogg page holding body (under 255 bytes) at granule position granule.
+func oggPage(granule int64, body []byte) []byte {
+	p := make([]byte, 27, 28+len(body))
+	copy(p, "OggS")
+	binary.LittleEndian.PutUint64(p[6:], uint64(granule))
+	p[26] = 1
+	p = append(p, byte(len(body)))
+	return append(p, body...)
+}
+
+func opusHead(preSkip uint16) []byte {
+	b := []byte("OpusHead\x01\x01\x00\x00\x80\xbb\x00\x00\x00\x00\x00")
+	binary.LittleEndian.PutUint16(b[10:], preSkip)
+	return b
+}
+
+func flacHeader(rate int, totalSamples int64) []byte {
+	b := make([]byte, 8+34)
+	copy(b, "fLaC")
+	b[4] = 0x80 // last metadata block, STREAMINFO
+	b[7] = 34
+	si := b[8:]
+	si[10] = byte(rate >> 12)
+	si[11] = byte(rate >> 4)
+	si[12] = byte(rate<<4) | 0x01 // mono, 16 bits
+	si[13] = 0xF0 | byte(totalSamples>>32)
+	binary.BigEndian.PutUint32(si[14:], uint32(totalSamples))
+	return b
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func TestEstimateDuration(t *testing.T) {
+	pcm := audio.Format{Encoding: audio.Linear16, SampleRateHz: 16000, Channels: 1}
+	wav, _ := audio.EncodeWAV(audio.Format{Encoding: audio.Linear16, SampleRateHz: 8000, Channels: 2}, make([]byte, 32000))
+	audioFrame := make([]byte, 100)
+
+	for _, tc := range []struct {
+		name string
+		f    audio.Format
+		data []byte
+		want time.Duration
+	}{
+		{"empty", pcm, nil, 0},
+		{"linear16", pcm, make([]byte, 32000), time.Second},
+		{"mulaw", audio.Format{Encoding: audio.MuLaw, SampleRateHz: 8000, Channels: 1}, make([]byte, 4000), 500 * time.Millisecond},
+		{"wav header", audio.Format{Encoding: audio.WAV}, wav, time.Second},
+		{
+			"ogg opus stream start",
+			audio.Format{Encoding: audio.OggOpus, SampleRateHz: 48000, Channels: 1},
+			concat(oggPage(0, opusHead(312)), oggPage(0, []byte("OpusTags")), oggPage(24312, audioFrame), oggPage(48312, audioFrame)),
+			time.Second,
+		},
+		{
+			"ogg opus mid-stream",
+			audio.Format{Encoding: audio.OggOpus, SampleRateHz: 48000, Channels: 1},
+			concat(oggPage(48312, audioFrame), oggPage(72312, audioFrame), oggPage(96312, audioFrame)),
+			1500 * time.Millisecond,
+		},
+		{
+			"ogg opus single page falls back to floor",
+			audio.Format{Encoding: audio.OggOpus, SampleRateHz: 48000, Channels: 1},
+			oggPage(48312, make([]byte, 222)),
+			time.Duration(250) * 8 * time.Second / 6000,
+		},
+		{"flac streaminfo", audio.Format{Encoding: audio.FLAC, SampleRateHz: 16000, Channels: 1}, flacHeader(16000, 32000), 2 * time.Second},
+		{"flac without length", audio.Format{Encoding: audio.FLAC, SampleRateHz: 16000, Channels: 1}, make([]byte, 8000), time.Second},
+		{"webm opus", audio.Format{Encoding: audio.WebMOpus, SampleRateHz: 48000, Channels: 1}, make([]byte, 750), time.Second},
+		{"unreadable wav", audio.Format{Encoding: audio.WAV}, make([]byte, 750), time.Second},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := audio.EstimateDuration(tc.f, tc.data); got != tc.want {
+				t.Errorf("EstimateDuration = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEstimateDurationNeverZeroForAudio(t *testing.T) {
+	for _, enc := range []audio.Encoding{audio.Linear16, audio.WAV, audio.FLAC, audio.MuLaw, audio.WebMOpus, audio.OggOpus} {
+		if d := audio.EstimateDuration(audio.Format{Encoding: enc}, []byte{0x4f}); d <= 0 {
+			t.Errorf("%s: EstimateDuration of one byte = %v, want > 0", enc, d)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Package audio describes the audio formats clients may send and converts
+// PCM input into what the STT providers expect.
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Encoding string
+
+const (
+	// Linear16 is raw little-endian signed 16-bit PCM, channels interleaved.
+	Linear16 Encoding = "linear16"
+	// WAV chunks are complete RIFF/WAVE files (PCM 16-bit); the header wins over the declared format.
+	WAV      Encoding = "wav"
+	FLAC     Encoding = "flac"
+	MuLaw    Encoding = "mulaw"
+	WebMOpus Encoding = "webm_opus"
+	OggOpus  Encoding = "ogg_opus"
+)
+
+// TargetSampleRate is what PCM input is resampled to before recognition.
+const TargetSampleRate = 16000
+
+// Format is the audio format a WS session declares in its start message.
+type Format struct {
+	Encoding     Encoding `json:"encoding"`
+	SampleRateHz int      `json:"sample_rate_hz"`
+	Channels     int      `json:"channels"`
+}
+
+// Default is assumed for sessions that never declare a format.
+var Default = Format{Encoding: Linear16, SampleRateHz: TargetSampleRate, Channels: 1}
+
+var ErrInvalidFormat = errors.New("audio: invalid format")
+
+var opusRates = map[int]bool{8000: true, 12000: true, 16000: true, 24000: true, 48000: true}
+
+// IsPCM reports whether the audio is uncompressed PCM the server can transcode.
+func (f Format) IsPCM() bool { return f.Encoding == Linear16 || f.Encoding == WAV }
+
+// Duration is the playing time of n bytes of raw audio in this format, or 0
+// for compressed encodings whose length is not a function of size (see
+// EstimateDuration for those).
+func (f Format) Duration(n int) time.Duration {
+	var bytesPerSample int
+	switch f.Encoding {
+	case Linear16:
+		bytesPerSample = 2
+	case MuLaw:
+		bytesPerSample = 1
+	default:
+		return 0
+	}
+	if f.SampleRateHz <= 0 {
+		return 0
+	}
+	frames := n / (bytesPerSample * max(f.Channels, 1))
+	return time.Duration(frames) * time.Second / time.Duration(f.SampleRateHz)
+}
+
+// Silence is d of silent raw audio in this format, or nil for encodings
+// whose silence cannot be produced without an encoder.
+func (f Format) Silence(d time.Duration) []byte {
+	if f.SampleRateHz <= 0 {
+		return nil
+	}
+	frames := int(d * time.Duration(f.SampleRateHz) / time.Second)
+	switch f.Encoding {
+	case Linear16:
+		return make([]byte, frames*2*max(f.Channels, 1))
+	case MuLaw:
+		return bytes.Repeat([]byte{0xFF}, frames*max(f.Channels, 1)) // mu-law zero
+	}
+	return nil
+}
+
+// Validate checks that the format is one the pipeline can handle. WAV may omit
+// rate and channels since the header carries them.
+func (f Format) Validate() error {
+	switch f.Encoding {
+	case Linear16, FLAC, MuLaw, WebMOpus, OggOpus:
+	case WAV:
+		if f.SampleRateHz == 0 && f.Channels == 0 {
+			return nil
+		}
+	case "":
+		return fmt.Errorf("%w: encoding is required", ErrInvalidFormat)
+	default:
+		return fmt.Errorf("%w: unsupported encoding %q (linear16, wav, flac, mulaw, webm_opus, ogg_opus)", ErrInvalidFormat, f.Encoding)
+	}
+
+	if f.SampleRateHz < 8000 || f.SampleRateHz > 48000 {
+		return fmt.Errorf("%w: sample_rate_hz must be between 8000 and 48000", ErrInvalidFormat)
+	}
+	if (f.Encoding == WebMOpus || f.Encoding == OggOpus) && !opusRates[f.SampleRateHz] {
+		return fmt.Errorf("%w: opus sample_rate_hz must be 8000, 12000, 16000, 24000 or 48000", ErrInvalidFormat)
+	}
+	if f.Encoding == MuLaw && f.SampleRateHz != 8000 {
+		return fmt.Errorf("%w: mulaw sample_rate_hz must be 8000", ErrInvalidFormat)
+	}
+	if f.Channels < 1 || f.Channels > 2 {
+		return fmt.Errorf("%w: channels must be 1 or 2", ErrInvalidFormat)
+	}
+	return nil
+}
+
+// Fields flattens the format into string values for a Redis stream entry.
+func (f Format) Fields() map[string]string {
+	return map[string]string{
+		"audio_encoding": string(f.Encoding),
+		"sample_rate_hz": strconv.Itoa(f.SampleRateHz),
+		"channels":       strconv.Itoa(f.Channels),
+	}
+}
+
+// FormatFromFields is the inverse of Fields; entries without a format get Default.
+func FormatFromFields(get func(string) string) (Format, error) {
+	enc := strings.ToLower(get("audio_encoding"))
+	if enc == "" {
+		return Default, nil
+	}
+	f := Format{Encoding: Encoding(enc)}
+	f.SampleRateHz, _ = strconv.Atoi(get("sample_rate_hz"))
+	f.Channels, _ = strconv.Atoi(get("channels"))
+	return f, f.Validate()
+}
@@ -0,0 +1,112 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Prepare turns a chunk into something the STT provider accepts: WAV is
+// unwrapped, and PCM is down-mixed to mono and resampled to TargetSampleRate.
+// Compressed encodings are passed through unchanged with their declared format.
+func Prepare(f Format, data []byte) (Format, []byte, error) {
+	if f.Encoding == WAV {
+		var err error
+		f, data, err = ParseWAV(data)
+		if err != nil {
+			return Format{}, nil, err
+		}
+	}
+	if f.Encoding != Linear16 {
+		return f, data, nil
+	}
+
+	if len(data)%(2*f.Channels) != 0 {
+		return Format{}, nil, fmt.Errorf("%w: pcm length is not a whole number of frames", ErrInvalidFormat)
+	}
+	samples := decodePCM16(data)
+	if f.Channels == 2 {
+		samples = Downmix(samples, 2)
+	}
+	if f.SampleRateHz != TargetSampleRate {
+		samples = Resample(samples, f.SampleRateHz, TargetSampleRate)
+	}
+	return Format{Encoding: Linear16, SampleRateHz: TargetSampleRate, Channels: 1}, encodePCM16(samples), nil
+}
+
+func decodePCM16(b []byte) []int16 {
+	out := make([]int16, len(b)/2)
+	for i := range out {
+		out[i] = int16(binary.LittleEndian.Uint16(b[2*i:]))
+	}
+	return out
+}
+
+func encodePCM16(s []int16) []byte {
+	out := make([]byte, 2*len(s))
+	for i, v := range s {
+		binary.LittleEndian.PutUint16(out[2*i:], uint16(v))
+	}
+	return out
+}
+
+// Downmix averages interleaved channels into mono.
+func Downmix(samples []int16, channels int) []int16 {
+	if channels <= 1 {
+		return samples
+	}
+	out := make([]int16, len(samples)/channels)
+	for i := range out {
+		sum := 0
+		for c := 0; c < channels; c++ {
+			sum += int(samples[i*channels+c])
+		}
+		out[i] = int16(sum / channels)
+	}
+	return out
+}
+
+// Resample converts mono samples between rates by linear interpolation. When
+// downsampling, a moving average over the rate ratio first keeps the worst of
+// the aliasing out; speech recognition does not need more than that.
+func Resample(samples []int16, from, to int) []int16 {
+	if from == to || len(samples) == 0 || from <= 0 || to <= 0 {
+		return samples
+	}
+
+	src := samples
+	if from > to {
+		if w := (from + to - 1) / to; w > 1 {
+			src = boxFilter(samples, w)
+		}
+	}
+
+	n := int(int64(len(src)) * int64(to) / int64(from))
+	out := make([]int16, n)
+	step := float64(from) / float64(to)
+	for i := range out {
+		pos := float64(i) * step
+		j := int(pos)
+		frac := pos - float64(j)
+		a := float64(src[j])
+		b := a
+		if j+1 < len(src) {
+			b = float64(src[j+1])
+		}
+		out[i] = int16(a + (b-a)*frac)
+	}
+	return out
+}
+
+func boxFilter(s []int16, w int) []int16 {
+	out := make([]int16, len(s))
+	sum := 0
+	for i, v := range s {
+		sum += int(v)
+		if i >= w {
+			sum -= int(s[i-w])
+		}
+		n := min(i+1, w)
+		out[i] = int16(sum / n)
+	}
+	return out
+}
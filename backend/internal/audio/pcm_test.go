@@ -0,0 +1,82 @@
+package audio_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/yoockh/yoospeak/internal/audio"
+)
+
+func pcm16(samples ...int16) []byte {
+	b := make([]byte, 2*len(samples))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(b[2*i:], uint16(s))
+	}
+	return b
+}
+
+func TestPrepareRejectsPartialFrames(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		f    audio.Format
+		n    int
+	}{
+		{"odd mono", audio.Format{Encoding: audio.Linear16, SampleRateHz: 16000, Channels: 1}, 3},
+		{"half a stereo frame", audio.Format{Encoding: audio.Linear16, SampleRateHz: 16000, Channels: 2}, 6},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, err := audio.Prepare(tc.f, make([]byte, tc.n)); !errors.Is(err, audio.ErrInvalidFormat) {
+				t.Errorf("err = %v, want ErrInvalidFormat", err)
+			}
+		})
+	}
+}
+
+func TestPrepareDownmixesStereo(t *testing.T) {
+	in := pcm16(1000, 3000, -2000, 0, 32767, 32767)
+	f, out, err := audio.Prepare(audio.Format{Encoding: audio.Linear16, SampleRateHz: 16000, Channels: 2}, in)
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	if f != audio.Default {
+		t.Errorf("format = %+v, want %+v", f, audio.Default)
+	}
+	if want := pcm16(2000, -1000, 32767); string(out) != string(want) {
+		t.Errorf("downmixed = %v, want %v", out, want)
+	}
+}
+
+func TestPrepareResamplesToTargetRate(t *testing.T) {
+	// one second at 44.1 kHz
+	in := make([]byte, 2*44100)
+	f, out, err := audio.Prepare(audio.Format{Encoding: audio.Linear16, SampleRateHz: 44100, Channels: 1}, in)
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	if f.SampleRateHz != audio.TargetSampleRate {
+		t.Errorf("rate = %d, want %d", f.SampleRateHz, audio.TargetSampleRate)
+	}
+	if len(out) != 2*audio.TargetSampleRate {
+		t.Errorf("resampled to %d bytes, want %d", len(out), 2*audio.TargetSampleRate)
+	}
+	if d := f.Duration(len(out)); d.Seconds() != 1 {
+		t.Errorf("duration = %v, want 1s", d)
+	}
+}
+
+func TestResampleKeepsConstantSignal(t *testing.T) {
+	in := make([]int16, 441)
+	for i := range in {
+		in[i] = 1200
+	}
+	out := audio.Resample(in, 44100, 16000)
+	if len(out) != 160 {
+		t.Fatalf("len = %d, want 160", len(out))
+	}
+	for i, v := range out {
+		if v != 1200 {
+			t.Fatalf("sample %d = %d, want 1200", i, v)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package audio
+
+import "math"
+
+// VAD is a frame-based energy / zero-crossing voice activity detector for
+// mono 16-bit PCM. A frame counts as speech when it is loud enough and not
+// dominated by zero crossings (hiss, fans), unless it is loud enough that the
+// crossings don't matter.
+type VAD struct {
+	FrameMS         int
+	EnergyThreshold float64 // frame RMS in sample units (~500 is -36 dBFS)
+	MaxZCR          float64 // zero crossings per sample above which a quiet frame is noise
+	MinSpeechMS     int     // less speech than this in a chunk is treated as silence
+	PaddingMS       int     // kept around speech when trimming
+}
+
+func NewVAD() *VAD {
+	return &VAD{FrameMS: 20, EnergyThreshold: 500, MaxZCR: 0.35, MinSpeechMS: 60, PaddingMS: 150}
+}
+
+// Activity is the VAD verdict for one chunk.
+type Activity struct {
+	Speech     bool
+	DurationMS int
+	SpeechMS   int
+	LeadingMS  int // silence before the first speech frame
+	TrailingMS int // silence after the last speech frame
+
+	// byte range of the chunk worth sending to STT (speech plus padding)
+	start, end, size int
+}
+
+func (v *VAD) Analyze(pcm []byte, sampleRate int) Activity {
+	frameLen := sampleRate * v.FrameMS / 1000
+	samples := len(pcm) / 2
+	if frameLen <= 0 || samples == 0 {
+		return Activity{}
+	}
+	ms := func(n int) int { return n * 1000 / sampleRate }
+
+	act := Activity{DurationMS: ms(samples), size: 2 * samples}
+	first, last := -1, -1
+	speechFrames := 0
+	for f := 0; f*frameLen < samples; f++ {
+		lo, hi := f*frameLen, min((f+1)*frameLen, samples)
+		if v.isSpeech(pcm[2*lo : 2*hi]) {
+			speechFrames++
+			if first < 0 {
+				first = lo
+			}
+			last = hi
+		}
+	}
+
+	act.SpeechMS = ms(speechFrames * frameLen)
+	if first < 0 || act.SpeechMS < v.MinSpeechMS {
+		act.LeadingMS, act.TrailingMS = act.DurationMS, act.DurationMS
+		return act
+	}
+
+	act.Speech = true
+	act.LeadingMS = ms(first)
+	act.TrailingMS = ms(samples - last)
+
+	pad := sampleRate * v.PaddingMS / 1000
+	act.start = 2 * max(first-pad, 0)
+	act.end = 2 * min(last+pad, samples)
+	return act
+}
+
+func (v *VAD) isSpeech(frame []byte) bool {
+	n := len(frame) / 2
+	if n == 0 {
+		return false
+	}
+	var sum float64
+	crossings := 0
+	prev := int16(frame[0]) | int16(frame[1])<<8
+	for i := 0; i < n; i++ {
+		s := int16(frame[2*i]) | int16(frame[2*i+1])<<8
+		sum += float64(s) * float64(s)
+		if (s >= 0) != (prev >= 0) {
+			crossings++
+		}
+		prev = s
+	}
+	rms := math.Sqrt(sum / float64(n))
+	zcr := float64(crossings) / float64(n)
+
+	if rms < v.EnergyThreshold {
+		return false
+	}
+	return zcr <= v.MaxZCR || rms >= 2*v.EnergyThreshold
+}
+
+// Trim returns the part of pcm around the detected speech (all of it when there was none).
+func (a Activity) Trim(pcm []byte) []byte {
+	if !a.Speech || a.end <= a.start || a.end > len(pcm) {
+		return pcm
+	}
+	return pcm[a.start:a.end]
+}
+
+// TrimmedMS is how much audio Trim removes.
+func (a Activity) TrimmedMS() int {
+	if !a.Speech || a.size == 0 {
+		return 0
+	}
+	return a.DurationMS - a.DurationMS*(a.end-a.start)/a.size
+}
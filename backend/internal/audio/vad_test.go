@@ -0,0 +1,98 @@
+package audio_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/yoockh/yoospeak/internal/audio"
+)
+
+const vadRate = 16000
+
+func silence(ms int) []int16 { return make([]int16, vadRate*ms/1000) }
+
+// tone is a 220 Hz sine at amplitude amp.
+func tone(ms int, amp float64) []int16 {
+	s := make([]int16, vadRate*ms/1000)
+	for i := range s {
+		s[i] = int16(amp * math.Sin(2*math.Pi*220*float64(i)/vadRate))
+	}
+	return s
+}
+
+// hiss flips sign every sample: loud enough to pass the energy gate, but all zero crossings.
+func hiss(ms int, amp int16) []int16 {
+	s := make([]int16, vadRate*ms/1000)
+	for i := range s {
+		if s[i] = amp; i%2 == 1 {
+			s[i] = -amp
+		}
+	}
+	return s
+}
+
+func join(parts ...[]int16) []byte {
+	var all []int16
+	for _, p := range parts {
+		all = append(all, p...)
+	}
+	return pcm16(all...)
+}
+
+func TestVADSilence(t *testing.T) {
+	for name, pcm := range map[string][]byte{
+		"digital silence": join(silence(1000)),
+		"hiss":            join(hiss(1000, 700)),
+		"too short tone":  join(silence(500), tone(40, 8000), silence(500)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			act := audio.NewVAD().Analyze(pcm, vadRate)
+			if act.Speech {
+				t.Fatalf("speech detected: %+v", act)
+			}
+			if act.TrailingMS != act.DurationMS || act.LeadingMS != act.DurationMS {
+				t.Errorf("leading/trailing = %d/%d ms, want the whole %d ms", act.LeadingMS, act.TrailingMS, act.DurationMS)
+			}
+			if got := act.Trim(pcm); len(got) != len(pcm) || act.TrimmedMS() != 0 {
+				t.Errorf("silence trimmed to %d of %d bytes", len(got), len(pcm))
+			}
+		})
+	}
+}
+
+func TestVADTone(t *testing.T) {
+	pcm := join(tone(1000, 8000))
+	act := audio.NewVAD().Analyze(pcm, vadRate)
+	if !act.Speech {
+		t.Fatalf("tone not detected: %+v", act)
+	}
+	if act.DurationMS != 1000 || act.SpeechMS != 1000 || act.LeadingMS != 0 || act.TrailingMS != 0 {
+		t.Errorf("activity = %+v, want 1000 ms of speech end to end", act)
+	}
+	if got := act.Trim(pcm); len(got) != len(pcm) {
+		t.Errorf("trimmed %d of %d bytes of speech", len(pcm)-len(got), len(pcm))
+	}
+}
+
+func TestVADToneBetweenSilence(t *testing.T) {
+	pcm := join(silence(500), tone(500, 8000), silence(1000))
+	act := audio.NewVAD().Analyze(pcm, vadRate)
+	if !act.Speech {
+		t.Fatalf("tone not detected: %+v", act)
+	}
+	if act.DurationMS != 2000 || act.SpeechMS != 500 || act.LeadingMS != 500 || act.TrailingMS != 1000 {
+		t.Errorf("activity = %+v, want 500 ms leading, 500 ms speech, 1000 ms trailing", act)
+	}
+
+	// speech plus 150 ms padding either side
+	trimmed := act.Trim(pcm)
+	if want := 2 * vadRate * 800 / 1000; len(trimmed) != want {
+		t.Errorf("trimmed to %d bytes, want %d", len(trimmed), want)
+	}
+	if want := join(silence(150), tone(500, 8000), silence(150)); string(trimmed) != string(want) {
+		t.Error("trim did not keep the tone with its padding")
+	}
+	if got := act.TrimmedMS(); got != 1200 {
+		t.Errorf("TrimmedMS = %d, want 1200", got)
+	}
+}
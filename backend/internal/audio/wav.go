@@ -0,0 +1,95 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const wavFormatPCM = 1
+
+// ParseWAV reads a RIFF/WAVE file holding 16-bit PCM and returns its format
+// and the raw sample data. Unknown chunks (LIST, fact, ...) are skipped.
+func ParseWAV(b []byte) (Format, []byte, error) {
+	if len(b) < 12 || string(b[0:4]) != "RIFF" || string(b[8:12]) != "WAVE" {
+		return Format{}, nil, fmt.Errorf("%w: not a RIFF/WAVE file", ErrInvalidFormat)
+	}
+
+	var f Format
+	var haveFmt bool
+	for off := 12; off+8 <= len(b); {
+		id := string(b[off : off+4])
+		size := int(binary.LittleEndian.Uint32(b[off+4 : off+8]))
+		body := b[off+8:]
+		switch {
+		case size <= len(body) && !(id == "data" && size == 0):
+			body = body[:size]
+		case id != "data":
+			return Format{}, nil, fmt.Errorf("%w: truncated %q chunk", ErrInvalidFormat, id)
+		}
+		// streamed recorders leave the data size at 0 or 0xFFFFFFFF; take what is there
+
+		switch id {
+		case "fmt ":
+			if len(body) < 16 {
+				return Format{}, nil, fmt.Errorf("%w: short fmt chunk", ErrInvalidFormat)
+			}
+			tag := binary.LittleEndian.Uint16(body[0:2])
+			channels := int(binary.LittleEndian.Uint16(body[2:4]))
+			rate := int(binary.LittleEndian.Uint32(body[4:8]))
+			bits := binary.LittleEndian.Uint16(body[14:16])
+			if tag == 0xFFFE && len(body) >= 26 {
+				// WAVE_FORMAT_EXTENSIBLE: the real tag is the first two bytes of the sub-format GUID
+				tag = binary.LittleEndian.Uint16(body[24:26])
+			}
+			if tag != wavFormatPCM || bits != 16 {
+				return Format{}, nil, fmt.Errorf("%w: only 16-bit PCM wav is supported", ErrInvalidFormat)
+			}
+			f = Format{Encoding: Linear16, SampleRateHz: rate, Channels: channels}
+			haveFmt = true
+
+		case "data":
+			if !haveFmt {
+				return Format{}, nil, fmt.Errorf("%w: data chunk before fmt chunk", ErrInvalidFormat)
+			}
+			if f.Channels < 1 || f.Channels > 2 || f.SampleRateHz < 8000 || f.SampleRateHz > 48000 {
+				return Format{}, nil, fmt.Errorf("%w: wav must be mono/stereo at 8-48 kHz", ErrInvalidFormat)
+			}
+			frame := 2 * f.Channels
+			return f, body[:len(body)/frame*frame], nil
+		}
+
+		off += 8 + size + size%2 // chunks are word aligned
+	}
+	return Format{}, nil, fmt.Errorf("%w: wav has no data chunk", ErrInvalidFormat)
+}
+
+// EncodeWAV wraps raw linear16 or mu-law samples in a RIFF/WAVE header, for
+// services that want a container rather than bare PCM.
+func EncodeWAV(f Format, data []byte) ([]byte, error) {
+	var tag, bits uint16
+	switch f.Encoding {
+	case Linear16:
+		tag, bits = wavFormatPCM, 16
+	case MuLaw:
+		tag, bits = 7, 8
+	default:
+		return nil, fmt.Errorf("%w: cannot wrap %q in wav", ErrInvalidFormat, f.Encoding)
+	}
+	channels := uint16(max(f.Channels, 1))
+	blockAlign := channels * bits / 8
+
+	out := make([]byte, 44, 44+len(data))
+	copy(out[0:], "RIFF")
+	binary.LittleEndian.PutUint32(out[4:], uint32(36+len(data)))
+	copy(out[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(out[16:], 16)
+	binary.LittleEndian.PutUint16(out[20:], tag)
+	binary.LittleEndian.PutUint16(out[22:], channels)
+	binary.LittleEndian.PutUint32(out[24:], uint32(f.SampleRateHz))
+	binary.LittleEndian.PutUint32(out[28:], uint32(f.SampleRateHz)*uint32(blockAlign))
+	binary.LittleEndian.PutUint16(out[32:], blockAlign)
+	binary.LittleEndian.PutUint16(out[34:], bits)
+	copy(out[36:], "data")
+	binary.LittleEndian.PutUint32(out[40:], uint32(len(data)))
+	return append(out, data...), nil
+}
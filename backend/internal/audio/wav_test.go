@@ -0,0 +1,61 @@
+package audio_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/yoockh/yoospeak/internal/audio"
+)
+
+func TestWAVRoundTrip(t *testing.T) {
+	f := audio.Format{Encoding: audio.Linear16, SampleRateHz: 22050, Channels: 2}
+	pcm := pcm16(1, -1, 2, -2, 300, -300)
+
+	wav, err := audio.EncodeWAV(f, pcm)
+	if err != nil {
+		t.Fatalf("EncodeWAV: %v", err)
+	}
+	got, data, err := audio.ParseWAV(wav)
+	if err != nil {
+		t.Fatalf("ParseWAV: %v", err)
+	}
+	if got != f {
+		t.Errorf("format = %+v, want %+v", got, f)
+	}
+	if string(data) != string(pcm) {
+		t.Errorf("data = %v, want %v", data, pcm)
+	}
+}
+
+func TestParseWAVDropsTrailingPartialFrame(t *testing.T) {
+	f := audio.Format{Encoding: audio.Linear16, SampleRateHz: 16000, Channels: 1}
+	wav, err := audio.EncodeWAV(f, []byte{1, 0, 2, 0, 3})
+	if err != nil {
+		t.Fatalf("EncodeWAV: %v", err)
+	}
+	_, data, err := audio.ParseWAV(wav)
+	if err != nil {
+		t.Fatalf("ParseWAV: %v", err)
+	}
+	if len(data) != 4 {
+		t.Errorf("data is %d bytes, want the 4 of whole frames", len(data))
+	}
+}
+
+func TestParseWAVRejects(t *testing.T) {
+	mulaw, _ := audio.EncodeWAV(audio.Format{Encoding: audio.MuLaw, SampleRateHz: 8000, Channels: 1}, make([]byte, 8))
+	for name, b := range map[string][]byte{
+		"not riff":  []byte("OggS not a wav file"),
+		"mu-law":    mulaw,
+		"truncated": mulaw[:20],
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := audio.ParseWAV(b); !errors.Is(err, audio.ErrInvalidFormat) {
+				t.Errorf("err = %v, want ErrInvalidFormat", err)
+			}
+		})
+	}
+	if _, err := audio.EncodeWAV(audio.Format{Encoding: audio.FLAC, SampleRateHz: 16000, Channels: 1}, nil); err == nil {
+		t.Error("EncodeWAV wrapped flac")
+	}
+}
@@ -0,0 +1,158 @@
+package cvtext
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Format is a supported CV file format, identified from content rather than
+// the file name.
+type Format string
+
+const (
+	FormatPDF      Format = "pdf"
+	FormatDOCX     Format = "docx"
+	FormatText     Format = "txt"
+	FormatMarkdown Format = "md"
+)
+
+var ErrUnsupportedFormat = errors.New("cvtext: unsupported file format (pdf, docx, txt or md)")
+
+// MimeType is the canonical content type stored on CVFile.
+func (f Format) MimeType() string {
+	switch f {
+	case FormatPDF:
+		return "application/pdf"
+	case FormatDOCX:
+		return "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	case FormatMarkdown:
+		return "text/markdown; charset=utf-8"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// Ext is the extension used for stored objects.
+func (f Format) Ext() string { return "." + string(f) }
+
+// FormatFromMime maps a stored CVFile.MimeType back to its format.
+func FormatFromMime(mime string) (Format, bool) {
+	base, _, _ := strings.Cut(mime, ";")
+	switch strings.TrimSpace(base) {
+	case "application/pdf":
+		return FormatPDF, true
+	case FormatDOCX.MimeType():
+		return FormatDOCX, true
+	case "text/markdown":
+		return FormatMarkdown, true
+	case "text/plain":
+		return FormatText, true
+	}
+	return "", false
+}
+
+// Detect identifies the format of a whole file. PDF is recognised by its
+// header, DOCX by a zip whose entries include the WordprocessingML main part,
+// text by decoding cleanly with no binary control bytes. The file name only
+// decides between plain text and Markdown once content says "text".
+func Detect(r io.ReaderAt, size int64, fileName string) (Format, error) {
+	head := make([]byte, 1024)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte("%PDF-")):
+		return FormatPDF, nil
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		if isDOCX(r, size) {
+			return FormatDOCX, nil
+		}
+		return "", ErrUnsupportedFormat
+	}
+
+	if !looksLikeText(r, size) {
+		return "", ErrUnsupportedFormat
+	}
+	if ext := strings.ToLower(fileName); strings.HasSuffix(ext, ".md") || strings.HasSuffix(ext, ".markdown") {
+		return FormatMarkdown, nil
+	}
+	return FormatText, nil
+}
+
+func isDOCX(r io.ReaderAt, size int64) bool {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return false
+	}
+	var contentTypes, document bool
+	for _, f := range zr.File {
+		switch f.Name {
+		case "[Content_Types].xml":
+			contentTypes = true
+		case "word/document.xml":
+			document = true
+		}
+	}
+	return contentTypes && document
+}
+
+// looksLikeText accepts UTF-8 (optionally with a BOM) and UTF-16 with a BOM,
+// rejecting NUL and other C0 control bytes that plain text never contains.
+func looksLikeText(r io.ReaderAt, size int64) bool {
+	if size == 0 {
+		return false
+	}
+	data, err := io.ReadAll(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return false
+	}
+	s, ok := decodeText(data)
+	if !ok {
+		return false
+	}
+	for _, c := range s {
+		if c < 0x20 && c != '\n' && c != '\r' && c != '\t' && c != '\f' {
+			return false
+		}
+	}
+	return strings.TrimSpace(s) != ""
+}
+
+// decodeText returns data as a UTF-8 string, converting UTF-16 (with BOM).
+func decodeText(data []byte) (string, bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		data = data[3:]
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}), bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return decodeUTF16(data)
+	}
+	if !utf8.Valid(data) {
+		return "", false
+	}
+	return string(data), true
+}
+
+func decodeUTF16(data []byte) (string, bool) {
+	little := data[0] == 0xFF
+	data = data[2:]
+	if len(data)%2 != 0 {
+		return "", false
+	}
+	u := make([]uint16, len(data)/2)
+	for i := range u {
+		if little {
+			u[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+		} else {
+			u[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+		}
+	}
+	return string(utf16.Decode(u)), true
+}
@@ -0,0 +1,101 @@
+package cvtext
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		fileName string
+		want     Format
+		wantErr  error
+	}{
+		{"cv.pdf", "resume.txt", FormatPDF, nil},
+		{"cv.docx", "resume.pdf", FormatDOCX, nil},
+		{"cv.txt", "resume.txt", FormatText, nil},
+		{"cv.md", "Resume.MD", FormatMarkdown, nil},
+		{"cv.md", "resume", FormatText, nil},
+		{"cv-utf16le.txt", "resume.txt", FormatText, nil},
+		{"cv-utf16be.txt", "resume.txt", FormatText, nil},
+		{"plain.zip", "resume.docx", "", ErrUnsupportedFormat},
+		{"photo.png", "resume.txt", "", ErrUnsupportedFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture+" as "+tt.fileName, func(t *testing.T) {
+			f, size := openFixture(t, tt.fixture)
+			got, err := Detect(f, size, tt.fileName)
+			if got != tt.want || !errors.Is(err, tt.wantErr) {
+				t.Errorf("Detect = %q, %v; want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLooksLikeText(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"utf-8", []byte("Jane Doe\r\n\tGo\f"), true},
+		{"utf-8 bom", []byte("\xEF\xBB\xBFJane"), true},
+		{"empty", nil, false},
+		{"only whitespace", []byte(" \n\t"), false},
+		{"invalid utf-8", []byte("Jane \xff Doe"), false},
+		{"nul byte", []byte("Jane\x00Doe"), false},
+		{"escape byte", []byte("Jane\x1bDoe"), false},
+		{"utf-16le with nul-free text", []byte{0xFF, 0xFE, 'h', 0, 'i', 0}, true},
+		{"utf-16le hiding a control char", []byte{0xFF, 0xFE, 'h', 0, 0x07, 0}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := looksLikeText(bytes.NewReader(tt.data), int64(len(tt.data))); got != tt.want {
+				t.Errorf("looksLikeText(%q) = %v, want %v", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeUTF16(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		want   string
+		wantOK bool
+	}{
+		{"little endian", []byte{0xFF, 0xFE, 'J', 0, 0xE9, 0}, "Jé", true},
+		{"big endian", []byte{0xFE, 0xFF, 0, 'J', 0, 0xE9}, "Jé", true},
+		{"surrogate pair", []byte{0xFF, 0xFE, 0x3D, 0xD8, 0x00, 0xDE}, "😀", true},
+		{"bom only", []byte{0xFF, 0xFE}, "", true},
+		{"odd length", []byte{0xFF, 0xFE, 'J', 0, 'x'}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := decodeUTF16(tt.data)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("decodeUTF16 = %q, %v; want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestExtractText(t *testing.T) {
+	want := "Jane Doe\nSenior Go Engineer — Jakarta\n"
+	for _, fixture := range []string{"cv.txt", "cv-utf16le.txt", "cv-utf16be.txt"} {
+		t.Run(fixture, func(t *testing.T) {
+			f, size := openFixture(t, fixture)
+			got, err := Extract(FormatText, f, size)
+			if err != nil || got != want {
+				t.Errorf("Extract = %q, %v; want %q", got, err, want)
+			}
+		})
+	}
+
+	f, size := openFixture(t, "photo.png")
+	if _, err := Extract(FormatText, f, size); !errors.Is(err, ErrMalformed) {
+		t.Errorf("binary as text: err = %v, want ErrMalformed", err)
+	}
+}
@@ -0,0 +1,97 @@
+package cvtext
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxDocumentXML bounds the decompressed main part, so a zip bomb costs at most this much.
+const maxDocumentXML = 20 << 20
+
+// ExtractDOCX returns the text of a Word document's body: one line per
+// paragraph, tabs and line breaks preserved. Headers, footers and comments are skipped.
+func ExtractDOCX(r io.ReaderAt, size int64) (string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	var doc *zip.File
+	for _, f := range zr.File {
+		if f.Name == "word/document.xml" {
+			doc = f
+			break
+		}
+	}
+	if doc == nil {
+		return "", fmt.Errorf("%w: word/document.xml missing", ErrMalformed)
+	}
+
+	rc, err := doc.Open()
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	defer rc.Close()
+
+	lr := &io.LimitedReader{R: rc, N: maxDocumentXML + 1}
+	text, err := wordprocessingText(lr)
+	if lr.N <= 0 {
+		return "", fmt.Errorf("%w: document.xml exceeds %d bytes", ErrMalformed, maxDocumentXML)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	return text, nil
+}
+
+// wordprocessingText walks WordprocessingML, keeping w:t runs and turning
+// w:tab, w:br/w:cr and paragraph ends into whitespace.
+func wordprocessingText(r io.Reader) (string, error) {
+	const w = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+
+	dec := xml.NewDecoder(r)
+	var b strings.Builder
+	inText := false
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return b.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space != w {
+				continue
+			}
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				b.WriteByte('\t')
+			case "br", "cr":
+				b.WriteByte('\n')
+			}
+		case xml.EndElement:
+			if t.Name.Space != w {
+				continue
+			}
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				b.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				b.Write(t)
+			}
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package cvtext
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExtractDOCX(t *testing.T) {
+	f, size := openFixture(t, "cv.docx")
+	got, err := ExtractDOCX(f, size)
+	if err != nil {
+		t.Fatalf("ExtractDOCX: %v", err)
+	}
+	if want := "Jane Doe\nGo\tEngineer\nJakarta\n"; got != want {
+		t.Errorf("text = %q, want %q", got, want)
+	}
+}
+
+func TestExtractDOCXRejectsOtherFiles(t *testing.T) {
+	for _, name := range []string{"plain.zip", "cv.pdf"} {
+		t.Run(name, func(t *testing.T) {
+			f, size := openFixture(t, name)
+			if _, err := ExtractDOCX(f, size); !errors.Is(err, ErrMalformed) {
+				t.Errorf("err = %v, want ErrMalformed", err)
+			}
+		})
+	}
+}
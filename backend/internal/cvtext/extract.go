@@ -0,0 +1,27 @@
+package cvtext
+
+import (
+	"fmt"
+	"io"
+)
+
+// Extract returns the raw text of a CV in format f; pass it through Normalize.
+func Extract(f Format, r io.ReaderAt, size int64) (string, error) {
+	switch f {
+	case FormatPDF:
+		return ExtractPDF(r, size)
+	case FormatDOCX:
+		return ExtractDOCX(r, size)
+	case FormatText, FormatMarkdown:
+		data, err := io.ReadAll(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return "", err
+		}
+		s, ok := decodeText(data)
+		if !ok {
+			return "", fmt.Errorf("%w: text is not valid UTF-8 or UTF-16", ErrMalformed)
+		}
+		return s, nil
+	}
+	return "", ErrUnsupportedFormat
+}
@@ -0,0 +1,88 @@
+package cvtext
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxRunes caps the stored CV text. Prompts and embeddings only ever use a
+// fraction of it; the cap guards against pathological documents.
+const MaxRunes = 50000
+
+var replacer = strings.NewReplacer(
+	"\r\n", "\n",
+	"\r", "\n",
+	"\u00ad", "", // soft hyphen
+	"\u00a0", " ", // no-break space
+	"\ufb00", "ff",
+	"\ufb01", "fi",
+	"\ufb02", "fl",
+	"\ufb03", "ffi",
+	"\ufb04", "ffl",
+	"\u2022", "-", // bullet
+	"\u25cf", "-", // black circle
+	"\u25aa", "-", // small square
+	"\uf0b7", "-", // Symbol-font bullet (private use area)
+	"\u2013", "-",
+	"\u2014", "-",
+	"\u2018", "'",
+	"\u2019", "'",
+	"\u201c", "\"",
+	"\u201d", "\"",
+)
+
+// Normalize cleans extracted text for storage in Profile.CVText: unifies line
+// endings, quotes, bullets and ligatures, drops control characters, re-joins words
+// hyphenated across lines, collapses runs of spaces and blank lines, and caps length.
+func Normalize(s string) string {
+	s = strings.ToValidUTF8(s, "")
+	s = replacer.Replace(s)
+
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\t':
+			return r
+		case unicode.IsControl(r), r == utf8.RuneError, unicode.Is(unicode.Co, r):
+			return -1
+		}
+		return r
+	}, s)
+
+	lines := strings.Split(s, "\n")
+	out := make([]string, 0, len(lines))
+	blank := 0
+	for _, l := range lines {
+		l = strings.Join(strings.Fields(l), " ")
+		if l == "" {
+			blank++
+			continue
+		}
+		if n := len(out); n > 0 && blank == 0 && joinsHyphenated(out[n-1], l) {
+			out[n-1] = strings.TrimSuffix(out[n-1], "-") + l
+			continue
+		}
+		if blank > 0 && len(out) > 0 {
+			out = append(out, "")
+		}
+		blank = 0
+		out = append(out, l)
+	}
+
+	s = strings.Join(out, "\n")
+	if utf8.RuneCountInString(s) > MaxRunes {
+		s = string([]rune(s)[:MaxRunes])
+	}
+	return s
+}
+
+// joinsHyphenated reports whether prev ends in a word broken by a hyphen that
+// next continues ("manage-" + "ment ..."), as opposed to a list dash.
+func joinsHyphenated(prev, next string) bool {
+	if len(prev) < 2 || !strings.HasSuffix(prev, "-") {
+		return false
+	}
+	before, _ := utf8.DecodeLastRuneInString(prev[:len(prev)-1])
+	first, _ := utf8.DecodeRuneInString(next)
+	return unicode.IsLetter(before) && unicode.IsLower(first)
+}
@@ -0,0 +1,88 @@
+package cvtext
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// MaxPages bounds how much of a PDF is read; CVs beyond this are almost
+// certainly not CVs and only cost CPU.
+const MaxPages = 30
+
+var (
+	ErrEncrypted = errors.New("cvtext: pdf is password protected")
+	ErrMalformed = errors.New("cvtext: file could not be parsed")
+)
+
+// ExtractPDF returns the text of a PDF, one line per baseline and a blank line
+// between pages. The result is not normalised; pass it through Normalize.
+func ExtractPDF(r io.ReaderAt, size int64) (text string, err error) {
+	// the parser panics on some malformed inputs; treat that as a bad file
+	defer func() {
+		if rec := recover(); rec != nil {
+			text, err = "", fmt.Errorf("%w: %v", ErrMalformed, rec)
+		}
+	}()
+
+	doc, err := pdf.NewReader(r, size)
+	if err != nil {
+		if errors.Is(err, pdf.ErrInvalidPassword) {
+			return "", ErrEncrypted
+		}
+		return "", fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	n := doc.NumPage()
+	if n > MaxPages {
+		n = MaxPages
+	}
+
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		page := doc.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		b.WriteString(pageText(page.Content().Text))
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+// pageText lays out positioned glyph runs in drawing order, which for generated
+// documents is reading order. A change of baseline starts a new line; a forward
+// jump wider than a fraction of the font size becomes a space (PDFs often draw
+// words, or single glyphs, without any space character between them).
+func pageText(runs []pdf.Text) string {
+	var b strings.Builder
+	var prev *pdf.Text
+	for i := range runs {
+		t := &runs[i]
+		if t.S == "" {
+			continue
+		}
+		if prev != nil {
+			tol := math.Max(t.FontSize, prev.FontSize) * 0.5
+			if tol < 1 {
+				tol = 1
+			}
+			switch {
+			case math.Abs(t.Y-prev.Y) > tol:
+				b.WriteByte('\n')
+			case t.X-(prev.X+prev.W) > math.Max(t.FontSize*0.2, 1) && !strings.HasSuffix(prev.S, " ") && !strings.HasPrefix(t.S, " "):
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(t.S)
+		prev = t
+	}
+	if b.Len() > 0 {
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
@@ -0,0 +1,51 @@
+package cvtext
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func openFixture(t *testing.T, name string) (*os.File, int64) {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatalf("open fixture: %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	st, err := f.Stat()
+	if err != nil {
+		t.Fatalf("stat fixture: %v", err)
+	}
+	return f, st.Size()
+}
+
+func TestExtractPDF(t *testing.T) {
+	f, size := openFixture(t, "cv.pdf")
+	text, err := ExtractPDF(f, size)
+	if err != nil {
+		t.Fatalf("ExtractPDF: %v", err)
+	}
+	want := "Jane Doe\nSenior Go Engineer\n\nSkills: Redis, Postgres\n\n"
+	if text != want {
+		t.Errorf("text = %q, want %q", text, want)
+	}
+}
+
+func TestExtractPDFRejectsBrokenFiles(t *testing.T) {
+	for _, name := range []string{
+		"not-a-pdf.pdf",     // a PDF header and nothing else
+		"panics-parser.pdf", // Tm without its operands makes the parser panic
+	} {
+		t.Run(name, func(t *testing.T) {
+			f, size := openFixture(t, name)
+			text, err := ExtractPDF(f, size)
+			if !errors.Is(err, ErrMalformed) {
+				t.Errorf("err = %v, want ErrMalformed", err)
+			}
+			if text != "" {
+				t.Errorf("text = %q, want none", text)
+			}
+		})
+	}
+}
@@ -18,11 +18,46 @@ type RealtimeBuffer struct {
 	STTStatus     string  `bson:"stt_status" json:"stt_status"` // pending|processing|done|failed
 	STTConfidence float64 `bson:"stt_confidence,omitempty" json:"stt_confidence,omitempty"`
 
-	LLMStatus   string `bson:"llm_status" json:"llm_status"` // pending|processing|done|failed
+	LLMStatus   string `bson:"llm_status" json:"llm_status"` // pending|processing|done|failed|aggregated|skipped|late
 	LLMResponse string `bson:"llm_response,omitempty" json:"llm_response,omitempty"`
 
+	// set on the chunk that closed an utterance: the chunk range the LLM answer covers
+	UtteranceStart int64 `bson:"utterance_start,omitempty" json:"utterance_start,omitempty"`
+	UtteranceEnd   int64 `bson:"utterance_end,omitempty" json:"utterance_end,omitempty"`
+
+	// voice activity detection before STT (absent when VAD is off)
+	VAD *VADDecision `bson:"vad,omitempty" json:"vad,omitempty"`
+
+	// what this chunk cost: STT for every transcribed chunk, LLM on the chunk that closed an utterance
+	Usage *ChunkUsage `bson:"usage,omitempty" json:"usage,omitempty"`
+
 	ProcessingTimeMS int64     `bson:"processing_time_ms,omitempty" json:"processing_time_ms,omitempty"`
 	Timestamp        time.Time `bson:"timestamp" json:"timestamp"`
 
 	ExpiresAt time.Time `bson:"expires_at" json:"expires_at"` // for TTL index
 }
+
+type VADDecision struct {
+	Decision       string `bson:"decision" json:"decision"` // speech|silence|skipped (not PCM)
+	SpeechMS       int64  `bson:"speech_ms" json:"speech_ms"`
+	TrimmedMS      int64  `bson:"trimmed_ms" json:"trimmed_ms"`
+	EndOfUtterance bool   `bson:"end_of_utterance,omitempty" json:"end_of_utterance,omitempty"`
+}
+
+type ChunkUsage struct {
+	STT *STTUsage `bson:"stt,omitempty" json:"stt,omitempty"`
+	LLM *LLMUsage `bson:"llm,omitempty" json:"llm,omitempty"`
+}
+
+type STTUsage struct {
+	AudioSeconds float64 `bson:"audio_seconds" json:"audio_seconds"`
+	Estimated    bool    `bson:"estimated,omitempty" json:"estimated,omitempty"` // provider did not report billed time
+	CostMicroUSD int64   `bson:"cost_micro_usd" json:"cost_micro_usd"`
+}
+
+type LLMUsage struct {
+	PromptTokens     int64 `bson:"prompt_tokens" json:"prompt_tokens"`
+	CompletionTokens int64 `bson:"completion_tokens" json:"completion_tokens"`
+	Estimated        bool  `bson:"estimated,omitempty" json:"estimated,omitempty"` // provider did not report token counts
+	CostMicroUSD     int64 `bson:"cost_micro_usd" json:"cost_micro_usd"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/pgvector/pgvector-go"
+)
+
+// CVChunk is one passage of a user's CV text, embedded for retrieval.
+type CVChunk struct {
+	ID         string           `gorm:"column:id;type:uuid;primaryKey" json:"id"`
+	UserID     string           `gorm:"column:user_id;type:uuid;index" json:"user_id"`
+	ChunkIndex int              `gorm:"column:chunk_index;type:integer" json:"chunk_index"`
+	Content    string           `gorm:"column:content;type:text" json:"content"`
+	Embedding  *pgvector.Vector `gorm:"column:embedding;type:vector(768)" json:"embedding,omitempty"`
+	CreatedAt  time.Time        `gorm:"column:created_at;type:timestamptz" json:"created_at"`
+}
+
+func (CVChunk) TableName() string { return "cv_chunks" }
+
+// CVChunkMatch is a CV passage returned by retrieval, with its cosine distance to the query.
+type CVChunkMatch struct {
+	CVChunk
+	Distance float64 `gorm:"column:distance" json:"distance"`
+}
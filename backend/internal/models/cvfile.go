@@ -12,6 +12,19 @@ type CVFile struct {
 	MimeType string `gorm:"column:mime_type;type:text" json:"mime_type"`
 
 	UploadAt time.Time `gorm:"column:upload_at;type:timestamptz" json:"upload_at"`
+
+	// IsActive marks the CV used for coaching (at most one per user)
+	IsActive bool `gorm:"column:is_active;type:boolean" json:"is_active"`
+
+	// Upload scanning: quarantined files are kept for review but never activated, extracted or served
+	ScanStatus string `gorm:"column:scan_status;type:text" json:"scan_status"` // clean|quarantined|unscanned
+	ScanThreat string `gorm:"column:scan_threat;type:text" json:"scan_threat,omitempty"`
+
+	// Text extraction (async, after upload)
+	ExtractionStatus string     `gorm:"column:extraction_status;type:text" json:"extraction_status"` // pending|processing|done|failed
+	ExtractionError  string     `gorm:"column:extraction_error;type:text" json:"extraction_error,omitempty"`
+	ExtractedAt      *time.Time `gorm:"column:extracted_at;type:timestamptz" json:"extracted_at,omitempty"`
+	ExtractedText    string     `gorm:"column:extracted_text;type:text" json:"extracted_text,omitempty"`
 }
 
 func (CVFile) TableName() string { return "cv_files" }
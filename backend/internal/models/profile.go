@@ -13,6 +13,8 @@ type Profile struct {
 	FullName    string `gorm:"column:full_name;type:text" json:"full_name"`
 	PhoneNumber string `gorm:"column:phone_number;type:text" json:"phone_number"`
 	CVText      string `gorm:"column:cv_text;type:text" json:"cv_text"`
+	// CVFileID is the uploaded CV that CVText was extracted from (nil when typed in by the user)
+	CVFileID *string `gorm:"column:cv_file_id;type:uuid" json:"cv_file_id,omitempty"`
 
 	Skills pq.StringArray `gorm:"column:skills;type:text[]" json:"skills"`
 
@@ -21,8 +23,8 @@ type Profile struct {
 	Education   datatypes.JSON `gorm:"column:education;type:jsonb" json:"education"`
 	Preferences datatypes.JSON `gorm:"column:preferences;type:jsonb" json:"preferences"`
 
-	// pgvector
-	CVEmbedding pgvector.Vector `gorm:"column:cv_embedding;type:vector(768)" json:"cv_embedding"`
+	// pgvector (NULL until the CV text is embedded; written only by the embedding job)
+	CVEmbedding *pgvector.Vector `gorm:"column:cv_embedding;type:vector(768)" json:"cv_embedding,omitempty"`
 
 	UpdatedAt time.Time `gorm:"column:updated_at;type:timestamptz" json:"updated_at"`
 }
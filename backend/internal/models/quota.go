@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// QuotaLimits are daily allowances; 0 means unlimited.
+type QuotaLimits struct {
+	AudioMinutesPerDay int64 `json:"audio_minutes_per_day"`
+	SessionsPerDay     int64 `json:"sessions_per_day"`
+	LLMTokensPerDay    int64 `json:"llm_tokens_per_day"`
+}
+
+// QuotaOverride is an admin's per-user change to plan limits. Plan replaces
+// the user's plan when set; each non-nil limit replaces that limit of the plan.
+type QuotaOverride struct {
+	UserID             string    `gorm:"column:user_id;type:uuid;primaryKey" json:"user_id"`
+	Plan               string    `gorm:"column:plan;type:text" json:"plan,omitempty"`
+	AudioMinutesPerDay *int64    `gorm:"column:audio_minutes_per_day;type:bigint" json:"audio_minutes_per_day,omitempty"`
+	SessionsPerDay     *int64    `gorm:"column:sessions_per_day;type:bigint" json:"sessions_per_day,omitempty"`
+	LLMTokensPerDay    *int64    `gorm:"column:llm_tokens_per_day;type:bigint" json:"llm_tokens_per_day,omitempty"`
+	Note               string    `gorm:"column:note;type:text" json:"note,omitempty"`
+	UpdatedBy          string    `gorm:"column:updated_by;type:text" json:"updated_by"`
+	UpdatedAt          time.Time `gorm:"column:updated_at;type:timestamptz" json:"updated_at"`
+}
+
+func (QuotaOverride) TableName() string { return "quota_overrides" }
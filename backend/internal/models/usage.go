@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// UsageRecord is one billable provider call: STT for a chunk, or the LLM
+// answer of an utterance (on the utterance's last chunk). A retried chunk maps
+// to the same (session_id, chunk_index, kind) and is stored once.
+type UsageRecord struct {
+	ID               string    `gorm:"column:id;type:uuid;primaryKey" json:"id"`
+	UserID           string    `gorm:"column:user_id;type:uuid;index" json:"user_id"`
+	SessionID        string    `gorm:"column:session_id;type:uuid" json:"session_id"`
+	ChunkIndex       int64     `gorm:"column:chunk_index;type:bigint" json:"chunk_index"`
+	Kind             string    `gorm:"column:kind;type:text" json:"kind"` // "stt" | "llm"
+	AudioSeconds     float64   `gorm:"column:audio_seconds;type:double precision" json:"audio_seconds"`
+	PromptTokens     int64     `gorm:"column:prompt_tokens;type:bigint" json:"prompt_tokens"`
+	CompletionTokens int64     `gorm:"column:completion_tokens;type:bigint" json:"completion_tokens"`
+	Estimated        bool      `gorm:"column:estimated;type:boolean" json:"estimated"`
+	CostMicroUSD     int64     `gorm:"column:cost_micro_usd;type:bigint" json:"cost_micro_usd"`
+	CreatedAt        time.Time `gorm:"column:created_at;type:timestamptz" json:"created_at"`
+}
+
+func (UsageRecord) TableName() string { return "usage_records" }
+
+const (
+	UsageKindSTT = "stt"
+	UsageKindLLM = "llm"
+)
+
+// UsageTotals sums usage records. Cost is kept in integer micro-dollars;
+// CostUSD is the same amount for display.
+type UsageTotals struct {
+	AudioSeconds     float64 `gorm:"column:audio_seconds" json:"audio_seconds"`
+	PromptTokens     int64   `gorm:"column:prompt_tokens" json:"prompt_tokens"`
+	CompletionTokens int64   `gorm:"column:completion_tokens" json:"completion_tokens"`
+	LLMCalls         int64   `gorm:"column:llm_calls" json:"llm_calls"`
+	CostMicroUSD     int64   `gorm:"column:cost_micro_usd" json:"cost_micro_usd"`
+	CostUSD          float64 `gorm:"-" json:"cost_usd"`
+}
+
+// SessionUsage is the usage of one session.
+type SessionUsage struct {
+	SessionID string `gorm:"column:session_id" json:"session_id"`
+	UsageTotals
+	FirstAt time.Time `gorm:"column:first_at" json:"first_at"`
+	LastAt  time.Time `gorm:"column:last_at" json:"last_at"`
+}
+
+// UsageGroup is one row of an aggregate grouped by user, session, day or kind.
+type UsageGroup struct {
+	Key string `gorm:"column:key" json:"key"`
+	UsageTotals
+	Users    int64 `gorm:"column:users" json:"users"`
+	Sessions int64 `gorm:"column:sessions" json:"sessions"`
+}
@@ -0,0 +1,21 @@
+package embeddings
+
+import "context"
+
+// Dimensions matches the vector(768) columns in Postgres.
+const Dimensions = 768
+
+// Task tells the model how the vector will be used; retrieval models embed
+// queries and documents slightly differently.
+type Task string
+
+const (
+	TaskDocument Task = "RETRIEVAL_DOCUMENT"
+	TaskQuery    Task = "RETRIEVAL_QUERY"
+)
+
+type Provider interface {
+	// Embed returns one vector per input text, in input order.
+	Embed(ctx context.Context, task Task, texts []string) ([][]float32, error)
+	Close() error
+}
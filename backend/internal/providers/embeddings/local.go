@@ -0,0 +1,74 @@
+package embeddings
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Local is a deterministic, dependency-free embedder based on feature hashing
+// of words and word bigrams. Texts sharing vocabulary land close together, which
+// is enough for development and tests; it is not a semantic model.
+type Local struct {
+	dims int
+}
+
+func NewLocal(dims int) *Local {
+	if dims <= 0 {
+		dims = Dimensions
+	}
+	return &Local{dims: dims}
+}
+
+func (l *Local) Close() error { return nil }
+
+func (l *Local) Embed(ctx context.Context, task Task, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, t := range texts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		out[i] = l.embed(t)
+	}
+	return out, nil
+}
+
+func (l *Local) embed(text string) []float32 {
+	vec := make([]float32, l.dims)
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	add := func(feature string, weight float32) {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(feature))
+		sum := h.Sum64()
+		idx := int(sum % uint64(l.dims))
+		if sum>>63 == 1 {
+			weight = -weight
+		}
+		vec[idx] += weight
+	}
+
+	for i, w := range words {
+		add(w, 1)
+		if i > 0 {
+			add(words[i-1]+" "+w, 0.5)
+		}
+	}
+
+	var norm float64
+	for _, x := range vec {
+		norm += float64(x) * float64(x)
+	}
+	if norm > 0 {
+		inv := float32(1 / math.Sqrt(norm))
+		for i := range vec {
+			vec[i] *= inv
+		}
+	}
+	return vec
+}
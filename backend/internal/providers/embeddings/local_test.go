@@ -0,0 +1,77 @@
+package embeddings_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/yoockh/yoospeak/internal/providers/embeddings"
+)
+
+func cosine(a, b []float32) float64 {
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+func TestLocalEmbedIsDeterministicAndNormalised(t *testing.T) {
+	l := embeddings.NewLocal(0)
+	texts := []string{"Go backend engineer, Redis and Postgres", "", "!!!"}
+
+	a, err := l.Embed(context.Background(), embeddings.TaskDocument, texts)
+	if err != nil {
+		t.Fatalf("embed: %v", err)
+	}
+	b, _ := l.Embed(context.Background(), embeddings.TaskQuery, texts)
+
+	if len(a) != len(texts) {
+		t.Fatalf("got %d vectors for %d texts", len(a), len(texts))
+	}
+	for i, v := range a {
+		if len(v) != embeddings.Dimensions {
+			t.Errorf("text %d: %d dims, want %d", i, len(v), embeddings.Dimensions)
+		}
+		for j := range v {
+			if v[j] != b[i][j] {
+				t.Fatalf("text %d: embedding differs between calls", i)
+			}
+		}
+	}
+	if n := cosine(a[0], a[0]); math.Abs(n-1) > 1e-5 {
+		t.Errorf("|v|^2 = %v, want unit length", n)
+	}
+	// no words: the zero vector, not NaNs from normalising it
+	for _, v := range a[1:] {
+		if n := cosine(v, v); n != 0 {
+			t.Errorf("wordless text has norm %v, want 0", n)
+		}
+	}
+}
+
+func TestLocalEmbedRanksSharedVocabularyCloser(t *testing.T) {
+	l := embeddings.NewLocal(256)
+	vecs, err := l.Embed(context.Background(), embeddings.TaskDocument, []string{
+		"Led the Kubernetes migration of our payment services",
+		"kubernetes MIGRATION of payment services",
+		"Fluent in Spanish and Indonesian",
+	})
+	if err != nil {
+		t.Fatalf("embed: %v", err)
+	}
+	if len(vecs[0]) != 256 {
+		t.Errorf("%d dims, want 256", len(vecs[0]))
+	}
+	if near, far := cosine(vecs[0], vecs[1]), cosine(vecs[0], vecs[2]); near <= far {
+		t.Errorf("similar text scored %v, unrelated %v; want similar closer", near, far)
+	}
+}
+
+func TestLocalEmbedStopsOnCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := embeddings.NewLocal(0).Embed(ctx, embeddings.TaskDocument, []string{"a"}); err == nil {
+		t.Error("embed with a cancelled context succeeded")
+	}
+}
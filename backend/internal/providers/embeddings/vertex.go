@@ -0,0 +1,100 @@
+package embeddings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	aiplatform "cloud.google.com/go/aiplatform/apiv1"
+	"cloud.google.com/go/aiplatform/apiv1/aiplatformpb"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// vertexBatchSize stays under the per-request instance limit of the text embedding models.
+const vertexBatchSize = 32
+
+type VertexEmbeddings struct {
+	client   *aiplatform.PredictionClient
+	endpoint string
+}
+
+func NewVertexEmbeddings(ctx context.Context, projectID, location, modelName string) (*VertexEmbeddings, error) {
+	c, err := aiplatform.NewPredictionClient(ctx, option.WithEndpoint(location+"-aiplatform.googleapis.com:443"))
+	if err != nil {
+		return nil, err
+	}
+
+	if modelName == "" {
+		modelName = "text-multilingual-embedding-002"
+	}
+
+	return &VertexEmbeddings{
+		client:   c,
+		endpoint: fmt.Sprintf("projects/%s/locations/%s/publishers/google/models/%s", projectID, location, modelName),
+	}, nil
+}
+
+func (v *VertexEmbeddings) Close() error { return v.client.Close() }
+
+func (v *VertexEmbeddings) Embed(ctx context.Context, task Task, texts []string) ([][]float32, error) {
+	out := make([][]float32, 0, len(texts))
+
+	params, err := structpb.NewStruct(map[string]any{"outputDimensionality": Dimensions})
+	if err != nil {
+		return nil, err
+	}
+
+	for start := 0; start < len(texts); start += vertexBatchSize {
+		end := min(start+vertexBatchSize, len(texts))
+
+		instances := make([]*structpb.Value, 0, end-start)
+		for _, t := range texts[start:end] {
+			inst, err := structpb.NewValue(map[string]any{
+				"content":   t,
+				"task_type": string(task),
+			})
+			if err != nil {
+				return nil, err
+			}
+			instances = append(instances, inst)
+		}
+
+		resp, err := v.client.Predict(ctx, &aiplatformpb.PredictRequest{
+			Endpoint:   v.endpoint,
+			Instances:  instances,
+			Parameters: structpb.NewStructValue(params),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Predictions) != end-start {
+			return nil, fmt.Errorf("vertex embeddings: got %d predictions for %d inputs", len(resp.Predictions), end-start)
+		}
+
+		for _, pred := range resp.Predictions {
+			vec, err := parseVertexEmbedding(pred)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, vec)
+		}
+	}
+
+	return out, nil
+}
+
+// prediction shape: {"embeddings": {"values": [...], "statistics": {...}}}
+func parseVertexEmbedding(pred *structpb.Value) ([]float32, error) {
+	emb := pred.GetStructValue().GetFields()["embeddings"].GetStructValue()
+	values := emb.GetFields()["values"].GetListValue().GetValues()
+	if len(values) == 0 {
+		return nil, errors.New("vertex embeddings: empty embedding in prediction")
+	}
+
+	vec := make([]float32, len(values))
+	for i, x := range values {
+		vec[i] = float32(x.GetNumberValue())
+	}
+	return vec, nil
+}
@@ -0,0 +1,89 @@
+// Package fake is a scriptable llm.Provider for tests.
+package fake
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/yoockh/yoospeak/internal/providers/llm"
+)
+
+var _ llm.Provider = (*Provider)(nil)
+
+// Response is one streamed answer: Chunks are sent ChunkDelay apart, then
+// Usage (if set) on a chunk of its own, then Err (if any) is reported. Err with
+// no Chunks fails before streaming; Err after some Chunks is a mid-stream failure.
+type Response struct {
+	Chunks     []string
+	ChunkDelay time.Duration
+	Usage      *llm.Usage
+	Err        error
+}
+
+// Provider answers Stream calls from Script in order, then with Default;
+// Respond, when set, decides instead.
+type Provider struct {
+	Script  []Response
+	Default Response
+	Respond func(req llm.Request) Response
+
+	mu       sync.Mutex
+	next     int
+	requests []llm.Request
+}
+
+func New(responses ...Response) *Provider {
+	return &Provider{Script: responses}
+}
+
+func (p *Provider) Stream(ctx context.Context, req llm.Request) (<-chan llm.Chunk, <-chan error) {
+	p.mu.Lock()
+	p.requests = append(p.requests, req)
+	var r Response
+	switch {
+	case p.Respond != nil:
+		r = p.Respond(req)
+	case p.next < len(p.Script):
+		r = p.Script[p.next]
+		p.next++
+	default:
+		r = p.Default
+	}
+	p.mu.Unlock()
+
+	out := make(chan llm.Chunk, len(r.Chunks)+1)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(out)
+		defer close(errs)
+		for _, c := range r.Chunks {
+			if r.ChunkDelay > 0 {
+				select {
+				case <-time.After(r.ChunkDelay):
+				case <-ctx.Done():
+					errs <- ctx.Err()
+					return
+				}
+			}
+			out <- llm.Chunk{Text: c}
+		}
+		if r.Usage != nil {
+			u := *r.Usage
+			out <- llm.Chunk{Usage: &u}
+		}
+		if r.Err != nil {
+			errs <- r.Err
+		}
+	}()
+	return out, errs
+}
+
+// Requests returns every request received so far.
+func (p *Provider) Requests() []llm.Request {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]llm.Request(nil), p.requests...)
+}
+
+func (p *Provider) Close() error { return nil }
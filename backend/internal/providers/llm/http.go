@@ -0,0 +1,76 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/yoockh/yoospeak/internal/utils"
+)
+
+// newStreamingClient has no overall timeout (answers stream for as long as the
+// model writes) but gives up on servers that never start responding.
+func newStreamingClient() *http.Client {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.ResponseHeaderTimeout = 60 * time.Second
+	return &http.Client{Transport: t}
+}
+
+// doStream sends req and returns the body of a 2xx response; anything else
+// becomes an *utils.AppError carrying the server's message.
+func doStream(ctx context.Context, client *http.Client, op string, req *http.Request) (io.ReadCloser, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, utils.E(utils.CodeTimeout, op, "llm request timed out", err)
+		}
+		return nil, utils.E(utils.CodeUnavailable, op, "llm service unreachable", err)
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp.Body, nil
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	msg := errorMessage(body)
+	if msg == "" {
+		msg = http.StatusText(resp.StatusCode)
+	}
+	return nil, utils.E(utils.CodeFromHTTPStatus(resp.StatusCode), op, "llm request failed", fmt.Errorf("status %d: %s", resp.StatusCode, msg))
+}
+
+// errorMessage extracts the message from an OpenAI ({"error":{"message"}}) or
+// Ollama ({"error":"..."}) error body.
+func errorMessage(b []byte) string {
+	var e struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(b, &e) != nil || len(e.Error) == 0 {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(e.Error, &s) == nil {
+		return s
+	}
+	var o struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(e.Error, &o) == nil {
+		return o.Message
+	}
+	return string(e.Error)
+}
+
+// emit delivers a chunk unless the caller went away.
+func emit(ctx context.Context, out chan<- Chunk, c Chunk) bool {
+	select {
+	case out <- c:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -1,9 +1,146 @@
 package llm
 
-import "context"
+import (
+	"context"
+	"strings"
+
+	"github.com/yoockh/yoospeak/internal/utils"
+)
+
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+)
+
+type Message struct {
+	Role    Role
+	Content string
+}
+
+// Options tune generation. Zero values keep the provider's defaults.
+type Options struct {
+	Temperature *float32
+	TopP        *float32
+	MaxTokens   int
+	Stop        []string
+}
+
+// Request is one chat turn: System steers the model, Messages is the
+// conversation oldest first and ends with the user message to answer.
+type Request struct {
+	System   string
+	Messages []Message
+	Options  Options
+}
+
+// Usage is the token count a provider reports for one answer.
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// Chunk is one piece of a streamed answer. Providers that report token
+// counts send them on a last chunk with Usage set and, usually, no Text.
+type Chunk struct {
+	Text  string
+	Usage *Usage
+}
 
 type Provider interface {
-	// StreamAnswer returns a stream of text chunks (incremental).
-	StreamAnswer(ctx context.Context, prompt string) (chunks <-chan string, errs <-chan error)
+	// Stream returns a stream of chunks (incremental) answering req.
+	Stream(ctx context.Context, req Request) (chunks <-chan Chunk, errs <-chan error)
 	Close() error
 }
+
+// Prompt wraps a single-string prompt as a one-message request.
+func Prompt(prompt string) Request {
+	return Request{Messages: []Message{{Role: RoleUser, Content: prompt}}}
+}
+
+// Float32 is a helper for the optional Options fields.
+func Float32(v float32) *float32 { return &v }
+
+func (r Request) validate(op string) error {
+	if len(r.Messages) == 0 {
+		return utils.E(utils.CodeInvalidArgument, op, "llm request has no messages", nil)
+	}
+	for _, m := range r.Messages {
+		if m.Role != RoleUser && m.Role != RoleAssistant {
+			return utils.E(utils.CodeInvalidArgument, op, "unknown message role "+string(m.Role), nil)
+		}
+	}
+	if r.Messages[len(r.Messages)-1].Role != RoleUser {
+		return utils.E(utils.CodeInvalidArgument, op, "llm request must end with a user message", nil)
+	}
+	return nil
+}
+
+// Flatten renders req as a single prompt for backends that only take one string.
+func (r Request) Flatten() string {
+	if len(r.Messages) == 1 && r.System == "" {
+		return r.Messages[0].Content
+	}
+	var sections []string
+	if r.System != "" {
+		sections = append(sections, r.System)
+	}
+	for _, m := range r.Messages {
+		label := "User"
+		if m.Role == RoleAssistant {
+			label = "Assistant"
+		}
+		sections = append(sections, label+": "+m.Content)
+	}
+	return strings.Join(sections, "\n\n")
+}
+
+// Prompter is the single-prompt provider interface that predates Request.
+type Prompter interface {
+	StreamAnswer(ctx context.Context, prompt string) (<-chan string, <-chan error)
+	Close() error
+}
+
+// FromPrompter adapts a Prompter to Provider by flattening each request.
+// Options are dropped: a plain prompt has nowhere to carry them.
+func FromPrompter(p Prompter) Provider { return prompterProvider{p} }
+
+type prompterProvider struct{ Prompter }
+
+func (p prompterProvider) Stream(ctx context.Context, req Request) (<-chan Chunk, <-chan error) {
+	texts, errs := p.StreamAnswer(ctx, req.Flatten())
+	out := make(chan Chunk, 32)
+	go func() {
+		defer close(out)
+		for t := range texts {
+			out <- Chunk{Text: t}
+		}
+	}()
+	return out, errs
+}
+
+// textOnly backs the StreamAnswer shims: it forwards the text of each chunk
+// and drops usage.
+func textOnly(chunks <-chan Chunk, errs <-chan error) (<-chan string, <-chan error) {
+	out := make(chan string, 32)
+	go func() {
+		defer close(out)
+		for c := range chunks {
+			if c.Text != "" {
+				out <- c.Text
+			}
+		}
+	}()
+	return out, errs
+}
+
+// failed reports err on a stream that never produced a chunk.
+func failed(err error) (<-chan Chunk, <-chan error) {
+	out := make(chan Chunk)
+	errs := make(chan error, 1)
+	close(out)
+	errs <- err
+	close(errs)
+	return out, errs
+}
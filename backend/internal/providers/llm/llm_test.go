@@ -0,0 +1,44 @@
+package llm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/yoockh/yoospeak/internal/providers/llm"
+)
+
+// echoPrompter is an old-style provider that answers with the prompt it got.
+type echoPrompter struct{}
+
+func (echoPrompter) StreamAnswer(ctx context.Context, prompt string) (<-chan string, <-chan error) {
+	out := make(chan string, 1)
+	errs := make(chan error)
+	out <- prompt
+	close(out)
+	close(errs)
+	return out, errs
+}
+
+func (echoPrompter) Close() error { return nil }
+
+func TestFromPrompterFlattensRequest(t *testing.T) {
+	p := llm.FromPrompter(echoPrompter{})
+
+	got, _, _ := collectStream(p.Stream(context.Background(), llm.Prompt("just this")))
+	if len(got) != 1 || got[0] != "just this" {
+		t.Errorf("single prompt = %q, want it passed through unchanged", got)
+	}
+
+	got, _, _ = collectStream(p.Stream(context.Background(), llm.Request{
+		System: "Be brief.",
+		Messages: []llm.Message{
+			{Role: llm.RoleUser, Content: "hi"},
+			{Role: llm.RoleAssistant, Content: "hello"},
+			{Role: llm.RoleUser, Content: "how was that?"},
+		},
+	}))
+	want := "Be brief.\n\nUser: hi\n\nAssistant: hello\n\nUser: how was that?"
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("flattened = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,150 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/yoockh/yoospeak/internal/utils"
+)
+
+// Ollama streams answers from a local Ollama server's POST /api/chat, which
+// replies with one JSON object per line until an object with "done": true.
+type Ollama struct {
+	BaseURL string // e.g. "http://localhost:11434"
+	Model   string // e.g. "llama3.1"
+	HTTP    *http.Client
+}
+
+func NewOllama(baseURL, model string) *Ollama {
+	if baseURL == "" {
+		baseURL = "http://localhost:11434"
+	}
+	if model == "" {
+		model = "llama3.1"
+	}
+	return &Ollama{BaseURL: strings.TrimRight(baseURL, "/"), Model: model, HTTP: newStreamingClient()}
+}
+
+func (o *Ollama) Close() error { return nil }
+
+type ollamaChatChunk struct {
+	Message struct {
+		Content string `json:"content"`
+	} `json:"message"`
+	Done  bool   `json:"done"`
+	Error string `json:"error"`
+
+	// token counts, on the final ("done") object only
+	PromptEvalCount int `json:"prompt_eval_count"`
+	EvalCount       int `json:"eval_count"`
+}
+
+// StreamAnswer is the single-prompt form of Stream.
+func (o *Ollama) StreamAnswer(ctx context.Context, prompt string) (<-chan string, <-chan error) {
+	return textOnly(o.Stream(ctx, Prompt(prompt)))
+}
+
+func (o *Ollama) Stream(ctx context.Context, r Request) (<-chan Chunk, <-chan error) {
+	const op = "Ollama.Stream"
+	if err := r.validate(op); err != nil {
+		return failed(err)
+	}
+	out := make(chan Chunk, 32)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(out)
+		defer close(errs)
+
+		payload := map[string]any{
+			"model":    o.Model,
+			"stream":   true,
+			"messages": chatMessages(r),
+		}
+		if opts := ollamaOptions(r.Options); len(opts) > 0 {
+			payload["options"] = opts
+		}
+		body, _ := json.Marshal(payload)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.BaseURL+"/api/chat", bytes.NewReader(body))
+		if err != nil {
+			errs <- utils.E(utils.CodeInternal, op, "invalid llm url", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		client := o.HTTP
+		if client == nil {
+			client = newStreamingClient()
+		}
+		rc, err := doStream(ctx, client, op, req)
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer rc.Close()
+
+		if err := readNDJSON(ctx, op, rc, out); err != nil {
+			errs <- err
+		}
+	}()
+
+	return out, errs
+}
+
+// ollamaOptions maps Options onto Ollama's model parameters (max tokens is num_predict).
+func ollamaOptions(o Options) map[string]any {
+	opts := map[string]any{}
+	if o.Temperature != nil {
+		opts["temperature"] = *o.Temperature
+	}
+	if o.TopP != nil {
+		opts["top_p"] = *o.TopP
+	}
+	if o.MaxTokens > 0 {
+		opts["num_predict"] = o.MaxTokens
+	}
+	if len(o.Stop) > 0 {
+		opts["stop"] = o.Stop
+	}
+	return opts
+}
+
+func readNDJSON(ctx context.Context, op string, r io.Reader, out chan<- Chunk) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var chunk ollamaChatChunk
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return utils.E(utils.CodeUnavailable, op, "invalid llm stream chunk", err)
+		}
+		if chunk.Error != "" {
+			return utils.E(utils.CodeUnavailable, op, "llm stream failed: "+chunk.Error, nil)
+		}
+		if chunk.Message.Content != "" && !emit(ctx, out, Chunk{Text: chunk.Message.Content}) {
+			return ctx.Err()
+		}
+		if chunk.Done {
+			if chunk.PromptEvalCount > 0 || chunk.EvalCount > 0 {
+				emit(ctx, out, Chunk{Usage: &Usage{PromptTokens: chunk.PromptEvalCount, CompletionTokens: chunk.EvalCount}})
+			}
+			return nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return utils.E(utils.CodeUnavailable, op, "llm stream interrupted", err)
+	}
+	return utils.E(utils.CodeUnavailable, op, "llm stream ended unexpectedly", io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,131 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yoockh/yoospeak/internal/providers/llm"
+	"github.com/yoockh/yoospeak/internal/utils"
+)
+
+func ndjsonServer(t *testing.T, lines ...string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		var body struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body.Model != "llama-test" || !body.Stream {
+			t.Errorf("unexpected request body %+v", body)
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, l := range lines {
+			_, _ = io.WriteString(w, l+"\n")
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func ollamaChunk(s string) string {
+	b, _ := json.Marshal(map[string]any{
+		"model":      "llama-test",
+		"created_at": "2024-08-01T10:00:00.000000Z",
+		"message":    map[string]string{"role": "assistant", "content": s},
+		"done":       false,
+	})
+	return string(b)
+}
+
+const ollamaDone = `{"model":"llama-test","created_at":"2024-08-01T10:00:01.000000Z","message":{"role":"assistant","content":""},"done_reason":"stop","done":true,"total_duration":123456,"eval_count":5}`
+
+func TestOllamaStreamsMessages(t *testing.T) {
+	srv := ndjsonServer(t, ollamaChunk("Nice "), ollamaChunk("structure."), ollamaDone)
+
+	got, err := collect(llm.NewOllama(srv.URL, "llama-test").StreamAnswer(context.Background(), "x"))
+	if err != nil {
+		t.Fatalf("stream error: %v", err)
+	}
+	if strings.Join(got, "|") != "Nice |structure." {
+		t.Fatalf("chunks = %q", got)
+	}
+}
+
+func TestOllamaMidStreamError(t *testing.T) {
+	srv := ndjsonServer(t, ollamaChunk("Nice "), `{"error":"model runner has unexpectedly stopped"}`)
+
+	got, err := collect(llm.NewOllama(srv.URL, "llama-test").StreamAnswer(context.Background(), "x"))
+	if len(got) != 1 {
+		t.Errorf("chunks = %q", got)
+	}
+	if !utils.IsCode(err, utils.CodeUnavailable) || !strings.Contains(err.Error(), "unexpectedly stopped") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestOllamaTruncatedStream(t *testing.T) {
+	srv := ndjsonServer(t, ollamaChunk("Nice "))
+
+	_, err := collect(llm.NewOllama(srv.URL, "llama-test").StreamAnswer(context.Background(), "x"))
+	if !utils.IsCode(err, utils.CodeUnavailable) {
+		t.Fatalf("err = %v, want a truncated-stream error", err)
+	}
+}
+
+func TestOllamaModelNotFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(w, `{"error":"model \"llama-test\" not found, try pulling it first"}`)
+	}))
+	defer srv.Close()
+
+	_, err := collect(llm.NewOllama(srv.URL, "llama-test").StreamAnswer(context.Background(), "x"))
+	if !utils.IsCode(err, utils.CodeUpstream) || !strings.Contains(err.Error(), "try pulling it first") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestOllamaMapsRequest(t *testing.T) {
+	var body struct {
+		Messages []map[string]string `json:"messages"`
+		Options  map[string]any      `json:"options"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		_, _ = io.WriteString(w, ollamaDone+"\n")
+	}))
+	defer srv.Close()
+
+	req := llm.Request{
+		System:   "Reply in Indonesian.",
+		Messages: []llm.Message{{Role: llm.RoleUser, Content: "halo"}},
+		Options:  llm.Options{Temperature: llm.Float32(0), MaxTokens: 64},
+	}
+	_, usage, err := collectStream(llm.NewOllama(srv.URL, "llama-test").Stream(context.Background(), req))
+	if err != nil {
+		t.Fatalf("stream error: %v", err)
+	}
+	// token counts come from the final object's eval counters
+	if usage == nil || *usage != (llm.Usage{CompletionTokens: 5}) {
+		t.Errorf("usage = %+v", usage)
+	}
+
+	if len(body.Messages) != 2 || body.Messages[0]["role"] != "system" || body.Messages[1]["content"] != "halo" {
+		t.Errorf("messages = %v", body.Messages)
+	}
+	// a zero temperature is still sent; max tokens is Ollama's num_predict
+	if body.Options["temperature"] != float64(0) || body.Options["num_predict"] != float64(64) || len(body.Options) != 2 {
+		t.Errorf("options = %v", body.Options)
+	}
+}
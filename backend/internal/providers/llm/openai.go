@@ -0,0 +1,204 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/yoockh/yoospeak/internal/utils"
+)
+
+// OpenAIChat streams answers from an OpenAI-compatible POST {BaseURL}/chat/completions
+// endpoint (OpenAI, Azure-style gateways, vLLM, llama.cpp server, LM Studio, ...)
+// using server-sent events.
+type OpenAIChat struct {
+	BaseURL string // e.g. "https://api.openai.com/v1"
+	Model   string
+	APIKey  string // optional for self-hosted servers
+	HTTP    *http.Client
+}
+
+func NewOpenAIChat(baseURL, model, apiKey string) *OpenAIChat {
+	if model == "" {
+		model = "gpt-4o-mini"
+	}
+	return &OpenAIChat{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Model:   model,
+		APIKey:  apiKey,
+		HTTP:    newStreamingClient(),
+	}
+}
+
+func (o *OpenAIChat) Close() error { return nil }
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// chatMessages maps a request onto the role/content list shared by the OpenAI
+// and Ollama chat APIs, with the system instruction as the first message.
+func chatMessages(r Request) []chatMessage {
+	msgs := make([]chatMessage, 0, len(r.Messages)+1)
+	if r.System != "" {
+		msgs = append(msgs, chatMessage{Role: "system", Content: r.System})
+	}
+	for _, m := range r.Messages {
+		msgs = append(msgs, chatMessage{Role: string(m.Role), Content: m.Content})
+	}
+	return msgs
+}
+
+type chatCompletionChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// StreamAnswer is the single-prompt form of Stream.
+func (o *OpenAIChat) StreamAnswer(ctx context.Context, prompt string) (<-chan string, <-chan error) {
+	return textOnly(o.Stream(ctx, Prompt(prompt)))
+}
+
+func (o *OpenAIChat) Stream(ctx context.Context, r Request) (<-chan Chunk, <-chan error) {
+	const op = "OpenAIChat.Stream"
+	if err := r.validate(op); err != nil {
+		return failed(err)
+	}
+	out := make(chan Chunk, 32)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(out)
+		defer close(errs)
+
+		payload := map[string]any{
+			"model":    o.Model,
+			"stream":   true,
+			"messages": chatMessages(r),
+			// usage arrives on one extra chunk with no choices, before [DONE]
+			"stream_options": map[string]any{"include_usage": true},
+		}
+		if t := r.Options.Temperature; t != nil {
+			payload["temperature"] = *t
+		}
+		if p := r.Options.TopP; p != nil {
+			payload["top_p"] = *p
+		}
+		if r.Options.MaxTokens > 0 {
+			payload["max_tokens"] = r.Options.MaxTokens
+		}
+		if len(r.Options.Stop) > 0 {
+			payload["stop"] = r.Options.Stop
+		}
+		body, _ := json.Marshal(payload)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.BaseURL+"/chat/completions", bytes.NewReader(body))
+		if err != nil {
+			errs <- utils.E(utils.CodeInternal, op, "invalid llm url", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "text/event-stream")
+		if o.APIKey != "" {
+			req.Header.Set("Authorization", "Bearer "+o.APIKey)
+		}
+
+		client := o.HTTP
+		if client == nil {
+			client = newStreamingClient()
+		}
+		rc, err := doStream(ctx, client, op, req)
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer rc.Close()
+
+		if err := readSSE(ctx, op, rc, out); err != nil {
+			errs <- err
+		}
+	}()
+
+	return out, errs
+}
+
+// readSSE forwards content deltas until "data: [DONE]" (or a finish_reason).
+// A stream that ends before either was cut off and is reported as an error.
+func readSSE(ctx context.Context, op string, r io.Reader, out chan<- Chunk) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+
+	finished := false
+	event := ""
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			event = ""
+			continue
+		case strings.HasPrefix(line, ":"):
+			continue // comment / keep-alive
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			continue
+		case !strings.HasPrefix(line, "data:"):
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			return nil
+		}
+		if event == "error" {
+			msg := errorMessage([]byte(data))
+			if msg == "" {
+				msg = data
+			}
+			return utils.E(utils.CodeUnavailable, op, "llm stream failed: "+msg, nil)
+		}
+
+		var chunk chatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return utils.E(utils.CodeUnavailable, op, "invalid llm stream chunk", err)
+		}
+		if chunk.Error != nil {
+			return utils.E(utils.CodeUnavailable, op, "llm stream failed: "+chunk.Error.Message, nil)
+		}
+		for _, c := range chunk.Choices {
+			if c.Delta.Content != "" && !emit(ctx, out, Chunk{Text: c.Delta.Content}) {
+				return ctx.Err()
+			}
+			if c.FinishReason != nil && *c.FinishReason != "" {
+				finished = true
+			}
+		}
+		if u := chunk.Usage; u != nil && !emit(ctx, out, Chunk{Usage: &Usage{PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens}}) {
+			return ctx.Err()
+		}
+	}
+	if err := sc.Err(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return utils.E(utils.CodeUnavailable, op, "llm stream interrupted", err)
+	}
+	if !finished {
+		return utils.E(utils.CodeUnavailable, op, "llm stream ended unexpectedly", io.ErrUnexpectedEOF)
+	}
+	return nil
+}
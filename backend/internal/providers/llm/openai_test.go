@@ -0,0 +1,230 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yoockh/yoospeak/internal/providers/llm"
+	"github.com/yoockh/yoospeak/internal/utils"
+)
+
+// collect drains a StreamAnswer result the way the audio worker does.
+func collect(chunks <-chan string, errs <-chan error) ([]string, error) {
+	var got []string
+	for c := range chunks {
+		got = append(got, c)
+	}
+	return got, <-errs
+}
+
+// collectStream drains a Stream result, keeping the usage chunk apart from the text.
+func collectStream(chunks <-chan llm.Chunk, errs <-chan error) ([]string, *llm.Usage, error) {
+	var got []string
+	var usage *llm.Usage
+	for c := range chunks {
+		if c.Text != "" {
+			got = append(got, c.Text)
+		}
+		if c.Usage != nil {
+			usage = c.Usage
+		}
+	}
+	return got, usage, <-errs
+}
+
+// sseServer writes each event as its own flushed write, like a real streaming server.
+func sseServer(t *testing.T, check func(r *http.Request), events ...string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if check != nil {
+			check(r)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, e := range events {
+			_, _ = io.WriteString(w, e)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func delta(s string) string {
+	return fmt.Sprintf(`data: {"id":"chatcmpl-1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":%q},"finish_reason":null}]}`+"\n\n", s)
+}
+
+const (
+	roleChunk   = `data: {"id":"chatcmpl-1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}` + "\n\n"
+	finishChunk = `data: {"id":"chatcmpl-1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}` + "\n\n"
+)
+
+func TestOpenAIChatStreamsDeltas(t *testing.T) {
+	srv := sseServer(t, func(r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer sk-test" {
+			t.Errorf("Authorization = %q", got)
+		}
+		var body struct {
+			Model    string `json:"model"`
+			Stream   bool   `json:"stream"`
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("decode body: %v", err)
+		}
+		if body.Model != "gpt-test" || !body.Stream || len(body.Messages) != 1 || body.Messages[0].Content != "hi coach" {
+			t.Errorf("unexpected request body %+v", body)
+		}
+	},
+		": keep-alive\n\n",
+		roleChunk,
+		delta("Good "),
+		delta("answer, "),
+		delta("try STAR."),
+		finishChunk,
+		"data: [DONE]\n\n",
+	)
+
+	chunks, errs := llm.NewOpenAIChat(srv.URL+"/v1", "gpt-test", "sk-test").StreamAnswer(context.Background(), "hi coach")
+	got, err := collect(chunks, errs)
+	if err != nil {
+		t.Fatalf("stream error: %v", err)
+	}
+	if strings.Join(got, "|") != "Good |answer, |try STAR." {
+		t.Fatalf("chunks = %q", got)
+	}
+}
+
+func TestOpenAIChatMidStreamError(t *testing.T) {
+	srv := sseServer(t, nil,
+		delta("Good "),
+		`data: {"error":{"message":"The server had an error while processing your request.","type":"server_error"}}`+"\n\n",
+	)
+
+	got, err := collect(llm.NewOpenAIChat(srv.URL, "m", "").StreamAnswer(context.Background(), "x"))
+	if len(got) != 1 || got[0] != "Good " {
+		t.Errorf("chunks before the error = %q", got)
+	}
+	if !utils.IsCode(err, utils.CodeUnavailable) || !strings.Contains(err.Error(), "server had an error") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestOpenAIChatErrorEvent(t *testing.T) {
+	srv := sseServer(t, nil,
+		delta("Hel"),
+		"event: error\ndata: {\"error\":{\"message\":\"overloaded\"}}\n\n",
+	)
+
+	_, err := collect(llm.NewOpenAIChat(srv.URL, "m", "").StreamAnswer(context.Background(), "x"))
+	if err == nil || !strings.Contains(err.Error(), "overloaded") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestOpenAIChatTruncatedStream(t *testing.T) {
+	srv := sseServer(t, nil, delta("Good "), delta("ans"))
+
+	got, err := collect(llm.NewOpenAIChat(srv.URL, "m", "").StreamAnswer(context.Background(), "x"))
+	if len(got) != 2 {
+		t.Errorf("chunks = %q", got)
+	}
+	if !utils.IsCode(err, utils.CodeUnavailable) {
+		t.Fatalf("err = %v, want a truncated-stream error", err)
+	}
+}
+
+func TestOpenAIChatHTTPErrors(t *testing.T) {
+	cases := []struct {
+		status int
+		code   utils.Code
+	}{
+		{http.StatusUnauthorized, utils.CodeUpstream},
+		{http.StatusForbidden, utils.CodeUpstream},
+		{http.StatusNotFound, utils.CodeUpstream},
+		{http.StatusBadRequest, utils.CodeUpstream},
+		{http.StatusTooManyRequests, utils.CodeUnavailable},
+		{http.StatusInternalServerError, utils.CodeUnavailable},
+	}
+	for _, tc := range cases {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.status)
+			_, _ = io.WriteString(w, `{"error":{"message":"nope","type":"invalid_request_error"}}`)
+		}))
+		_, err := collect(llm.NewOpenAIChat(srv.URL, "m", "").StreamAnswer(context.Background(), "x"))
+		if !utils.IsCode(err, tc.code) || !strings.Contains(err.Error(), "nope") {
+			t.Errorf("status %d: err = %v, want %s", tc.status, err, tc.code)
+		}
+		srv.Close()
+	}
+}
+
+func TestOpenAIChatMapsRequest(t *testing.T) {
+	var body map[string]any
+	srv := sseServer(t, func(r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("decode body: %v", err)
+		}
+	}, delta("ok"), finishChunk,
+		`data: {"id":"chatcmpl-1","object":"chat.completion.chunk","choices":[],"usage":{"prompt_tokens":42,"completion_tokens":7,"total_tokens":49}}`+"\n\n",
+		"data: [DONE]\n\n",
+	)
+
+	req := llm.Request{
+		System: "You are a coach.",
+		Messages: []llm.Message{
+			{Role: llm.RoleUser, Content: "first answer"},
+			{Role: llm.RoleAssistant, Content: "first feedback"},
+			{Role: llm.RoleUser, Content: "second answer"},
+		},
+		Options: llm.Options{Temperature: llm.Float32(0.2), MaxTokens: 256, Stop: []string{"\n\nUser:"}},
+	}
+	got, usage, err := collectStream(llm.NewOpenAIChat(srv.URL, "m", "").Stream(context.Background(), req))
+	if err != nil {
+		t.Fatalf("stream error: %v", err)
+	}
+	if len(got) != 1 || usage == nil || *usage != (llm.Usage{PromptTokens: 42, CompletionTokens: 7}) {
+		t.Errorf("chunks = %q, usage = %+v", got, usage)
+	}
+	if so, _ := body["stream_options"].(map[string]any); so["include_usage"] != true {
+		t.Errorf("stream_options = %v, want include_usage", body["stream_options"])
+	}
+
+	msgs, _ := json.Marshal(body["messages"])
+	want := `[{"content":"You are a coach.","role":"system"},{"content":"first answer","role":"user"},{"content":"first feedback","role":"assistant"},{"content":"second answer","role":"user"}]`
+	if string(msgs) != want {
+		t.Errorf("messages = %s", msgs)
+	}
+	if body["temperature"] != 0.2 || body["max_tokens"] != float64(256) || fmt.Sprint(body["stop"]) != "[\n\nUser:]" {
+		t.Errorf("options = temperature %v, max_tokens %v, stop %q", body["temperature"], body["max_tokens"], body["stop"])
+	}
+	if _, ok := body["top_p"]; ok {
+		t.Errorf("unset top_p was sent")
+	}
+}
+
+func TestOpenAIChatRejectsInvalidRequest(t *testing.T) {
+	srv := sseServer(t, func(r *http.Request) { t.Error("invalid request reached the server") })
+
+	for name, req := range map[string]llm.Request{
+		"no messages":     {System: "s"},
+		"ends with model": {Messages: []llm.Message{{Role: llm.RoleUser, Content: "q"}, {Role: llm.RoleAssistant, Content: "a"}}},
+		"unknown role":    {Messages: []llm.Message{{Role: "system", Content: "q"}}},
+	} {
+		_, _, err := collectStream(llm.NewOpenAIChat(srv.URL, "m", "").Stream(context.Background(), req))
+		if !utils.IsCode(err, utils.CodeInvalidArgument) {
+			t.Errorf("%s: err = %v, want invalid argument", name, err)
+		}
+	}
+}
@@ -8,8 +8,8 @@ import (
 )
 
 type VertexGemini struct {
-	client *vertexgenai.Client
-	model  *vertexgenai.GenerativeModel
+	client    *vertexgenai.Client
+	modelName string
 }
 
 func NewVertexGemini(ctx context.Context, projectID, location, modelName string) (*VertexGemini, error) {
@@ -22,24 +22,70 @@ func NewVertexGemini(ctx context.Context, projectID, location, modelName string)
 		modelName = "gemini-1.5-flash"
 	}
 
-	m := c.GenerativeModel(modelName)
-	return &VertexGemini{client: c, model: m}, nil
+	return &VertexGemini{client: c, modelName: modelName}, nil
 }
 
 func (v *VertexGemini) Close() error { return v.client.Close() }
 
+// StreamAnswer is the single-prompt form of Stream.
 func (v *VertexGemini) StreamAnswer(ctx context.Context, prompt string) (<-chan string, <-chan error) {
-	out := make(chan string, 32)
+	return textOnly(v.Stream(ctx, Prompt(prompt)))
+}
+
+// model builds a GenerativeModel per request: system instruction and
+// generation config live on the model, which is not safe to share across calls.
+func (v *VertexGemini) model(r Request) *vertexgenai.GenerativeModel {
+	m := v.client.GenerativeModel(v.modelName)
+	if r.System != "" {
+		m.SystemInstruction = vertexgenai.NewUserContent(vertexgenai.Text(r.System))
+	}
+	o := r.Options
+	if o.Temperature != nil {
+		m.SetTemperature(*o.Temperature)
+	}
+	if o.TopP != nil {
+		m.SetTopP(*o.TopP)
+	}
+	if o.MaxTokens > 0 {
+		m.SetMaxOutputTokens(int32(o.MaxTokens))
+	}
+	if len(o.Stop) > 0 {
+		m.StopSequences = o.Stop
+	}
+	return m
+}
+
+func (v *VertexGemini) Stream(ctx context.Context, r Request) (<-chan Chunk, <-chan error) {
+	if err := r.validate("VertexGemini.Stream"); err != nil {
+		return failed(err)
+	}
+	out := make(chan Chunk, 32)
 	errs := make(chan error, 1)
 
 	go func() {
 		defer close(out)
 		defer close(errs)
 
-		it := v.model.GenerateContentStream(ctx, vertexgenai.Text(prompt))
+		// earlier messages become chat history; Gemini calls the assistant "model"
+		cs := v.model(r).StartChat()
+		last := len(r.Messages) - 1
+		for _, m := range r.Messages[:last] {
+			role := "user"
+			if m.Role == RoleAssistant {
+				role = "model"
+			}
+			cs.History = append(cs.History, &vertexgenai.Content{Role: role, Parts: []vertexgenai.Part{vertexgenai.Text(m.Content)}})
+		}
+
+		// usage metadata is cumulative; the last response carries the totals
+		var usage *Usage
+		it := cs.SendMessageStream(ctx, vertexgenai.Text(r.Messages[last].Content))
 		for {
 			resp, err := it.Next()
 			if err == iterator.Done {
+				if usage != nil {
+					emit(ctx, out, Chunk{Usage: usage})
+				}
 				return
 			}
 			if err != nil {
@@ -47,13 +93,17 @@ func (v *VertexGemini) StreamAnswer(ctx context.Context, prompt string) (<-chan
 				return
 			}
 
+			if m := resp.UsageMetadata; m != nil {
+				usage = &Usage{PromptTokens: int(m.PromptTokenCount), CompletionTokens: int(m.CandidatesTokenCount)}
+			}
 			for _, cand := range resp.Candidates {
 				if cand.Content == nil {
 					continue
 				}
 				for _, part := range cand.Content.Parts {
-					if t, ok := part.(vertexgenai.Text); ok && string(t) != "" {
-						out <- string(t)
+					if t, ok := part.(vertexgenai.Text); ok && string(t) != "" && !emit(ctx, out, Chunk{Text: string(t)}) {
+						errs <- ctx.Err()
+						return
 					}
 				}
 			}
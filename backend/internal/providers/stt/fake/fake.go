@@ -0,0 +1,89 @@
+// Package fake is a scriptable stt.Provider for tests: no network, no
+// credentials, and the same answers every run.
+package fake
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/yoockh/yoospeak/internal/audio"
+	"github.com/yoockh/yoospeak/internal/providers/stt"
+)
+
+var _ stt.Provider = (*Provider)(nil)
+
+// Response is what one Transcribe call returns, after Latency.
+type Response struct {
+	Text          string
+	Confidence    float64
+	BilledSeconds float64
+	Err           error
+	Latency       time.Duration
+}
+
+// Call records the arguments of one Transcribe call.
+type Call struct {
+	Audio    []byte
+	Format   audio.Format
+	Language string
+}
+
+// Provider answers Transcribe calls from Script in order, then with Default.
+// When Respond is set it decides instead, which keeps concurrent callers
+// deterministic (e.g. answer by audio content rather than call order).
+type Provider struct {
+	Script  []Response
+	Default Response
+	Respond func(c Call) Response
+
+	mu    sync.Mutex
+	next  int
+	calls []Call
+}
+
+// New returns a provider that plays back responses in order.
+func New(responses ...Response) *Provider {
+	return &Provider{Script: responses}
+}
+
+func (p *Provider) Transcribe(ctx context.Context, data []byte, format audio.Format, language string) (stt.Result, error) {
+	c := Call{Audio: append([]byte(nil), data...), Format: format, Language: language}
+
+	p.mu.Lock()
+	p.calls = append(p.calls, c)
+	var r Response
+	switch {
+	case p.Respond != nil:
+		r = p.Respond(c)
+	case p.next < len(p.Script):
+		r = p.Script[p.next]
+		p.next++
+	default:
+		r = p.Default
+	}
+	p.mu.Unlock()
+
+	if r.Latency > 0 {
+		t := time.NewTimer(r.Latency)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return stt.Result{}, ctx.Err()
+		}
+	}
+	if r.Err != nil {
+		return stt.Result{}, r.Err
+	}
+	return stt.Result{Text: r.Text, Confidence: r.Confidence, IsFinal: true, BilledSeconds: r.BilledSeconds}, nil
+}
+
+// Calls returns a copy of every call made so far.
+func (p *Provider) Calls() []Call {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Call(nil), p.calls...)
+}
+
+func (p *Provider) Close() error { return nil }
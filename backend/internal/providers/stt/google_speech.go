@@ -2,16 +2,22 @@ package stt
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 
 	speech "cloud.google.com/go/speech/apiv1"
 	speechpb "cloud.google.com/go/speech/apiv1/speechpb"
+	"github.com/yoockh/yoospeak/internal/audio"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+var _ StreamingProvider = (*GoogleSpeech)(nil)
+
 type GoogleSpeech struct {
 	c *speech.Client
-
-	Encoding     speechpb.RecognitionConfig_AudioEncoding
-	SampleRateHz int32
 }
 
 func NewGoogleSpeech(ctx context.Context) (*GoogleSpeech, error) {
@@ -19,34 +25,51 @@ func NewGoogleSpeech(ctx context.Context) (*GoogleSpeech, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &GoogleSpeech{
-		c:            c,
-		Encoding:     speechpb.RecognitionConfig_LINEAR16,
-		SampleRateHz: 16000,
-	}, nil
+	return &GoogleSpeech{c: c}, nil
 }
 
 func (g *GoogleSpeech) Close() error { return g.c.Close() }
 
-// language example: "en-US", "id-ID"
-func (g *GoogleSpeech) Transcribe(ctx context.Context, audio []byte, language string) (string, float64, error) {
+var googleEncodings = map[audio.Encoding]speechpb.RecognitionConfig_AudioEncoding{
+	audio.Linear16: speechpb.RecognitionConfig_LINEAR16,
+	audio.FLAC:     speechpb.RecognitionConfig_FLAC,
+	audio.MuLaw:    speechpb.RecognitionConfig_MULAW,
+	audio.WebMOpus: speechpb.RecognitionConfig_WEBM_OPUS,
+	audio.OggOpus:  speechpb.RecognitionConfig_OGG_OPUS,
+}
+
+func recognitionConfig(f audio.Format, language string) (*speechpb.RecognitionConfig, error) {
 	if language == "" {
 		language = "en-US"
 	}
+	enc, ok := googleEncodings[f.Encoding]
+	if !ok {
+		return nil, fmt.Errorf("google speech: unsupported encoding %q", f.Encoding)
+	}
+	return &speechpb.RecognitionConfig{
+		Encoding:                   enc,
+		SampleRateHertz:            int32(f.SampleRateHz),
+		AudioChannelCount:          int32(max(f.Channels, 1)),
+		LanguageCode:               language,
+		EnableAutomaticPunctuation: true,
+	}, nil
+}
+
+// language example: "en-US", "id-ID"
+func (g *GoogleSpeech) Transcribe(ctx context.Context, data []byte, format audio.Format, language string) (Result, error) {
+	cfg, err := recognitionConfig(format, language)
+	if err != nil {
+		return Result{}, err
+	}
 
 	resp, err := g.c.Recognize(ctx, &speechpb.RecognizeRequest{
-		Config: &speechpb.RecognitionConfig{
-			Encoding:                   g.Encoding,
-			SampleRateHertz:            g.SampleRateHz,
-			LanguageCode:               language,
-			EnableAutomaticPunctuation: true,
-		},
+		Config: cfg,
 		Audio: &speechpb.RecognitionAudio{
-			AudioSource: &speechpb.RecognitionAudio_Content{Content: audio},
+			AudioSource: &speechpb.RecognitionAudio_Content{Content: data},
 		},
 	})
 	if err != nil {
-		return "", 0, err
+		return Result{}, err
 	}
 
 	var bestText string
@@ -60,5 +83,90 @@ func (g *GoogleSpeech) Transcribe(ctx context.Context, audio []byte, language st
 		}
 	}
 
-	return bestText, bestConf, nil
+	return Result{Text: bestText, Confidence: bestConf, IsFinal: true, BilledSeconds: resp.GetTotalBilledTime().AsDuration().Seconds()}, nil
+}
+
+// OpenStream starts a StreamingRecognize call with interim results enabled.
+// Google closes a stream after ~5 minutes or ~10s without audio, so callers
+// should keep one stream per utterance rather than per session.
+func (g *GoogleSpeech) OpenStream(ctx context.Context, format audio.Format, language string) (Stream, error) {
+	cfg, err := recognitionConfig(format, language)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	sc, err := g.c.StreamingRecognize(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	err = sc.Send(&speechpb.StreamingRecognizeRequest{
+		StreamingRequest: &speechpb.StreamingRecognizeRequest_StreamingConfig{
+			StreamingConfig: &speechpb.StreamingRecognitionConfig{
+				Config:         cfg,
+				InterimResults: true,
+			},
+		},
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &googleStream{sc: sc, cancel: cancel}, nil
+}
+
+type googleStream struct {
+	sc     speechpb.Speech_StreamingRecognizeClient
+	cancel context.CancelFunc
+}
+
+func (s *googleStream) Send(audio []byte) error {
+	return s.sc.Send(&speechpb.StreamingRecognizeRequest{
+		StreamingRequest: &speechpb.StreamingRecognizeRequest_AudioContent{AudioContent: audio},
+	})
+}
+
+func (s *googleStream) CloseSend() error { return s.sc.CloseSend() }
+
+func (s *googleStream) Close() error {
+	s.cancel()
+	return nil
+}
+
+func (s *googleStream) Recv() (Result, error) {
+	for {
+		resp, err := s.sc.Recv()
+		if err != nil {
+			if status.Code(err) == codes.Canceled {
+				return Result{}, io.EOF
+			}
+			return Result{}, err
+		}
+		if e := resp.GetError(); e != nil {
+			return Result{}, errors.New(e.GetMessage())
+		}
+
+		// a final result comes alone; interim responses may split the
+		// hypothesis into a stable head and unstable tail results
+		var parts []string
+		var out Result
+		for _, r := range resp.GetResults() {
+			if len(r.Alternatives) == 0 {
+				continue
+			}
+			alt := r.Alternatives[0]
+			if r.IsFinal {
+				return Result{Text: strings.TrimSpace(alt.Transcript), Confidence: float64(alt.Confidence), IsFinal: true}, nil
+			}
+			if t := strings.TrimSpace(alt.Transcript); t != "" {
+				parts = append(parts, t)
+			}
+		}
+		if len(parts) == 0 {
+			continue // speech events etc.
+		}
+		out.Text = strings.Join(parts, " ")
+		return out, nil
+	}
 }
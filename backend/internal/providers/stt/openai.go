@@ -0,0 +1,191 @@
+package stt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yoockh/yoospeak/internal/audio"
+	"github.com/yoockh/yoospeak/internal/utils"
+)
+
+// OpenAITranscriber calls an OpenAI-compatible POST {BaseURL}/audio/transcriptions
+// endpoint: OpenAI itself, or a self-hosted whisper server (faster-whisper-server,
+// whisper.cpp server, LocalAI, ...). Errors are *utils.AppError.
+type OpenAITranscriber struct {
+	BaseURL string // e.g. "https://api.openai.com/v1" or "http://whisper:8000/v1"
+	Model   string // e.g. "whisper-1", "Systran/faster-whisper-small"
+	APIKey  string // optional for self-hosted servers
+	HTTP    *http.Client
+}
+
+func NewOpenAITranscriber(baseURL, model, apiKey string) *OpenAITranscriber {
+	if model == "" {
+		model = "whisper-1"
+	}
+	return &OpenAITranscriber{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Model:   model,
+		APIKey:  apiKey,
+		HTTP:    &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func (o *OpenAITranscriber) Close() error { return nil }
+
+// transcriptionResponse covers both "json" ({text}) and "verbose_json" (with
+// duration and segments). OpenAI also reports usage for duration-billed models.
+type transcriptionResponse struct {
+	Text     string  `json:"text"`
+	Duration float64 `json:"duration"`
+	Usage    *struct {
+		Type    string  `json:"type"`
+		Seconds float64 `json:"seconds"`
+	} `json:"usage"`
+	Segments []struct {
+		AvgLogprob   float64 `json:"avg_logprob"`
+		NoSpeechProb float64 `json:"no_speech_prob"`
+	} `json:"segments"`
+}
+
+func (o *OpenAITranscriber) Transcribe(ctx context.Context, data []byte, format audio.Format, language string) (Result, error) {
+	const op = "OpenAITranscriber.Transcribe"
+
+	file, name, err := audioFile(format, data)
+	if err != nil {
+		return Result{}, utils.E(utils.CodeInvalidArgument, op, "unsupported audio format", err)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		return Result{}, utils.E(utils.CodeInternal, op, "failed to build request", err)
+	}
+	_, _ = fw.Write(file)
+	_ = mw.WriteField("model", o.Model)
+	_ = mw.WriteField("response_format", "verbose_json")
+	if lang := languageHint(language); lang != "" {
+		_ = mw.WriteField("language", lang)
+	}
+	if err := mw.Close(); err != nil {
+		return Result{}, utils.E(utils.CodeInternal, op, "failed to build request", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.BaseURL+"/audio/transcriptions", &body)
+	if err != nil {
+		return Result{}, utils.E(utils.CodeInternal, op, "invalid transcription url", err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if o.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.APIKey)
+	}
+
+	client := o.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return Result{}, utils.E(utils.CodeTimeout, op, "transcription timed out", err)
+		}
+		return Result{}, utils.E(utils.CodeUnavailable, op, "transcription service unreachable", err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return Result{}, utils.E(utils.CodeUnavailable, op, "failed to read transcription response", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return Result{}, httpError(op, resp.StatusCode, raw)
+	}
+
+	var out transcriptionResponse
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return Result{}, utils.E(utils.CodeUnavailable, op, "invalid transcription response", err)
+	}
+	return Result{Text: strings.TrimSpace(out.Text), Confidence: out.confidence(), IsFinal: true, BilledSeconds: out.billedSeconds()}, nil
+}
+
+// confidence turns whisper's per-segment average log-probability into a 0..1
+// score. Plain "json" responses carry no segments and report 0 (unknown).
+func (r transcriptionResponse) confidence() float64 {
+	if len(r.Segments) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, s := range r.Segments {
+		sum += s.AvgLogprob
+	}
+	return math.Exp(sum / float64(len(r.Segments)))
+}
+
+// billedSeconds prefers the billed usage, then the transcribed duration
+// (self-hosted servers report only that); 0 when the response has neither.
+func (r transcriptionResponse) billedSeconds() float64 {
+	if r.Usage != nil && r.Usage.Type == "duration" {
+		return r.Usage.Seconds
+	}
+	return r.Duration
+}
+
+// audioFile packages a chunk as an uploadable file: bare PCM needs a WAV
+// container, compressed formats already have one.
+func audioFile(f audio.Format, data []byte) ([]byte, string, error) {
+	switch f.Encoding {
+	case audio.Linear16, audio.MuLaw:
+		b, err := audio.EncodeWAV(f, data)
+		return b, "audio.wav", err
+	case audio.FLAC:
+		return data, "audio.flac", nil
+	case audio.WebMOpus:
+		return data, "audio.webm", nil
+	case audio.OggOpus:
+		return data, "audio.ogg", nil
+	}
+	return nil, "", fmt.Errorf("encoding %q", f.Encoding)
+}
+
+// languageHint maps "en-US" style codes to the ISO-639-1 code whisper expects.
+func languageHint(language string) string {
+	lang, _, _ := strings.Cut(strings.TrimSpace(language), "-")
+	return strings.ToLower(lang)
+}
+
+// httpError maps an error response to an AppError, keeping the server's message.
+// Statuses that reject the uploaded audio itself (bad or oversized file,
+// unsupported encoding) are InvalidArgument: sending the same audio again
+// cannot succeed.
+func httpError(op string, status int, body []byte) error {
+	var e struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+		Detail any `json:"detail"` // FastAPI-based servers
+	}
+	msg := http.StatusText(status)
+	if json.Unmarshal(body, &e) == nil {
+		switch {
+		case e.Error.Message != "":
+			msg = e.Error.Message
+		case e.Detail != nil:
+			msg = fmt.Sprint(e.Detail)
+		}
+	}
+	code := utils.CodeFromHTTPStatus(status)
+	switch status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity:
+		code = utils.CodeInvalidArgument
+	}
+	return utils.E(code, op, "transcription request failed", fmt.Errorf("status %d: %s", status, msg))
+}
@@ -0,0 +1,136 @@
+package stt_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yoockh/yoospeak/internal/audio"
+	"github.com/yoockh/yoospeak/internal/providers/stt"
+	"github.com/yoockh/yoospeak/internal/utils"
+)
+
+func TestOpenAITranscriberUploadsMultipart(t *testing.T) {
+	pcm := make([]byte, 3200) // 100ms of 16 kHz mono silence
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/audio/transcriptions" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer sk-test" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("ParseMultipartForm: %v", err)
+		}
+		if got := r.FormValue("model"); got != "whisper-small" {
+			t.Errorf("model = %q", got)
+		}
+		if got := r.FormValue("language"); got != "id" {
+			t.Errorf("language = %q, want id", got)
+		}
+
+		f, fh, err := r.FormFile("file")
+		if err != nil {
+			t.Fatalf("FormFile: %v", err)
+		}
+		b, _ := io.ReadAll(f)
+		if fh.Filename != "audio.wav" {
+			t.Errorf("filename = %q", fh.Filename)
+		}
+		format, data, err := audio.ParseWAV(b)
+		if err != nil || format.SampleRateHz != 16000 || format.Channels != 1 || len(data) != len(pcm) {
+			t.Errorf("uploaded wav: format %+v, %d data bytes, err %v", format, len(data), err)
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"text":     " halo, apa kabar ",
+			"duration": 0.1,
+			"segments": []map[string]any{{"avg_logprob": -0.1}, {"avg_logprob": -0.3}},
+		})
+	}))
+	defer srv.Close()
+
+	p := stt.NewOpenAITranscriber(srv.URL+"/v1/", "whisper-small", "sk-test")
+	res, err := p.Transcribe(context.Background(), pcm, audio.Default, "id-ID")
+	if err != nil {
+		t.Fatalf("Transcribe: %v", err)
+	}
+	if res.Text != "halo, apa kabar" {
+		t.Errorf("text = %q", res.Text)
+	}
+	if want := math.Exp(-0.2); math.Abs(res.Confidence-want) > 1e-9 {
+		t.Errorf("confidence = %v, want %v", res.Confidence, want)
+	}
+	if res.BilledSeconds != 0.1 {
+		t.Errorf("billed seconds = %v, want the reported duration", res.BilledSeconds)
+	}
+}
+
+func TestOpenAITranscriberPrefersBilledUsage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"text":"hi","duration":0.1,"usage":{"type":"duration","seconds":1}}`)
+	}))
+	defer srv.Close()
+
+	res, err := stt.NewOpenAITranscriber(srv.URL, "", "").Transcribe(context.Background(), make([]byte, 3200), audio.Default, "en-US")
+	if err != nil {
+		t.Fatalf("Transcribe: %v", err)
+	}
+	if res.BilledSeconds != 1 {
+		t.Errorf("billed seconds = %v, want usage.seconds", res.BilledSeconds)
+	}
+}
+
+func TestOpenAITranscriberErrorMapping(t *testing.T) {
+	cases := []struct {
+		status int
+		body   string
+		code   utils.Code
+	}{
+		{http.StatusBadRequest, `{"error":{"message":"Invalid file format."}}`, utils.CodeInvalidArgument},
+		{http.StatusRequestEntityTooLarge, `{}`, utils.CodeInvalidArgument},
+		{http.StatusUnsupportedMediaType, `{}`, utils.CodeInvalidArgument},
+		{http.StatusUnprocessableEntity, `{"detail":"bad language"}`, utils.CodeInvalidArgument},
+		{http.StatusUnauthorized, `{"error":{"message":"Incorrect API key"}}`, utils.CodeUpstream},
+		{http.StatusForbidden, `{}`, utils.CodeUpstream},
+		{http.StatusNotFound, `{"detail":"Model not found"}`, utils.CodeUpstream},
+		{http.StatusTooManyRequests, `{}`, utils.CodeUnavailable},
+		{http.StatusBadGateway, `upstream down`, utils.CodeUnavailable},
+		{http.StatusGatewayTimeout, ``, utils.CodeTimeout},
+	}
+
+	for _, tc := range cases {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.status)
+			_, _ = io.WriteString(w, tc.body)
+		}))
+
+		_, err := stt.NewOpenAITranscriber(srv.URL, "", "").Transcribe(context.Background(), make([]byte, 320), audio.Default, "en-US")
+		if !utils.IsCode(err, tc.code) {
+			t.Errorf("status %d: err = %v, want code %s", tc.status, err, tc.code)
+		}
+		srv.Close()
+	}
+}
+
+func TestOpenAITranscriberUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	_, err := stt.NewOpenAITranscriber(srv.URL, "", "").Transcribe(context.Background(), make([]byte, 320), audio.Default, "en-US")
+	if !utils.IsCode(err, utils.CodeUnavailable) {
+		t.Fatalf("err = %v, want UNAVAILABLE", err)
+	}
+}
+
+func TestOpenAITranscriberRejectsUnknownEncoding(t *testing.T) {
+	_, err := stt.NewOpenAITranscriber("http://unused", "", "").Transcribe(context.Background(), []byte("x"), audio.Format{Encoding: "mp3"}, "en")
+	if !utils.IsCode(err, utils.CodeInvalidArgument) {
+		t.Fatalf("err = %v, want INVALID_ARGUMENT", err)
+	}
+}
@@ -1,8 +1,47 @@
 package stt
 
-import "context"
+import (
+	"context"
 
+	"github.com/yoockh/yoospeak/internal/audio"
+)
+
+// Provider recognises a chunk of audio. format describes data as it is passed
+// in (already prepared by audio.Prepare), so providers need no format settings of their own.
 type Provider interface {
-	Transcribe(ctx context.Context, audio []byte, language string) (text string, confidence float64, err error)
+	// Transcribe returns a final Result for data.
+	Transcribe(ctx context.Context, data []byte, format audio.Format, language string) (Result, error)
 	Close() error
 }
+
+// Result is one recognition result. Interim results from a stream (IsFinal
+// false) are revised by later ones; a final result is never revised.
+type Result struct {
+	Text       string
+	Confidence float64
+	IsFinal    bool
+
+	// BilledSeconds is the audio the provider charged for Transcribe, when it
+	// says so (0 = unknown).
+	BilledSeconds float64
+}
+
+// Stream recognises one continuous stretch of audio (an utterance). Send and
+// Recv may be called from different goroutines.
+type Stream interface {
+	Send(audio []byte) error
+	// Recv blocks for the next result and returns io.EOF once CloseSend was
+	// called and every result has been delivered.
+	Recv() (Result, error)
+	// CloseSend signals the end of audio; pending finals still arrive via Recv.
+	CloseSend() error
+	// Close aborts the stream.
+	Close() error
+}
+
+// StreamingProvider is implemented by providers that can recognise audio as
+// it arrives instead of one chunk at a time.
+type StreamingProvider interface {
+	Provider
+	OpenStream(ctx context.Context, format audio.Format, language string) (Stream, error)
+}
@@ -14,7 +14,11 @@ type BufferRepository interface {
 	InsertChunk(ctx context.Context, b *models.RealtimeBuffer) error
 	UpdateSTT(ctx context.Context, sessionID string, chunkIndex int64, rawText string, confidence float64, status string) error
 	UpdateLLM(ctx context.Context, sessionID string, chunkIndex int64, response string, status string, processingMS int64) error
+	UpdateUtterance(ctx context.Context, sessionID string, chunkIndex int64, start, end int64) error
+	UpdateVAD(ctx context.Context, sessionID string, chunkIndex int64, v models.VADDecision) error
+	UpdateUsage(ctx context.Context, sessionID string, chunkIndex int64, u models.ChunkUsage) error
 	ListBySession(ctx context.Context, sessionID string, limit int64) ([]models.RealtimeBuffer, error)
+	ListTranscriptsBefore(ctx context.Context, sessionID string, beforeChunk int64, limit int64) ([]models.RealtimeBuffer, error)
 }
 
 type bufferRepo struct {
@@ -57,6 +61,45 @@ func (r *bufferRepo) UpdateLLM(ctx context.Context, sessionID string, chunkIndex
 	return err
 }
 
+func (r *bufferRepo) UpdateUtterance(ctx context.Context, sessionID string, chunkIndex int64, start, end int64) error {
+	_, err := r.col.UpdateOne(ctx,
+		bson.M{"session_id": sessionID, "chunk_index": chunkIndex},
+		bson.M{"$set": bson.M{
+			"utterance_start": start,
+			"utterance_end":   end,
+		}},
+	)
+	return err
+}
+
+func (r *bufferRepo) UpdateVAD(ctx context.Context, sessionID string, chunkIndex int64, v models.VADDecision) error {
+	_, err := r.col.UpdateOne(ctx,
+		bson.M{"session_id": sessionID, "chunk_index": chunkIndex},
+		bson.M{"$set": bson.M{"vad": v}},
+	)
+	return err
+}
+
+// UpdateUsage sets usage.stt and/or usage.llm; the STT and LLM parts of a
+// chunk are recorded at different times and must not overwrite each other.
+func (r *bufferRepo) UpdateUsage(ctx context.Context, sessionID string, chunkIndex int64, u models.ChunkUsage) error {
+	set := bson.M{}
+	if u.STT != nil {
+		set["usage.stt"] = u.STT
+	}
+	if u.LLM != nil {
+		set["usage.llm"] = u.LLM
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	_, err := r.col.UpdateOne(ctx,
+		bson.M{"session_id": sessionID, "chunk_index": chunkIndex},
+		bson.M{"$set": set},
+	)
+	return err
+}
+
 func (r *bufferRepo) ListBySession(ctx context.Context, sessionID string, limit int64) ([]models.RealtimeBuffer, error) {
 	if limit <= 0 {
 		limit = 200
@@ -79,3 +122,29 @@ func (r *bufferRepo) ListBySession(ctx context.Context, sessionID string, limit
 	}
 	return out, nil
 }
+
+// ListTranscriptsBefore returns the newest chunks below beforeChunk (newest first),
+// without the audio payload.
+func (r *bufferRepo) ListTranscriptsBefore(ctx context.Context, sessionID string, beforeChunk int64, limit int64) ([]models.RealtimeBuffer, error) {
+	if limit <= 0 {
+		limit = 200
+	}
+
+	cur, err := r.col.Find(ctx,
+		bson.M{"session_id": sessionID, "chunk_index": bson.M{"$lt": beforeChunk}},
+		options.Find().
+			SetSort(bson.D{{Key: "chunk_index", Value: -1}}).
+			SetLimit(limit).
+			SetProjection(bson.M{"audio_base64": 0, "audio_url": 0}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.RealtimeBuffer
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
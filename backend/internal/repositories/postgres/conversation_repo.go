@@ -3,17 +3,35 @@ package postgres
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
+	"github.com/pgvector/pgvector-go"
 	"github.com/yoockh/yoospeak/internal/models"
 	"github.com/yoockh/yoospeak/internal/utils"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ConversationRepo interface {
 	Insert(ctx context.Context, log *models.ConversationLog) error
+	InsertIfAbsent(ctx context.Context, log *models.ConversationLog) (inserted bool, err error)
 	ListBySession(ctx context.Context, userID, sessionID string, limit int) ([]models.ConversationLog, error)
 	LatestN(ctx context.Context, userID string, n int) ([]models.ConversationLog, error)
 	GetByID(ctx context.Context, id string) (*models.ConversationLog, error)
+	UpdateEmbedding(ctx context.Context, id string, vec pgvector.Vector) error
+	SearchSimilar(ctx context.Context, f ConversationSearchFilter, query pgvector.Vector) ([]models.ConversationMatch, error)
+}
+
+// ConversationSearchFilter scopes a nearest-neighbour search. UserID is mandatory;
+// the rest narrow the candidate set.
+type ConversationSearchFilter struct {
+	UserID    string
+	SessionID string
+	Role      string
+	From      *time.Time
+	To        *time.Time
+	Limit     int
 }
 
 type conversationRepo struct {
@@ -28,6 +46,17 @@ func (r *conversationRepo) Insert(ctx context.Context, log *models.ConversationL
 	return r.db.WithContext(ctx).Create(log).Error
 }
 
+// InsertIfAbsent inserts log unless a row with the same id already exists.
+func (r *conversationRepo) InsertIfAbsent(ctx context.Context, log *models.ConversationLog) (bool, error) {
+	res := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoNothing: true,
+		}).
+		Create(log)
+	return res.RowsAffected > 0, res.Error
+}
+
 func (r *conversationRepo) ListBySession(ctx context.Context, userID, sessionID string, limit int) ([]models.ConversationLog, error) {
 	if limit <= 0 {
 		limit = 50
@@ -63,3 +92,77 @@ func (r *conversationRepo) GetByID(ctx context.Context, id string) (*models.Conv
 	}
 	return &row, err
 }
+
+func (r *conversationRepo) UpdateEmbedding(ctx context.Context, id string, vec pgvector.Vector) error {
+	return r.db.WithContext(ctx).
+		Model(&models.ConversationLog{}).
+		Where("id = ?", id).
+		Update("embedding", vec).Error
+}
+
+// annMaxScanTuples bounds how many index tuples an iterative HNSW scan visits
+// looking for rows that pass the filter before it gives up.
+const annMaxScanTuples = 20000
+
+// SearchSimilar returns the caller's logs closest to query by cosine distance.
+func (r *conversationRepo) SearchSimilar(ctx context.Context, f ConversationSearchFilter, query pgvector.Vector) ([]models.ConversationMatch, error) {
+	if f.Limit <= 0 {
+		f.Limit = 10
+	}
+
+	var rows []models.ConversationMatch
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// The HNSW index is global, so the user/session/role/date filter is
+		// applied after the index scan. Iterative scanning keeps walking the
+		// graph until enough rows pass the filter (pgvector >= 0.8).
+		for _, stmt := range []string{
+			"SET LOCAL hnsw.ef_search = 100",
+			"SET LOCAL hnsw.iterative_scan = relaxed_order",
+			fmt.Sprintf("SET LOCAL hnsw.max_scan_tuples = %d", annMaxScanTuples),
+		} {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+
+		ann := searchScope(tx, f, query).
+			Order(clause.OrderBy{Expression: clause.Expr{SQL: "embedding <=> ?", Vars: []any{query}}}).
+			Limit(f.Limit)
+		// relaxed_order may return neighbours slightly out of order
+		if err := tx.Table("(?) AS ann", ann).Order("distance").Scan(&rows).Error; err != nil {
+			return err
+		}
+		if len(rows) == f.Limit {
+			return nil
+		}
+
+		// Short: the caller has fewer matching rows than asked for, or theirs
+		// sit beyond max_scan_tuples. Rank all of them exactly; MATERIALIZED
+		// keeps the planner off the ANN index.
+		rows = nil
+		return tx.Raw("WITH mine AS MATERIALIZED (?) SELECT * FROM mine ORDER BY distance LIMIT ?",
+			searchScope(tx, f, query), f.Limit).
+			Scan(&rows).Error
+	})
+	return rows, err
+}
+
+// searchScope selects the caller's embedded logs matching f with their distance to query.
+func searchScope(tx *gorm.DB, f ConversationSearchFilter, query pgvector.Vector) *gorm.DB {
+	q := tx.Model(&models.ConversationLog{}).
+		Select("id, user_id, session_id, role, content, timestamp, metadata, embedding <=> ? AS distance", query).
+		Where("user_id = ? AND embedding IS NOT NULL", f.UserID)
+	if f.SessionID != "" {
+		q = q.Where("session_id = ?", f.SessionID)
+	}
+	if f.Role != "" {
+		q = q.Where("role = ?", f.Role)
+	}
+	if f.From != nil {
+		q = q.Where("timestamp >= ?", *f.From)
+	}
+	if f.To != nil {
+		q = q.Where("timestamp < ?", *f.To)
+	}
+	return q
+}
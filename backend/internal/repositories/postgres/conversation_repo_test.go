@@ -0,0 +1,66 @@
+package postgres_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pgvector/pgvector-go"
+	"github.com/yoockh/yoospeak/internal/models"
+	pgrepo "github.com/yoockh/yoospeak/internal/repositories/postgres"
+)
+
+func TestConversationSearchSimilarFindsRowsFarFromTheGlobalTopK(t *testing.T) {
+	db := openTestDB(t)
+	repo := pgrepo.NewConversationRepo(db)
+	ctx := context.Background()
+
+	alice, bob := uuid.NewString(), uuid.NewString()
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM conversation_logs WHERE user_id IN (?, ?)", alice, bob)
+	})
+
+	seed := func(userID, role, content string, v *pgvector.Vector) {
+		t.Helper()
+		log := &models.ConversationLog{ID: uuid.NewString(), UserID: userID, SessionID: userID, Role: role, Content: content, Embedding: v, Timestamp: time.Now()}
+		if err := repo.Insert(ctx, log); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	// bob's logs crowd the query's neighbourhood, well past ef_search; alice's sit far from it
+	for i := 0; i < 500; i++ {
+		seed(bob, "user", fmt.Sprintf("bob-%d", i), axis(0, float32(i)/10000))
+	}
+	seed(alice, "user", "alice-near", axis(0, 2))
+	seed(alice, "assistant", "alice-mid", axis(0, 4))
+	seed(alice, "user", "alice-far", axis(1, 0))
+
+	query := *axis(0, 0)
+	for _, tt := range []struct {
+		name string
+		f    pgrepo.ConversationSearchFilter
+		want []string
+	}{
+		{"top k", pgrepo.ConversationSearchFilter{UserID: alice, Limit: 2}, []string{"alice-near", "alice-mid"}},
+		{"fewer rows than k", pgrepo.ConversationSearchFilter{UserID: alice, Limit: 10}, []string{"alice-near", "alice-mid", "alice-far"}},
+		{"role filter", pgrepo.ConversationSearchFilter{UserID: alice, Role: "user", Limit: 2}, []string{"alice-near", "alice-far"}},
+		{"crowded user", pgrepo.ConversationSearchFilter{UserID: bob, Limit: 2}, []string{"bob-0", "bob-1"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := repo.SearchSimilar(ctx, tt.f, query)
+			if err != nil {
+				t.Fatalf("search: %v", err)
+			}
+			if len(rows) != len(tt.want) {
+				t.Fatalf("%d rows, want %d", len(rows), len(tt.want))
+			}
+			for i, r := range rows {
+				if r.UserID != tt.f.UserID || r.Content != tt.want[i] {
+					t.Errorf("row %d = %q of %s, want %q", i, r.Content, r.UserID, tt.want[i])
+				}
+			}
+		})
+	}
+}
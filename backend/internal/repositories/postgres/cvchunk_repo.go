@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/pgvector/pgvector-go"
+	"github.com/yoockh/yoospeak/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CVChunkRepository interface {
+	// ReplaceForUser swaps the user's chunks for chunks in one transaction.
+	ReplaceForUser(ctx context.Context, userID string, chunks []models.CVChunk) error
+	DeleteByUser(ctx context.Context, userID string) error
+	SearchSimilar(ctx context.Context, userID string, query pgvector.Vector, k int) ([]models.CVChunkMatch, error)
+}
+
+type cvChunkRepo struct {
+	db *gorm.DB
+}
+
+func NewCVChunkRepo(db *gorm.DB) CVChunkRepository {
+	return &cvChunkRepo{db: db}
+}
+
+func (r *cvChunkRepo) ReplaceForUser(ctx context.Context, userID string, chunks []models.CVChunk) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.CVChunk{}).Error; err != nil {
+			return err
+		}
+		if len(chunks) == 0 {
+			return nil
+		}
+		return tx.Create(&chunks).Error
+	})
+}
+
+func (r *cvChunkRepo) DeleteByUser(ctx context.Context, userID string) error {
+	return r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Delete(&models.CVChunk{}).Error
+}
+
+// SearchSimilar returns the user's k CV chunks closest to query by cosine
+// distance. It is an exact scan over the user's rows (cv_chunks_user index);
+// there is no ANN index on cv_chunks to return fewer than k rows.
+func (r *cvChunkRepo) SearchSimilar(ctx context.Context, userID string, query pgvector.Vector, k int) ([]models.CVChunkMatch, error) {
+	if k <= 0 {
+		k = 4
+	}
+
+	var rows []models.CVChunkMatch
+	err := r.db.WithContext(ctx).
+		Model(&models.CVChunk{}).
+		Select("id, user_id, chunk_index, content, created_at, embedding <=> ? AS distance", query).
+		Where("user_id = ? AND embedding IS NOT NULL", userID).
+		Order(clause.OrderBy{Expression: clause.Expr{SQL: "embedding <=> ?", Vars: []any{query}}}).
+		Limit(k).
+		Scan(&rows).Error
+	return rows, err
+}
@@ -0,0 +1,117 @@
+package postgres_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pgvector/pgvector-go"
+	"github.com/yoockh/yoospeak/internal/models"
+	pgrepo "github.com/yoockh/yoospeak/internal/repositories/postgres"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Runs against a Postgres with pgvector, e.g.
+//
+//	docker run -e POSTGRES_PASSWORD=pg -p 5432:5432 pgvector/pgvector:pg16
+//	POSTGRES_TEST_URI=postgres://postgres:pg@localhost:5432/postgres go test ./internal/repositories/postgres
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	uri := os.Getenv("POSTGRES_TEST_URI")
+	if uri == "" {
+		t.Skip("POSTGRES_TEST_URI not set")
+	}
+	db, err := gorm.Open(postgres.Open(uri), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for _, stmt := range []string{
+		`CREATE EXTENSION IF NOT EXISTS vector`,
+		`CREATE TABLE IF NOT EXISTS cv_chunks (
+			id          uuid PRIMARY KEY,
+			user_id     uuid NOT NULL,
+			chunk_index integer NOT NULL,
+			content     text NOT NULL,
+			embedding   vector(768),
+			created_at  timestamptz NOT NULL DEFAULT now(),
+			UNIQUE (user_id, chunk_index)
+		)`,
+		`CREATE TABLE IF NOT EXISTS conversation_logs (
+			id         uuid PRIMARY KEY,
+			user_id    uuid,
+			session_id uuid,
+			role       text,
+			content    text,
+			embedding  vector(768),
+			timestamp  timestamptz,
+			metadata   jsonb
+		)`,
+		`CREATE INDEX IF NOT EXISTS conversation_logs_embedding_hnsw
+			ON conversation_logs USING hnsw (embedding vector_cosine_ops)`,
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+	return db
+}
+
+// axis is a unit vector along dimension i (cosine distance 0 to itself, 1 to other axes).
+func axis(i int, tilt float32) *pgvector.Vector {
+	v := make([]float32, 768)
+	v[i] = 1
+	v[767] = tilt
+	vec := pgvector.NewVector(v)
+	return &vec
+}
+
+func TestCVChunkSearchSimilarKeepsEachUserToTheirOwnTopK(t *testing.T) {
+	db := openTestDB(t)
+	repo := pgrepo.NewCVChunkRepo(db)
+	ctx := context.Background()
+
+	alice, bob := uuid.NewString(), uuid.NewString()
+	t.Cleanup(func() {
+		_ = repo.DeleteByUser(ctx, alice)
+		_ = repo.DeleteByUser(ctx, bob)
+	})
+
+	seed := func(userID string, vecs ...*pgvector.Vector) {
+		t.Helper()
+		chunks := make([]models.CVChunk, len(vecs))
+		for i, v := range vecs {
+			chunks[i] = models.CVChunk{ID: uuid.NewString(), UserID: userID, ChunkIndex: i, Content: userID[:8] + "-" + string(rune('a'+i)), Embedding: v, CreatedAt: time.Now()}
+		}
+		if err := repo.ReplaceForUser(ctx, userID, chunks); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	// bob's chunks all sit right on the query; alice's are progressively further
+	seed(bob, axis(0, 0), axis(0, 0.01), axis(0, 0.02))
+	seed(alice, axis(0, 0.5), axis(1, 0), axis(0, 1), axis(2, 0))
+
+	query := *axis(0, 0)
+	for _, tt := range []struct {
+		user string
+		want []int
+	}{
+		{alice, []int{0, 2}},
+		{bob, []int{0, 1}},
+	} {
+		rows, err := repo.SearchSimilar(ctx, tt.user, query, 2)
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+		if len(rows) != len(tt.want) {
+			t.Fatalf("user %s: %d rows, want %d", tt.user, len(rows), len(tt.want))
+		}
+		for i, r := range rows {
+			if r.UserID != tt.user || r.ChunkIndex != tt.want[i] {
+				t.Errorf("user %s: row %d = chunk %d of %s, want chunk %d", tt.user, i, r.ChunkIndex, r.UserID, tt.want[i])
+			}
+		}
+	}
+}
@@ -2,14 +2,27 @@ package postgres
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/yoockh/yoospeak/internal/models"
+	"github.com/yoockh/yoospeak/internal/utils"
 	"gorm.io/gorm"
 )
 
 type CVFileRepository interface {
 	Insert(ctx context.Context, f *models.CVFile) error
 	LatestByUser(ctx context.Context, userID string) (*models.CVFile, error)
+	GetByID(ctx context.Context, id string) (*models.CVFile, error)
+	// UpdateExtraction records the extraction outcome; extractedAt is set only on success.
+	UpdateExtraction(ctx context.Context, id, status, errMsg string, extractedAt *time.Time) error
+	// CompleteExtraction stores the extracted text and marks the row done.
+	CompleteExtraction(ctx context.Context, id, text string, at time.Time) error
+	// ListByUser pages the user's CVs, newest first, without extracted text.
+	ListByUser(ctx context.Context, userID string, limit, offset int) ([]models.CVFile, int64, error)
+	// SetActive makes id the user's only active CV.
+	SetActive(ctx context.Context, userID, id string) error
+	Delete(ctx context.Context, id string) error
 }
 
 type cvFileRepo struct {
@@ -32,3 +45,84 @@ func (r *cvFileRepo) LatestByUser(ctx context.Context, userID string) (*models.C
 		Take(&row).Error
 	return &row, err
 }
+
+func (r *cvFileRepo) GetByID(ctx context.Context, id string) (*models.CVFile, error) {
+	var row models.CVFile
+	err := r.db.WithContext(ctx).
+		Where("id = ?", id).
+		Take(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrNotFound
+	}
+	return &row, err
+}
+
+func (r *cvFileRepo) UpdateExtraction(ctx context.Context, id, status, errMsg string, extractedAt *time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&models.CVFile{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"extraction_status": status,
+			"extraction_error":  errMsg,
+			"extracted_at":      extractedAt,
+		}).Error
+}
+
+func (r *cvFileRepo) CompleteExtraction(ctx context.Context, id, text string, at time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&models.CVFile{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"extraction_status": "done",
+			"extraction_error":  "",
+			"extracted_at":      at,
+			"extracted_text":    text,
+		}).Error
+}
+
+func (r *cvFileRepo) ListByUser(ctx context.Context, userID string, limit, offset int) ([]models.CVFile, int64, error) {
+	var total int64
+	if err := r.db.WithContext(ctx).
+		Model(&models.CVFile{}).
+		Where("user_id = ?", userID).
+		Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var rows []models.CVFile
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Omit("extracted_text").
+		Order("upload_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&rows).Error
+	return rows, total, err
+}
+
+func (r *cvFileRepo) SetActive(ctx context.Context, userID, id string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// clear first: the partial unique index allows one active row per user
+		if err := tx.Model(&models.CVFile{}).
+			Where("user_id = ? AND is_active AND id <> ?", userID, id).
+			Update("is_active", false).Error; err != nil {
+			return err
+		}
+		res := tx.Model(&models.CVFile{}).
+			Where("id = ? AND user_id = ?", id, userID).
+			Update("is_active", true)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return utils.ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (r *cvFileRepo) Delete(ctx context.Context, id string) error {
+	return r.db.WithContext(ctx).
+		Where("id = ?", id).
+		Delete(&models.CVFile{}).Error
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 
+	"github.com/pgvector/pgvector-go"
 	"github.com/yoockh/yoospeak/internal/models"
 	"github.com/yoockh/yoospeak/internal/utils"
 	"gorm.io/gorm"
@@ -13,6 +14,7 @@ import (
 type ProfileRepository interface {
 	GetByUserID(ctx context.Context, userID string) (*models.Profile, error)
 	Upsert(ctx context.Context, p *models.Profile) error
+	UpdateCVEmbedding(ctx context.Context, userID string, vec *pgvector.Vector) error
 }
 
 type profileRepo struct {
@@ -38,7 +40,15 @@ func (r *profileRepo) Upsert(ctx context.Context, p *models.Profile) error {
 	return r.db.WithContext(ctx).
 		Clauses(clause.OnConflict{
 			Columns:   []clause.Column{{Name: "user_id"}},
-			DoUpdates: clause.AssignmentColumns([]string{"full_name", "phone_number", "cv_text", "skills", "experience", "education", "cv_embedding", "preferences", "updated_at"}),
+			DoUpdates: clause.AssignmentColumns([]string{"full_name", "phone_number", "cv_text", "cv_file_id", "skills", "experience", "education", "preferences", "updated_at"}),
 		}).
 		Create(p).Error
 }
+
+// UpdateCVEmbedding sets (or clears, when vec is nil) the profile's CV embedding.
+func (r *profileRepo) UpdateCVEmbedding(ctx context.Context, userID string, vec *pgvector.Vector) error {
+	return r.db.WithContext(ctx).
+		Model(&models.Profile{}).
+		Where("user_id = ?", userID).
+		Update("cv_embedding", vec).Error
+}
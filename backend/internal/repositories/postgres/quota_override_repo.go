@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/yoockh/yoospeak/internal/models"
+	"github.com/yoockh/yoospeak/internal/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type QuotaOverrideRepo interface {
+	Get(ctx context.Context, userID string) (*models.QuotaOverride, error)
+	Upsert(ctx context.Context, o *models.QuotaOverride) error
+	Delete(ctx context.Context, userID string) error
+}
+
+type quotaOverrideRepo struct {
+	db *gorm.DB
+}
+
+func NewQuotaOverrideRepo(db *gorm.DB) QuotaOverrideRepo {
+	return &quotaOverrideRepo{db: db}
+}
+
+func (r *quotaOverrideRepo) Get(ctx context.Context, userID string) (*models.QuotaOverride, error) {
+	var o models.QuotaOverride
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Take(&o).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrNotFound
+	}
+	return &o, err
+}
+
+// Upsert replaces the user's override as a whole: nil limits are stored as NULL.
+func (r *quotaOverrideRepo) Upsert(ctx context.Context, o *models.QuotaOverride) error {
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"plan", "audio_minutes_per_day", "sessions_per_day", "llm_tokens_per_day", "note", "updated_by", "updated_at"}),
+		}).
+		Create(o).Error
+}
+
+func (r *quotaOverrideRepo) Delete(ctx context.Context, userID string) error {
+	res := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Delete(&models.QuotaOverride{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return utils.ErrNotFound
+	}
+	return nil
+}
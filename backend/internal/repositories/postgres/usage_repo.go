@@ -0,0 +1,135 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/yoockh/yoospeak/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type UsageRepo interface {
+	// InsertIfAbsent stores rec unless its (session_id, chunk_index, kind) was already recorded.
+	InsertIfAbsent(ctx context.Context, rec *models.UsageRecord) (inserted bool, err error)
+	Totals(ctx context.Context, f UsageFilter) (*models.UsageTotals, error)
+	BySession(ctx context.Context, f UsageFilter) ([]models.SessionUsage, error)
+	// Aggregate groups usage by one of the UsageGroupBy* keys.
+	Aggregate(ctx context.Context, f UsageFilter, groupBy string) ([]models.UsageGroup, error)
+}
+
+// UsageFilter scopes usage queries; every field is optional.
+type UsageFilter struct {
+	UserID    string
+	SessionID string
+	From      *time.Time
+	To        *time.Time
+	Limit     int
+}
+
+const (
+	UsageGroupByUser    = "user"
+	UsageGroupBySession = "session"
+	UsageGroupByDay     = "day"
+	UsageGroupByKind    = "kind"
+)
+
+// usageGroupKeys maps the allowed group_by values to their SQL expression.
+var usageGroupKeys = map[string]string{
+	UsageGroupByUser:    "user_id::text",
+	UsageGroupBySession: "session_id::text",
+	UsageGroupByDay:     "to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD')",
+	UsageGroupByKind:    "kind",
+}
+
+// ValidUsageGroupBy reports whether groupBy is one of the UsageGroupBy* keys.
+func ValidUsageGroupBy(groupBy string) bool {
+	_, ok := usageGroupKeys[groupBy]
+	return ok
+}
+
+const usageSums = `COALESCE(SUM(audio_seconds), 0) AS audio_seconds,
+	COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens,
+	COALESCE(SUM(completion_tokens), 0) AS completion_tokens,
+	COUNT(*) FILTER (WHERE kind = 'llm') AS llm_calls,
+	COALESCE(SUM(cost_micro_usd), 0) AS cost_micro_usd`
+
+type usageRepo struct {
+	db *gorm.DB
+}
+
+func NewUsageRepo(db *gorm.DB) UsageRepo {
+	return &usageRepo{db: db}
+}
+
+func (r *usageRepo) InsertIfAbsent(ctx context.Context, rec *models.UsageRecord) (bool, error) {
+	res := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "session_id"}, {Name: "chunk_index"}, {Name: "kind"}},
+			DoNothing: true,
+		}).
+		Create(rec)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *usageRepo) scoped(ctx context.Context, f UsageFilter) *gorm.DB {
+	q := r.db.WithContext(ctx).Model(&models.UsageRecord{})
+	if f.UserID != "" {
+		q = q.Where("user_id = ?", f.UserID)
+	}
+	if f.SessionID != "" {
+		q = q.Where("session_id = ?", f.SessionID)
+	}
+	if f.From != nil {
+		q = q.Where("created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		q = q.Where("created_at < ?", *f.To)
+	}
+	return q
+}
+
+func (r *usageRepo) Totals(ctx context.Context, f UsageFilter) (*models.UsageTotals, error) {
+	var t models.UsageTotals
+	err := r.scoped(ctx, f).Select(usageSums).Scan(&t).Error
+	return &t, err
+}
+
+// BySession returns per-session usage, most recently active first.
+func (r *usageRepo) BySession(ctx context.Context, f UsageFilter) ([]models.SessionUsage, error) {
+	if f.Limit <= 0 {
+		f.Limit = 50
+	}
+	var rows []models.SessionUsage
+	err := r.scoped(ctx, f).
+		Select("session_id::text AS session_id, " + usageSums + ", MIN(created_at) AS first_at, MAX(created_at) AS last_at").
+		Group("session_id").
+		Order("last_at DESC").
+		Limit(f.Limit).
+		Scan(&rows).Error
+	return rows, err
+}
+
+// Aggregate returns one row per group: days in date order, everything else by cost.
+func (r *usageRepo) Aggregate(ctx context.Context, f UsageFilter, groupBy string) ([]models.UsageGroup, error) {
+	key, ok := usageGroupKeys[groupBy]
+	if !ok {
+		key = usageGroupKeys[UsageGroupByUser]
+	}
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+	order := "cost_micro_usd DESC, key"
+	if groupBy == UsageGroupByDay {
+		order = "key"
+	}
+
+	var rows []models.UsageGroup
+	err := r.scoped(ctx, f).
+		Select(key + " AS key, " + usageSums + ", COUNT(DISTINCT user_id) AS users, COUNT(DISTINCT session_id) AS sessions").
+		Group("key").
+		Order(order).
+		Limit(f.Limit).
+		Scan(&rows).Error
+	return rows, err
+}
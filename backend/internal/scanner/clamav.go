@@ -0,0 +1,150 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// ClamAV scans through a clamd daemon using the INSTREAM command: the file is
+// sent as length-prefixed chunks terminated by a zero-length chunk, and clamd
+// answers "stream: OK" or "stream: <signature> FOUND".
+type ClamAV struct {
+	Network   string // "tcp" or "unix"
+	Address   string // "localhost:3310" or "/var/run/clamav/clamd.ctl"
+	Timeout   time.Duration
+	ChunkSize int
+}
+
+func NewClamAV(network, address string) *ClamAV {
+	return &ClamAV{Network: network, Address: address, Timeout: 30 * time.Second, ChunkSize: 64 << 10}
+}
+
+func (c *ClamAV) Scan(ctx context.Context, data []byte) (Verdict, error) {
+	reply, err := c.instream(ctx, bytes.NewReader(data))
+	if err != nil {
+		return Verdict{}, fmt.Errorf("%w: clamav: %v", ErrUnavailable, err)
+	}
+	return parseClamReply(reply)
+}
+
+// Ping checks that clamd is reachable and answering.
+func (c *ClamAV) Ping(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("zPING\x00")); err != nil {
+		return err
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("clamav: unexpected ping reply %q", reply)
+	}
+	return nil
+}
+
+func (c *ClamAV) dial(ctx context.Context) (net.Conn, error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	d := net.Dialer{Timeout: timeout}
+	conn, err := d.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+		deadline = dl
+	}
+	_ = conn.SetDeadline(deadline)
+	return conn, nil
+}
+
+func (c *ClamAV) instream(ctx context.Context, r io.Reader) (string, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	chunk := c.ChunkSize
+	if chunk <= 0 {
+		chunk = 64 << 10
+	}
+
+	w := bufio.NewWriterSize(conn, chunk+4)
+	if _, err := w.WriteString("zINSTREAM\x00"); err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, chunk)
+	var size [4]byte
+	for {
+		n, rerr := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size[:], uint32(n))
+			if _, err := w.Write(size[:]); err != nil {
+				return "", err
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				// clamd closes the connection once StreamMaxLength is exceeded; its reply says why
+				if reply, rerr := readReply(conn); rerr == nil {
+					return reply, nil
+				}
+				return "", err
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return "", rerr
+		}
+	}
+
+	binary.BigEndian.PutUint32(size[:], 0)
+	if _, err := w.Write(size[:]); err != nil {
+		return "", err
+	}
+	if err := w.Flush(); err != nil {
+		return "", err
+	}
+	return readReply(conn)
+}
+
+// readReply reads one NUL-terminated ("z" command) reply.
+func readReply(r io.Reader) (string, error) {
+	b, err := bufio.NewReader(r).ReadBytes(0)
+	if err != nil && !(err == io.EOF && len(b) > 0) {
+		return "", err
+	}
+	return string(bytes.TrimRight(b, "\x00\n")), nil
+}
+
+func parseClamReply(reply string) (Verdict, error) {
+	// "stream: OK" | "stream: Eicar-Test-Signature FOUND" | "INSTREAM size limit exceeded. ERROR"
+	body := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case body == "OK":
+		return Verdict{Clean: true, Scanner: "clamav"}, nil
+	case strings.HasSuffix(body, " FOUND"):
+		return Verdict{Clean: false, Threat: strings.TrimSuffix(body, " FOUND"), Scanner: "clamav"}, nil
+	case strings.Contains(body, "size limit exceeded"):
+		// too big to scan is not "clean"; reject rather than let it through
+		return Verdict{Clean: false, Threat: "file exceeds scanner size limit", Scanner: "clamav"}, nil
+	}
+	return Verdict{}, fmt.Errorf("%w: clamav: %s", ErrUnavailable, reply)
+}
@@ -0,0 +1,132 @@
+package scanner_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/yoockh/yoospeak/internal/scanner"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd speaks enough of the clamd protocol (zPING, zINSTREAM) to stand in
+// for the daemon: streams containing the EICAR string are reported infected.
+func fakeClamd(t *testing.T, maxStream int) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveClamd(conn, maxStream)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveClamd(conn net.Conn, maxStream int) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	cmd, err := r.ReadString(0)
+	if err != nil {
+		return
+	}
+	switch cmd {
+	case "zPING\x00":
+		_, _ = conn.Write([]byte("PONG\x00"))
+		return
+	case "zINSTREAM\x00":
+	default:
+		_, _ = conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+
+	var stream bytes.Buffer
+	for {
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return
+		}
+		if size == 0 {
+			break
+		}
+		if _, err := io.CopyN(&stream, r, int64(size)); err != nil {
+			return
+		}
+		if stream.Len() > maxStream {
+			_, _ = conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			return
+		}
+	}
+
+	if bytes.Contains(stream.Bytes(), []byte(eicar)) {
+		_, _ = conn.Write([]byte("stream: Win.Test.EICAR_HDB-1 FOUND\x00"))
+		return
+	}
+	_, _ = conn.Write([]byte("stream: OK\x00"))
+}
+
+func TestClamAVScan(t *testing.T) {
+	addr := fakeClamd(t, 1<<20)
+	c := scanner.NewClamAV("tcp", addr)
+	c.ChunkSize = 7 // force many chunks so reassembly is exercised
+	ctx := context.Background()
+
+	if err := c.Ping(ctx); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+
+	v, err := c.Scan(ctx, []byte("just a plain CV\nwith two lines"))
+	if err != nil || !v.Clean {
+		t.Fatalf("clean file: verdict %+v, err %v", v, err)
+	}
+
+	v, err = c.Scan(ctx, []byte("header "+eicar+" trailer"))
+	if err != nil {
+		t.Fatalf("infected file: %v", err)
+	}
+	if v.Clean || v.Threat != "Win.Test.EICAR_HDB-1" {
+		t.Fatalf("infected file: verdict %+v", v)
+	}
+}
+
+func TestClamAVSizeLimitIsNotClean(t *testing.T) {
+	c := scanner.NewClamAV("tcp", fakeClamd(t, 16))
+
+	v, err := c.Scan(context.Background(), []byte(strings.Repeat("a", 64)))
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if v.Clean {
+		t.Fatalf("oversized stream reported clean: %+v", v)
+	}
+}
+
+func TestClamAVUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	_, err = scanner.NewClamAV("tcp", addr).Scan(context.Background(), []byte("x"))
+	if !errors.Is(err, scanner.ErrUnavailable) {
+		t.Fatalf("err = %v, want ErrUnavailable", err)
+	}
+}
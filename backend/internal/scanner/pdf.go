@@ -0,0 +1,107 @@
+package scanner
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// PDFActiveContent rejects PDFs that carry JavaScript, launch actions or
+// embedded files. A CV has no business doing any of that, and these are the
+// usual carriers for PDF-borne exploits. Non-PDF input passes through.
+type PDFActiveContent struct{}
+
+// activeNames are the PDF name objects that mark active content.
+var activeNames = map[string]string{
+	"JavaScript":    "pdf contains JavaScript",
+	"JS":            "pdf contains JavaScript",
+	"Launch":        "pdf contains a launch action",
+	"EmbeddedFile":  "pdf contains embedded files",
+	"EmbeddedFiles": "pdf contains embedded files",
+	"RichMedia":     "pdf contains embedded media",
+}
+
+const (
+	// decompressed streams are also searched (object streams can hide
+	// dictionaries); these caps keep a zip-bomb from running away with memory
+	maxStreamInflate = 8 << 20
+	maxTotalInflate  = 32 << 20
+)
+
+var (
+	pdfNameRE   = regexp.MustCompile(`/([A-Za-z0-9#]+)`)
+	pdfStreamRE = regexp.MustCompile(`stream\r?\n`)
+)
+
+func (PDFActiveContent) Scan(ctx context.Context, data []byte) (Verdict, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return Verdict{Clean: true, Scanner: "pdf"}, nil
+	}
+
+	if threat := findActiveName(data); threat != "" {
+		return Verdict{Threat: threat, Scanner: "pdf"}, nil
+	}
+
+	budget := maxTotalInflate
+	for _, loc := range pdfStreamRE.FindAllIndex(data, -1) {
+		if budget <= 0 || ctx.Err() != nil {
+			break
+		}
+		start := loc[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		body, _ := inflate(data[start:start+end], min(maxStreamInflate, budget))
+		budget -= len(body)
+		if threat := findActiveName(body); threat != "" {
+			return Verdict{Threat: threat, Scanner: "pdf"}, nil
+		}
+	}
+	return Verdict{Clean: true, Scanner: "pdf"}, nil
+}
+
+// findActiveName looks for any of activeNames as a PDF name token, decoding
+// #xx escapes first so "/J#61vaScript" is caught as well.
+func findActiveName(b []byte) string {
+	for _, m := range pdfNameRE.FindAllSubmatch(b, -1) {
+		name := decodePDFName(m[1])
+		if threat, ok := activeNames[name]; ok {
+			return threat
+		}
+	}
+	return ""
+}
+
+func decodePDFName(raw []byte) string {
+	if !bytes.Contains(raw, []byte("#")) {
+		return string(raw)
+	}
+	var out []byte
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && i+2 < len(raw) {
+			if v, err := strconv.ParseUint(string(raw[i+1:i+3]), 16, 8); err == nil {
+				out = append(out, byte(v))
+				i += 2
+				continue
+			}
+		}
+		out = append(out, raw[i])
+	}
+	return string(out)
+}
+
+// inflate decompresses a FlateDecode stream body. Anything that is not zlib
+// (images, other filters) simply yields nothing.
+func inflate(b []byte, limit int) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(io.LimitReader(zr, int64(limit)))
+	return out, err
+}
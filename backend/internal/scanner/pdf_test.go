@@ -0,0 +1,48 @@
+package scanner_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"testing"
+
+	"github.com/yoockh/yoospeak/internal/scanner"
+)
+
+func deflate(s string) string {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	_, _ = w.Write([]byte(s))
+	_ = w.Close()
+	return b.String()
+}
+
+func TestPDFActiveContent(t *testing.T) {
+	cases := []struct {
+		name  string
+		data  string
+		clean bool
+	}{
+		{"plain", "%PDF-1.4\n1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n%%EOF", true},
+		{"not a pdf", "/JavaScript in a text file", true},
+		{"javascript", "%PDF-1.4\n1 0 obj << /OpenAction << /S /JavaScript /JS (app.alert(1)) >> >> endobj", false},
+		{"hex-escaped name", "%PDF-1.4\n1 0 obj << /S /J#61vaScript >> endobj", false},
+		{"embedded file", "%PDF-1.7\n1 0 obj << /Names << /EmbeddedFiles 2 0 R >> >> endobj", false},
+		{"launch", "%PDF-1.4\n1 0 obj << /S /Launch /F (cmd.exe) >> endobj", false},
+		{"similar name", "%PDF-1.4\n1 0 obj << /JSON 1 /Launcher 2 >> endobj", true},
+		{"inside object stream", "%PDF-1.5\n3 0 obj << /Type /ObjStm /Filter /FlateDecode >>\nstream\n" +
+			deflate("<< /S /JavaScript /JS 4 0 R >>") + "\nendstream\nendobj", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := scanner.PDFActiveContent{}.Scan(context.Background(), []byte(tc.data))
+			if err != nil {
+				t.Fatalf("Scan: %v", err)
+			}
+			if v.Clean != tc.clean {
+				t.Fatalf("clean = %v, want %v (threat %q)", v.Clean, tc.clean, v.Threat)
+			}
+		})
+	}
+}
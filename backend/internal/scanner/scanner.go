@@ -0,0 +1,45 @@
+// Package scanner checks uploaded files for malware and disallowed content
+// before they are persisted.
+package scanner
+
+import (
+	"context"
+	"errors"
+)
+
+// Verdict is the outcome of a scan. Threat names what was found when !Clean.
+type Verdict struct {
+	Clean   bool
+	Threat  string
+	Scanner string
+}
+
+// ErrUnavailable wraps failures to reach or talk to a scanning backend;
+// callers should fail closed rather than persist an unscanned file.
+var ErrUnavailable = errors.New("scanner: unavailable")
+
+type Scanner interface {
+	Scan(ctx context.Context, data []byte) (Verdict, error)
+}
+
+// Noop accepts everything. It is the default when no scanner is configured.
+type Noop struct{}
+
+func (Noop) Scan(ctx context.Context, data []byte) (Verdict, error) {
+	return Verdict{Clean: true, Scanner: "noop"}, nil
+}
+
+// Chain runs scanners in order and stops at the first error or non-clean verdict.
+type Chain []Scanner
+
+func (c Chain) Scan(ctx context.Context, data []byte) (Verdict, error) {
+	v := Verdict{Clean: true, Scanner: "chain"}
+	for _, s := range c {
+		var err error
+		v, err = s.Scan(ctx, data)
+		if err != nil || !v.Clean {
+			return v, err
+		}
+	}
+	return v, nil
+}
@@ -13,7 +13,12 @@ type BufferService interface {
 	InsertAudioChunk(ctx context.Context, sessionID string, chunkIndex int64, audioURL, audioBase64 *string) (*models.RealtimeBuffer, error)
 	MarkSTT(ctx context.Context, sessionID string, chunkIndex int64, rawText string, confidence float64, status string) error
 	MarkLLM(ctx context.Context, sessionID string, chunkIndex int64, response string, status string, processingMS int64) error
+	MarkUtterance(ctx context.Context, sessionID string, chunkIndex int64, start, end int64) error
+	MarkVAD(ctx context.Context, sessionID string, chunkIndex int64, v models.VADDecision) error
+	// MarkUsage sets the parts of u that are non-nil, leaving the others as they are.
+	MarkUsage(ctx context.Context, sessionID string, chunkIndex int64, u models.ChunkUsage) error
 	ListBySession(ctx context.Context, sessionID string, limit int64) ([]models.RealtimeBuffer, error)
+	RecentTranscripts(ctx context.Context, sessionID string, beforeChunk int64, limit int64) ([]models.RealtimeBuffer, error)
 }
 
 type bufferService struct {
@@ -79,6 +84,42 @@ func (s *bufferService) MarkLLM(ctx context.Context, sessionID string, chunkInde
 	return nil
 }
 
+func (s *bufferService) MarkUtterance(ctx context.Context, sessionID string, chunkIndex int64, start, end int64) error {
+	const op = "BufferService.MarkUtterance"
+
+	if sessionID == "" || chunkIndex <= 0 || start <= 0 || end < start {
+		return utils.E(utils.CodeInvalidArgument, op, "session_id, chunk_index (>0), and a valid chunk range are required", nil)
+	}
+	if err := s.buffers.UpdateUtterance(ctx, sessionID, chunkIndex, start, end); err != nil {
+		return utils.E(utils.CodeInternal, op, "failed to update utterance range", err)
+	}
+	return nil
+}
+
+func (s *bufferService) MarkVAD(ctx context.Context, sessionID string, chunkIndex int64, v models.VADDecision) error {
+	const op = "BufferService.MarkVAD"
+
+	if sessionID == "" || chunkIndex <= 0 || v.Decision == "" {
+		return utils.E(utils.CodeInvalidArgument, op, "session_id, chunk_index (>0), and decision are required", nil)
+	}
+	if err := s.buffers.UpdateVAD(ctx, sessionID, chunkIndex, v); err != nil {
+		return utils.E(utils.CodeInternal, op, "failed to update vad fields", err)
+	}
+	return nil
+}
+
+func (s *bufferService) MarkUsage(ctx context.Context, sessionID string, chunkIndex int64, u models.ChunkUsage) error {
+	const op = "BufferService.MarkUsage"
+
+	if sessionID == "" || chunkIndex <= 0 || (u.STT == nil && u.LLM == nil) {
+		return utils.E(utils.CodeInvalidArgument, op, "session_id, chunk_index (>0), and usage are required", nil)
+	}
+	if err := s.buffers.UpdateUsage(ctx, sessionID, chunkIndex, u); err != nil {
+		return utils.E(utils.CodeInternal, op, "failed to update usage fields", err)
+	}
+	return nil
+}
+
 func (s *bufferService) ListBySession(ctx context.Context, sessionID string, limit int64) ([]models.RealtimeBuffer, error) {
 	const op = "BufferService.ListBySession"
 
@@ -91,3 +132,16 @@ func (s *bufferService) ListBySession(ctx context.Context, sessionID string, lim
 	}
 	return out, nil
 }
+
+func (s *bufferService) RecentTranscripts(ctx context.Context, sessionID string, beforeChunk int64, limit int64) ([]models.RealtimeBuffer, error) {
+	const op = "BufferService.RecentTranscripts"
+
+	if sessionID == "" || beforeChunk <= 0 {
+		return nil, utils.E(utils.CodeInvalidArgument, op, "session_id and before chunk (>0) are required", nil)
+	}
+	out, err := s.buffers.ListTranscriptsBefore(ctx, sessionID, beforeChunk, limit)
+	if err != nil {
+		return nil, utils.E(utils.CodeInternal, op, "failed to list transcripts", err)
+	}
+	return out, nil
+}
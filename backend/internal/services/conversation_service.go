@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/yoockh/yoospeak/internal/models"
+	"github.com/yoockh/yoospeak/internal/providers/embeddings"
 	pgrepo "github.com/yoockh/yoospeak/internal/repositories/postgres"
 	"github.com/yoockh/yoospeak/internal/utils"
 
@@ -15,17 +16,26 @@ import (
 
 type ConversationService interface {
 	Append(ctx context.Context, userID, sessionID, role, content string, embedding []float32, metadataJSON []byte) (*models.ConversationLog, error)
+	// AppendOnce appends with a caller-chosen (deterministic) id; replaying the same id is a no-op.
+	AppendOnce(ctx context.Context, id, userID, sessionID, role, content string, metadataJSON []byte) (*models.ConversationLog, error)
 	ListBySession(ctx context.Context, userID, sessionID string, limit int) ([]models.ConversationLog, error)
+	// Search embeds query and returns the user's closest logs (f.UserID is set from userID).
+	Search(ctx context.Context, userID, query string, f pgrepo.ConversationSearchFilter) ([]models.ConversationMatch, error)
 }
 
 type conversationService struct {
-	convos pgrepo.ConversationRepo
+	convos   pgrepo.ConversationRepo
+	embedder embeddings.Provider
 }
 
 func NewConversationService(convos pgrepo.ConversationRepo) ConversationService {
 	return &conversationService{convos: convos}
 }
 
+func NewConversationServiceWithEmbeddings(convos pgrepo.ConversationRepo, embedder embeddings.Provider) ConversationService {
+	return &conversationService{convos: convos, embedder: embedder}
+}
+
 func (s *conversationService) Append(ctx context.Context, userID, sessionID, role, content string, embedding []float32, metadataJSON []byte) (*models.ConversationLog, error) {
 	const op = "ConversationService.Append"
 
@@ -44,7 +54,8 @@ func (s *conversationService) Append(ctx context.Context, userID, sessionID, rol
 	}
 
 	if len(embedding) > 0 {
-		row.Embedding = pgvector.NewVector(embedding)
+		v := pgvector.NewVector(embedding)
+		row.Embedding = &v
 	}
 
 	if err := s.convos.Insert(ctx, row); err != nil {
@@ -53,6 +64,29 @@ func (s *conversationService) Append(ctx context.Context, userID, sessionID, rol
 	return row, nil
 }
 
+func (s *conversationService) AppendOnce(ctx context.Context, id, userID, sessionID, role, content string, metadataJSON []byte) (*models.ConversationLog, error) {
+	const op = "ConversationService.AppendOnce"
+
+	if id == "" || userID == "" || sessionID == "" || role == "" || content == "" {
+		return nil, utils.E(utils.CodeInvalidArgument, op, "id, user_id, session_id, role, and content are required", nil)
+	}
+
+	row := &models.ConversationLog{
+		ID:        id,
+		UserID:    userID,
+		SessionID: sessionID,
+		Role:      role,
+		Content:   content,
+		Timestamp: time.Now().UTC(),
+		Metadata:  datatypes.JSON(metadataJSON),
+	}
+
+	if _, err := s.convos.InsertIfAbsent(ctx, row); err != nil {
+		return nil, utils.E(utils.CodeInternal, op, "failed to insert conversation log", err)
+	}
+	return row, nil
+}
+
 func (s *conversationService) ListBySession(ctx context.Context, userID, sessionID string, limit int) ([]models.ConversationLog, error) {
 	const op = "ConversationService.ListBySession"
 
@@ -66,3 +100,29 @@ func (s *conversationService) ListBySession(ctx context.Context, userID, session
 	}
 	return rows, nil
 }
+
+func (s *conversationService) Search(ctx context.Context, userID, query string, f pgrepo.ConversationSearchFilter) ([]models.ConversationMatch, error) {
+	const op = "ConversationService.Search"
+
+	if userID == "" || query == "" {
+		return nil, utils.E(utils.CodeInvalidArgument, op, "user_id and query are required", nil)
+	}
+	if s.embedder == nil {
+		return nil, utils.E(utils.CodeUnavailable, op, "semantic search is not configured", nil)
+	}
+
+	vecs, err := s.embedder.Embed(ctx, embeddings.TaskQuery, []string{query})
+	if err != nil {
+		return nil, utils.E(utils.CodeUnavailable, op, "failed to embed query", err)
+	}
+	if len(vecs) != 1 || len(vecs[0]) != embeddings.Dimensions {
+		return nil, utils.E(utils.CodeInternal, op, "query embedding has unexpected dimensions", nil)
+	}
+
+	f.UserID = userID
+	rows, err := s.convos.SearchSimilar(ctx, f, pgvector.NewVector(vecs[0]))
+	if err != nil {
+		return nil, utils.E(utils.CodeInternal, op, "failed to search conversations", err)
+	}
+	return rows, nil
+}
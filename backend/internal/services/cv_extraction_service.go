@@ -0,0 +1,156 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/yoockh/yoospeak/internal/cvtext"
+	"github.com/yoockh/yoospeak/internal/models"
+	pgrepo "github.com/yoockh/yoospeak/internal/repositories/postgres"
+	"github.com/yoockh/yoospeak/internal/storage"
+	"github.com/yoockh/yoospeak/internal/utils"
+)
+
+const (
+	ExtractionPending    = "pending"
+	ExtractionProcessing = "processing"
+	ExtractionDone       = "done"
+	ExtractionFailed     = "failed"
+)
+
+// maxCVBytes matches the upload limit; anything larger in the bucket was not put there by us.
+const maxCVBytes = 10 << 20
+
+// CVExtractionJobs schedules text extraction for an uploaded CV (implemented by workers.CVExtractionQueue).
+type CVExtractionJobs interface {
+	EnqueueCVExtraction(ctx context.Context, cvFileID string) error
+}
+
+// CVExtractionService turns an uploaded CV file into Profile.CVText; called by the CV worker.
+type CVExtractionService interface {
+	Extract(ctx context.Context, cvFileID string) error
+}
+
+type cvExtractionService struct {
+	files    pgrepo.CVFileRepository
+	store    storage.Downloader
+	profiles ProfileService
+	embeds   EmbeddingJobs // optional
+}
+
+func NewCVExtractionService(files pgrepo.CVFileRepository, store storage.Downloader, profiles ProfileService, embeds EmbeddingJobs) CVExtractionService {
+	return &cvExtractionService{files: files, store: store, profiles: profiles, embeds: embeds}
+}
+
+func (s *cvExtractionService) Extract(ctx context.Context, cvFileID string) error {
+	const op = "CVExtractionService.Extract"
+
+	if cvFileID == "" {
+		return utils.E(utils.CodeInvalidArgument, op, "cv file id is required", nil)
+	}
+
+	row, err := s.files.GetByID(ctx, cvFileID)
+	if err != nil {
+		if errors.Is(err, utils.ErrNotFound) {
+			return utils.E(utils.CodeNotFound, op, "cv file not found", err)
+		}
+		return utils.E(utils.CodeInternal, op, "failed to get cv file", err)
+	}
+	if row.ExtractionStatus == ExtractionDone {
+		return nil // redelivered job
+	}
+	if row.ScanStatus == ScanQuarantined {
+		return utils.E(utils.CodeInvalidArgument, op, "cv file is quarantined", nil)
+	}
+
+	if err := s.files.UpdateExtraction(ctx, row.ID, ExtractionProcessing, "", nil); err != nil {
+		return utils.E(utils.CodeInternal, op, "failed to update extraction status", err)
+	}
+
+	text, err := s.extractText(ctx, op, row)
+	if err != nil {
+		// recorded on every attempt; a successful retry overwrites it
+		_ = s.files.UpdateExtraction(ctx, row.ID, ExtractionFailed, safeMessage(err), nil)
+		return err
+	}
+
+	now := time.Now().UTC()
+	if err := s.files.CompleteExtraction(ctx, row.ID, text, now); err != nil {
+		return utils.E(utils.CodeInternal, op, "failed to store extracted text", err)
+	}
+
+	// only the active CV feeds the profile; re-read in case the user switched meanwhile
+	cur, err := s.files.GetByID(ctx, row.ID)
+	if err != nil {
+		if errors.Is(err, utils.ErrNotFound) {
+			return nil // deleted while extracting
+		}
+		return utils.E(utils.CodeInternal, op, "failed to get cv file", err)
+	}
+	if !cur.IsActive {
+		return nil
+	}
+	return applyCVText(ctx, s.profiles, s.embeds, row.UserID, &row.ID, text)
+}
+
+func (s *cvExtractionService) extractText(ctx context.Context, op string, row *models.CVFile) (string, error) {
+	if s.store == nil {
+		return "", utils.E(utils.CodeUnavailable, op, "storage is not configured", nil)
+	}
+
+	rc, err := s.store.Open(ctx, row.FilePath)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			return "", utils.E(utils.CodeNotFound, op, "stored cv object not found", err)
+		}
+		return "", utils.E(utils.CodeUnavailable, op, "failed to read stored cv", err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxCVBytes+1))
+	if err != nil {
+		return "", utils.E(utils.CodeUnavailable, op, "failed to read stored cv", err)
+	}
+	if len(data) > maxCVBytes {
+		return "", utils.E(utils.CodeInvalidArgument, op, "stored cv exceeds 10MB", nil)
+	}
+
+	// trust the bytes over the stored type, which only older rows could get wrong
+	format, err := cvtext.Detect(bytes.NewReader(data), int64(len(data)), row.FileName)
+	if err != nil {
+		f, ok := cvtext.FormatFromMime(row.MimeType)
+		if !ok {
+			return "", utils.E(utils.CodeInvalidArgument, op, "unsupported cv file format", err)
+		}
+		format = f
+	}
+
+	raw, err := cvtext.Extract(format, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		if errors.Is(err, cvtext.ErrEncrypted) {
+			return "", utils.E(utils.CodeInvalidArgument, op, "pdf is password protected", err)
+		}
+		return "", utils.E(utils.CodeInvalidArgument, op, string(format)+" could not be parsed", err)
+	}
+
+	text := cvtext.Normalize(raw)
+	if text == "" {
+		if format == cvtext.FormatPDF {
+			return "", utils.E(utils.CodeInvalidArgument, op, "no text found in pdf (scanned image?)", nil)
+		}
+		return "", utils.E(utils.CodeInvalidArgument, op, "no text found in cv", nil)
+	}
+	return text, nil
+}
+
+// safeMessage is the client-safe part of an AppError, suitable for storing on the row.
+func safeMessage(err error) string {
+	var ae *utils.AppError
+	if errors.As(err, &ae) && ae.Message != "" {
+		return ae.Message
+	}
+	return "extraction failed"
+}
@@ -0,0 +1,463 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/yoockh/yoospeak/internal/cache"
+	"github.com/yoockh/yoospeak/internal/models"
+	"github.com/yoockh/yoospeak/internal/providers/llm"
+	"github.com/yoockh/yoospeak/internal/utils"
+	"gorm.io/datatypes"
+)
+
+// ParsedCV is the structured form of a CV, as returned by the model and validated.
+type ParsedCV struct {
+	Skills     []string          `json:"skills"`
+	Experience []ExperienceEntry `json:"experience"`
+	Education  []EducationEntry  `json:"education"`
+}
+
+// Dates are "YYYY", "YYYY-MM" or "YYYY-MM-DD"; EndDate may also be "present".
+type ExperienceEntry struct {
+	Company     string `json:"company"`
+	Title       string `json:"title"`
+	StartDate   string `json:"start_date"`
+	EndDate     string `json:"end_date"`
+	Description string `json:"description,omitempty"`
+}
+
+type EducationEntry struct {
+	Institution string `json:"institution"`
+	Degree      string `json:"degree"`
+	Field       string `json:"field,omitempty"`
+	StartDate   string `json:"start_date"`
+	EndDate     string `json:"end_date"`
+}
+
+// FieldChange is one profile field the proposal would change.
+type FieldChange struct {
+	Field    string          `json:"field"` // skills|experience|education
+	Current  json.RawMessage `json:"current"`
+	Proposed json.RawMessage `json:"proposed"`
+	Added    []string        `json:"added,omitempty"`   // skills only
+	Removed  []string        `json:"removed,omitempty"` // skills only
+}
+
+// CVProposal is a parsed CV waiting for the user to accept (some of) its changes.
+type CVProposal struct {
+	ID        string        `json:"id"`
+	UserID    string        `json:"user_id"`
+	Parsed    ParsedCV      `json:"parsed"`
+	Changes   []FieldChange `json:"changes"`
+	CreatedAt time.Time     `json:"created_at"`
+	ExpiresAt time.Time     `json:"expires_at"`
+
+	// ProfileVersion fingerprints the profile Changes were diffed against.
+	ProfileVersion string `json:"profile_version"`
+}
+
+type CVParseService interface {
+	// Propose parses the profile's CV text and stores a proposal with the diff against the profile.
+	Propose(ctx context.Context, userID string) (*CVProposal, error)
+	// Apply writes the accepted fields of a proposal (all changed fields when fields is empty).
+	// It fails with Conflict when the profile changed after the proposal was made.
+	Apply(ctx context.Context, userID, proposalID string, fields []string) (*models.Profile, error)
+}
+
+const (
+	cvParseAttempts    = 3
+	cvParseMaxRunes    = 24000
+	cvProposalTTL      = 24 * time.Hour
+	cvParseMaxSkills   = 100
+	cvParseMaxEntries  = 30
+	cvParseMaxFieldLen = 300
+)
+
+var cvProfileFields = []string{"skills", "experience", "education"}
+
+type cvParseService struct {
+	profiles ProfileService
+	llm      llm.Provider
+	cache    cache.Cache
+}
+
+func NewCVParseService(profiles ProfileService, provider llm.Provider, c cache.Cache) CVParseService {
+	return &cvParseService{profiles: profiles, llm: provider, cache: c}
+}
+
+func cvProposalKey(userID, id string) string { return "cv_proposal:" + userID + ":" + id }
+
+func (s *cvParseService) Propose(ctx context.Context, userID string) (*CVProposal, error) {
+	const op = "CVParseService.Propose"
+
+	if userID == "" {
+		return nil, utils.E(utils.CodeInvalidArgument, op, "user_id is required", nil)
+	}
+	if s.llm == nil {
+		return nil, utils.E(utils.CodeUnavailable, op, "cv parsing is not configured", nil)
+	}
+	if s.cache == nil {
+		return nil, utils.E(utils.CodeUnavailable, op, "proposal storage is not configured", nil)
+	}
+
+	p, err := s.profiles.GetMe(ctx, userID)
+	if err != nil {
+		if utils.IsCode(err, utils.CodeNotFound) {
+			return nil, utils.E(utils.CodeInvalidArgument, op, "profile has no cv text; upload a cv first", err)
+		}
+		return nil, err
+	}
+	cv := strings.TrimSpace(p.CVText)
+	if cv == "" {
+		return nil, utils.E(utils.CodeInvalidArgument, op, "profile has no cv text; upload a cv first", nil)
+	}
+	if utf8.RuneCountInString(cv) > cvParseMaxRunes {
+		cv = string([]rune(cv)[:cvParseMaxRunes])
+	}
+
+	parsed, err := s.parse(ctx, op, cv)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := diffProfile(p, parsed)
+	if err != nil {
+		return nil, utils.E(utils.CodeInternal, op, "failed to diff profile", err)
+	}
+
+	now := time.Now().UTC()
+	prop := &CVProposal{
+		ID:      uuid.NewString(),
+		UserID:  userID,
+		Parsed:  *parsed,
+		Changes: changes,
+
+		ProfileVersion: profileVersion(p),
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(cvProposalTTL),
+	}
+	if err := s.cache.SetJSON(ctx, cvProposalKey(userID, prop.ID), prop, cvProposalTTL); err != nil {
+		return nil, utils.E(utils.CodeUnavailable, op, "failed to store proposal", err)
+	}
+	return prop, nil
+}
+
+func (s *cvParseService) Apply(ctx context.Context, userID, proposalID string, fields []string) (*models.Profile, error) {
+	const op = "CVParseService.Apply"
+
+	if userID == "" || proposalID == "" {
+		return nil, utils.E(utils.CodeInvalidArgument, op, "user_id and proposal id are required", nil)
+	}
+	if s.cache == nil {
+		return nil, utils.E(utils.CodeUnavailable, op, "proposal storage is not configured", nil)
+	}
+	for _, f := range fields {
+		if !slices.Contains(cvProfileFields, f) {
+			return nil, utils.E(utils.CodeInvalidArgument, op, "unknown field "+f+" (use skills, experience, education)", nil)
+		}
+	}
+
+	var prop CVProposal
+	hit, err := s.cache.GetJSON(ctx, cvProposalKey(userID, proposalID), &prop)
+	if err != nil {
+		return nil, utils.E(utils.CodeUnavailable, op, "failed to load proposal", err)
+	}
+	if !hit {
+		return nil, utils.E(utils.CodeNotFound, op, "proposal not found or expired", nil)
+	}
+	if len(fields) == 0 {
+		for _, c := range prop.Changes {
+			fields = append(fields, c.Field)
+		}
+	}
+
+	p, err := s.profiles.GetMe(ctx, userID)
+	if err != nil {
+		if !utils.IsCode(err, utils.CodeNotFound) {
+			return nil, err
+		}
+		p = &models.Profile{UserID: userID}
+	}
+	// the user accepted changes against the profile they were shown; don't
+	// overwrite edits (or a new CV) that landed since
+	if prop.ProfileVersion != profileVersion(p) {
+		return nil, utils.E(utils.CodeConflict, op, "profile changed since the proposal was made; parse the cv again", nil)
+	}
+
+	for _, f := range fields {
+		if !prop.Parsed.extracted(f) {
+			continue
+		}
+		switch f {
+		case "skills":
+			p.Skills = prop.Parsed.Skills
+		case "experience":
+			b, _ := json.Marshal(prop.Parsed.Experience)
+			p.Experience = datatypes.JSON(b)
+		case "education":
+			b, _ := json.Marshal(prop.Parsed.Education)
+			p.Education = datatypes.JSON(b)
+		}
+	}
+	p.UpdatedAt = time.Now().UTC()
+
+	if err := s.profiles.Upsert(ctx, p); err != nil {
+		return nil, err
+	}
+	_ = s.cache.Del(ctx, cvProposalKey(userID, proposalID))
+	return p, nil
+}
+
+// profileVersion fingerprints the profile fields a proposal is diffed from.
+func profileVersion(p *models.Profile) string {
+	b, _ := json.Marshal(struct {
+		CVText     string          `json:"cv_text"`
+		Skills     []string        `json:"skills"`
+		Experience json.RawMessage `json:"experience"`
+		Education  json.RawMessage `json:"education"`
+	}{p.CVText, p.Skills, canonicalJSON(p.Experience), canonicalJSON(p.Education)})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalJSON re-encodes b so that jsonb's key order and spacing don't change the fingerprint.
+func canonicalJSON(b []byte) json.RawMessage {
+	var v any
+	if len(b) == 0 || json.Unmarshal(b, &v) != nil {
+		return json.RawMessage(strconv.Quote(string(b)))
+	}
+	out, _ := json.Marshal(v)
+	return out
+}
+
+// parse asks the model for the CV as JSON, feeding validation errors back on
+// retry. Output that never validates is rejected, not written.
+func (s *cvParseService) parse(ctx context.Context, op, cv string) (*ParsedCV, error) {
+	var lastErr error
+	for attempt := 1; attempt <= cvParseAttempts; attempt++ {
+		raw, err := collectAnswer(ctx, s.llm, cvParseRequest(cv, lastErr))
+		if err != nil {
+			return nil, utils.E(utils.CodeUnavailable, op, "llm request failed", err)
+		}
+
+		parsed, err := decodeParsedCV(raw)
+		if err == nil {
+			return parsed, nil
+		}
+		lastErr = err
+	}
+	return nil, utils.E(utils.CodeUnavailable, op, "model did not return valid cv json", lastErr)
+}
+
+// cvParseInstructions is the system instruction for CV extraction; the CV
+// itself (and any rejection of the previous answer) is the user message.
+const cvParseInstructions = `Extract structured data from the CV the user sends. Respond with ONLY a JSON object, no markdown, matching exactly:
+{"skills": [string], "experience": [{"company": string, "title": string, "start_date": string, "end_date": string, "description": string}], "education": [{"institution": string, "degree": string, "field": string, "start_date": string, "end_date": string}]}
+Rules: dates are "YYYY", "YYYY-MM" or "YYYY-MM-DD", or "" when unknown; end_date may be "present". Use [] for missing sections. Do not invent information that is not in the CV. Skills are short names (e.g. "Go", "Project management").`
+
+func cvParseRequest(cv string, prevErr error) llm.Request {
+	var b strings.Builder
+	if prevErr != nil {
+		fmt.Fprintf(&b, "Your previous answer was rejected: %v. Return corrected JSON only.\n\n", prevErr)
+	}
+	b.WriteString("CV:\n")
+	b.WriteString(cv)
+	return llm.Request{
+		System:   cvParseInstructions,
+		Messages: []llm.Message{{Role: llm.RoleUser, Content: b.String()}},
+		// extraction, not writing: keep the output deterministic
+		Options: llm.Options{Temperature: llm.Float32(0)},
+	}
+}
+
+// collectAnswer drains a streamed answer into one string.
+func collectAnswer(ctx context.Context, p llm.Provider, req llm.Request) (string, error) {
+	chunks, errs := p.Stream(ctx, req)
+	var b strings.Builder
+	for c := range chunks {
+		b.WriteString(c.Text)
+	}
+	if err := <-errs; err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+var cvDatePattern = regexp.MustCompile(`^\d{4}(-(0[1-9]|1[0-2])(-(0[1-9]|[12]\d|3[01]))?)?$`)
+
+func validCVDate(s string, allowPresent bool) bool {
+	return s == "" || cvDatePattern.MatchString(s) || (allowPresent && strings.EqualFold(s, "present"))
+}
+
+// decodeParsedCV strictly decodes and validates model output. A surrounding
+// markdown code fence is tolerated; unknown or missing keys are not.
+func decodeParsedCV(raw string) (*ParsedCV, error) {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "```") {
+		raw = strings.TrimPrefix(raw, "```json")
+		raw = strings.TrimPrefix(raw, "```")
+		raw = strings.TrimSuffix(strings.TrimSpace(raw), "```")
+	}
+
+	var out struct {
+		Skills     *[]string          `json:"skills"`
+		Experience *[]ExperienceEntry `json:"experience"`
+		Education  *[]EducationEntry  `json:"education"`
+	}
+	dec := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&out); err != nil {
+		return nil, fmt.Errorf("invalid json: %v", err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after the json object")
+	}
+	if out.Skills == nil || out.Experience == nil || out.Education == nil {
+		return nil, fmt.Errorf("skills, experience and education are all required")
+	}
+
+	parsed := &ParsedCV{Skills: []string{}, Experience: []ExperienceEntry{}, Education: []EducationEntry{}}
+
+	seen := map[string]bool{}
+	for _, sk := range *out.Skills {
+		sk = clip(sk)
+		if sk == "" || seen[strings.ToLower(sk)] {
+			continue
+		}
+		seen[strings.ToLower(sk)] = true
+		parsed.Skills = append(parsed.Skills, sk)
+	}
+	if len(parsed.Skills) > cvParseMaxSkills {
+		return nil, fmt.Errorf("too many skills (%d, max %d)", len(parsed.Skills), cvParseMaxSkills)
+	}
+
+	if len(*out.Experience) > cvParseMaxEntries || len(*out.Education) > cvParseMaxEntries {
+		return nil, fmt.Errorf("too many entries (max %d per section)", cvParseMaxEntries)
+	}
+	for i, e := range *out.Experience {
+		e.Company, e.Title, e.StartDate, e.EndDate = clip(e.Company), clip(e.Title), strings.TrimSpace(e.StartDate), strings.TrimSpace(e.EndDate)
+		e.Description = strings.TrimSpace(e.Description)
+		if e.Company == "" && e.Title == "" {
+			return nil, fmt.Errorf("experience[%d] needs a company or a title", i)
+		}
+		if !validCVDate(e.StartDate, false) || !validCVDate(e.EndDate, true) {
+			return nil, fmt.Errorf("experience[%d] has an invalid date (use YYYY, YYYY-MM, YYYY-MM-DD or present)", i)
+		}
+		parsed.Experience = append(parsed.Experience, e)
+	}
+	for i, e := range *out.Education {
+		e.Institution, e.Degree, e.Field = clip(e.Institution), clip(e.Degree), clip(e.Field)
+		e.StartDate, e.EndDate = strings.TrimSpace(e.StartDate), strings.TrimSpace(e.EndDate)
+		if e.Institution == "" {
+			return nil, fmt.Errorf("education[%d] needs an institution", i)
+		}
+		if !validCVDate(e.StartDate, false) || !validCVDate(e.EndDate, true) {
+			return nil, fmt.Errorf("education[%d] has an invalid date (use YYYY, YYYY-MM, YYYY-MM-DD or present)", i)
+		}
+		parsed.Education = append(parsed.Education, e)
+	}
+	return parsed, nil
+}
+
+func clip(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) > cvParseMaxFieldLen {
+		s = string([]rune(s)[:cvParseMaxFieldLen])
+	}
+	return s
+}
+
+// extracted reports whether the model found anything for field. An empty
+// section means the CV did not show it, not that the profile should lose it.
+func (p *ParsedCV) extracted(field string) bool {
+	switch field {
+	case "skills":
+		return len(p.Skills) > 0
+	case "experience":
+		return len(p.Experience) > 0
+	case "education":
+		return len(p.Education) > 0
+	}
+	return false
+}
+
+// diffProfile lists the fields the parsed CV would change. Sections the CV
+// yielded nothing for are left out rather than proposed as empty.
+func diffProfile(p *models.Profile, parsed *ParsedCV) ([]FieldChange, error) {
+	var changes []FieldChange
+
+	cur := map[string]bool{}
+	for _, s := range p.Skills {
+		cur[strings.ToLower(s)] = true
+	}
+	next := map[string]bool{}
+	var added, removed []string
+	for _, s := range parsed.Skills {
+		next[strings.ToLower(s)] = true
+		if !cur[strings.ToLower(s)] {
+			added = append(added, s)
+		}
+	}
+	for _, s := range p.Skills {
+		if !next[strings.ToLower(s)] {
+			removed = append(removed, s)
+		}
+	}
+	sort.Strings(removed)
+	if parsed.extracted("skills") && (len(added) > 0 || len(removed) > 0) {
+		curJSON, _ := json.Marshal([]string(p.Skills))
+		nextJSON, _ := json.Marshal(parsed.Skills)
+		changes = append(changes, FieldChange{Field: "skills", Current: curJSON, Proposed: nextJSON, Added: added, Removed: removed})
+	}
+
+	for _, f := range []struct {
+		name     string
+		current  []byte
+		proposed any
+	}{
+		{"experience", p.Experience, parsed.Experience},
+		{"education", p.Education, parsed.Education},
+	} {
+		if !parsed.extracted(f.name) {
+			continue
+		}
+		next, err := json.Marshal(f.proposed)
+		if err != nil {
+			return nil, err
+		}
+		if sameJSON(f.current, next) {
+			continue
+		}
+		current := json.RawMessage(f.current)
+		if len(current) == 0 {
+			current = json.RawMessage("null")
+		}
+		changes = append(changes, FieldChange{Field: f.name, Current: current, Proposed: next})
+	}
+	return changes, nil
+}
+
+func sameJSON(a, b []byte) bool {
+	var va, vb any
+	if len(a) == 0 {
+		a = []byte("[]")
+	}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+	"github.com/yoockh/yoospeak/internal/cache"
+	"github.com/yoockh/yoospeak/internal/models"
+	llmfake "github.com/yoockh/yoospeak/internal/providers/llm/fake"
+	"github.com/yoockh/yoospeak/internal/utils"
+	"gorm.io/datatypes"
+)
+
+func TestDecodeParsedCV(t *testing.T) {
+	const valid = `{"skills":["Go"," go ","Redis",""],"experience":[{"company":"  Acme   Corp ","title":"Engineer","start_date":"2020-01","end_date":"present","description":" built things "}],"education":[]}`
+
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr string // substring; "" means success
+	}{
+		{"valid", valid, ""},
+		{"json code fence", "```json\n" + valid + "\n```", ""},
+		{"bare code fence", "```\n" + valid + "\n```", ""},
+		{"empty sections", `{"skills":[],"experience":[],"education":[]}`, ""},
+		{"malformed json", `{"skills":["Go"],`, "invalid json"},
+		{"prose around json", "Here you go: " + valid, "invalid json"},
+		{"trailing data", valid + ` {"skills":[]}`, "unexpected data"},
+		{"unknown key", `{"skills":[],"experience":[],"education":[],"hobbies":[]}`, "invalid json"},
+		{"missing section", `{"skills":[],"experience":[]}`, "all required"},
+		{"null section", `{"skills":null,"experience":[],"education":[]}`, "all required"},
+		{"skills not a list", `{"skills":"Go, Redis","experience":[],"education":[]}`, "invalid json"},
+		{"skill not a string", `{"skills":[42],"experience":[],"education":[]}`, "invalid json"},
+		{"entry not an object", `{"skills":[],"experience":["Acme"],"education":[]}`, "invalid json"},
+		{"experience without company or title", `{"skills":[],"experience":[{"company":" ","title":""}],"education":[]}`, "experience[0] needs"},
+		{"education without institution", `{"skills":[],"experience":[],"education":[{"degree":"BSc"}]}`, "education[0] needs"},
+		{"bad date", `{"skills":[],"experience":[{"title":"Dev","start_date":"Jan 2020"}],"education":[]}`, "invalid date"},
+		{"present start date", `{"skills":[],"experience":[{"title":"Dev","start_date":"present"}],"education":[]}`, "invalid date"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeParsedCV(tt.raw)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeParsedCV: %v", err)
+			}
+			if got.Skills == nil || got.Experience == nil || got.Education == nil {
+				t.Errorf("parsed = %+v, want non-nil sections", got)
+			}
+		})
+	}
+
+	got, _ := decodeParsedCV(valid)
+	if strings.Join(got.Skills, ",") != "Go,Redis" {
+		t.Errorf("skills = %q, want trimmed, deduplicated case-insensitively, blanks dropped", got.Skills)
+	}
+	if e := got.Experience[0]; e.Company != "Acme Corp" || e.Description != "built things" {
+		t.Errorf("experience = %+v, want whitespace collapsed", e)
+	}
+}
+
+func TestDiffProfile(t *testing.T) {
+	existing := &models.Profile{
+		Skills:     pq.StringArray{"Go", "Kafka"},
+		Experience: datatypes.JSON(`[{"company":"Acme","title":"Engineer","start_date":"2020","end_date":"present"}]`),
+		Education:  datatypes.JSON(`[{"institution":"UI","degree":"BSc","start_date":"2014","end_date":"2018"}]`),
+	}
+	acme := []ExperienceEntry{{Company: "Acme", Title: "Engineer", StartDate: "2020", EndDate: "present"}}
+	ui := []EducationEntry{{Institution: "UI", Degree: "BSc", StartDate: "2014", EndDate: "2018"}}
+
+	tests := []struct {
+		name    string
+		profile *models.Profile
+		parsed  ParsedCV
+		want    []string // changed fields, in order
+		added   string
+		removed string
+	}{
+		{"identical", existing, ParsedCV{Skills: []string{"go", "KAFKA"}, Experience: acme, Education: ui}, nil, "", ""},
+		{"skills changed", existing, ParsedCV{Skills: []string{"Go", "Redis"}, Experience: acme, Education: ui}, []string{"skills"}, "Redis", "Kafka"},
+		{"new job", existing, ParsedCV{Skills: []string{"Go", "Kafka"}, Experience: append([]ExperienceEntry{{Company: "Beta", Title: "Lead", StartDate: "2024"}}, acme...), Education: ui}, []string{"experience"}, "", ""},
+		{"empty sections keep the profile", existing, ParsedCV{Skills: []string{}, Experience: []ExperienceEntry{}, Education: []EducationEntry{}}, nil, "", ""},
+		{"empty profile", &models.Profile{}, ParsedCV{Skills: []string{"Go"}, Experience: acme, Education: []EducationEntry{}}, []string{"skills", "experience"}, "Go", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := diffProfile(tt.profile, &tt.parsed)
+			if err != nil {
+				t.Fatalf("diffProfile: %v", err)
+			}
+			var fields []string
+			for _, c := range changes {
+				fields = append(fields, c.Field)
+				if c.Field == "skills" && (strings.Join(c.Added, ",") != tt.added || strings.Join(c.Removed, ",") != tt.removed) {
+					t.Errorf("skills added %q removed %q, want %q and %q", c.Added, c.Removed, tt.added, tt.removed)
+				}
+				if c.Field == "experience" && tt.profile.Experience == nil && string(c.Current) != "null" {
+					t.Errorf("current experience = %s, want null", c.Current)
+				}
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("changed fields = %q, want %q", fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyRejectsProposalForChangedProfile(t *testing.T) {
+	ctx := context.Background()
+	const parsed = `{"skills":["Go","Redis"],"experience":[{"company":"Acme","title":"Engineer","start_date":"2020","end_date":"present"}],"education":[]}`
+
+	tests := []struct {
+		name   string
+		edit   func(p *models.Profile)
+		stale  bool
+		fields []string
+	}{
+		{"unchanged profile", nil, false, nil},
+		{"unrelated field edited", func(p *models.Profile) { p.UpdatedAt = p.UpdatedAt.AddDate(0, 0, 1) }, false, nil},
+		{"experience jsonb reordered", func(p *models.Profile) {
+			p.Experience = datatypes.JSON(`[{"title": "Intern", "company": "Initech"}]`)
+		}, false, nil},
+		{"skills edited", func(p *models.Profile) { p.Skills = pq.StringArray{"Go", "Kafka", "Rust"} }, true, nil},
+		{"experience edited", func(p *models.Profile) { p.Experience = datatypes.JSON(`[]`) }, true, []string{"skills"}},
+		{"new cv text", func(p *models.Profile) { p.CVText = "another cv" }, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			t.Cleanup(func() { rdb.Close() })
+
+			f := &cvFixture{profiles: map[string]*models.Profile{cvOwner: {
+				UserID:     cvOwner,
+				CVText:     "my cv",
+				Skills:     pq.StringArray{"Go", "Kafka"},
+				Experience: datatypes.JSON(`[{"company":"Initech","title":"Intern"}]`),
+			}}}
+			llmP := &llmfake.Provider{Default: llmfake.Response{Chunks: []string{parsed}}}
+			svc := NewCVParseService(memProfiles{f: f}, llmP, cache.NewRedisCache(rdb))
+
+			prop, err := svc.Propose(ctx, cvOwner)
+			if err != nil {
+				t.Fatalf("Propose: %v", err)
+			}
+			if tt.edit != nil {
+				tt.edit(f.profiles[cvOwner])
+			}
+			before := *f.profiles[cvOwner]
+
+			p, err := svc.Apply(ctx, cvOwner, prop.ID, tt.fields)
+			if tt.stale {
+				if !utils.IsCode(err, utils.CodeConflict) {
+					t.Fatalf("Apply = %v, want Conflict", err)
+				}
+				if after := f.profiles[cvOwner]; strings.Join(after.Skills, ",") != strings.Join(before.Skills, ",") || string(after.Experience) != string(before.Experience) {
+					t.Errorf("stale proposal wrote the profile: %+v", after)
+				}
+				// the user can still parse again and apply the fresh proposal
+				fresh, err := svc.Propose(ctx, cvOwner)
+				if err != nil {
+					t.Fatalf("Propose again: %v", err)
+				}
+				if _, err := svc.Apply(ctx, cvOwner, fresh.ID, nil); err != nil {
+					t.Errorf("Apply fresh proposal: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			if strings.Join(p.Skills, ",") != "Go,Redis" || !strings.Contains(string(p.Experience), "Acme") {
+				t.Errorf("applied profile = %+v, want the proposal's skills and experience", p)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/pgvector/pgvector-go"
+	"github.com/yoockh/yoospeak/internal/models"
+	"github.com/yoockh/yoospeak/internal/providers/embeddings"
+	pgrepo "github.com/yoockh/yoospeak/internal/repositories/postgres"
+	"github.com/yoockh/yoospeak/internal/utils"
+)
+
+// CVRetrievalService indexes a user's CV as embedded passages and retrieves the
+// ones relevant to what the user is saying.
+type CVRetrievalService interface {
+	// Reindex replaces the user's CV chunks; empty cvText just removes them.
+	Reindex(ctx context.Context, userID, cvText string) error
+	// Retrieve returns up to k passages closest to query (none when the user has no indexed CV).
+	Retrieve(ctx context.Context, userID, query string, k int) ([]models.CVChunkMatch, error)
+}
+
+// Chunk sizes in runes (~4 runes per token): passages of ~200 tokens overlapping
+// by a sentence or two so facts spanning a boundary survive in one of them.
+const (
+	cvChunkRunes   = 800
+	cvChunkOverlap = 120
+	cvMaxChunks    = 64
+)
+
+type cvRetrievalService struct {
+	provider embeddings.Provider
+	chunks   pgrepo.CVChunkRepository
+}
+
+func NewCVRetrievalService(provider embeddings.Provider, chunks pgrepo.CVChunkRepository) CVRetrievalService {
+	return &cvRetrievalService{provider: provider, chunks: chunks}
+}
+
+func (s *cvRetrievalService) Reindex(ctx context.Context, userID, cvText string) error {
+	const op = "CVRetrievalService.Reindex"
+
+	if userID == "" {
+		return utils.E(utils.CodeInvalidArgument, op, "user_id is required", nil)
+	}
+
+	parts := chunkCVText(cvText, cvChunkRunes, cvChunkOverlap)
+	if len(parts) > cvMaxChunks {
+		parts = parts[:cvMaxChunks]
+	}
+	if len(parts) == 0 {
+		if err := s.chunks.DeleteByUser(ctx, userID); err != nil {
+			return utils.E(utils.CodeInternal, op, "failed to delete cv chunks", err)
+		}
+		return nil
+	}
+
+	vecs, err := s.provider.Embed(ctx, embeddings.TaskDocument, parts)
+	if err != nil {
+		return utils.E(utils.CodeUnavailable, op, "embedding provider failed", err)
+	}
+	if len(vecs) != len(parts) {
+		return utils.E(utils.CodeInternal, op, "embedding count does not match chunk count", nil)
+	}
+
+	now := time.Now().UTC()
+	rows := make([]models.CVChunk, 0, len(parts))
+	for i, text := range parts {
+		if len(vecs[i]) != embeddings.Dimensions {
+			return utils.E(utils.CodeInternal, op, "embedding has unexpected dimensions", nil)
+		}
+		v := pgvector.NewVector(vecs[i])
+		rows = append(rows, models.CVChunk{
+			ID:         uuid.NewString(),
+			UserID:     userID,
+			ChunkIndex: i,
+			Content:    text,
+			Embedding:  &v,
+			CreatedAt:  now,
+		})
+	}
+
+	if err := s.chunks.ReplaceForUser(ctx, userID, rows); err != nil {
+		return utils.E(utils.CodeInternal, op, "failed to store cv chunks", err)
+	}
+	return nil
+}
+
+func (s *cvRetrievalService) Retrieve(ctx context.Context, userID, query string, k int) ([]models.CVChunkMatch, error) {
+	const op = "CVRetrievalService.Retrieve"
+
+	query = strings.TrimSpace(query)
+	if userID == "" || query == "" {
+		return nil, nil
+	}
+
+	vecs, err := s.provider.Embed(ctx, embeddings.TaskQuery, []string{query})
+	if err != nil {
+		return nil, utils.E(utils.CodeUnavailable, op, "failed to embed query", err)
+	}
+	if len(vecs) != 1 || len(vecs[0]) != embeddings.Dimensions {
+		return nil, utils.E(utils.CodeInternal, op, "query embedding has unexpected dimensions", nil)
+	}
+
+	rows, err := s.chunks.SearchSimilar(ctx, userID, pgvector.NewVector(vecs[0]), k)
+	if err != nil {
+		return nil, utils.E(utils.CodeInternal, op, "failed to search cv chunks", err)
+	}
+	return rows, nil
+}
+
+// chunkCVText splits CV text into passages of at most size runes. Paragraphs
+// (blank-line separated sections) are packed together while they fit; longer
+// ones are cut on word boundaries with overlap runes carried into the next passage.
+func chunkCVText(text string, size, overlap int) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	var paras []string
+	for _, p := range strings.Split(text, "\n\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			paras = append(paras, p)
+		}
+	}
+
+	var out []string
+	var cur string
+	flush := func() {
+		if cur != "" {
+			out = append(out, cur)
+			cur = ""
+		}
+	}
+
+	for _, p := range paras {
+		if utf8.RuneCountInString(p) > size {
+			flush()
+			out = append(out, splitRunes(p, size, overlap)...)
+			continue
+		}
+		if cur != "" && utf8.RuneCountInString(cur)+2+utf8.RuneCountInString(p) > size {
+			flush()
+		}
+		if cur != "" {
+			cur += "\n\n"
+		}
+		cur += p
+	}
+	flush()
+	return out
+}
+
+func splitRunes(s string, size, overlap int) []string {
+	r := []rune(s)
+	var out []string
+	for start := 0; start < len(r); {
+		end := start + size
+		if end >= len(r) {
+			out = append(out, strings.TrimSpace(string(r[start:])))
+			break
+		}
+		// back off to the last whitespace in the second half of the window
+		cut := end
+		for i := end; i > start+size/2; i-- {
+			if r[i] == ' ' || r[i] == '\n' || r[i] == '\t' {
+				cut = i
+				break
+			}
+		}
+		out = append(out, strings.TrimSpace(string(r[start:cut])))
+
+		next := cut - overlap
+		if next <= start {
+			next = cut
+		}
+		// don't resume mid-word
+		for next < cut && r[next] != ' ' && r[next] != '\n' && r[next] != '\t' {
+			next++
+		}
+		start = next
+	}
+	return out
+}
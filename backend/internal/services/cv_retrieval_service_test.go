@@ -0,0 +1,59 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestChunkCVText(t *testing.T) {
+	long := strings.Repeat("word ", 30) // 150 runes, no paragraph breaks
+
+	tests := []struct {
+		name string
+		text string
+		size int
+		want []string
+	}{
+		{"empty", "  \n\n \r\n ", 50, nil},
+		{"short paragraphs packed together", "Alpha\r\n\r\nBeta\n\nGamma", 50, []string{"Alpha\n\nBeta\n\nGamma"}},
+		{"paragraphs split when the next does not fit", "aaaaaaaaaa\n\nbbbbbbbbbb\n\ncccccccccc", 22, []string{"aaaaaaaaaa\n\nbbbbbbbbbb", "cccccccccc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chunkCVText(tt.text, tt.size, 5)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+				t.Errorf("chunkCVText = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("long paragraph cut on words with overlap", func(t *testing.T) {
+		got := chunkCVText("Intro\n\n"+long, 40, 10)
+		if len(got) < 2 || got[0] != "Intro" {
+			t.Fatalf("chunks = %q, want the intro on its own before the long paragraph", got)
+		}
+		var words int
+		for i, c := range got[1:] {
+			if n := utf8.RuneCountInString(c); n > 40 {
+				t.Errorf("chunk %d has %d runes, want at most 40", i+1, n)
+			}
+			for _, w := range strings.Fields(c) {
+				if w != "word" {
+					t.Errorf("chunk %d cut mid-word: %q", i+1, c)
+				}
+				words++
+			}
+		}
+		if words <= 30 {
+			t.Errorf("%d words across chunks, want overlap to repeat some of the 30", words)
+		}
+	})
+
+	t.Run("multibyte runes counted as one", func(t *testing.T) {
+		got := chunkCVText(strings.Repeat("é", 30), 40, 5)
+		if len(got) != 1 {
+			t.Errorf("chunks = %q, want 30 runes to fit one chunk of 40", got)
+		}
+	})
+}
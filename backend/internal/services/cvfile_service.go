@@ -1,18 +1,42 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"io"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/yoockh/yoospeak/internal/models"
 	pgrepo "github.com/yoockh/yoospeak/internal/repositories/postgres"
+	"github.com/yoockh/yoospeak/internal/scanner"
 	"github.com/yoockh/yoospeak/internal/storage"
 	"github.com/yoockh/yoospeak/internal/utils"
 )
 
+const (
+	ScanClean       = "clean"
+	ScanQuarantined = "quarantined"
+	ScanUnscanned   = "unscanned"
+)
+
+// quarantinePrefix keeps rejected uploads apart from servable objects.
+const quarantinePrefix = "quarantine/"
+
 type CVFileService interface {
+	// Upload scans the file before storing it. A rejected file is stored under
+	// quarantine/ with a quarantined row and the call fails with InvalidArgument.
 	Upload(ctx context.Context, userID string, fileName string, fileSize int, mimeType string, objectName string, r storageReader) (*models.CVFile, error)
+	// DownloadURL returns a short-lived signed URL for one of the user's CVs.
+	DownloadURL(ctx context.Context, userID, cvFileID string, ttl time.Duration) (string, error)
+
+	List(ctx context.Context, userID string, limit, offset int) ([]models.CVFile, int64, error)
+	Get(ctx context.Context, userID, cvFileID string) (*models.CVFile, error)
+	// Activate makes the CV the one used for coaching and copies its text into the profile.
+	Activate(ctx context.Context, userID, cvFileID string) (*models.CVFile, error)
+	// Delete removes the row, clears profile CV data derived from it, then removes the stored object.
+	Delete(ctx context.Context, userID, cvFileID string) error
 }
 
 type storageReader interface {
@@ -21,11 +45,19 @@ type storageReader interface {
 
 type cvFileService struct {
 	repo     pgrepo.CVFileRepository
-	uploader storage.Uploader
+	store    storage.Backend
+	profiles ProfileService
+	chunks   pgrepo.CVChunkRepository
+	embeds   EmbeddingJobs // optional
+	scan     scanner.Scanner
 }
 
-func NewCVFileService(repo pgrepo.CVFileRepository, uploader storage.Uploader) CVFileService {
-	return &cvFileService{repo: repo, uploader: uploader}
+// NewCVFileService builds the service; a nil scan accepts every upload.
+func NewCVFileService(repo pgrepo.CVFileRepository, store storage.Backend, profiles ProfileService, chunks pgrepo.CVChunkRepository, embeds EmbeddingJobs, scan scanner.Scanner) CVFileService {
+	if scan == nil {
+		scan = scanner.Noop{}
+	}
+	return &cvFileService{repo: repo, store: store, profiles: profiles, chunks: chunks, embeds: embeds, scan: scan}
 }
 
 func (s *cvFileService) Upload(ctx context.Context, userID string, fileName string, fileSize int, mimeType string, objectName string, r storageReader) (*models.CVFile, error) {
@@ -34,28 +66,243 @@ func (s *cvFileService) Upload(ctx context.Context, userID string, fileName stri
 	if userID == "" || objectName == "" {
 		return nil, utils.E(utils.CodeInvalidArgument, op, "user_id and object_name are required", nil)
 	}
-	if s.uploader == nil {
+	if s.store == nil {
 		return nil, utils.E(utils.CodeInternal, op, "uploader is not configured", nil)
 	}
 
-	storedPath, err := s.uploader.Upload(ctx, objectName, mimeType, r)
+	// scanners need the whole file; uploads are capped at maxCVBytes anyway
+	data, err := io.ReadAll(io.LimitReader(r, maxCVBytes+1))
 	if err != nil {
-		return nil, utils.E(utils.CodeUnavailable, op, "failed to upload file", err)
+		return nil, utils.E(utils.CodeInvalidArgument, op, "failed to read upload", err)
+	}
+	if len(data) > maxCVBytes {
+		return nil, utils.E(utils.CodeInvalidArgument, op, "file too large", nil)
+	}
+
+	// fail closed: nothing is stored while the scanner is unreachable
+	verdict, err := s.scan.Scan(ctx, data)
+	if err != nil {
+		return nil, utils.E(utils.CodeUnavailable, op, "upload scanning unavailable", err)
 	}
 
 	row := &models.CVFile{
 		ID:       uuid.NewString(),
 		UserID:   userID,
 		FileName: fileName,
-		FilePath: storedPath, // <-- was public URL; now object key
 		FileSize: fileSize,
 		MimeType: mimeType,
 		UploadAt: time.Now().UTC(),
+
+		ScanStatus:       ScanClean,
+		ExtractionStatus: ExtractionPending,
+	}
+	if !verdict.Clean {
+		objectName = quarantinePrefix + objectName
+		row.ScanStatus = ScanQuarantined
+		row.ScanThreat = verdict.Threat
+		row.ExtractionStatus = ExtractionFailed
+		row.ExtractionError = "file quarantined"
 	}
 
+	storedPath, err := s.store.Upload(ctx, objectName, mimeType, bytes.NewReader(data))
+	if err != nil {
+		return nil, utils.E(utils.CodeUnavailable, op, "failed to upload file", err)
+	}
+	row.FilePath = storedPath // object key, not a public URL
+
 	if err := s.repo.Insert(ctx, row); err != nil {
 		return nil, utils.E(utils.CodeInternal, op, "failed to persist cv file metadata", err)
 	}
 
+	if row.ScanStatus == ScanQuarantined {
+		return nil, utils.E(utils.CodeInvalidArgument, op, "file rejected by upload scan: "+verdict.Threat, nil)
+	}
+
+	// the newest upload becomes the active CV; its text reaches the profile once extracted
+	if err := s.repo.SetActive(ctx, userID, row.ID); err != nil {
+		return nil, utils.E(utils.CodeInternal, op, "failed to activate cv", err)
+	}
+	row.IsActive = true
+
+	return row, nil
+}
+
+// getOwned loads a CV row, answering NotFound for other users' rows so ids don't leak.
+func (s *cvFileService) getOwned(ctx context.Context, op, userID, cvFileID string) (*models.CVFile, error) {
+	if userID == "" || cvFileID == "" {
+		return nil, utils.E(utils.CodeInvalidArgument, op, "user_id and cv id are required", nil)
+	}
+	if _, err := uuid.Parse(cvFileID); err != nil {
+		return nil, utils.E(utils.CodeInvalidArgument, op, "invalid cv id", err)
+	}
+
+	row, err := s.repo.GetByID(ctx, cvFileID)
+	if err != nil {
+		if errors.Is(err, utils.ErrNotFound) {
+			return nil, utils.E(utils.CodeNotFound, op, "cv not found", err)
+		}
+		return nil, utils.E(utils.CodeInternal, op, "failed to get cv file", err)
+	}
+	if row.UserID != userID {
+		return nil, utils.E(utils.CodeNotFound, op, "cv not found", nil)
+	}
+	return row, nil
+}
+
+func (s *cvFileService) DownloadURL(ctx context.Context, userID, cvFileID string, ttl time.Duration) (string, error) {
+	const op = "CVFileService.DownloadURL"
+
+	if s.store == nil {
+		return "", utils.E(utils.CodeUnavailable, op, "storage is not configured", nil)
+	}
+
+	row, err := s.getOwned(ctx, op, userID, cvFileID)
+	if err != nil {
+		return "", err
+	}
+	if row.ScanStatus == ScanQuarantined {
+		return "", utils.E(utils.CodeForbidden, op, "cv is quarantined", nil)
+	}
+
+	u, err := s.store.SignedGetURL(ctx, row.FilePath, ttl)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			return "", utils.E(utils.CodeNotFound, op, "stored cv object not found", err)
+		}
+		return "", utils.E(utils.CodeUnavailable, op, "failed to sign download url", err)
+	}
+	return u, nil
+}
+
+func (s *cvFileService) List(ctx context.Context, userID string, limit, offset int) ([]models.CVFile, int64, error) {
+	const op = "CVFileService.List"
+
+	if userID == "" {
+		return nil, 0, utils.E(utils.CodeInvalidArgument, op, "user_id is required", nil)
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	rows, total, err := s.repo.ListByUser(ctx, userID, limit, offset)
+	if err != nil {
+		return nil, 0, utils.E(utils.CodeInternal, op, "failed to list cv files", err)
+	}
+	return rows, total, nil
+}
+
+func (s *cvFileService) Get(ctx context.Context, userID, cvFileID string) (*models.CVFile, error) {
+	return s.getOwned(ctx, "CVFileService.Get", userID, cvFileID)
+}
+
+func (s *cvFileService) Activate(ctx context.Context, userID, cvFileID string) (*models.CVFile, error) {
+	const op = "CVFileService.Activate"
+
+	row, err := s.getOwned(ctx, op, userID, cvFileID)
+	if err != nil {
+		return nil, err
+	}
+	if row.ScanStatus == ScanQuarantined {
+		return nil, utils.E(utils.CodeInvalidArgument, op, "cv is quarantined", nil)
+	}
+
+	if err := s.repo.SetActive(ctx, userID, row.ID); err != nil {
+		if errors.Is(err, utils.ErrNotFound) {
+			return nil, utils.E(utils.CodeNotFound, op, "cv not found", err)
+		}
+		return nil, utils.E(utils.CodeInternal, op, "failed to activate cv", err)
+	}
+	row.IsActive = true
+
+	// not extracted yet: the extraction job applies it when it finishes
+	if row.ExtractionStatus == ExtractionDone && row.ExtractedText != "" {
+		if err := applyCVText(ctx, s.profiles, s.embeds, userID, &row.ID, row.ExtractedText); err != nil {
+			return nil, err
+		}
+	}
 	return row, nil
 }
+
+func (s *cvFileService) Delete(ctx context.Context, userID, cvFileID string) error {
+	const op = "CVFileService.Delete"
+
+	if s.store == nil {
+		return utils.E(utils.CodeUnavailable, op, "storage is not configured", nil)
+	}
+
+	row, err := s.getOwned(ctx, op, userID, cvFileID)
+	if err != nil {
+		return err
+	}
+
+	// row first: a failed object delete then leaves an unreachable object behind,
+	// never a listed CV whose download 404s
+	if err := s.repo.Delete(ctx, row.ID); err != nil {
+		return utils.E(utils.CodeInternal, op, "failed to delete cv file metadata", err)
+	}
+	if err := s.clearDerived(ctx, op, userID, row.ID); err != nil {
+		return err
+	}
+
+	if err := s.store.Delete(ctx, row.FilePath); err != nil {
+		return utils.E(utils.CodeUnavailable, op, "cv deleted but its stored file was not removed", err)
+	}
+	return nil
+}
+
+// clearDerived wipes the profile's CV text, embedding and chunks when they came from fileID.
+func (s *cvFileService) clearDerived(ctx context.Context, op, userID, fileID string) error {
+	p, err := s.profiles.GetMe(ctx, userID)
+	if err != nil {
+		if utils.IsCode(err, utils.CodeNotFound) {
+			return nil
+		}
+		return err
+	}
+	if p.CVFileID == nil || *p.CVFileID != fileID {
+		return nil
+	}
+
+	p.CVText = ""
+	p.CVFileID = nil
+	p.UpdatedAt = time.Now().UTC()
+	if err := s.profiles.Upsert(ctx, p); err != nil {
+		return err
+	}
+	if err := s.profiles.SetCVEmbedding(ctx, userID, nil); err != nil {
+		return err
+	}
+	if s.chunks != nil {
+		if err := s.chunks.DeleteByUser(ctx, userID); err != nil {
+			return utils.E(utils.CodeInternal, op, "failed to delete cv chunks", err)
+		}
+	}
+	return nil
+}
+
+// applyCVText writes CV text (and the file it came from) into the profile and
+// schedules re-embedding.
+func applyCVText(ctx context.Context, profiles ProfileService, embeds EmbeddingJobs, userID string, fileID *string, text string) error {
+	p, err := profiles.GetMe(ctx, userID)
+	if err != nil {
+		if !utils.IsCode(err, utils.CodeNotFound) {
+			return err
+		}
+		p = &models.Profile{UserID: userID}
+	}
+	p.CVText = text
+	p.CVFileID = fileID
+	p.UpdatedAt = time.Now().UTC()
+	if err := profiles.Upsert(ctx, p); err != nil {
+		return err
+	}
+
+	// re-embed CV asynchronously (best-effort)
+	if embeds != nil {
+		_ = embeds.EnqueueProfileCV(ctx, userID)
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/yoockh/yoospeak/internal/models"
+	pgrepo "github.com/yoockh/yoospeak/internal/repositories/postgres"
+	"github.com/yoockh/yoospeak/internal/storage"
+	"github.com/yoockh/yoospeak/internal/utils"
+)
+
+const (
+	cvOwner = "11111111-1111-1111-1111-111111111111"
+	cvOther = "22222222-2222-2222-2222-222222222222"
+	cvA     = "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa"
+	cvB     = "bbbbbbbb-bbbb-bbbb-bbbb-bbbbbbbbbbbb"
+	cvQ     = "cccccccc-cccc-cccc-cccc-cccccccccccc"
+	cvTheir = "dddddddd-dddd-dddd-dddd-dddddddddddd"
+)
+
+// cvFixture records the order of row, object and profile writes in steps.
+type cvFixture struct {
+	steps    []string
+	rows     map[string]*models.CVFile
+	objects  map[string]bool
+	profiles map[string]*models.Profile
+	chunks   map[string]bool
+	embedded map[string]bool
+	enqueued []string
+
+	listLimit  int
+	listOffset int
+	storeErr   error
+}
+
+type memCVFileRepo struct {
+	pgrepo.CVFileRepository
+	f *cvFixture
+}
+
+func (r memCVFileRepo) GetByID(_ context.Context, id string) (*models.CVFile, error) {
+	row, ok := r.f.rows[id]
+	if !ok {
+		return nil, utils.ErrNotFound
+	}
+	cp := *row
+	return &cp, nil
+}
+
+func (r memCVFileRepo) ListByUser(_ context.Context, userID string, limit, offset int) ([]models.CVFile, int64, error) {
+	r.f.listLimit, r.f.listOffset = limit, offset
+	var out []models.CVFile
+	for _, id := range []string{cvA, cvB, cvQ, cvTheir} {
+		if row, ok := r.f.rows[id]; ok && row.UserID == userID {
+			out = append(out, *row)
+		}
+	}
+	return out, int64(len(out)), nil
+}
+
+func (r memCVFileRepo) SetActive(_ context.Context, userID, id string) error {
+	r.f.steps = append(r.f.steps, "activate "+id)
+	for _, row := range r.f.rows {
+		if row.UserID == userID {
+			row.IsActive = row.ID == id
+		}
+	}
+	return nil
+}
+
+func (r memCVFileRepo) Delete(_ context.Context, id string) error {
+	r.f.steps = append(r.f.steps, "delete row "+id)
+	delete(r.f.rows, id)
+	return nil
+}
+
+type memCVStore struct {
+	storage.Backend
+	f *cvFixture
+}
+
+func (s memCVStore) Delete(_ context.Context, name string) error {
+	s.f.steps = append(s.f.steps, "delete object "+name)
+	if s.f.storeErr != nil {
+		return s.f.storeErr
+	}
+	delete(s.f.objects, name)
+	return nil
+}
+
+type memProfiles struct{ f *cvFixture }
+
+func (p memProfiles) GetMe(_ context.Context, userID string) (*models.Profile, error) {
+	prof, ok := p.f.profiles[userID]
+	if !ok {
+		return nil, utils.E(utils.CodeNotFound, "memProfiles.GetMe", "profile not found", nil)
+	}
+	cp := *prof
+	return &cp, nil
+}
+
+func (p memProfiles) Upsert(_ context.Context, prof *models.Profile) error {
+	p.f.steps = append(p.f.steps, "upsert profile")
+	cp := *prof
+	p.f.profiles[prof.UserID] = &cp
+	return nil
+}
+
+func (p memProfiles) SetCVEmbedding(_ context.Context, userID string, vec []float32) error {
+	p.f.embedded[userID] = vec != nil
+	return nil
+}
+
+type memCVChunks struct {
+	pgrepo.CVChunkRepository
+	f *cvFixture
+}
+
+func (c memCVChunks) DeleteByUser(_ context.Context, userID string) error {
+	delete(c.f.chunks, userID)
+	return nil
+}
+
+type memEmbeds struct{ f *cvFixture }
+
+func (e memEmbeds) EnqueueConversation(context.Context, string) error { return nil }
+
+func (e memEmbeds) EnqueueProfileCV(_ context.Context, userID string) error {
+	e.f.enqueued = append(e.f.enqueued, userID)
+	return nil
+}
+
+// newCVFileFixture gives cvOwner an extracted active CV A (whose text is in the
+// profile), an unextracted CV B and a quarantined CV Q; cvOther owns cvTheir.
+func newCVFileFixture() (*cvFixture, CVFileService) {
+	fileA := cvA
+	f := &cvFixture{
+		rows: map[string]*models.CVFile{
+			cvA:     {ID: cvA, UserID: cvOwner, FilePath: "cv/a.pdf", IsActive: true, ScanStatus: ScanClean, ExtractionStatus: ExtractionDone, ExtractedText: "cv a text"},
+			cvB:     {ID: cvB, UserID: cvOwner, FilePath: "cv/b.pdf", ScanStatus: ScanClean, ExtractionStatus: ExtractionPending},
+			cvQ:     {ID: cvQ, UserID: cvOwner, FilePath: "quarantine/cv/q.pdf", ScanStatus: ScanQuarantined, ExtractionStatus: ExtractionFailed},
+			cvTheir: {ID: cvTheir, UserID: cvOther, FilePath: "cv/their.pdf", IsActive: true, ScanStatus: ScanClean, ExtractionStatus: ExtractionDone, ExtractedText: "their text"},
+		},
+		objects:  map[string]bool{"cv/a.pdf": true, "cv/b.pdf": true, "quarantine/cv/q.pdf": true, "cv/their.pdf": true},
+		profiles: map[string]*models.Profile{cvOwner: {UserID: cvOwner, CVText: "cv a text", CVFileID: &fileA}},
+		chunks:   map[string]bool{cvOwner: true},
+		embedded: map[string]bool{cvOwner: true},
+	}
+	svc := NewCVFileService(memCVFileRepo{f: f}, memCVStore{f: f}, memProfiles{f: f}, memCVChunks{f: f}, memEmbeds{f: f}, nil)
+	return f, svc
+}
+
+func TestCVFileServiceList(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name          string
+		limit, offset int
+		wantLimit     int
+		wantOffset    int
+	}{
+		{"default limit", 0, 0, 20, 0},
+		{"limit in range kept", 5, 10, 5, 10},
+		{"limit over 100 reset", 500, 0, 20, 0},
+		{"negative offset reset", 10, -3, 10, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, svc := newCVFileFixture()
+			rows, total, err := svc.List(ctx, cvOwner, tt.limit, tt.offset)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if f.listLimit != tt.wantLimit || f.listOffset != tt.wantOffset {
+				t.Errorf("repo paged with limit %d offset %d, want %d %d", f.listLimit, f.listOffset, tt.wantLimit, tt.wantOffset)
+			}
+			if total != 3 || len(rows) != 3 {
+				t.Errorf("List = %d rows of %d, want the owner's 3", len(rows), total)
+			}
+			for _, row := range rows {
+				if row.UserID != cvOwner {
+					t.Errorf("listed %s owned by %s", row.ID, row.UserID)
+				}
+			}
+		})
+	}
+
+	t.Run("user required", func(t *testing.T) {
+		_, svc := newCVFileFixture()
+		if _, _, err := svc.List(ctx, "", 10, 0); !utils.IsCode(err, utils.CodeInvalidArgument) {
+			t.Errorf("List without user = %v, want InvalidArgument", err)
+		}
+	})
+}
+
+func TestCVFileServiceGet(t *testing.T) {
+	ctx := context.Background()
+	_, svc := newCVFileFixture()
+
+	row, err := svc.Get(ctx, cvOwner, cvA)
+	if err != nil || row.ID != cvA {
+		t.Fatalf("Get own cv = %+v, %v", row, err)
+	}
+
+	tests := []struct {
+		name string
+		user string
+		id   string
+		code utils.Code
+	}{
+		{"other user's cv", cvOwner, cvTheir, utils.CodeNotFound},
+		{"unknown cv", cvOwner, "eeeeeeee-eeee-eeee-eeee-eeeeeeeeeeee", utils.CodeNotFound},
+		{"malformed id", cvOwner, "not-a-uuid", utils.CodeInvalidArgument},
+		{"no user", "", cvA, utils.CodeInvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.Get(ctx, tt.user, tt.id); !utils.IsCode(err, tt.code) {
+				t.Errorf("Get = %v, want %s", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestCVFileServiceActivate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("extracted cv copied into the profile", func(t *testing.T) {
+		f, svc := newCVFileFixture()
+		f.rows[cvB].ExtractionStatus = ExtractionDone
+		f.rows[cvB].ExtractedText = "cv b text"
+
+		row, err := svc.Activate(ctx, cvOwner, cvB)
+		if err != nil {
+			t.Fatalf("Activate: %v", err)
+		}
+		if !row.IsActive || !f.rows[cvB].IsActive || f.rows[cvA].IsActive {
+			t.Errorf("active rows A=%v B=%v, want only B", f.rows[cvA].IsActive, f.rows[cvB].IsActive)
+		}
+		p := f.profiles[cvOwner]
+		if p.CVText != "cv b text" || p.CVFileID == nil || *p.CVFileID != cvB {
+			t.Errorf("profile cv = %q from %v, want B's text", p.CVText, p.CVFileID)
+		}
+		if len(f.enqueued) != 1 || f.enqueued[0] != cvOwner {
+			t.Errorf("re-embeds enqueued %v, want one for the owner", f.enqueued)
+		}
+	})
+
+	t.Run("unextracted cv leaves the profile for the extraction job", func(t *testing.T) {
+		f, svc := newCVFileFixture()
+		if _, err := svc.Activate(ctx, cvOwner, cvB); err != nil {
+			t.Fatalf("Activate: %v", err)
+		}
+		if !f.rows[cvB].IsActive {
+			t.Errorf("B not activated")
+		}
+		if p := f.profiles[cvOwner]; p.CVText != "cv a text" || len(f.enqueued) != 0 {
+			t.Errorf("profile cv = %q, %d re-embeds; want A's text kept until B is extracted", p.CVText, len(f.enqueued))
+		}
+	})
+
+	t.Run("quarantined cv refused", func(t *testing.T) {
+		f, svc := newCVFileFixture()
+		if _, err := svc.Activate(ctx, cvOwner, cvQ); !utils.IsCode(err, utils.CodeInvalidArgument) {
+			t.Errorf("Activate quarantined = %v, want InvalidArgument", err)
+		}
+		if f.rows[cvQ].IsActive || len(f.steps) != 0 {
+			t.Errorf("quarantined activation wrote %v", f.steps)
+		}
+	})
+
+	t.Run("other user's cv not found", func(t *testing.T) {
+		f, svc := newCVFileFixture()
+		if _, err := svc.Activate(ctx, cvOwner, cvTheir); !utils.IsCode(err, utils.CodeNotFound) {
+			t.Errorf("Activate other user's cv = %v, want NotFound", err)
+		}
+		if len(f.steps) != 0 {
+			t.Errorf("foreign activation wrote %v", f.steps)
+		}
+	})
+}
+
+func TestCVFileServiceDelete(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("active cv clears derived profile data", func(t *testing.T) {
+		f, svc := newCVFileFixture()
+		if err := svc.Delete(ctx, cvOwner, cvA); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		want := []string{"delete row " + cvA, "upsert profile", "delete object cv/a.pdf"}
+		if len(f.steps) != len(want) {
+			t.Fatalf("steps = %q, want %q", f.steps, want)
+		}
+		for i := range want {
+			if f.steps[i] != want[i] {
+				t.Fatalf("steps = %q, want %q", f.steps, want)
+			}
+		}
+		if _, ok := f.rows[cvA]; ok || f.objects["cv/a.pdf"] {
+			t.Errorf("row or object kept after delete")
+		}
+		p := f.profiles[cvOwner]
+		if p.CVText != "" || p.CVFileID != nil || f.embedded[cvOwner] || f.chunks[cvOwner] {
+			t.Errorf("profile kept cv %q from %v (embedded=%v, chunks=%v)", p.CVText, p.CVFileID, f.embedded[cvOwner], f.chunks[cvOwner])
+		}
+	})
+
+	t.Run("other cv leaves the profile alone", func(t *testing.T) {
+		f, svc := newCVFileFixture()
+		if err := svc.Delete(ctx, cvOwner, cvB); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		p := f.profiles[cvOwner]
+		if p.CVText != "cv a text" || p.CVFileID == nil || !f.embedded[cvOwner] || !f.chunks[cvOwner] {
+			t.Errorf("deleting B touched A's profile data: %+v", p)
+		}
+	})
+
+	t.Run("row gone even when the object delete fails", func(t *testing.T) {
+		f, svc := newCVFileFixture()
+		f.storeErr = errors.New("bucket unavailable")
+		if err := svc.Delete(ctx, cvOwner, cvA); !utils.IsCode(err, utils.CodeUnavailable) {
+			t.Errorf("Delete = %v, want Unavailable", err)
+		}
+		if _, ok := f.rows[cvA]; ok {
+			t.Errorf("row kept pointing at %s", f.rows[cvA].FilePath)
+		}
+		if p := f.profiles[cvOwner]; p.CVFileID != nil {
+			t.Errorf("profile still derived from the deleted cv")
+		}
+		if _, err := svc.Get(ctx, cvOwner, cvA); !utils.IsCode(err, utils.CodeNotFound) {
+			t.Errorf("Get after delete = %v, want NotFound", err)
+		}
+	})
+
+	t.Run("other user's cv not found", func(t *testing.T) {
+		f, svc := newCVFileFixture()
+		if err := svc.Delete(ctx, cvOwner, cvTheir); !utils.IsCode(err, utils.CodeNotFound) {
+			t.Errorf("Delete other user's cv = %v, want NotFound", err)
+		}
+		if len(f.steps) != 0 || !f.objects["cv/their.pdf"] {
+			t.Errorf("foreign delete ran %v", f.steps)
+		}
+	})
+}
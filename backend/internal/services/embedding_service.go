@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/pgvector/pgvector-go"
+	"github.com/yoockh/yoospeak/internal/providers/embeddings"
+	pgrepo "github.com/yoockh/yoospeak/internal/repositories/postgres"
+	"github.com/yoockh/yoospeak/internal/utils"
+)
+
+// EmbeddingJobs schedules asynchronous embedding work (implemented by workers.EmbeddingQueue).
+type EmbeddingJobs interface {
+	EnqueueConversation(ctx context.Context, logID string) error
+	EnqueueProfileCV(ctx context.Context, userID string) error
+}
+
+// EmbeddingService computes and stores embeddings; called by the embedding worker.
+type EmbeddingService interface {
+	EmbedConversation(ctx context.Context, logID string) error
+	EmbedProfileCV(ctx context.Context, userID string) error
+}
+
+type embeddingService struct {
+	provider embeddings.Provider
+	convos   pgrepo.ConversationRepo
+	profiles ProfileService
+	cv       CVRetrievalService // optional: per-passage CV index
+}
+
+func NewEmbeddingService(provider embeddings.Provider, convos pgrepo.ConversationRepo, profiles ProfileService, cv CVRetrievalService) EmbeddingService {
+	return &embeddingService{provider: provider, convos: convos, profiles: profiles, cv: cv}
+}
+
+func (s *embeddingService) embedOne(ctx context.Context, op string, text string) ([]float32, error) {
+	vecs, err := s.provider.Embed(ctx, embeddings.TaskDocument, []string{text})
+	if err != nil {
+		return nil, utils.E(utils.CodeUnavailable, op, "embedding provider failed", err)
+	}
+	if len(vecs) != 1 || len(vecs[0]) != embeddings.Dimensions {
+		return nil, utils.E(utils.CodeInternal, op, "embedding has unexpected dimensions", nil)
+	}
+	return vecs[0], nil
+}
+
+func (s *embeddingService) EmbedConversation(ctx context.Context, logID string) error {
+	const op = "EmbeddingService.EmbedConversation"
+
+	if logID == "" {
+		return utils.E(utils.CodeInvalidArgument, op, "log id is required", nil)
+	}
+
+	row, err := s.convos.GetByID(ctx, logID)
+	if err != nil {
+		if errors.Is(err, utils.ErrNotFound) {
+			return utils.E(utils.CodeNotFound, op, "conversation log not found", err)
+		}
+		return utils.E(utils.CodeInternal, op, "failed to get conversation log", err)
+	}
+	if strings.TrimSpace(row.Content) == "" {
+		return nil
+	}
+
+	vec, err := s.embedOne(ctx, op, row.Content)
+	if err != nil {
+		return err
+	}
+	if err := s.convos.UpdateEmbedding(ctx, logID, pgvector.NewVector(vec)); err != nil {
+		return utils.E(utils.CodeInternal, op, "failed to store embedding", err)
+	}
+	return nil
+}
+
+func (s *embeddingService) EmbedProfileCV(ctx context.Context, userID string) error {
+	const op = "EmbeddingService.EmbedProfileCV"
+
+	if userID == "" {
+		return utils.E(utils.CodeInvalidArgument, op, "user_id is required", nil)
+	}
+
+	p, err := s.profiles.GetMe(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if s.cv != nil {
+		if err := s.cv.Reindex(ctx, userID, p.CVText); err != nil {
+			return err
+		}
+	}
+
+	// CV removed: drop the stale vector
+	if strings.TrimSpace(p.CVText) == "" {
+		return s.profiles.SetCVEmbedding(ctx, userID, nil)
+	}
+
+	vec, err := s.embedOne(ctx, op, p.CVText)
+	if err != nil {
+		return err
+	}
+	return s.profiles.SetCVEmbedding(ctx, userID, vec)
+}
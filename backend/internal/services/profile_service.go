@@ -5,6 +5,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/pgvector/pgvector-go"
 	"github.com/yoockh/yoospeak/internal/cache"
 	"github.com/yoockh/yoospeak/internal/models"
 	pgrepo "github.com/yoockh/yoospeak/internal/repositories/postgres"
@@ -14,6 +15,8 @@ import (
 type ProfileService interface {
 	GetMe(ctx context.Context, userID string) (*models.Profile, error)
 	Upsert(ctx context.Context, p *models.Profile) error
+	// SetCVEmbedding stores the CV embedding (nil clears it).
+	SetCVEmbedding(ctx context.Context, userID string, vec []float32) error
 }
 
 type profileService struct {
@@ -87,3 +90,25 @@ func (s *profileService) Upsert(ctx context.Context, p *models.Profile) error {
 
 	return nil
 }
+
+func (s *profileService) SetCVEmbedding(ctx context.Context, userID string, vec []float32) error {
+	const op = "ProfileService.SetCVEmbedding"
+
+	if userID == "" {
+		return utils.E(utils.CodeInvalidArgument, op, "user_id is required", nil)
+	}
+
+	var v *pgvector.Vector
+	if len(vec) > 0 {
+		pv := pgvector.NewVector(vec)
+		v = &pv
+	}
+	if err := s.profiles.UpdateCVEmbedding(ctx, userID, v); err != nil {
+		return utils.E(utils.CodeInternal, op, "failed to update cv embedding", err)
+	}
+
+	if s.cache != nil {
+		_ = s.cache.Del(ctx, profileKey(userID))
+	}
+	return nil
+}
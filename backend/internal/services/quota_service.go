@@ -0,0 +1,422 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yoockh/yoospeak/internal/cache"
+	"github.com/yoockh/yoospeak/internal/models"
+	pgrepo "github.com/yoockh/yoospeak/internal/repositories/postgres"
+	"github.com/yoockh/yoospeak/internal/utils"
+)
+
+// QuotaPlans maps plan names to their daily limits.
+type QuotaPlans map[string]models.QuotaLimits
+
+// QuotaConfig is the plan table; users without a known plan get DefaultPlan.
+type QuotaConfig struct {
+	Plans       QuotaPlans
+	DefaultPlan string
+}
+
+// QuotaUsage is what a user used today (UTC).
+type QuotaUsage struct {
+	AudioMinutes float64 `json:"audio_minutes"`
+	Sessions     int64   `json:"sessions"`
+	LLMTokens    int64   `json:"llm_tokens"`
+}
+
+// QuotaStatus is a user's effective limits and today's usage against them.
+type QuotaStatus struct {
+	UserID   string                `json:"user_id"`
+	Plan     string                `json:"plan"`
+	Limits   models.QuotaLimits    `json:"limits"`
+	Used     QuotaUsage            `json:"used"`
+	Override *models.QuotaOverride `json:"override,omitempty"`
+	ResetsAt time.Time             `json:"resets_at"`
+}
+
+// QuotaService enforces per-user daily limits. plan is the plan the caller's
+// token carries ("" for none); an admin override takes precedence over it.
+//
+// Checks fail open: when Redis is unreachable, users are let through rather
+// than locked out of the realtime path.
+type QuotaService interface {
+	// StartSession counts a new session against today's allowance, or fails
+	// with CodeQuotaExceeded (counting nothing) when it is used up.
+	StartSession(ctx context.Context, userID, plan string) error
+	// AdmitAudio reserves estimate of today's audio allowance for one chunk, or
+	// fails with CodeQuotaExceeded (reserving nothing) when the chunk does not
+	// fit or today's LLM tokens are used up. Tokens cannot be known up front,
+	// so that limit only stops chunks once it has been reached.
+	AdmitAudio(ctx context.Context, userID, plan, sessionID string, chunkIndex int64, estimate time.Duration) error
+	// SettleAudio replaces the chunk's reservation with the audio it used (0
+	// releases it). Without a reservation, used is counted as is.
+	SettleAudio(ctx context.Context, userID, sessionID string, chunkIndex int64, used time.Duration) error
+	AddLLMTokens(ctx context.Context, userID string, n int64) error
+	Status(ctx context.Context, userID, plan string) (*QuotaStatus, error)
+
+	GetOverride(ctx context.Context, userID string) (*models.QuotaOverride, error)
+	SetOverride(ctx context.Context, o *models.QuotaOverride) error
+	DeleteOverride(ctx context.Context, userID string) error
+}
+
+type quotaService struct {
+	rdb       *redis.Client
+	cfg       QuotaConfig
+	overrides pgrepo.QuotaOverrideRepo
+	cache     cache.Cache
+	cacheTTL  time.Duration
+}
+
+// NewQuotaService enforces plan limits only; overrides is optional (nil
+// leaves every user on their plan and makes SetOverride unavailable).
+func NewQuotaService(rdb *redis.Client, cfg QuotaConfig, overrides pgrepo.QuotaOverrideRepo) QuotaService {
+	return &quotaService{rdb: rdb, cfg: cfg, overrides: overrides}
+}
+
+// NewQuotaServiceWithCache caches overrides, which are read on every audio chunk.
+func NewQuotaServiceWithCache(rdb *redis.Client, cfg QuotaConfig, overrides pgrepo.QuotaOverrideRepo, c cache.Cache, ttl time.Duration) QuotaService {
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	return &quotaService{rdb: rdb, cfg: cfg, overrides: overrides, cache: c, cacheTTL: ttl}
+}
+
+// Counters live in one hash per user and UTC day; they outlive the day a
+// little so Status around midnight still reads yesterday consistently.
+const (
+	quotaFieldSessions  = "sessions"
+	quotaFieldAudioMS   = "audio_ms"
+	quotaFieldLLMTokens = "llm_tokens"
+	quotaCounterTTL     = 48 * time.Hour
+)
+
+func quotaKey(userID string, now time.Time) string {
+	return "quota:" + userID + ":" + now.UTC().Format("2006-01-02")
+}
+
+func quotaOverrideKey(userID string) string { return "quota:override:" + userID }
+
+// QuotaResetsAt is when the day's counters start over: the next UTC midnight.
+func QuotaResetsAt(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
+
+// startSessionScript counts a session unless that would exceed ARGV[1] (0 = unlimited).
+// Returns the new count, or -1 when the limit was already reached.
+var startSessionScript = redis.NewScript(`
+local n = redis.call('HINCRBY', KEYS[1], 'sessions', 1)
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+local limit = tonumber(ARGV[1])
+if limit > 0 and n > limit then
+  redis.call('HINCRBY', KEYS[1], 'sessions', -1)
+  return -1
+end
+return n
+`)
+
+func (s *quotaService) StartSession(ctx context.Context, userID, plan string) error {
+	const op = "QuotaService.StartSession"
+
+	if userID == "" {
+		return utils.E(utils.CodeInvalidArgument, op, "user_id is required", nil)
+	}
+	name, limits, _ := s.effective(ctx, userID, plan)
+
+	n, err := startSessionScript.Run(ctx, s.rdb,
+		[]string{quotaKey(userID, time.Now())},
+		limits.SessionsPerDay, int64(quotaCounterTTL/time.Second),
+	).Int64()
+	if err != nil {
+		return nil // fail open
+	}
+	if n < 0 {
+		return utils.E(utils.CodeQuotaExceeded, op,
+			fmt.Sprintf("daily session limit reached (%d on plan %s)", limits.SessionsPerDay, name), nil)
+	}
+	return nil
+}
+
+// admitAudioScript reserves ARGV[3] ms of audio in field ARGV[4] of today's
+// counters unless audio_ms would pass ARGV[1] or llm_tokens has reached
+// ARGV[2] (0 = unlimited). Reserved audio is counted in audio_ms right away.
+// Returns 1, or -1 / -2 when the audio / token limit refused the chunk. A
+// chunk index that already holds a reservation (a resent chunk) keeps it.
+var admitAudioScript = redis.NewScript(`
+local tokenLimit = tonumber(ARGV[2])
+if tokenLimit > 0 and tonumber(redis.call('HGET', KEYS[1], 'llm_tokens') or '0') >= tokenLimit then
+  return -2
+end
+if redis.call('HEXISTS', KEYS[1], ARGV[4]) == 1 then
+  return 1
+end
+local audioLimit = tonumber(ARGV[1])
+local est = tonumber(ARGV[3])
+local used = tonumber(redis.call('HGET', KEYS[1], 'audio_ms') or '0')
+if audioLimit > 0 and used + est > audioLimit then
+  return -1
+end
+redis.call('HINCRBY', KEYS[1], 'audio_ms', est)
+redis.call('HSET', KEYS[1], ARGV[4], est)
+redis.call('EXPIRE', KEYS[1], ARGV[5])
+return 1
+`)
+
+// settleAudioScript moves audio_ms by ARGV[2] minus the reservation in field
+// ARGV[1], found in today's (KEYS[1]) or, across midnight, yesterday's
+// counters (KEYS[2]), and drops the reservation.
+var settleAudioScript = redis.NewScript(`
+local key = KEYS[1]
+local reserved = redis.call('HGET', key, ARGV[1])
+if not reserved then
+  reserved = redis.call('HGET', KEYS[2], ARGV[1])
+  if reserved then key = KEYS[2] end
+end
+local delta = tonumber(ARGV[2]) - tonumber(reserved or '0')
+if reserved then
+  redis.call('HDEL', key, ARGV[1])
+end
+if delta ~= 0 then
+  redis.call('HINCRBY', key, 'audio_ms', delta)
+  redis.call('EXPIRE', key, ARGV[3])
+end
+return delta
+`)
+
+func quotaReservationField(sessionID string, chunkIndex int64) string {
+	return "reserved:" + sessionID + ":" + strconv.FormatInt(chunkIndex, 10)
+}
+
+func (s *quotaService) AdmitAudio(ctx context.Context, userID, plan, sessionID string, chunkIndex int64, estimate time.Duration) error {
+	const op = "QuotaService.AdmitAudio"
+
+	if userID == "" {
+		return utils.E(utils.CodeInvalidArgument, op, "user_id is required", nil)
+	}
+	name, limits, _ := s.effective(ctx, userID, plan)
+
+	res, err := admitAudioScript.Run(ctx, s.rdb,
+		[]string{quotaKey(userID, time.Now())},
+		limits.AudioMinutesPerDay*int64(time.Minute/time.Millisecond), limits.LLMTokensPerDay,
+		max(estimate.Milliseconds(), 0), quotaReservationField(sessionID, chunkIndex), int64(quotaCounterTTL/time.Second),
+	).Int64()
+	if err != nil {
+		return nil // fail open
+	}
+	switch res {
+	case -1:
+		return utils.E(utils.CodeQuotaExceeded, op,
+			fmt.Sprintf("daily audio limit reached (%d minutes on plan %s)", limits.AudioMinutesPerDay, name), nil)
+	case -2:
+		return utils.E(utils.CodeQuotaExceeded, op,
+			fmt.Sprintf("daily LLM token limit reached (%d on plan %s)", limits.LLMTokensPerDay, name), nil)
+	}
+	return nil
+}
+
+func (s *quotaService) SettleAudio(ctx context.Context, userID, sessionID string, chunkIndex int64, used time.Duration) error {
+	const op = "QuotaService.SettleAudio"
+
+	if userID == "" {
+		return utils.E(utils.CodeInvalidArgument, op, "user_id is required", nil)
+	}
+	now := time.Now()
+	err := settleAudioScript.Run(ctx, s.rdb,
+		[]string{quotaKey(userID, now), quotaKey(userID, now.Add(-24*time.Hour))},
+		quotaReservationField(sessionID, chunkIndex), max(used.Milliseconds(), 0), int64(quotaCounterTTL/time.Second),
+	).Err()
+	if err != nil {
+		return utils.E(utils.CodeUnavailable, op, "failed to update quota counter", err)
+	}
+	return nil
+}
+
+func (s *quotaService) AddLLMTokens(ctx context.Context, userID string, n int64) error {
+	return s.add(ctx, "QuotaService.AddLLMTokens", userID, quotaFieldLLMTokens, n)
+}
+
+func (s *quotaService) add(ctx context.Context, op, userID, field string, n int64) error {
+	if userID == "" {
+		return utils.E(utils.CodeInvalidArgument, op, "user_id is required", nil)
+	}
+	if n <= 0 {
+		return nil
+	}
+	key := quotaKey(userID, time.Now())
+	_, err := s.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.HIncrBy(ctx, key, field, n)
+		p.Expire(ctx, key, quotaCounterTTL)
+		return nil
+	})
+	if err != nil {
+		return utils.E(utils.CodeUnavailable, op, "failed to update quota counter", err)
+	}
+	return nil
+}
+
+func (s *quotaService) Status(ctx context.Context, userID, plan string) (*QuotaStatus, error) {
+	const op = "QuotaService.Status"
+
+	if userID == "" {
+		return nil, utils.E(utils.CodeInvalidArgument, op, "user_id is required", nil)
+	}
+	name, limits, o := s.effective(ctx, userID, plan)
+	used, err := s.used(ctx, userID)
+	if err != nil {
+		return nil, utils.E(utils.CodeUnavailable, op, "failed to read quota counters", err)
+	}
+	return &QuotaStatus{
+		UserID:   userID,
+		Plan:     name,
+		Limits:   limits,
+		Used:     used,
+		Override: o,
+		ResetsAt: QuotaResetsAt(time.Now()),
+	}, nil
+}
+
+func (s *quotaService) used(ctx context.Context, userID string) (QuotaUsage, error) {
+	vals, err := s.rdb.HMGet(ctx, quotaKey(userID, time.Now()), quotaFieldSessions, quotaFieldAudioMS, quotaFieldLLMTokens).Result()
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+	n := func(i int) int64 {
+		str, _ := vals[i].(string)
+		v, _ := strconv.ParseInt(str, 10, 64)
+		return v
+	}
+	return QuotaUsage{
+		Sessions:     n(0),
+		AudioMinutes: float64(n(1)) / float64(time.Minute/time.Millisecond),
+		LLMTokens:    n(2),
+	}, nil
+}
+
+// effective resolves the user's plan and limits: the override's plan wins
+// over the token's, unknown plans fall back to the default, and each limit
+// the override sets replaces the plan's.
+func (s *quotaService) effective(ctx context.Context, userID, plan string) (string, models.QuotaLimits, *models.QuotaOverride) {
+	o := s.override(ctx, userID)
+	if o != nil && o.Plan != "" {
+		plan = o.Plan
+	}
+	limits, ok := s.cfg.Plans[plan]
+	if !ok {
+		plan = s.cfg.DefaultPlan
+		limits = s.cfg.Plans[plan]
+	}
+	if o != nil {
+		if o.AudioMinutesPerDay != nil {
+			limits.AudioMinutesPerDay = *o.AudioMinutesPerDay
+		}
+		if o.SessionsPerDay != nil {
+			limits.SessionsPerDay = *o.SessionsPerDay
+		}
+		if o.LLMTokensPerDay != nil {
+			limits.LLMTokensPerDay = *o.LLMTokensPerDay
+		}
+	}
+	return plan, limits, o
+}
+
+// cachedOverride also caches "no override", so most users cost no query per chunk.
+type cachedOverride struct {
+	Override *models.QuotaOverride `json:"override"`
+}
+
+// override is best-effort: on errors the user is held to their plan.
+func (s *quotaService) override(ctx context.Context, userID string) *models.QuotaOverride {
+	if s.overrides == nil {
+		return nil
+	}
+	if s.cache != nil {
+		var cached cachedOverride
+		if hit, err := s.cache.GetJSON(ctx, quotaOverrideKey(userID), &cached); err == nil && hit {
+			return cached.Override
+		}
+	}
+
+	o, err := s.overrides.Get(ctx, userID)
+	if err != nil && !errors.Is(err, utils.ErrNotFound) {
+		return nil
+	}
+	if s.cache != nil {
+		_ = s.cache.SetJSON(ctx, quotaOverrideKey(userID), cachedOverride{Override: o}, s.cacheTTL)
+	}
+	return o
+}
+
+func (s *quotaService) GetOverride(ctx context.Context, userID string) (*models.QuotaOverride, error) {
+	const op = "QuotaService.GetOverride"
+
+	if userID == "" {
+		return nil, utils.E(utils.CodeInvalidArgument, op, "user_id is required", nil)
+	}
+	if s.overrides == nil {
+		return nil, utils.E(utils.CodeUnavailable, op, "quota overrides are not configured", nil)
+	}
+	o, err := s.overrides.Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, utils.ErrNotFound) {
+			return nil, utils.E(utils.CodeNotFound, op, "quota override not found", err)
+		}
+		return nil, utils.E(utils.CodeInternal, op, "failed to get quota override", err)
+	}
+	return o, nil
+}
+
+func (s *quotaService) SetOverride(ctx context.Context, o *models.QuotaOverride) error {
+	const op = "QuotaService.SetOverride"
+
+	if o == nil || o.UserID == "" {
+		return utils.E(utils.CodeInvalidArgument, op, "user_id is required", nil)
+	}
+	if s.overrides == nil {
+		return utils.E(utils.CodeUnavailable, op, "quota overrides are not configured", nil)
+	}
+	if _, ok := s.cfg.Plans[o.Plan]; o.Plan != "" && !ok {
+		return utils.E(utils.CodeInvalidArgument, op, "unknown plan "+o.Plan, nil)
+	}
+	for _, v := range []*int64{o.AudioMinutesPerDay, o.SessionsPerDay, o.LLMTokensPerDay} {
+		if v != nil && *v < 0 {
+			return utils.E(utils.CodeInvalidArgument, op, "limits must be >= 0 (0 = unlimited)", nil)
+		}
+	}
+	if o.UpdatedAt.IsZero() {
+		o.UpdatedAt = time.Now().UTC()
+	}
+
+	if err := s.overrides.Upsert(ctx, o); err != nil {
+		return utils.E(utils.CodeInternal, op, "failed to save quota override", err)
+	}
+	if s.cache != nil {
+		_ = s.cache.Del(ctx, quotaOverrideKey(o.UserID))
+	}
+	return nil
+}
+
+func (s *quotaService) DeleteOverride(ctx context.Context, userID string) error {
+	const op = "QuotaService.DeleteOverride"
+
+	if userID == "" {
+		return utils.E(utils.CodeInvalidArgument, op, "user_id is required", nil)
+	}
+	if s.overrides == nil {
+		return utils.E(utils.CodeUnavailable, op, "quota overrides are not configured", nil)
+	}
+	if err := s.overrides.Delete(ctx, userID); err != nil {
+		if errors.Is(err, utils.ErrNotFound) {
+			return utils.E(utils.CodeNotFound, op, "quota override not found", err)
+		}
+		return utils.E(utils.CodeInternal, op, "failed to delete quota override", err)
+	}
+	if s.cache != nil {
+		_ = s.cache.Del(ctx, quotaOverrideKey(userID))
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/yoockh/yoospeak/internal/models"
+	"github.com/yoockh/yoospeak/internal/utils"
+)
+
+func newTestQuota(t *testing.T, limits models.QuotaLimits) (*quotaService, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	q := NewQuotaService(rdb, QuotaConfig{Plans: QuotaPlans{"free": limits}, DefaultPlan: "free"}, nil)
+	return q.(*quotaService), rdb
+}
+
+func audioUsed(t *testing.T, q *quotaService) time.Duration {
+	t.Helper()
+	st, err := q.Status(context.Background(), "user-1", "")
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	return time.Duration(st.Used.AudioMinutes * float64(time.Minute)).Round(time.Millisecond)
+}
+
+func TestAdmitAudioReservesBeforeTheLimitIsPassed(t *testing.T) {
+	q, _ := newTestQuota(t, models.QuotaLimits{AudioMinutesPerDay: 1})
+	ctx := context.Background()
+
+	if err := q.AdmitAudio(ctx, "user-1", "", "sess-1", 1, 40*time.Second); err != nil {
+		t.Fatalf("chunk 1: %v", err)
+	}
+	// 40s reserved + 30s would pass the minute, though nothing is settled yet
+	if err := q.AdmitAudio(ctx, "user-1", "", "sess-1", 2, 30*time.Second); !utils.IsCode(err, utils.CodeQuotaExceeded) {
+		t.Fatalf("chunk 2: err = %v, want QUOTA_EXCEEDED", err)
+	}
+	// a resent chunk keeps its reservation rather than taking a second one
+	if err := q.AdmitAudio(ctx, "user-1", "", "sess-1", 1, 40*time.Second); err != nil {
+		t.Fatalf("chunk 1 resent: %v", err)
+	}
+	if got := audioUsed(t, q); got != 40*time.Second {
+		t.Errorf("used = %v, want the 40s reservation", got)
+	}
+
+	if err := q.SettleAudio(ctx, "user-1", "sess-1", 1, 10*time.Second); err != nil {
+		t.Fatalf("settle chunk 1: %v", err)
+	}
+	if got := audioUsed(t, q); got != 10*time.Second {
+		t.Errorf("used after settling = %v, want 10s", got)
+	}
+	if err := q.AdmitAudio(ctx, "user-1", "", "sess-1", 2, 30*time.Second); err != nil {
+		t.Fatalf("chunk 2 after settling: %v", err)
+	}
+
+	// releasing, settling twice and settling without a reservation
+	steps := []struct {
+		chunk int64
+		used  time.Duration
+		want  time.Duration
+	}{
+		{2, 0, 10 * time.Second},
+		{1, 0, 10 * time.Second},
+		{3, 5 * time.Second, 15 * time.Second},
+	}
+	for _, s := range steps {
+		if err := q.SettleAudio(ctx, "user-1", "sess-1", s.chunk, s.used); err != nil {
+			t.Fatalf("settle chunk %d: %v", s.chunk, err)
+		}
+		if got := audioUsed(t, q); got != s.want {
+			t.Errorf("settle chunk %d with %v: used = %v, want %v", s.chunk, s.used, got, s.want)
+		}
+	}
+}
+
+func TestAdmitAudioStopsOnceTokensAreUsedUp(t *testing.T) {
+	q, _ := newTestQuota(t, models.QuotaLimits{LLMTokensPerDay: 100})
+	ctx := context.Background()
+
+	if err := q.AddLLMTokens(ctx, "user-1", 100); err != nil {
+		t.Fatalf("AddLLMTokens: %v", err)
+	}
+	if err := q.AdmitAudio(ctx, "user-1", "", "sess-1", 1, time.Second); !utils.IsCode(err, utils.CodeQuotaExceeded) {
+		t.Fatalf("err = %v, want QUOTA_EXCEEDED", err)
+	}
+	if got := audioUsed(t, q); got != 0 {
+		t.Errorf("refused chunk reserved %v", got)
+	}
+}
+
+func TestSettleAudioFindsYesterdaysReservation(t *testing.T) {
+	q, rdb := newTestQuota(t, models.QuotaLimits{})
+	ctx := context.Background()
+
+	if err := q.AdmitAudio(ctx, "user-1", "", "sess-1", 1, 20*time.Second); err != nil {
+		t.Fatalf("AdmitAudio: %v", err)
+	}
+	// the day rolls over while the chunk is queued
+	now := time.Now()
+	yesterday := quotaKey("user-1", now.Add(-24*time.Hour))
+	if err := rdb.Rename(ctx, quotaKey("user-1", now), yesterday).Err(); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+
+	if err := q.SettleAudio(ctx, "user-1", "sess-1", 1, 5*time.Second); err != nil {
+		t.Fatalf("SettleAudio: %v", err)
+	}
+	if got := audioUsed(t, q); got != 0 {
+		t.Errorf("today used = %v, want 0", got)
+	}
+	if ms, _ := rdb.HGet(ctx, yesterday, quotaFieldAudioMS).Int64(); ms != 5000 {
+		t.Errorf("yesterday audio_ms = %d, want 5000", ms)
+	}
+	if n, _ := rdb.HLen(ctx, yesterday).Result(); n != 1 {
+		t.Errorf("yesterday still holds %d fields, want only audio_ms", n)
+	}
+}
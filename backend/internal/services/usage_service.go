@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yoockh/yoospeak/internal/models"
+	pgrepo "github.com/yoockh/yoospeak/internal/repositories/postgres"
+	"github.com/yoockh/yoospeak/internal/utils"
+)
+
+// Pricing turns usage into cost. Prices are in USD; a zero price records the
+// usage at no cost.
+type Pricing struct {
+	STTPerMinute        float64
+	LLMInputPerMillion  float64 // prompt tokens
+	LLMOutputPerMillion float64 // completion tokens
+}
+
+// CostMicroUSD is what rec costs at these prices, in millionths of a dollar.
+func (p Pricing) CostMicroUSD(rec *models.UsageRecord) int64 {
+	usd := rec.AudioSeconds/60*p.STTPerMinute +
+		float64(rec.PromptTokens)/1e6*p.LLMInputPerMillion +
+		float64(rec.CompletionTokens)/1e6*p.LLMOutputPerMillion
+	return int64(math.Round(usd * 1e6))
+}
+
+// UserUsage is a user's usage over a period, in total and per session.
+type UserUsage struct {
+	UserID   string                `json:"user_id"`
+	From     *time.Time            `json:"from,omitempty"`
+	To       *time.Time            `json:"to,omitempty"`
+	Totals   models.UsageTotals    `json:"totals"`
+	Sessions []models.SessionUsage `json:"sessions"`
+}
+
+type UsageService interface {
+	// Record prices rec (setting CostMicroUSD) and stores it. Recording the
+	// same session, chunk and kind again is a no-op (recorded is false), so
+	// retries are not billed twice.
+	Record(ctx context.Context, rec *models.UsageRecord) (recorded bool, err error)
+	Me(ctx context.Context, userID string, from, to *time.Time) (*UserUsage, error)
+	// Aggregate is the admin view across users; f.UserID narrows it to one user.
+	Aggregate(ctx context.Context, f pgrepo.UsageFilter, groupBy string) ([]models.UsageGroup, error)
+}
+
+type usageService struct {
+	repo    pgrepo.UsageRepo
+	pricing Pricing
+}
+
+func NewUsageService(repo pgrepo.UsageRepo, pricing Pricing) UsageService {
+	return &usageService{repo: repo, pricing: pricing}
+}
+
+func (s *usageService) Record(ctx context.Context, rec *models.UsageRecord) (bool, error) {
+	const op = "UsageService.Record"
+
+	if rec.UserID == "" || rec.SessionID == "" || rec.ChunkIndex <= 0 {
+		return false, utils.E(utils.CodeInvalidArgument, op, "user_id, session_id and chunk_index are required", nil)
+	}
+	if rec.Kind != models.UsageKindSTT && rec.Kind != models.UsageKindLLM {
+		return false, utils.E(utils.CodeInvalidArgument, op, "kind must be 'stt' or 'llm'", nil)
+	}
+
+	if rec.ID == "" {
+		rec.ID = uuid.NewString()
+	}
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = time.Now().UTC()
+	}
+	rec.CostMicroUSD = s.pricing.CostMicroUSD(rec)
+
+	inserted, err := s.repo.InsertIfAbsent(ctx, rec)
+	if err != nil {
+		return false, utils.E(utils.CodeInternal, op, "failed to record usage", err)
+	}
+	return inserted, nil
+}
+
+func (s *usageService) Me(ctx context.Context, userID string, from, to *time.Time) (*UserUsage, error) {
+	const op = "UsageService.Me"
+
+	if userID == "" {
+		return nil, utils.E(utils.CodeInvalidArgument, op, "user_id is required", nil)
+	}
+	f := pgrepo.UsageFilter{UserID: userID, From: from, To: to}
+
+	totals, err := s.repo.Totals(ctx, f)
+	if err != nil {
+		return nil, utils.E(utils.CodeInternal, op, "failed to load usage", err)
+	}
+	sessions, err := s.repo.BySession(ctx, f)
+	if err != nil {
+		return nil, utils.E(utils.CodeInternal, op, "failed to load usage", err)
+	}
+
+	out := &UserUsage{UserID: userID, From: from, To: to, Totals: *totals, Sessions: sessions}
+	setCostUSD(&out.Totals)
+	for i := range out.Sessions {
+		setCostUSD(&out.Sessions[i].UsageTotals)
+	}
+	if out.Sessions == nil {
+		out.Sessions = []models.SessionUsage{}
+	}
+	return out, nil
+}
+
+func (s *usageService) Aggregate(ctx context.Context, f pgrepo.UsageFilter, groupBy string) ([]models.UsageGroup, error) {
+	const op = "UsageService.Aggregate"
+
+	if !pgrepo.ValidUsageGroupBy(groupBy) {
+		return nil, utils.E(utils.CodeInvalidArgument, op, "group_by must be user, session, day or kind", nil)
+	}
+	rows, err := s.repo.Aggregate(ctx, f, groupBy)
+	if err != nil {
+		return nil, utils.E(utils.CodeInternal, op, "failed to aggregate usage", err)
+	}
+	for i := range rows {
+		setCostUSD(&rows[i].UsageTotals)
+	}
+	return rows, nil
+}
+
+func setCostUSD(t *models.UsageTotals) { t.CostUSD = float64(t.CostMicroUSD) / 1e6 }
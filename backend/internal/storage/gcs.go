@@ -2,25 +2,68 @@ package storage
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"os"
 	"time"
 
 	gcs "cloud.google.com/go/storage"
-	"google.golang.org/api/iterator"
+	"google.golang.org/api/iamcredentials/v1"
 )
 
+// GCSSigning selects how signed URLs are produced:
+//   - KeyFile: sign locally with a service-account JSON key;
+//   - ServiceAccountEmail: sign remotely with IAM Credentials SignBlob (Workload
+//     Identity / Cloud Run; the runtime identity needs roles/iam.serviceAccountTokenCreator
+//     on that account);
+//   - neither: let the client library detect credentials (key file from ADC, or
+//     the metadata server's account + SignBlob).
+type GCSSigning struct {
+	KeyFile             string
+	ServiceAccountEmail string
+}
+
 type GCSUploader struct {
 	client *gcs.Client
 	bucket string
+
+	// signing; both empty = library auto-detection
+	accessID   string
+	privateKey []byte
+	signBytes  func([]byte) ([]byte, error)
 }
 
-func NewGCSUploader(ctx context.Context, bucket string) (*GCSUploader, error) {
+// ctx must outlive the uploader: the clients keep it for credential refreshes.
+func NewGCSUploader(ctx context.Context, bucket string, signing GCSSigning) (*GCSUploader, error) {
 	c, err := gcs.NewClient(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return &GCSUploader{client: c, bucket: bucket}, nil
+	u := &GCSUploader{client: c, bucket: bucket}
+
+	switch {
+	case signing.ServiceAccountEmail != "":
+		iam, err := iamcredentials.NewService(ctx)
+		if err != nil {
+			_ = c.Close()
+			return nil, fmt.Errorf("iam credentials client: %w", err)
+		}
+		u.accessID = signing.ServiceAccountEmail
+		u.signBytes = signBlob(iam, signing.ServiceAccountEmail)
+
+	case signing.KeyFile != "":
+		email, key, err := readServiceAccountKey(signing.KeyFile)
+		if err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+		u.accessID, u.privateKey = email, key
+	}
+
+	return u, nil
 }
 
 func (u *GCSUploader) Close() error { return u.client.Close() }
@@ -44,26 +87,80 @@ func (u *GCSUploader) Upload(ctx context.Context, objectName string, contentType
 	return objectName, nil
 }
 
-// Signed URL via service account credentials (GOOGLE_APPLICATION_CREDENTIALS must be a JSON key file).
+// Open streams a stored object; ErrObjectNotFound when the key does not exist.
+func (u *GCSUploader) Open(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	r, err := u.client.Bucket(u.bucket).Object(objectName).NewReader(ctx)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	return r, err
+}
+
+func (u *GCSUploader) Delete(ctx context.Context, objectName string) error {
+	err := u.client.Bucket(u.bucket).Object(objectName).Delete(ctx)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return nil
+	}
+	return err
+}
+
+// SignedGetURL returns a V4 signed GET URL valid for ttl (max 7 days).
 func (u *GCSUploader) SignedGetURL(ctx context.Context, objectName string, ttl time.Duration) (string, error) {
 	if ttl <= 0 {
 		ttl = 10 * time.Minute
 	}
 
-	// Find service account email from the JSON key already loaded by ADC is non-trivial without parsing.
-	// Simplest: require env GCS_SIGNING_EMAIL when using SignedURL with key file.
-	// If you prefer Workload Identity (recommended), we should implement IAMCredentials SignBlob flow instead.
-	email := "" // set via env in next patch if you want
-	_ = email
+	// don't hand out links to objects that are gone
+	if _, err := u.client.Bucket(u.bucket).Object(objectName).Attrs(ctx); err != nil {
+		if errors.Is(err, gcs.ErrObjectNotExist) {
+			return "", ErrObjectNotFound
+		}
+		return "", err
+	}
 
-	// Minimal validation: ensure object exists (optional)
-	_, err := u.client.Bucket(u.bucket).Object(objectName).Attrs(ctx)
-	if err != nil {
-		if err == iterator.Done {
-			return "", errors.New("object not found")
+	opts := &gcs.SignedURLOptions{
+		Scheme:         gcs.SigningSchemeV4,
+		Method:         "GET",
+		Expires:        time.Now().Add(ttl),
+		GoogleAccessID: u.accessID,
+		PrivateKey:     u.privateKey,
+		SignBytes:      u.signBytes,
+	}
+	return u.client.Bucket(u.bucket).SignedURL(objectName, opts)
+}
+
+// signBlob signs as the service account email through IAM Credentials SignBlob.
+func signBlob(iam *iamcredentials.Service, email string) func([]byte) ([]byte, error) {
+	name := "projects/-/serviceAccounts/" + email
+	return func(b []byte) ([]byte, error) {
+		sctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		resp, err := iam.Projects.ServiceAccounts.SignBlob(name, &iamcredentials.SignBlobRequest{
+			Payload: base64.StdEncoding.EncodeToString(b),
+		}).Context(sctx).Do()
+		if err != nil {
+			return nil, err
 		}
-		// if not found, Storage returns error; bubble up
+		return base64.StdEncoding.DecodeString(resp.SignedBlob)
 	}
+}
 
-	return "", errors.New("SignedGetURL is not configured: set up signer (see next patch request)")
+// readServiceAccountKey extracts the signing identity from a service-account JSON key.
+func readServiceAccountKey(path string) (email string, key []byte, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("read signing key: %w", err)
+	}
+	var k struct {
+		Type        string `json:"type"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+	}
+	if err := json.Unmarshal(b, &k); err != nil {
+		return "", nil, fmt.Errorf("parse signing key: %w", err)
+	}
+	if k.Type != "service_account" || k.ClientEmail == "" || k.PrivateKey == "" {
+		return "", nil, errors.New("signing key is not a service account key (need client_email and private_key)")
+	}
+	return k.ClientEmail, []byte(k.PrivateKey), nil
 }
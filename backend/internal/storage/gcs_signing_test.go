@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/iamcredentials/v1"
+	"google.golang.org/api/option"
+)
+
+const signerEmail = "signer@project.iam.gserviceaccount.com"
+
+// fakeGCS serves object metadata for the objects it holds, as the JSON API does.
+func fakeGCS(t *testing.T, objects ...string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, name := range objects {
+			if strings.HasSuffix(r.URL.Path, "/o/"+name) {
+				_ = json.NewEncoder(w).Encode(map[string]string{"bucket": "cvs", "name": name})
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":{"code":404,"message":"No such object"}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func rsaKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return key
+}
+
+// signatureOf returns the credential and the decoded signature of a V4 signed URL.
+func signatureOf(t *testing.T, signed string) (string, []byte) {
+	t.Helper()
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("signed url %q: %v", signed, err)
+	}
+	sig, err := hex.DecodeString(u.Query().Get("X-Goog-Signature"))
+	if err != nil {
+		t.Fatalf("signature of %q: %v", signed, err)
+	}
+	return u.Query().Get("X-Goog-Credential"), sig
+}
+
+func TestGCSSignsWithServiceAccountKeyFile(t *testing.T) {
+	srv := fakeGCS(t, "cv/a.pdf")
+	t.Setenv("STORAGE_EMULATOR_HOST", strings.TrimPrefix(srv.URL, "http://"))
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey(t))})
+	keyFile := filepath.Join(t.TempDir(), "key.json")
+	b, _ := json.Marshal(map[string]string{"type": "service_account", "client_email": signerEmail, "private_key": string(keyPEM)})
+	if err := os.WriteFile(keyFile, b, 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+
+	u, err := NewGCSUploader(context.Background(), "cvs", GCSSigning{KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("NewGCSUploader: %v", err)
+	}
+	defer u.Close()
+
+	signed, err := u.SignedGetURL(context.Background(), "cv/a.pdf", time.Minute)
+	if err != nil {
+		t.Fatalf("SignedGetURL: %v", err)
+	}
+	cred, sig := signatureOf(t, signed)
+	if !strings.HasPrefix(cred, signerEmail+"/") || len(sig) != 256 {
+		t.Errorf("signed url %q: credential %q, %d-byte signature; want the key's account and an RSA-2048 signature", signed, cred, len(sig))
+	}
+
+	if _, err := u.SignedGetURL(context.Background(), "cv/gone.pdf", time.Minute); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("missing object: err = %v, want ErrObjectNotFound", err)
+	}
+}
+
+func TestGCSRejectsKeyFilesThatAreNotServiceAccountKeys(t *testing.T) {
+	dir := t.TempDir()
+	for name, body := range map[string]string{
+		"user.json":    `{"type":"authorized_user","client_id":"x","refresh_token":"y"}`,
+		"nokey.json":   `{"type":"service_account","client_email":"` + signerEmail + `"}`,
+		"garbage.json": `not json`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if _, _, err := readServiceAccountKey(path); err == nil {
+			t.Errorf("%s accepted as a signing key", name)
+		}
+	}
+	if _, _, err := readServiceAccountKey(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("missing key file accepted")
+	}
+}
+
+func TestGCSSignsThroughIAMSignBlob(t *testing.T) {
+	key := rsaKey(t)
+	var mu sync.Mutex
+	var signedFor []string
+	var payload []byte
+	iamSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req iamcredentials.SignBlobRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		payload, _ = base64.StdEncoding.DecodeString(req.Payload)
+		signedFor = append(signedFor, r.URL.Path)
+		digest := sha256.Sum256(payload)
+		sig, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		_ = json.NewEncoder(w).Encode(iamcredentials.SignBlobResponse{KeyId: "k1", SignedBlob: base64.StdEncoding.EncodeToString(sig)})
+	}))
+	defer iamSrv.Close()
+
+	gcsSrv := fakeGCS(t, "cv/a.pdf")
+	t.Setenv("STORAGE_EMULATOR_HOST", strings.TrimPrefix(gcsSrv.URL, "http://"))
+	ctx := context.Background()
+	u, err := NewGCSUploader(ctx, "cvs", GCSSigning{})
+	if err != nil {
+		t.Fatalf("NewGCSUploader: %v", err)
+	}
+	defer u.Close()
+	iam, err := iamcredentials.NewService(ctx, option.WithEndpoint(iamSrv.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("iam client: %v", err)
+	}
+	u.accessID, u.signBytes = signerEmail, signBlob(iam, signerEmail)
+
+	signed, err := u.SignedGetURL(ctx, "cv/a.pdf", time.Minute)
+	if err != nil {
+		t.Fatalf("SignedGetURL: %v", err)
+	}
+	cred, sig := signatureOf(t, signed)
+	if !strings.HasPrefix(cred, signerEmail+"/") {
+		t.Errorf("signed url %q: credential %q, want %s's", signed, cred, signerEmail)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(signedFor) != 1 || !strings.HasSuffix(signedFor[0], "/projects/-/serviceAccounts/"+signerEmail+":signBlob") {
+		t.Fatalf("SignBlob calls = %v, want one for %s", signedFor, signerEmail)
+	}
+	// the url carries IAM's signature over the V4 string to sign
+	digest := sha256.Sum256(payload)
+	if !strings.HasPrefix(string(payload), "GOOG4-RSA-SHA256\n") || rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig) != nil {
+		t.Errorf("signature in %q is not IAM's signature of the string to sign %q", signed, payload)
+	}
+}
@@ -0,0 +1,43 @@
+package storage_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/yoockh/yoospeak/internal/storage"
+	"github.com/yoockh/yoospeak/internal/storage/storagetest"
+)
+
+// Runs against a real bucket with Application Default Credentials, once per
+// signing mode that is configured:
+//
+//	GCS_TEST_BUCKET=my-test-bucket GCS_TEST_SIGNING_KEY_FILE=key.json GCS_TEST_SIGNING_EMAIL=signer@project.iam.gserviceaccount.com go test ./internal/storage
+func TestGCSUploaderConformance(t *testing.T) {
+	bucket := os.Getenv("GCS_TEST_BUCKET")
+	if bucket == "" {
+		t.Skip("GCS_TEST_BUCKET not set")
+	}
+
+	for _, tc := range []struct {
+		name    string
+		signing storage.GCSSigning
+		env     string
+	}{
+		{"Detected", storage.GCSSigning{}, ""},
+		{"KeyFile", storage.GCSSigning{KeyFile: os.Getenv("GCS_TEST_SIGNING_KEY_FILE")}, "GCS_TEST_SIGNING_KEY_FILE"},
+		{"SignBlob", storage.GCSSigning{ServiceAccountEmail: os.Getenv("GCS_TEST_SIGNING_EMAIL")}, "GCS_TEST_SIGNING_EMAIL"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.env != "" && os.Getenv(tc.env) == "" {
+				t.Skip(tc.env + " not set")
+			}
+			s, err := storage.NewGCSUploader(context.Background(), bucket, tc.signing)
+			if err != nil {
+				t.Fatalf("NewGCSUploader: %v", err)
+			}
+			defer s.Close()
+			storagetest.Run(t, s)
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalStore keeps objects on local disk under Root. Meant for development and
+// tests: signed URLs point at BaseURL and are verified by Handler with an HMAC
+// over the object name and expiry.
+type LocalStore struct {
+	root    string
+	baseURL string
+	secret  []byte
+}
+
+var errInvalidObjectName = errors.New("storage: invalid object name")
+
+// NewLocalStore creates root if needed. baseURL is the public prefix Handler is
+// mounted at (e.g. "http://localhost:8080/files").
+func NewLocalStore(root, baseURL string, secret []byte) (*LocalStore, error) {
+	if root == "" {
+		return nil, errors.New("storage: local root is required")
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("storage: local signing secret is required")
+	}
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, err
+	}
+	return &LocalStore{root: root, baseURL: strings.TrimRight(baseURL, "/"), secret: secret}, nil
+}
+
+func (s *LocalStore) Close() error { return nil }
+
+// path maps an object name to a file under root, rejecting names that would escape it.
+func (s *LocalStore) path(objectName string) (string, error) {
+	clean := path.Clean("/" + objectName)
+	if objectName == "" || clean == "/" || clean[1:] != objectName {
+		return "", errInvalidObjectName
+	}
+	return filepath.Join(s.root, filepath.FromSlash(clean[1:])), nil
+}
+
+func (s *LocalStore) Upload(ctx context.Context, objectName string, contentType string, r io.Reader) (string, error) {
+	p, err := s.path(objectName)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+		return "", err
+	}
+
+	// write to a temp file and rename so readers never see a partial object
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, ctxReader{ctx: ctx, r: r}); err != nil {
+		_ = tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return "", err
+	}
+	return objectName, nil
+}
+
+func (s *LocalStore) Open(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	p, err := s.path(objectName)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	return f, err
+}
+
+func (s *LocalStore) Delete(ctx context.Context, objectName string) error {
+	p, err := s.path(objectName)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStore) SignedGetURL(ctx context.Context, objectName string, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		ttl = 10 * time.Minute
+	}
+	if _, err := s.path(objectName); err != nil {
+		return "", err
+	}
+
+	exp := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	q := url.Values{"expires": {exp}, "sig": {s.sign(objectName, exp)}}
+	return s.baseURL + "/" + (&url.URL{Path: objectName}).EscapedPath() + "?" + q.Encode(), nil
+}
+
+func (s *LocalStore) sign(objectName, expires string) string {
+	m := hmac.New(sha256.New, s.secret)
+	m.Write([]byte(objectName + "\n" + expires))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// Verify reports whether sig is a valid, unexpired signature for objectName.
+func (s *LocalStore) Verify(objectName, expires, sig string) bool {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(s.sign(objectName, expires)))
+}
+
+// Handler serves signed URLs. Mount it with the "/files" prefix stripped, so
+// the request path is the object name.
+func (s *LocalStore) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		q := r.URL.Query()
+		if !s.Verify(name, q.Get("expires"), q.Get("sig")) {
+			http.Error(w, "invalid or expired signature", http.StatusForbidden)
+			return
+		}
+
+		p, err := s.path(name)
+		if err != nil {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		defer f.Close()
+		st, err := f.Stat()
+		if err != nil || st.IsDir() {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		if ct := mime.TypeByExtension(filepath.Ext(p)); ct != "" {
+			w.Header().Set("Content-Type", ct)
+		}
+		w.Header().Set("Cache-Control", "private, no-store")
+		http.ServeContent(w, r, filepath.Base(p), st.ModTime(), f)
+	})
+}
+
+// ctxReader stops a copy once ctx is cancelled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,40 @@
+package storage_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yoockh/yoospeak/internal/storage"
+	"github.com/yoockh/yoospeak/internal/storage/storagetest"
+)
+
+func newLocal(t *testing.T) (*storage.LocalStore, *httptest.Server) {
+	t.Helper()
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	s, err := storage.NewLocalStore(t.TempDir(), srv.URL+"/files", []byte("test-secret"))
+	if err != nil {
+		t.Fatalf("NewLocalStore: %v", err)
+	}
+	mux.Handle("/files/", http.StripPrefix("/files", s.Handler()))
+	return s, srv
+}
+
+func TestLocalStoreConformance(t *testing.T) {
+	s, _ := newLocal(t)
+	storagetest.Run(t, s)
+}
+
+func TestLocalStoreRejectsEscapingNames(t *testing.T) {
+	s, _ := newLocal(t)
+	for _, name := range []string{"", "../x", "a/../../x", "/abs", "a//b", "a/./b"} {
+		if _, err := s.Upload(context.Background(), name, "text/plain", strings.NewReader("x")); err == nil {
+			t.Errorf("Upload(%q) succeeded, want an invalid name error", name)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+type S3Config struct {
+	Endpoint  string // host[:port], e.g. "s3.amazonaws.com" or "localhost:9000"
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+	// CreateBucket creates the bucket when missing (handy against a fresh MinIO).
+	CreateBucket bool
+}
+
+// UseSSL reads an S3 TLS setting from the environment: on unless "false",
+// so a missing value never downgrades to plain HTTP.
+func UseSSL(v string) bool { return v != "false" }
+
+// S3Store stores objects in an S3-compatible bucket (AWS S3, MinIO, R2, ...).
+type S3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+func NewS3Store(ctx context.Context, cfg S3Config) (*S3Store, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("storage: s3 endpoint and bucket are required")
+	}
+
+	c, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.CreateBucket {
+		exists, err := c.BucketExists(ctx, cfg.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			if err := c.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &S3Store{client: c, bucket: cfg.Bucket}, nil
+}
+
+func (s *S3Store) Close() error { return nil }
+
+func (s *S3Store) Upload(ctx context.Context, objectName string, contentType string, r io.Reader) (string, error) {
+	// unknown size: minio-go buffers one part at a time; keep parts at the 5 MiB minimum
+	_, err := s.client.PutObject(ctx, s.bucket, objectName, r, -1, minio.PutObjectOptions{
+		ContentType: contentType,
+		PartSize:    5 << 20,
+	})
+	if err != nil {
+		return "", err
+	}
+	return objectName, nil
+}
+
+func (s *S3Store) Open(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	// GetObject is lazy; Stat surfaces a missing key up front
+	obj, err := s.client.GetObject(ctx, s.bucket, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, mapS3Err(err)
+	}
+	if _, err := obj.Stat(); err != nil {
+		_ = obj.Close()
+		return nil, mapS3Err(err)
+	}
+	return obj, nil
+}
+
+// Delete is idempotent: S3 reports success for missing keys.
+func (s *S3Store) Delete(ctx context.Context, objectName string) error {
+	return s.client.RemoveObject(ctx, s.bucket, objectName, minio.RemoveObjectOptions{})
+}
+
+func (s *S3Store) SignedGetURL(ctx context.Context, objectName string, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		ttl = 10 * time.Minute
+	}
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, objectName, ttl, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func mapS3Err(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrObjectNotFound
+	}
+	return err
+}
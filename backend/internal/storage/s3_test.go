@@ -0,0 +1,38 @@
+package storage_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/yoockh/yoospeak/internal/storage"
+	"github.com/yoockh/yoospeak/internal/storage/storagetest"
+)
+
+// Runs against a real S3-compatible endpoint, e.g. a local MinIO:
+//
+//	S3_TEST_ENDPOINT=localhost:9000 S3_TEST_USE_SSL=false S3_TEST_ACCESS_KEY=minioadmin S3_TEST_SECRET_KEY=minioadmin go test ./internal/storage
+func TestS3StoreConformance(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT not set")
+	}
+	bucket := os.Getenv("S3_TEST_BUCKET")
+	if bucket == "" {
+		bucket = "yoospeak-storagetest"
+	}
+
+	s, err := storage.NewS3Store(context.Background(), storage.S3Config{
+		Endpoint:     endpoint,
+		Region:       os.Getenv("S3_TEST_REGION"),
+		Bucket:       bucket,
+		AccessKey:    os.Getenv("S3_TEST_ACCESS_KEY"),
+		SecretKey:    os.Getenv("S3_TEST_SECRET_KEY"),
+		UseSSL:       storage.UseSSL(os.Getenv("S3_TEST_USE_SSL")),
+		CreateBucket: true,
+	})
+	if err != nil {
+		t.Fatalf("NewS3Store: %v", err)
+	}
+	storagetest.Run(t, s)
+}
@@ -2,10 +2,13 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"io"
 	"time"
 )
 
+var ErrObjectNotFound = errors.New("storage: object not found")
+
 type Uploader interface {
 	Upload(ctx context.Context, objectName string, contentType string, r io.Reader) (storedPath string, err error)
 }
@@ -13,3 +16,28 @@ type Uploader interface {
 type Signer interface {
 	SignedGetURL(ctx context.Context, objectName string, ttl time.Duration) (string, error)
 }
+
+type Downloader interface {
+	Open(ctx context.Context, objectName string) (io.ReadCloser, error)
+}
+
+type Deleter interface {
+	// Delete removes an object; deleting a missing object is not an error.
+	Delete(ctx context.Context, objectName string) error
+}
+
+// Backend is a complete object store (GCS, S3-compatible or local disk).
+// Implementations must pass storagetest.Run.
+type Backend interface {
+	Uploader
+	Signer
+	Downloader
+	Deleter
+	Close() error
+}
+
+var (
+	_ Backend = (*GCSUploader)(nil)
+	_ Backend = (*S3Store)(nil)
+	_ Backend = (*LocalStore)(nil)
+)
@@ -0,0 +1,156 @@
+// Package storagetest is the conformance suite every storage.Backend must pass.
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yoockh/yoospeak/internal/storage"
+)
+
+// Run exercises b. Objects are written under a random prefix so the suite can
+// run against a shared bucket. Signed URLs are fetched over plain HTTP, so the
+// backend's URLs must be reachable from the test.
+func Run(t *testing.T, b storage.Backend) {
+	t.Helper()
+	ctx := context.Background()
+	prefix := "storagetest/" + uuid.NewString() + "/"
+
+	t.Run("UploadOpenRoundTrip", func(t *testing.T) {
+		name := prefix + "cv/user-1/file.pdf"
+		want := []byte("%PDF-1.4 round trip\n")
+
+		stored := mustUpload(t, b, name, want)
+		if stored != name {
+			t.Fatalf("Upload returned %q, want the object name %q", stored, name)
+		}
+		if got := mustRead(t, b, stored); !bytes.Equal(got, want) {
+			t.Fatalf("Open returned %q, want %q", got, want)
+		}
+	})
+
+	t.Run("UploadOverwrites", func(t *testing.T) {
+		name := prefix + "overwrite.txt"
+		mustUpload(t, b, name, []byte("first"))
+		mustUpload(t, b, name, []byte("second"))
+		if got := mustRead(t, b, name); string(got) != "second" {
+			t.Fatalf("after overwrite Open returned %q, want %q", got, "second")
+		}
+	})
+
+	t.Run("LargeObject", func(t *testing.T) {
+		name := prefix + "large.bin"
+		want := bytes.Repeat([]byte("0123456789abcdef"), 1<<16) // 1 MiB
+		mustUpload(t, b, name, want)
+		if got := mustRead(t, b, name); !bytes.Equal(got, want) {
+			t.Fatalf("large object corrupted: got %d bytes, want %d", len(got), len(want))
+		}
+	})
+
+	t.Run("OpenMissing", func(t *testing.T) {
+		rc, err := b.Open(ctx, prefix+"does-not-exist.pdf")
+		if err == nil {
+			rc.Close()
+			t.Fatal("Open of a missing object succeeded")
+		}
+		if !errors.Is(err, storage.ErrObjectNotFound) {
+			t.Fatalf("Open of a missing object returned %v, want storage.ErrObjectNotFound", err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		name := prefix + "delete/cv.pdf"
+		mustUpload(t, b, name, []byte("to be deleted"))
+
+		if err := b.Delete(ctx, name); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		rc, err := b.Open(ctx, name)
+		if err == nil {
+			rc.Close()
+			t.Fatal("Open after Delete succeeded")
+		}
+		if !errors.Is(err, storage.ErrObjectNotFound) {
+			t.Fatalf("Open after Delete returned %v, want storage.ErrObjectNotFound", err)
+		}
+		// idempotent
+		if err := b.Delete(ctx, name); err != nil {
+			t.Fatalf("second Delete: %v", err)
+		}
+	})
+
+	t.Run("SignedGetURL", func(t *testing.T) {
+		name := prefix + "signed/cv.pdf"
+		want := []byte("%PDF-1.4 signed\n")
+		mustUpload(t, b, name, want)
+
+		u, err := b.SignedGetURL(ctx, name, time.Minute)
+		if err != nil {
+			t.Fatalf("SignedGetURL: %v", err)
+		}
+		res, err := http.Get(u)
+		if err != nil {
+			t.Fatalf("GET signed url: %v", err)
+		}
+		defer res.Body.Close()
+		got, _ := io.ReadAll(res.Body)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("GET signed url: status %d: %s", res.StatusCode, got)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("GET signed url returned %q, want %q", got, want)
+		}
+	})
+
+	t.Run("SignedGetURLTampered", func(t *testing.T) {
+		name := prefix + "signed/private.pdf"
+		other := prefix + "signed/other.pdf"
+		mustUpload(t, b, name, []byte("private"))
+		mustUpload(t, b, other, []byte("other"))
+
+		u, err := b.SignedGetURL(ctx, name, time.Minute)
+		if err != nil {
+			t.Fatalf("SignedGetURL: %v", err)
+		}
+		// a signature for one object must not open another
+		tampered := strings.Replace(u, "private.pdf", "other.pdf", 1)
+		res, err := http.Get(tampered)
+		if err != nil {
+			t.Fatalf("GET tampered url: %v", err)
+		}
+		res.Body.Close()
+		if res.StatusCode == http.StatusOK {
+			t.Fatal("signed url for one object opened a different object")
+		}
+	})
+}
+
+func mustUpload(t *testing.T, b storage.Backend, name string, data []byte) string {
+	t.Helper()
+	stored, err := b.Upload(context.Background(), name, "application/octet-stream", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Upload %q: %v", name, err)
+	}
+	return stored
+}
+
+func mustRead(t *testing.T, b storage.Backend, name string) []byte {
+	t.Helper()
+	rc, err := b.Open(context.Background(), name)
+	if err != nil {
+		t.Fatalf("Open %q: %v", name, err)
+	}
+	defer rc.Close()
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("read %q: %v", name, err)
+	}
+	return got
+}
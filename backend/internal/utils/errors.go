@@ -17,6 +17,11 @@ const (
 	CodeUnavailable     Code = "UNAVAILABLE"
 	CodeTimeout         Code = "TIMEOUT"
 	CodeInternal        Code = "INTERNAL"
+	// CodeQuotaExceeded: the user's plan allows no more of this today (not retryable until reset).
+	CodeQuotaExceeded Code = "QUOTA_EXCEEDED"
+	// CodeUpstream: a provider refused a request we built (bad payload, unknown
+	// model, ...). The fault is ours, not the caller's: retry, and alert if it sticks.
+	CodeUpstream Code = "UPSTREAM_REJECTED"
 )
 
 // AppError is the unified error contract across layers.
@@ -81,6 +86,10 @@ func HTTPStatus(err error) int {
 			return http.StatusServiceUnavailable
 		case CodeTimeout:
 			return http.StatusGatewayTimeout
+		case CodeQuotaExceeded:
+			return http.StatusTooManyRequests
+		case CodeUpstream:
+			return http.StatusBadGateway
 		default:
 			return http.StatusInternalServerError
 		}
@@ -92,6 +101,23 @@ func HTTPStatus(err error) int {
 	return http.StatusInternalServerError
 }
 
+// CodeFromHTTPStatus maps an upstream service's error status to a Code, for
+// clients of HTTP APIs: rate limits and server errors are Unavailable
+// (retryable). Any other 4xx, 401 and 403 included, is Upstream rather than a
+// caller mistake: the request that was refused is one we built (with our
+// credentials), and the caller cannot fix it.
+func CodeFromHTTPStatus(status int) Code {
+	switch {
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		return CodeTimeout
+	case status == http.StatusTooManyRequests || status >= 500:
+		return CodeUnavailable
+	case status >= 400:
+		return CodeUpstream
+	}
+	return CodeInternal
+}
+
 // Backward-compatible sentinel errors
 var (
 	ErrNotFound = errors.New("not found")
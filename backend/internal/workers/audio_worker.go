@@ -9,10 +9,13 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
+	"github.com/yoockh/yoospeak/internal/audio"
+	"github.com/yoockh/yoospeak/internal/models"
 	"github.com/yoockh/yoospeak/internal/providers/llm"
 	"github.com/yoockh/yoospeak/internal/providers/stt"
 	"github.com/yoockh/yoospeak/internal/services"
@@ -26,17 +29,145 @@ type AudioWorkerPool struct {
 	STT stt.Provider
 	LLM llm.Provider
 
+	// Optional prompt context: session type/metadata and the user's profile.
+	// Without them the coach still answers, just less personalised.
+	Sessions services.SessionService
+	Profiles services.ProfileService
+	// CVRetrieval, when set, grounds answers in the CVTopK CV passages closest
+	// to the utterance instead of a truncated copy of the whole CV.
+	CVRetrieval services.CVRetrievalService
+	CVTopK      int
+
+	// Conversations, when set, receives every finished turn (user transcript and
+	// coach answer) so it shows up in GET /conversation/:session_id.
+	Conversations services.ConversationService
+	// Embeddings, when set, gets an async job for every persisted turn.
+	Embeddings services.EmbeddingJobs
+	// Usage, when set, is charged for every STT call and LLM answer. Per-chunk
+	// usage is kept on the realtime buffer either way.
+	Usage services.UsageService
+	// Quota, when set, settles the audio each chunk reserved when it was
+	// accepted and counts each answer's tokens against the user's daily
+	// limits (once per chunk, when Usage is set too).
+	Quota services.QuotaService
+
+	// PromptTokenBudget bounds the assembled prompt (approximate tokens);
+	// HistoryChunks is how many earlier chunks are scanned for prior turns.
+	PromptTokenBudget int
+	HistoryChunks     int64
+
+	// LLMOptions are the generation parameters for coach answers (temperature,
+	// max tokens, stop sequences); zero values keep the provider's defaults.
+	LLMOptions llm.Options
+
 	Logger *logrus.Logger
 
 	Stream         string
 	Group          string
 	ConsumerPrefix string
+	// InstanceID tells this process's consumers apart from other replicas'
+	// (default hostname-pid; the hostname is the pod name on Kubernetes).
+	InstanceID string
+
+	// Retry policy: failed entries are retried with exponential backoff
+	// (RetryBaseDelay doubling up to RetryMaxDelay) until MaxAttempts, then
+	// moved to DeadLetterStream together with the failure reason.
+	MaxAttempts      int
+	RetryBaseDelay   time.Duration
+	RetryMaxDelay    time.Duration
+	DeadLetterStream string
+
+	// Janitor: every ClaimInterval, entries idle in the PEL for longer than
+	// ClaimMinIdle are XAUTOCLAIMed and re-run; entries delivered more than
+	// MaxDeliveries times are dead-lettered instead.
+	ClaimInterval time.Duration
+	ClaimMinIdle  time.Duration
+	MaxDeliveries int
+
+	// Ordered guarantees per-session ordering: a single reader fans entries out
+	// to NumWorkers shards keyed by session_id, so chunks of one session are
+	// processed one after another while different sessions run in parallel.
+	// The guarantee holds per process, so only one ordered pool reads a stream
+	// group at a time: pools in other replicas hold off (standby) until the
+	// group's lease is free. Without it chunks of a session race, and an
+	// is_final that overtakes earlier chunks closes the utterance without
+	// them (they are reported late).
+	Ordered bool
+
+	// UtteranceTimeout closes an open utterance when no chunk arrived for that
+	// long, so the LLM still answers clients that never send is_final.
+	UtteranceTimeout time.Duration
+
+	// VAD, when set, screens PCM chunks before STT: silent chunks are not sent
+	// for recognition and leading/trailing silence is trimmed. After
+	// EndOfUtteranceSilence of silence following speech (0 disables) the
+	// utterance is closed as if the client had sent is_final.
+	VAD                   *audio.VAD
+	EndOfUtteranceSilence time.Duration
+
+	// StreamingSTT recognises each utterance over one stream when STT is an
+	// stt.StreamingProvider, publishing interim stt_result messages
+	// (is_final:false) as the user speaks. Needs Ordered, since the stream
+	// lives in the process that handles the session's chunks.
+	StreamingSTT bool
+
+	// retries, dead-lettering, janitor and keep-alive of the audio stream (set up by setDefaults)
+	*streamConsumer
+
+	shards   []chan func(context.Context)
+	leaseTTL time.Duration
+
+	// sessions waiting out a retry backoff in Ordered mode, with the work
+	// queued behind the retry
+	heldMu sync.Mutex
+	held   map[string][]func(context.Context)
+
+	// streaming STT: silence is sent after sttKeepAlive without audio; a
+	// session streamed by another instance is flushed here only once its
+	// deadline is sttOwnerGrace overdue (that instance is gone)
+	sttKeepAlive  time.Duration
+	sttOwnerGrace time.Duration
+
+	sttMu       sync.Mutex
+	sttSessions map[string]*sttSession
 }
 
 func (p *AudioWorkerPool) Start(ctx context.Context) error {
 	if p.Redis == nil || p.Buffers == nil || p.STT == nil || p.LLM == nil {
 		return errors.New("AudioWorkerPool missing dependency: Redis/Buffers/STT/LLM must be set")
 	}
+	p.setDefaults()
+	if _, ok := p.STT.(stt.StreamingProvider); p.StreamingSTT && (!ok || !p.Ordered) {
+		p.Logger.Warn("StreamingSTT needs Ordered and a streaming STT provider; falling back to per-chunk recognition")
+	}
+	if !p.Ordered {
+		p.Logger.Warn("audio chunks are processed unordered: chunks that arrive after their utterance closed are reported late")
+	}
+
+	_ = p.Redis.XGroupCreateMkStream(ctx, p.Stream, p.Group, "0").Err() // ignore BUSYGROUP
+
+	if p.Ordered {
+		p.shards = make([]chan func(context.Context), p.NumWorkers)
+		for i := range p.shards {
+			p.shards[i] = make(chan func(context.Context), 16)
+			go p.runShard(ctx, p.shards[i])
+		}
+		// reader, janitor and flusher run only while this process holds the lease
+		go p.runOrderedLease(ctx)
+		go p.runKeepAlive(ctx)
+	} else {
+		p.start(ctx, p.NumWorkers, p.ConsumerPrefix+"-"+p.InstanceID)
+		go p.runUtteranceFlusher(ctx)
+	}
+	return nil
+}
+
+// consumerName is unique per process, so replicas never share a consumer (and its PEL).
+func (p *AudioWorkerPool) consumerName(suffix string) string {
+	return p.ConsumerPrefix + "-" + p.InstanceID + "-" + suffix
+}
+
+func (p *AudioWorkerPool) setDefaults() {
 	if p.Stream == "" {
 		p.Stream = "audio:stream"
 	}
@@ -46,52 +177,86 @@ func (p *AudioWorkerPool) Start(ctx context.Context) error {
 	if p.ConsumerPrefix == "" {
 		p.ConsumerPrefix = "c"
 	}
+	if p.InstanceID == "" {
+		p.InstanceID = instanceID()
+	}
+	if p.leaseTTL <= 0 {
+		p.leaseTTL = 15 * time.Second
+	}
 	if p.NumWorkers <= 0 {
 		p.NumWorkers = 5
 	}
 	if p.Logger == nil {
 		p.Logger = logrus.New()
 	}
-
-	_ = p.Redis.XGroupCreateMkStream(ctx, p.Stream, p.Group, "0").Err() // ignore BUSYGROUP
-
-	for i := 0; i < p.NumWorkers; i++ {
-		consumer := p.ConsumerPrefix + "-" + strconv.Itoa(i+1)
-		go p.runConsumer(ctx, consumer)
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 5
+	}
+	if p.RetryBaseDelay <= 0 {
+		p.RetryBaseDelay = time.Second
+	}
+	if p.RetryMaxDelay <= 0 {
+		p.RetryMaxDelay = 30 * time.Second
+	}
+	if p.DeadLetterStream == "" {
+		p.DeadLetterStream = p.Stream + ":dlq"
+	}
+	if p.ClaimInterval <= 0 {
+		p.ClaimInterval = 30 * time.Second
+	}
+	if p.ClaimMinIdle <= 0 {
+		p.ClaimMinIdle = 2 * time.Minute
+	}
+	if p.MaxDeliveries <= 0 {
+		p.MaxDeliveries = 3
+	}
+	if p.PromptTokenBudget <= 0 {
+		p.PromptTokenBudget = 3000
+	}
+	if p.HistoryChunks <= 0 {
+		p.HistoryChunks = 200
+	}
+	if p.CVTopK <= 0 {
+		p.CVTopK = 4
+	}
+	if p.UtteranceTimeout <= 0 {
+		p.UtteranceTimeout = 3 * time.Second
+	}
+	if p.sttKeepAlive <= 0 {
+		p.sttKeepAlive = 2 * time.Second
+	}
+	if p.sttOwnerGrace <= 0 {
+		p.sttOwnerGrace = 10 * time.Second
 	}
-	return nil
-}
-
-func (p *AudioWorkerPool) runConsumer(ctx context.Context, consumer string) {
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-		}
-
-		res, err := p.Redis.XReadGroup(ctx, &redis.XReadGroupArgs{
-			Group:    p.Group,
-			Consumer: consumer,
-			Streams:  []string{p.Stream, ">"},
-			Count:    10,
-			Block:    5 * time.Second,
-		}).Result()
-
-		if err != nil {
-			if err == redis.Nil {
-				continue
-			}
-			time.Sleep(500 * time.Millisecond)
-			continue
-		}
 
-		for _, stream := range res {
-			for _, msg := range stream.Messages {
-				p.handleMsg(ctx, msg)
-				_ = p.Redis.XAck(ctx, p.Stream, p.Group, msg.ID).Err()
-			}
-		}
+	p.streamConsumer = &streamConsumer{
+		rdb:              p.Redis,
+		stream:           p.Stream,
+		group:            p.Group,
+		deadLetterStream: p.DeadLetterStream,
+		logger:           p.Logger,
+		name:             "audio message",
+		maxAttempts:      p.MaxAttempts,
+		retryBase:        p.RetryBaseDelay,
+		retryMax:         p.RetryMaxDelay,
+		claimInterval:    p.ClaimInterval,
+		claimMinIdle:     p.ClaimMinIdle,
+		maxDeliveries:    p.MaxDeliveries,
+		handle:           p.handleMsg,
+		schedule: func(ctx context.Context, msg redis.XMessage, run func(context.Context)) bool {
+			return p.dispatch(ctx, msgField(msg, "session_id"), run)
+		},
+		retryLater: func(ctx context.Context, msg redis.XMessage, delay time.Duration, run func(context.Context)) bool {
+			return p.retrySessionLater(ctx, msgField(msg, "session_id"), delay, run)
+		},
+		onRetry: func(ctx context.Context, msg redis.XMessage, reason string) {
+			p.publishStatus(ctx, msg, "retrying", reason)
+		},
+		onDeadLetter: func(ctx context.Context, msg redis.XMessage, reason string) {
+			p.releaseAudio(ctx, msg)
+			p.dropClosedUtterance(ctx, msg)
+			p.publishStatus(ctx, msg, "failed", reason)
+		},
 	}
 }
 
@@ -110,22 +275,37 @@ func normalizeLanguage(v string) string {
 	}
 }
 
-func (p *AudioWorkerPool) handleMsg(ctx context.Context, msg redis.XMessage) {
-	getStr := func(k string) string {
-		v, ok := msg.Values[k]
-		if !ok || v == nil {
-			return ""
-		}
-		s, _ := v.(string)
-		return s
+func msgField(msg redis.XMessage, k string) string {
+	v, ok := msg.Values[k]
+	if !ok || v == nil {
+		return ""
 	}
+	s, _ := v.(string)
+	return s
+}
+
+func (p *AudioWorkerPool) publishChunkStatus(ctx context.Context, sessionID string, chunkIndex int64, status, message string) {
+	payload, _ := json.Marshal(map[string]any{
+		"type":        "status",
+		"status":      status,
+		"message":     message,
+		"chunk_index": chunkIndex,
+	})
+	_ = p.Redis.Publish(ctx, "session:"+sessionID+":status", string(payload)).Err()
+}
 
-	sessionID := getStr("session_id")
-	chunkIndexStr := getStr("chunk_index")
+// handleMsg processes one audio chunk end-to-end (fetch -> STT -> LLM).
+// A non-nil error is a *msgError telling the pool whether to retry or dead-letter.
+func (p *AudioWorkerPool) handleMsg(ctx context.Context, msg redis.XMessage) error {
+	sessionID := msgField(msg, "session_id")
+	chunkIndexStr := msgField(msg, "chunk_index")
 	if sessionID == "" || chunkIndexStr == "" {
-		return
+		return permanent("missing session_id or chunk_index", nil)
+	}
+	chunkIndex, err := strconv.ParseInt(chunkIndexStr, 10, 64)
+	if err != nil || chunkIndex <= 0 {
+		return permanent("invalid chunk_index", err)
 	}
-	chunkIndex, _ := strconv.ParseInt(chunkIndexStr, 10, 64)
 
 	log := p.Logger.WithFields(logrus.Fields{
 		"redis_id":    msg.ID,
@@ -134,80 +314,229 @@ func (p *AudioWorkerPool) handleMsg(ctx context.Context, msg redis.XMessage) {
 	})
 
 	respCh := "session:" + sessionID + ":response"
-	statusCh := "session:" + sessionID + ":status"
 
-	language := normalizeLanguage(getStr("language"))
+	// chunks of an answered utterance are refused before paying for STT; a
+	// retry of the chunk that closed an utterance resumes its answer
+	if err := p.checkChunkOpen(ctx, sessionID, chunkIndex); errors.Is(err, errChunkReplayed) || errors.Is(err, errChunkLate) {
+		u, cerr := p.closedUtterance(ctx, sessionID, chunkOwner(chunkIndex))
+		if cerr != nil {
+			return retryable("utterance state unavailable", cerr)
+		}
+		if u != nil {
+			return p.answerUtterance(ctx, sessionID, u)
+		}
+		p.refuseClosedChunk(ctx, log, sessionID, chunkIndex, err)
+		p.releaseAudio(ctx, msg)
+		return nil
+	}
+
+	isFinal := msgField(msg, "is_final") == "true"
+
+	// a retry of a chunk already folded into the open utterance keeps its
+	// transcript from there: no second STT call, stt_result or usage record
+	folded, err := p.chunkFolded(ctx, sessionID, chunkIndex)
+	if err != nil {
+		return retryable("utterance state unavailable", err)
+	}
+	if folded {
+		log.Debug("chunk already transcribed, resuming")
+		return p.foldChunk(ctx, log, sessionID, chunkIndex, "", 0, nil, false, isFinal)
+	}
+
+	language := normalizeLanguage(msgField(msg, "language"))
 
 	// Fetch audio
 	var audioBytes []byte
-	if b64 := getStr("audio_base64"); b64 != "" {
+	if b64 := msgField(msg, "audio_base64"); b64 != "" {
 		raw := b64
 		if i := strings.Index(raw, ","); i >= 0 {
 			raw = raw[i+1:] // strip data:...;base64,
 		}
 		decoded, err := base64.StdEncoding.DecodeString(raw)
 		if err != nil {
-			log.WithError(err).Warn("base64 decode failed")
-			_ = p.Redis.Publish(ctx, statusCh, `{"type":"status","status":"failed","message":"invalid audio_base64","chunk_index":`+strconv.FormatInt(chunkIndex, 10)+`}`).Err()
-			return
+			return permanent("invalid audio_base64", err)
 		}
 		audioBytes = decoded
-	} else if url := getStr("audio_url"); url != "" {
-		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	} else if url := msgField(msg, "audio_url"); url != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return permanent("invalid audio_url", err)
+		}
 		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
-			log.WithError(err).Warn("audio_url fetch failed")
-			_ = p.Redis.Publish(ctx, statusCh, `{"type":"status","status":"failed","message":"failed to fetch audio_url","chunk_index":`+strconv.FormatInt(chunkIndex, 10)+`}`).Err()
-			return
+			return retryable("failed to fetch audio_url", err)
 		}
 		defer resp.Body.Close()
 
+		if resp.StatusCode >= 500 {
+			return retryable("failed to fetch audio_url", errors.New(resp.Status))
+		}
+		if resp.StatusCode >= 400 {
+			return permanent("failed to fetch audio_url", errors.New(resp.Status))
+		}
+
 		const maxBytes = 10 << 20
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBytes))
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes))
+		if err != nil {
+			return retryable("failed to fetch audio_url", err)
+		}
 		if len(body) == 0 {
-			_ = p.Redis.Publish(ctx, statusCh, `{"type":"status","status":"failed","message":"empty audio","chunk_index":`+strconv.FormatInt(chunkIndex, 10)+`}`).Err()
-			return
+			return permanent("empty audio", nil)
 		}
 		audioBytes = body
 	} else {
-		return
+		return permanent("audio_base64 or audio_url required", nil)
 	}
 
-	// STT
-	_ = p.Buffers.MarkSTT(ctx, sessionID, chunkIndex, "", 0, "processing")
-	_ = p.Redis.Publish(ctx, statusCh, `{"type":"status","status":"processing","message":"stt processing","chunk_index":`+strconv.FormatInt(chunkIndex, 10)+`}`).Err()
+	// Transcode PCM to what STT expects; compressed audio goes through as declared
+	format, err := audio.FormatFromFields(func(k string) string { return msgField(msg, k) })
+	if err != nil {
+		return permanent("invalid audio format", err)
+	}
+	format, audioBytes, err = audio.Prepare(format, audioBytes)
+	if err != nil {
+		return permanent("invalid audio", err)
+	}
+
+	sp, streaming := p.streamingSTT()
+
+	// VAD: silent chunks skip recognition; trimming would splice a live stream, so only per-chunk STT trims
+	act := p.detectVoice(format, audioBytes)
+	silent := act != nil && !act.Speech
+	if act != nil && act.Speech && !streaming {
+		audioBytes = act.Trim(audioBytes)
+	}
 
-	text, conf, err := p.STT.Transcribe(ctx, audioBytes, language)
+	// STT
+	var text string
+	var conf float64
+	var billed float64
+	switch {
+	case streaming:
+		if silent {
+			audioBytes = nil // collect finals without feeding the stream
+		}
+		_ = p.Buffers.MarkSTT(ctx, sessionID, chunkIndex, "", 0, "processing")
+		p.publishChunkStatus(ctx, sessionID, chunkIndex, "processing", "stt processing")
+		text, conf, err = p.transcribeStreaming(ctx, sp, sessionID, chunkIndex, audioBytes, format, language, isFinal)
+	case silent:
+		// nothing to recognise
+	default:
+		_ = p.Buffers.MarkSTT(ctx, sessionID, chunkIndex, "", 0, "processing")
+		p.publishChunkStatus(ctx, sessionID, chunkIndex, "processing", "stt processing")
+		var res stt.Result
+		res, err = p.STT.Transcribe(ctx, audioBytes, format, language)
+		text, conf, billed = res.Text, res.Confidence, res.BilledSeconds
+	}
 	if err != nil {
 		log.WithError(err).Error("stt failed")
 		_ = p.Buffers.MarkSTT(ctx, sessionID, chunkIndex, "", 0, "failed")
-		_ = p.Redis.Publish(ctx, statusCh, `{"type":"status","status":"failed","message":"stt failed","chunk_index":`+strconv.FormatInt(chunkIndex, 10)+`}`).Err()
-		return
+		// audio the provider rejects (InvalidArgument) is not retried; a refusal
+		// of our request (bad key, unknown model: Upstream) is, until dead-lettered
+		return fromAppError("stt failed", err)
+	}
+	if silent {
+		p.releaseAudio(ctx, msg)
+	} else {
+		p.recordSTTUsage(ctx, sessionID, msgField(msg, "user_id"), chunkIndex, billed, audio.EstimateDuration(format, audioBytes))
 	}
 
-	_ = p.Buffers.MarkSTT(ctx, sessionID, chunkIndex, text, conf, "done")
-	sttPayload, _ := json.Marshal(map[string]any{
-		"type":        "stt_result",
-		"chunk_index": chunkIndex,
-		"text":        text,
-		"confidence":  conf,
-		"is_final":    true,
-	})
-	_ = p.Redis.Publish(ctx, respCh, string(sttPayload)).Err()
+	if silent && text == "" {
+		_ = p.Buffers.MarkSTT(ctx, sessionID, chunkIndex, "", 0, "skipped")
+	} else {
+		_ = p.Buffers.MarkSTT(ctx, sessionID, chunkIndex, text, conf, "done")
+		sttPayload, _ := json.Marshal(map[string]any{
+			"type":        "stt_result",
+			"chunk_index": chunkIndex,
+			"text":        text,
+			"confidence":  conf,
+			"is_final":    true,
+		})
+		_ = p.Redis.Publish(ctx, respCh, string(sttPayload)).Err()
+	}
+	return p.foldChunk(ctx, log, sessionID, chunkIndex, text, conf, act, streaming, isFinal)
+}
+
+// foldChunk adds a transcribed chunk to the session's utterance and answers
+// the utterance when the chunk ends it.
+func (p *AudioWorkerPool) foldChunk(ctx context.Context, log *logrus.Entry, sessionID string, chunkIndex int64, text string, conf float64, act *audio.Activity, streaming, isFinal bool) error {
+	respCh := "session:" + sessionID + ":response"
+
+	// a final chunk closes the utterance in the same step that folds it in
+	u, err := p.appendUtterance(ctx, sessionID, chunkIndex, text, conf, act, isFinal)
+	if errors.Is(err, errChunkReplayed) || errors.Is(err, errChunkLate) {
+		p.refuseClosedChunk(ctx, log, sessionID, chunkIndex, err)
+		return nil
+	}
+	if err != nil {
+		return retryable("utterance state unavailable", err)
+	}
+
+	// enough trailing silence after speech ends the utterance without waiting for is_final
+	eou := !isFinal && u != nil && p.endOfUtterance(u)
+	if act != nil {
+		_ = p.Buffers.MarkVAD(ctx, sessionID, chunkIndex, vadDecision(act, !streaming, eou))
+	} else if p.VAD != nil {
+		_ = p.Buffers.MarkVAD(ctx, sessionID, chunkIndex, models.VADDecision{Decision: "skipped"})
+	}
+	if eou {
+		isFinal = true
+		eouPayload, _ := json.Marshal(map[string]any{
+			"type":        "end_of_utterance",
+			"chunk_index": chunkIndex,
+			"silence_ms":  u.silenceMS,
+		})
+		_ = p.Redis.Publish(ctx, respCh, string(eouPayload)).Err()
+		p.foldStreamTail(ctx, sessionID)
+		if u, err = p.closeUtterance(ctx, sessionID, chunkOwner(chunkIndex), false); err != nil {
+			return retryable("utterance state unavailable", err)
+		}
+	}
+
+	// Mid-utterance: wait for the is_final chunk (or the silence timeout) before answering.
+	if !isFinal {
+		_ = p.Buffers.MarkLLM(ctx, sessionID, chunkIndex, "", "aggregated", 0)
+		p.scheduleFlush(ctx, sessionID)
+		p.publishChunkStatus(ctx, sessionID, chunkIndex, "done", "chunk transcribed")
+		return nil
+	}
+	if u == nil {
+		// closed meanwhile by the flusher, which answers it
+		p.publishChunkStatus(ctx, sessionID, chunkIndex, "done", "chunk transcribed")
+		return nil
+	}
+	return p.answerUtterance(ctx, sessionID, u)
+}
+
+// streamAnswer streams the LLM answer for u to the client and records its
+// usage. The answer is kept with the closed utterance, so a retry after a
+// later failure does not run (and bill) the LLM again.
+func (p *AudioWorkerPool) streamAnswer(ctx context.Context, log *logrus.Entry, sessionID string, u *utterance) (string, int64, *models.Session, error) {
+	chunkIndex := u.end
+	respCh := "session:" + sessionID + ":response"
 
-	// LLM streaming
 	start := time.Now()
+	_ = p.Buffers.MarkUtterance(ctx, sessionID, chunkIndex, u.start, u.end)
 	_ = p.Buffers.MarkLLM(ctx, sessionID, chunkIndex, "", "processing", 0)
-	_ = p.Redis.Publish(ctx, statusCh, `{"type":"status","status":"processing","message":"llm processing","chunk_index":`+strconv.FormatInt(chunkIndex, 10)+`}`).Err()
+	p.publishChunkStatus(ctx, sessionID, chunkIndex, "processing", "llm processing")
 
-	prompt := "You are an interview speaking coach. Reply concisely.\n\nUser said:\n" + text
+	pc := p.loadPromptContext(ctx, sessionID, u)
+	req := buildRequest(pc, p.PromptTokenBudget, p.LLMOptions)
 
-	chunks, errs := p.LLM.StreamAnswer(ctx, prompt)
+	chunks, errs := p.LLM.Stream(ctx, req)
 
 	full := strings.Builder{}
 	seq := int64(0)
 
-	for chunk := range chunks {
+	var usage *llm.Usage
+	for c := range chunks {
+		if c.Usage != nil {
+			usage = c.Usage
+		}
+		if c.Text == "" {
+			continue
+		}
+		chunk := c.Text
 		seq++
 		full.WriteString(chunk)
 
@@ -228,20 +557,77 @@ func (p *AudioWorkerPool) handleMsg(ctx context.Context, msg redis.XMessage) {
 	if streamErr != nil {
 		log.WithError(streamErr).Error("llm stream failed")
 		_ = p.Buffers.MarkLLM(ctx, sessionID, chunkIndex, "", "failed", time.Since(start).Milliseconds())
-		_ = p.Redis.Publish(ctx, statusCh, `{"type":"status","status":"failed","message":"llm failed","chunk_index":`+strconv.FormatInt(chunkIndex, 10)+`}`).Err()
-		return
+		return "", 0, nil, retryable("llm failed", streamErr)
 	}
 
 	answer := full.String()
 	procMS := time.Since(start).Milliseconds()
 	_ = p.Buffers.MarkLLM(ctx, sessionID, chunkIndex, answer, "done", procMS)
+	p.recordLLMUsage(ctx, pc.session, sessionID, chunkIndex, req, answer, usage)
+	p.keepAnswer(ctx, sessionID, u, answer, procMS)
+	return answer, procMS, pc.session, nil
+}
+
+// refuseClosedChunk acks a chunk whose utterance was already answered. Replays
+// are dropped quietly; a late chunk is logged and reported to the client,
+// since its speech will not be answered.
+func (p *AudioWorkerPool) refuseClosedChunk(ctx context.Context, log *logrus.Entry, sessionID string, chunkIndex int64, err error) {
+	if errors.Is(err, errChunkReplayed) {
+		log.Debug("chunk already answered, replay ignored")
+		return
+	}
+	log.Warn("late chunk after its utterance was answered, not answered")
+	_ = p.Buffers.MarkLLM(ctx, sessionID, chunkIndex, "", "late", 0)
+	p.publishChunkStatus(ctx, sessionID, chunkIndex, "late", err.Error())
+}
+
+// answerUtterance streams one LLM answer for a closed utterance. The answer is
+// recorded on the utterance's last chunk together with its chunk range.
+func (p *AudioWorkerPool) answerUtterance(ctx context.Context, sessionID string, u *utterance) error {
+	chunkIndex := u.end
+	log := p.Logger.WithFields(logrus.Fields{
+		"session_id":  sessionID,
+		"chunk_start": u.start,
+		"chunk_end":   u.end,
+	})
+
+	respCh := "session:" + sessionID + ":response"
+
+	if strings.TrimSpace(u.text) == "" {
+		_ = p.Buffers.MarkLLM(ctx, sessionID, chunkIndex, "", "skipped", 0)
+		p.finishUtterance(ctx, sessionID, u)
+		p.publishChunkStatus(ctx, sessionID, chunkIndex, "done", "no speech detected")
+		return nil
+	}
+
+	// an answer kept from an earlier attempt is saved without asking the LLM again
+	answer, procMS := u.answer, u.answerMS
+	var sess *models.Session
+	if u.hasAnswer {
+		log.Debug("answer kept from an earlier attempt, saving it")
+		sess = p.lookupSession(ctx, sessionID)
+	} else {
+		var err error
+		if answer, procMS, sess, err = p.streamAnswer(ctx, log, sessionID, u); err != nil {
+			return err
+		}
+	}
+
+	if err := p.persistTurn(ctx, sess, sessionID, u, answer, procMS); err != nil {
+		log.WithError(err).Error("persist turn failed")
+		return retryable("failed to save conversation", err)
+	}
+	p.finishUtterance(ctx, sessionID, u)
 
 	donePayload, _ := json.Marshal(map[string]any{
 		"type":               "llm_complete",
 		"chunk_index":        chunkIndex,
+		"chunk_start":        u.start,
+		"chunk_end":          u.end,
 		"full_response":      answer,
 		"processing_time_ms": procMS,
 	})
 	_ = p.Redis.Publish(ctx, respCh, string(donePayload)).Err()
-	_ = p.Redis.Publish(ctx, statusCh, `{"type":"status","status":"done","message":"chunk processed","chunk_index":`+strconv.FormatInt(chunkIndex, 10)+`}`).Err()
+	p.publishChunkStatus(ctx, sessionID, chunkIndex, "done", "chunk processed")
+	return nil
 }
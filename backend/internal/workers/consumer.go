@@ -0,0 +1,375 @@
+package workers
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// instanceID names this process among the consumers of a stream group:
+// hostname (the pod name on Kubernetes) and pid. Replicas sharing consumer
+// names would share one PEL identity and take each other's entries.
+func instanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "worker"
+	}
+	return host + "-" + strconv.Itoa(os.Getpid())
+}
+
+// streamConsumer is the consumer-group machinery shared by the worker pools:
+// bounded retries with backoff, dead-lettering, a janitor that reclaims
+// entries abandoned by dead consumers (and dead-letters poison entries that
+// keep killing them), and keep-alive of entries this process still holds.
+type streamConsumer struct {
+	rdb              *redis.Client
+	stream           string
+	group            string
+	deadLetterStream string
+	logger           *logrus.Logger
+	// name is what log lines call one entry, e.g. "audio message"
+	name string
+
+	maxAttempts   int
+	retryBase     time.Duration
+	retryMax      time.Duration
+	claimInterval time.Duration
+	claimMinIdle  time.Duration
+	maxDeliveries int
+
+	handle func(ctx context.Context, msg redis.XMessage) error
+	// Optional hooks: schedule runs an entry (inline by default) and reports
+	// whether it took it; retryLater reruns a failed entry after delay instead
+	// of process sleeping it out in place, and reports whether it took it;
+	// onRetry and onDeadLetter report an outcome, e.g. to the client.
+	schedule     func(ctx context.Context, msg redis.XMessage, run func(context.Context)) bool
+	retryLater   func(ctx context.Context, msg redis.XMessage, delay time.Duration, run func(context.Context)) bool
+	onRetry      func(ctx context.Context, msg redis.XMessage, reason string)
+	onDeadLetter func(ctx context.Context, msg redis.XMessage, reason string)
+
+	// entries read by this process and not finished yet (queued or running), by id -> consumer
+	inflightMu sync.Mutex
+	inflight   map[string]string
+}
+
+// start creates the group and runs workers readers, the janitor and the
+// keep-alive, all under consumer names starting with prefix.
+func (c *streamConsumer) start(ctx context.Context, workers int, prefix string) {
+	_ = c.rdb.XGroupCreateMkStream(ctx, c.stream, c.group, "0").Err() // ignore BUSYGROUP
+
+	for i := 0; i < workers; i++ {
+		go c.runConsumer(ctx, prefix+"-"+strconv.Itoa(i+1))
+	}
+	go c.runJanitor(ctx, prefix+"-janitor")
+	go c.runKeepAlive(ctx)
+}
+
+func (c *streamConsumer) runConsumer(ctx context.Context, consumer string) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		res, err := c.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    c.group,
+			Consumer: consumer,
+			Streams:  []string{c.stream, ">"},
+			Count:    10,
+			Block:    5 * time.Second,
+		}).Result()
+
+		if err != nil {
+			if err == redis.Nil {
+				continue
+			}
+			time.Sleep(500 * time.Millisecond)
+			continue
+		}
+
+		for _, stream := range res {
+			for _, msg := range stream.Messages {
+				msg := msg
+				c.track(msg.ID, consumer)
+				c.run(ctx, msg, func(ctx context.Context) { c.process(ctx, consumer, msg) })
+			}
+		}
+	}
+}
+
+// run hands a tracked entry to schedule. An entry that could not be handed
+// over (shutting down) is untracked, so the janitor can reclaim it.
+func (c *streamConsumer) run(ctx context.Context, msg redis.XMessage, fn func(context.Context)) {
+	if c.schedule == nil {
+		fn(ctx)
+		return
+	}
+	if !c.schedule(ctx, msg, fn) {
+		c.untrack(msg.ID)
+	}
+}
+
+func (c *streamConsumer) attemptsKey() string { return c.stream + ":attempts" }
+
+// incrAttempts bumps the attempt counter of a stream entry. The counter lives in
+// Redis so it survives restarts of the consumer that owned the entry.
+func (c *streamConsumer) incrAttempts(ctx context.Context, id string) int {
+	n, err := c.rdb.HIncrBy(ctx, c.attemptsKey(), id, 1).Result()
+	if err != nil {
+		return 1
+	}
+	_ = c.rdb.Expire(ctx, c.attemptsKey(), 24*time.Hour).Err()
+	return int(n)
+}
+
+func (c *streamConsumer) ack(ctx context.Context, id string) {
+	_ = c.rdb.XAck(ctx, c.stream, c.group, id).Err()
+	_ = c.rdb.HDel(ctx, c.attemptsKey(), id).Err()
+}
+
+// process runs handle with bounded retries, then acks or dead-letters the entry.
+// If ctx is cancelled mid-way the entry is left pending so another consumer can reclaim it.
+func (c *streamConsumer) process(ctx context.Context, consumer string, msg redis.XMessage) {
+	rescheduled := false
+	defer func() {
+		if !rescheduled {
+			c.untrack(msg.ID)
+		}
+	}()
+	for {
+		err := c.handle(ctx, msg)
+		if err == nil {
+			c.ack(ctx, msg.ID)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		attempt := c.incrAttempts(ctx, msg.ID)
+		class, reason := classify(err)
+
+		log := c.logger.WithFields(logrus.Fields{
+			"stream":   c.stream,
+			"redis_id": msg.ID,
+			"attempt":  attempt,
+			"reason":   reason,
+		}).WithError(err)
+
+		if class == failPermanent || attempt >= c.maxAttempts {
+			log.Error(c.name + " dead-lettered")
+			c.deadLetter(ctx, msg, reason, err, attempt)
+			return
+		}
+
+		delay := backoff(attempt, c.retryBase, c.retryMax)
+		log.WithField("retry_in_ms", delay.Milliseconds()).Warn(c.name + " failed, retrying")
+		if c.onRetry != nil {
+			c.onRetry(ctx, msg, reason)
+		}
+
+		c.touch(ctx, consumer, msg.ID)
+		if c.retryLater != nil && c.retryLater(ctx, msg, delay, func(ctx context.Context) { c.process(ctx, consumer, msg) }) {
+			rescheduled = true // still tracked until the rerun finishes
+			return
+		}
+		if !sleepCtx(ctx, delay) {
+			return
+		}
+	}
+}
+
+// deadLetter copies the original fields to the dead-letter stream together with
+// the failure details, then acks the entry on the main stream.
+func (c *streamConsumer) deadLetter(ctx context.Context, msg redis.XMessage, reason string, cause error, attempts int) {
+	fields := make(map[string]any, len(msg.Values)+5)
+	for k, v := range msg.Values {
+		fields[k] = v
+	}
+	fields["dlq_reason"] = reason
+	if cause != nil {
+		fields["dlq_error"] = cause.Error()
+	}
+	fields["dlq_attempts"] = strconv.Itoa(attempts)
+	fields["dlq_original_id"] = msg.ID
+	fields["dlq_failed_at"] = strconv.FormatInt(time.Now().UTC().Unix(), 10)
+
+	if err := c.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: c.deadLetterStream,
+		Values: fields,
+	}).Err(); err != nil {
+		// keep the entry pending rather than losing it
+		c.logger.WithError(err).WithField("redis_id", msg.ID).Error("dead-letter enqueue failed")
+		return
+	}
+
+	if c.onDeadLetter != nil {
+		c.onDeadLetter(ctx, msg, reason)
+	}
+	c.ack(ctx, msg.ID)
+}
+
+// runJanitor periodically reclaims entries that sat in the group's PEL longer
+// than claimMinIdle (their consumer died or was preempted) and re-runs them.
+func (c *streamConsumer) runJanitor(ctx context.Context, consumer string) {
+	t := time.NewTicker(c.claimInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		c.reclaim(ctx, consumer)
+	}
+}
+
+func (c *streamConsumer) reclaim(ctx context.Context, consumer string) {
+	start := "0-0"
+	for {
+		msgs, next, err := c.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   c.stream,
+			Group:    c.group,
+			Consumer: consumer,
+			MinIdle:  c.claimMinIdle,
+			Start:    start,
+			Count:    50,
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				c.logger.WithError(err).WithField("stream", c.stream).Warn("xautoclaim failed")
+			}
+			return
+		}
+
+		for _, msg := range msgs {
+			if ctx.Err() != nil {
+				return
+			}
+			c.handleReclaimed(ctx, consumer, msg)
+		}
+
+		if next == "" || next == "0-0" {
+			return
+		}
+		start = next
+	}
+}
+
+func (c *streamConsumer) handleReclaimed(ctx context.Context, consumer string, msg redis.XMessage) {
+	// entry was trimmed from the stream while pending: nothing left to run
+	if len(msg.Values) == 0 {
+		c.ack(ctx, msg.ID)
+		return
+	}
+
+	deliveries := c.deliveryCount(ctx, msg.ID)
+	log := c.logger.WithFields(logrus.Fields{
+		"stream":     c.stream,
+		"redis_id":   msg.ID,
+		"deliveries": deliveries,
+	})
+
+	// Poison message: it keeps taking its consumer down before process() can
+	// record an outcome, so stop redelivering it.
+	if deliveries > int64(c.maxDeliveries) {
+		log.Error(c.name + " exceeded max deliveries, dead-lettering")
+		attempts, _ := c.rdb.HGet(ctx, c.attemptsKey(), msg.ID).Int()
+		c.deadLetter(ctx, msg, "max deliveries exceeded", nil, attempts)
+		return
+	}
+
+	log.Warn("reclaimed stuck " + c.name)
+	c.track(msg.ID, consumer)
+	c.run(ctx, msg, func(ctx context.Context) { c.process(ctx, consumer, msg) })
+}
+
+// deliveryCount reports how many times the entry has been delivered to a consumer
+// (including the XAUTOCLAIM that just returned it).
+func (c *streamConsumer) deliveryCount(ctx context.Context, id string) int64 {
+	pending, err := c.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: c.stream,
+		Group:  c.group,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		return 1
+	}
+	return pending[0].RetryCount
+}
+
+// touch re-claims an entry for its current owner, resetting its idle time so the
+// janitor does not steal entries that are merely waiting out a retry backoff.
+func (c *streamConsumer) touch(ctx context.Context, consumer, id string) {
+	_ = c.rdb.XClaimJustID(ctx, &redis.XClaimArgs{
+		Stream:   c.stream,
+		Group:    c.group,
+		Consumer: consumer,
+		MinIdle:  0,
+		Messages: []string{id},
+	}).Err()
+}
+
+// track marks an entry as read by this process until process() is done with
+// it, so runKeepAlive keeps it fresh while it waits or runs.
+func (c *streamConsumer) track(id, consumer string) {
+	c.inflightMu.Lock()
+	defer c.inflightMu.Unlock()
+	if c.inflight == nil {
+		c.inflight = map[string]string{}
+	}
+	c.inflight[id] = consumer
+}
+
+func (c *streamConsumer) untrack(id string) {
+	c.inflightMu.Lock()
+	defer c.inflightMu.Unlock()
+	delete(c.inflight, id)
+}
+
+// runKeepAlive touches every tracked entry well within claimMinIdle. Without
+// it, entries queued behind slow work look abandoned and a janitor runs them
+// a second time.
+func (c *streamConsumer) runKeepAlive(ctx context.Context) {
+	t := time.NewTicker(c.claimMinIdle / 3)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		c.touchInflight(ctx)
+	}
+}
+
+func (c *streamConsumer) touchInflight(ctx context.Context) {
+	byConsumer := map[string][]string{}
+	c.inflightMu.Lock()
+	for id, consumer := range c.inflight {
+		byConsumer[consumer] = append(byConsumer[consumer], id)
+	}
+	c.inflightMu.Unlock()
+
+	for consumer, ids := range byConsumer {
+		if err := c.rdb.XClaimJustID(ctx, &redis.XClaimArgs{
+			Stream:   c.stream,
+			Group:    c.group,
+			Consumer: consumer,
+			MinIdle:  0,
+			Messages: ids,
+		}).Err(); err != nil && ctx.Err() == nil {
+			c.logger.WithError(err).WithField("stream", c.stream).Warn("keep-alive of in-flight " + c.name + "s failed")
+		}
+	}
+}
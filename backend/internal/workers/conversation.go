@@ -0,0 +1,67 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/yoockh/yoospeak/internal/models"
+)
+
+// turnID derives a stable id for one side of an utterance, so retries and
+// reclaimed replays of the same utterance hit the same rows.
+func turnID(sessionID string, u *utterance, role string) string {
+	name := fmt.Sprintf("yoospeak:turn:%s:%d-%d:%s", sessionID, u.start, u.end, role)
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(name)).String()
+}
+
+// persistTurn writes the user transcript and the coach answer of a finished
+// utterance into conversation_logs.
+func (p *AudioWorkerPool) persistTurn(ctx context.Context, sess *models.Session, sessionID string, u *utterance, answer string, processingMS int64) error {
+	if p.Conversations == nil {
+		return nil
+	}
+	if sess == nil || sess.UserID == "" {
+		p.Logger.WithField("session_id", sessionID).Warn("session unknown, turn not persisted")
+		return nil
+	}
+
+	userMeta, _ := json.Marshal(map[string]any{
+		"chunk_index":    u.end,
+		"chunk_start":    u.start,
+		"chunk_end":      u.end,
+		"stt_confidence": u.confidence(),
+	})
+	userRow, err := p.Conversations.AppendOnce(ctx, turnID(sessionID, u, "user"), sess.UserID, sessionID, "user", u.text, userMeta)
+	if err != nil {
+		return err
+	}
+	p.enqueueEmbedding(ctx, userRow.ID)
+
+	if answer == "" {
+		return nil
+	}
+	assistantMeta, _ := json.Marshal(map[string]any{
+		"chunk_index":        u.end,
+		"chunk_start":        u.start,
+		"chunk_end":          u.end,
+		"processing_time_ms": processingMS,
+	})
+	assistantRow, err := p.Conversations.AppendOnce(ctx, turnID(sessionID, u, "assistant"), sess.UserID, sessionID, "assistant", answer, assistantMeta)
+	if err != nil {
+		return err
+	}
+	p.enqueueEmbedding(ctx, assistantRow.ID)
+	return nil
+}
+
+// enqueueEmbedding is best-effort: a missing vector only hides the turn from search.
+func (p *AudioWorkerPool) enqueueEmbedding(ctx context.Context, logID string) {
+	if p.Embeddings == nil {
+		return
+	}
+	if err := p.Embeddings.EnqueueConversation(ctx, logID); err != nil {
+		p.Logger.WithError(err).WithField("log_id", logID).Warn("enqueue embedding failed")
+	}
+}
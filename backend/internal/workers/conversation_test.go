@@ -0,0 +1,149 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yoockh/yoospeak/internal/models"
+	llmfake "github.com/yoockh/yoospeak/internal/providers/llm/fake"
+	"github.com/yoockh/yoospeak/internal/services"
+)
+
+// knownSessions is a SessionService that knows every session as user-1's.
+type knownSessions struct{ services.SessionService }
+
+func (knownSessions) Get(_ context.Context, sessionID string) (*models.Session, error) {
+	return &models.Session{SessionID: sessionID, UserID: "user-1"}, nil
+}
+
+// conversationLog is a ConversationService keeping AppendOnce rows by id; the
+// first failures calls fail.
+type conversationLog struct {
+	services.ConversationService
+
+	mu       sync.Mutex
+	failures int
+	rows     map[string]models.ConversationLog
+}
+
+func (c *conversationLog) AppendOnce(_ context.Context, id, userID, sessionID, role, content string, _ []byte) (*models.ConversationLog, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failures > 0 {
+		c.failures--
+		return nil, errors.New("connection reset")
+	}
+	if c.rows == nil {
+		c.rows = map[string]models.ConversationLog{}
+	}
+	row, ok := c.rows[id]
+	if !ok {
+		row = models.ConversationLog{ID: id, UserID: userID, SessionID: sessionID, Role: role, Content: content, Timestamp: time.Now()}
+		c.rows[id] = row
+	}
+	return &row, nil
+}
+
+// roles counts the stored rows per role.
+func (c *conversationLog) roles() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := map[string]int{}
+	for _, r := range c.rows {
+		n[r.Role]++
+	}
+	return n
+}
+
+func TestRetryAfterSaveFailureKeepsTranscriptAndAnswer(t *testing.T) {
+	p, sttP, llmP := newUtterancePool(t)
+	convos := &conversationLog{failures: 1}
+	p.Sessions, p.Conversations = knownSessions{}, convos
+	ctx := context.Background()
+
+	sub := p.Redis.Subscribe(ctx, "session:sess-1:response")
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	handle(t, p, wordChunk("sess-1", 1, "good", false))
+	final := wordChunk("sess-1", 2, "team", true)
+	if err := p.handleMsg(ctx, final); err == nil {
+		t.Fatal("first attempt saved the turn, want the save to fail")
+	}
+	handle(t, p, final)
+
+	if n := len(sttP.Calls()); n != 2 {
+		t.Errorf("stt called %d times, want once per chunk", n)
+	}
+	if got := answered(llmP); len(got) != 1 || got[0] != "good team" {
+		t.Errorf("answered %q, want one answer for \"good team\"", got)
+	}
+	if got := convos.roles(); got["user"] != 1 || got["assistant"] != 1 {
+		t.Errorf("rows per role = %v, want one user and one assistant row", got)
+	}
+
+	var llmChunks, completes int
+	timeout := time.After(200 * time.Millisecond)
+drain:
+	for {
+		select {
+		case m := <-sub.Channel():
+			switch {
+			case strings.Contains(m.Payload, `"type":"llm_chunk"`):
+				llmChunks++
+			case strings.Contains(m.Payload, `"type":"llm_complete"`):
+				completes++
+			}
+		case <-timeout:
+			break drain
+		}
+	}
+	if llmChunks != 1 || completes != 1 {
+		t.Errorf("published %d llm_chunk and %d llm_complete, want the answer streamed once and completed once", llmChunks, completes)
+	}
+}
+
+func TestRetriedOrReplayedUtteranceSavesOneTurn(t *testing.T) {
+	cases := []struct {
+		name string
+		run  func(t *testing.T, p *AudioWorkerPool, llmP *llmfake.Provider)
+	}{
+		{"replayed after the answer", func(t *testing.T, p *AudioWorkerPool, _ *llmfake.Provider) {
+			handle(t, p, wordChunk("sess-1", 1, "good", false), wordChunk("sess-1", 2, "team", true))
+			handle(t, p, wordChunk("sess-1", 1, "good", false), wordChunk("sess-1", 2, "team", true))
+		}},
+		{"replayed after the utterance state was lost", func(t *testing.T, p *AudioWorkerPool, _ *llmfake.Provider) {
+			handle(t, p, wordChunk("sess-1", 1, "good", false), wordChunk("sess-1", 2, "team", true))
+			p.Redis.FlushAll(context.Background())
+			handle(t, p, wordChunk("sess-1", 1, "good", false), wordChunk("sess-1", 2, "team", true))
+		}},
+		{"retried after an llm failure", func(t *testing.T, p *AudioWorkerPool, llmP *llmfake.Provider) {
+			llmP.Script = []llmfake.Response{{Chunks: []string{"o"}, Err: errors.New("stream reset")}}
+			handle(t, p, wordChunk("sess-1", 1, "good", false))
+			final := wordChunk("sess-1", 2, "team", true)
+			if err := p.handleMsg(context.Background(), final); err == nil {
+				t.Fatal("first attempt answered, want the llm failure")
+			}
+			handle(t, p, final)
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, _, llmP := newUtterancePool(t)
+			convos := &conversationLog{}
+			p.Sessions, p.Conversations = knownSessions{}, convos
+
+			tc.run(t, p, llmP)
+
+			if got := convos.roles(); len(got) != 2 || got["user"] != 1 || got["assistant"] != 1 {
+				t.Errorf("rows per role = %v, want one user and one assistant row", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package workers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/yoockh/yoospeak/internal/services"
+)
+
+// CVExtractionQueue enqueues CV text extraction jobs on a Redis stream. It
+// implements services.CVExtractionJobs.
+type CVExtractionQueue struct {
+	Redis  *redis.Client
+	Stream string
+}
+
+func NewCVExtractionQueue(rdb *redis.Client, stream string) *CVExtractionQueue {
+	if stream == "" {
+		stream = "cv:stream"
+	}
+	return &CVExtractionQueue{Redis: rdb, Stream: stream}
+}
+
+func (q *CVExtractionQueue) EnqueueCVExtraction(ctx context.Context, cvFileID string) error {
+	return q.Redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: q.Stream,
+		Values: map[string]any{"cv_file_id": cvFileID},
+	}).Err()
+}
+
+// CVExtractionWorkerPool consumes the CV stream and fills Profile.CVText from uploaded files.
+type CVExtractionWorkerPool struct {
+	Redis      *redis.Client
+	Extraction services.CVExtractionService
+	NumWorkers int
+
+	Logger *logrus.Logger
+
+	Stream           string
+	Group            string
+	ConsumerPrefix   string
+	MaxAttempts      int
+	DeadLetterStream string
+}
+
+func (p *CVExtractionWorkerPool) Start(ctx context.Context) error {
+	if p.Redis == nil || p.Extraction == nil {
+		return errors.New("CVExtractionWorkerPool missing dependency: Redis/Extraction must be set")
+	}
+	if p.Stream == "" {
+		p.Stream = "cv:stream"
+	}
+	if p.Group == "" {
+		p.Group = "cv-workers"
+	}
+	if p.ConsumerPrefix == "" {
+		p.ConsumerPrefix = "cv"
+	}
+	if p.NumWorkers <= 0 {
+		p.NumWorkers = 1
+	}
+	if p.Logger == nil {
+		p.Logger = logrus.New()
+	}
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.DeadLetterStream == "" {
+		p.DeadLetterStream = p.Stream + ":dlq"
+	}
+
+	jobs := newJobConsumer(p.Redis, p.Stream, p.Group, p.DeadLetterStream, p.MaxAttempts, p.Logger, "cv extraction job", p.handleMsg)
+	jobs.start(ctx, p.NumWorkers, p.ConsumerPrefix+"-"+instanceID())
+	return nil
+}
+
+func (p *CVExtractionWorkerPool) handleMsg(ctx context.Context, msg redis.XMessage) error {
+	id := msgField(msg, "cv_file_id")
+	if id == "" {
+		return permanent("missing cv_file_id", nil)
+	}
+	if err := p.Extraction.Extract(ctx, id); err != nil {
+		return fromAppError("cv extraction failed", err)
+	}
+	return nil
+}
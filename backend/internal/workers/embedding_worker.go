@@ -0,0 +1,112 @@
+package workers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/yoockh/yoospeak/internal/services"
+)
+
+const (
+	embedKindConversation = "conversation"
+	embedKindProfileCV    = "profile_cv"
+)
+
+// EmbeddingQueue enqueues embedding jobs on a Redis stream. It implements
+// services.EmbeddingJobs so handlers and the audio worker stay decoupled from
+// the (slow) embedding provider.
+type EmbeddingQueue struct {
+	Redis  *redis.Client
+	Stream string
+}
+
+func NewEmbeddingQueue(rdb *redis.Client, stream string) *EmbeddingQueue {
+	if stream == "" {
+		stream = "embed:stream"
+	}
+	return &EmbeddingQueue{Redis: rdb, Stream: stream}
+}
+
+func (q *EmbeddingQueue) enqueue(ctx context.Context, kind, id string) error {
+	return q.Redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: q.Stream,
+		Values: map[string]any{"kind": kind, "id": id},
+	}).Err()
+}
+
+func (q *EmbeddingQueue) EnqueueConversation(ctx context.Context, logID string) error {
+	return q.enqueue(ctx, embedKindConversation, logID)
+}
+
+func (q *EmbeddingQueue) EnqueueProfileCV(ctx context.Context, userID string) error {
+	return q.enqueue(ctx, embedKindProfileCV, userID)
+}
+
+// EmbeddingWorkerPool consumes the embedding stream and fills the vector columns.
+type EmbeddingWorkerPool struct {
+	Redis      *redis.Client
+	Embeddings services.EmbeddingService
+	NumWorkers int
+
+	Logger *logrus.Logger
+
+	Stream           string
+	Group            string
+	ConsumerPrefix   string
+	MaxAttempts      int
+	DeadLetterStream string
+}
+
+func (p *EmbeddingWorkerPool) Start(ctx context.Context) error {
+	if p.Redis == nil || p.Embeddings == nil {
+		return errors.New("EmbeddingWorkerPool missing dependency: Redis/Embeddings must be set")
+	}
+	if p.Stream == "" {
+		p.Stream = "embed:stream"
+	}
+	if p.Group == "" {
+		p.Group = "embed-workers"
+	}
+	if p.ConsumerPrefix == "" {
+		p.ConsumerPrefix = "e"
+	}
+	if p.NumWorkers <= 0 {
+		p.NumWorkers = 2
+	}
+	if p.Logger == nil {
+		p.Logger = logrus.New()
+	}
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 5
+	}
+	if p.DeadLetterStream == "" {
+		p.DeadLetterStream = p.Stream + ":dlq"
+	}
+
+	jobs := newJobConsumer(p.Redis, p.Stream, p.Group, p.DeadLetterStream, p.MaxAttempts, p.Logger, "embedding job", p.handleMsg)
+	jobs.start(ctx, p.NumWorkers, p.ConsumerPrefix+"-"+instanceID())
+	return nil
+}
+
+func (p *EmbeddingWorkerPool) handleMsg(ctx context.Context, msg redis.XMessage) error {
+	id := msgField(msg, "id")
+	if id == "" {
+		return permanent("missing id", nil)
+	}
+
+	switch msgField(msg, "kind") {
+	case embedKindConversation:
+		if err := p.Embeddings.EmbedConversation(ctx, id); err != nil {
+			return fromAppError("conversation embedding failed", err)
+		}
+	case embedKindProfileCV:
+		if err := p.Embeddings.EmbedProfileCV(ctx, id); err != nil {
+			return fromAppError("cv embedding failed", err)
+		}
+	default:
+		return permanent("unknown embedding kind", nil)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package workers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	sttfake "github.com/yoockh/yoospeak/internal/providers/stt/fake"
+)
+
+func TestJanitorReclaimsIdleEntryOfDeadConsumer(t *testing.T) {
+	sttP := &sttfake.Provider{Default: sttfake.Response{Text: "hello", Confidence: 0.9}}
+	p := newTestPool(t, sttP)
+	ctx := context.Background()
+
+	// a consumer read the entry and died before acking it
+	deliver(t, p, "dead-1", audioChunk("sess-1", "1"))
+
+	// not idle long enough yet: left alone
+	p.reclaim(ctx, "c-janitor")
+	if n := len(sttP.Calls()); n != 0 {
+		t.Fatalf("entry reclaimed before ClaimMinIdle, stt called %d times", n)
+	}
+
+	time.Sleep(2 * p.ClaimMinIdle)
+	p.reclaim(ctx, "c-janitor")
+
+	if n := len(sttP.Calls()); n != 1 {
+		t.Errorf("stt called %d times, want the reclaimed entry run once", n)
+	}
+	if n := pendingCount(t, p); n != 0 {
+		t.Errorf("%d entries still pending, want the entry acked", n)
+	}
+	if dl := deadLetters(t, p); len(dl) != 0 {
+		t.Errorf("dead letters = %v", dl)
+	}
+}
+
+func TestJanitorDeadLettersEntryOverMaxDeliveries(t *testing.T) {
+	sttP := &sttfake.Provider{Default: sttfake.Response{Text: "hello", Confidence: 0.9}}
+	p := newTestPool(t, sttP)
+	ctx := context.Background()
+
+	// the entry has taken down every consumer it was delivered to
+	msg := deliver(t, p, "dead-1", audioChunk("sess-1", "1"))
+	for i := 0; i < p.MaxDeliveries; i++ {
+		if err := p.Redis.XClaim(ctx, &redis.XClaimArgs{
+			Stream:   p.Stream,
+			Group:    p.Group,
+			Consumer: "dead-2",
+			Messages: []string{msg.ID},
+		}).Err(); err != nil {
+			t.Fatalf("xclaim: %v", err)
+		}
+	}
+
+	time.Sleep(2 * p.ClaimMinIdle)
+	p.reclaim(ctx, "c-janitor")
+
+	if n := len(sttP.Calls()); n != 0 {
+		t.Errorf("poison entry was run again (stt called %d times)", n)
+	}
+	dl := deadLetters(t, p)
+	if len(dl) != 1 {
+		t.Fatalf("dead letters = %v, want 1", dl)
+	}
+	if got := dl[0].Values; got["dlq_reason"] != "max deliveries exceeded" || got["dlq_original_id"] != msg.ID {
+		t.Errorf("dead letter = %v", got)
+	}
+	if n := pendingCount(t, p); n != 0 {
+		t.Errorf("%d entries still pending, want the entry acked", n)
+	}
+}
+
+func TestJanitorAcksEntryTrimmedWhilePending(t *testing.T) {
+	sttP := &sttfake.Provider{Default: sttfake.Response{Text: "hello", Confidence: 0.9}}
+	p := newTestPool(t, sttP)
+	ctx := context.Background()
+
+	msg := deliver(t, p, "dead-1", audioChunk("sess-1", "1"))
+	if err := p.Redis.XDel(ctx, p.Stream, msg.ID).Err(); err != nil {
+		t.Fatalf("xdel: %v", err)
+	}
+
+	time.Sleep(2 * p.ClaimMinIdle)
+	p.reclaim(ctx, "c-janitor")
+
+	if n := pendingCount(t, p); n != 0 {
+		t.Errorf("%d entries still pending, want the trimmed entry acked", n)
+	}
+	if n := len(sttP.Calls()); n != 0 || len(deadLetters(t, p)) != 0 {
+		t.Errorf("trimmed entry was run or dead-lettered")
+	}
+}
@@ -0,0 +1,42 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/yoockh/yoospeak/internal/utils"
+)
+
+// newJobConsumer is the stream consumer of a background job pool, for jobs
+// that need neither ordering nor client status updates. Consumer names carry
+// the instance id (see start), so replicas do not share PELs.
+func newJobConsumer(rdb *redis.Client, stream, group, deadLetter string, maxAttempts int, logger *logrus.Logger, name string, handle func(ctx context.Context, msg redis.XMessage) error) *streamConsumer {
+	return &streamConsumer{
+		rdb:              rdb,
+		stream:           stream,
+		group:            group,
+		deadLetterStream: deadLetter,
+		logger:           logger,
+		name:             name,
+		maxAttempts:      maxAttempts,
+		retryBase:        2 * time.Second,
+		retryMax:         time.Minute,
+		claimInterval:    time.Minute,
+		claimMinIdle:     5 * time.Minute,
+		maxDeliveries:    3,
+		handle:           handle,
+	}
+}
+
+// fromAppError maps service errors onto retry classes: caller mistakes and
+// missing rows will not get better by retrying, everything else might. A
+// provider refusing our request (CodeUpstream) is retried too; if it keeps
+// refusing, the entry is dead-lettered with an error log to alert on.
+func fromAppError(reason string, err error) error {
+	if utils.IsCode(err, utils.CodeInvalidArgument) || utils.IsCode(err, utils.CodeNotFound) {
+		return permanent(reason, err)
+	}
+	return retryable(reason, err)
+}
@@ -0,0 +1,76 @@
+package workers
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/yoockh/yoospeak/internal/utils"
+)
+
+func TestFromAppErrorRetriesProviderRefusals(t *testing.T) {
+	cases := []struct {
+		code utils.Code
+		want failureClass
+	}{
+		{utils.CodeInvalidArgument, failPermanent},
+		{utils.CodeNotFound, failPermanent},
+		{utils.CodeFromHTTPStatus(400), failRetryable},
+		{utils.CodeFromHTTPStatus(401), failRetryable},
+		{utils.CodeFromHTTPStatus(403), failRetryable},
+		{utils.CodeFromHTTPStatus(404), failRetryable},
+		{utils.CodeFromHTTPStatus(422), failRetryable},
+		{utils.CodeFromHTTPStatus(429), failRetryable},
+		{utils.CodeFromHTTPStatus(503), failRetryable},
+	}
+	for _, tc := range cases {
+		class, _ := classify(fromAppError("stt failed", utils.E(tc.code, "op", "refused", nil)))
+		if class != tc.want {
+			t.Errorf("%s: class = %d, want %d", tc.code, class, tc.want)
+		}
+	}
+}
+
+func TestJobConsumerDeadLettersPoisonJobFromTheJanitor(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	var runs atomic.Int32
+	c := newJobConsumer(rdb, "jobs", "job-workers", "jobs:dlq", 3, logger, "test job", func(ctx context.Context, msg redis.XMessage) error {
+		runs.Add(1)
+		return nil
+	})
+	c.claimMinIdle = 20 * time.Millisecond
+	if err := rdb.XGroupCreateMkStream(ctx, "jobs", "job-workers", "0").Err(); err != nil {
+		t.Fatalf("xgroup create: %v", err)
+	}
+
+	// delivered to consumers that crashed on it, more often than maxDeliveries allows
+	id := rdb.XAdd(ctx, &redis.XAddArgs{Stream: "jobs", Values: map[string]any{"id": "job-1"}}).Val()
+	rdb.XReadGroup(ctx, &redis.XReadGroupArgs{Group: "job-workers", Consumer: "dead-1", Streams: []string{"jobs", ">"}})
+	for i := 0; i < c.maxDeliveries; i++ {
+		rdb.XClaim(ctx, &redis.XClaimArgs{Stream: "jobs", Group: "job-workers", Consumer: "dead-2", Messages: []string{id}})
+	}
+
+	time.Sleep(2 * c.claimMinIdle)
+	c.reclaim(ctx, "j-janitor")
+
+	if n := runs.Load(); n != 0 {
+		t.Errorf("poison job run %d times", n)
+	}
+	dl, _ := rdb.XRange(ctx, "jobs:dlq", "-", "+").Result()
+	if len(dl) != 1 || dl[0].Values["dlq_reason"] != "max deliveries exceeded" || dl[0].Values["id"] != "job-1" {
+		t.Errorf("dead letters = %v, want the poison job", dl)
+	}
+	if n := rdb.XPending(ctx, "jobs", "job-workers").Val().Count; n != 0 {
+		t.Errorf("%d jobs still pending", n)
+	}
+}
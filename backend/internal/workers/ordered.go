@@ -0,0 +1,172 @@
+package workers
+
+import (
+	"context"
+	"hash/fnv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// shardFor maps a session to one of n shards so all work for that session is
+// handled by the same goroutine, in submission order.
+func shardFor(sessionID string, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(sessionID))
+	return int(h.Sum32() % uint32(n))
+}
+
+func (p *AudioWorkerPool) runShard(ctx context.Context, in <-chan func(context.Context)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case run := <-in:
+			run(ctx)
+		}
+	}
+}
+
+// dispatch runs work for a session inline, or in Ordered mode hands it to the
+// session's shard. Blocks when the shard is backed up, which throttles the reader.
+// It reports false when ctx ended before the work was handed over.
+func (p *AudioWorkerPool) dispatch(ctx context.Context, sessionID string, run func(context.Context)) bool {
+	if len(p.shards) == 0 {
+		run(ctx)
+		return true
+	}
+	if p.holdBehindRetry(sessionID, run) {
+		return true
+	}
+
+	job := func(ctx context.Context) {
+		// the session may have started a retry backoff since this was queued
+		if !p.holdBehindRetry(sessionID, run) {
+			run(ctx)
+		}
+	}
+	select {
+	case p.shards[shardFor(sessionID, len(p.shards))] <- job:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// retrySessionLater reruns a failed entry of an Ordered session after delay
+// without holding up its shard: the session is held, so its later work
+// queues behind the retry, while other sessions on the shard carry on. Outside
+// Ordered mode it declines and the backoff is slept in place.
+func (p *AudioWorkerPool) retrySessionLater(ctx context.Context, sessionID string, delay time.Duration, run func(context.Context)) bool {
+	if len(p.shards) == 0 {
+		return false
+	}
+	p.heldMu.Lock()
+	if p.held == nil {
+		p.held = map[string][]func(context.Context){}
+	}
+	if _, ok := p.held[sessionID]; !ok {
+		p.held[sessionID] = nil
+	}
+	p.heldMu.Unlock()
+
+	resume := func(ctx context.Context) {
+		p.heldMu.Lock()
+		queued := p.held[sessionID]
+		delete(p.held, sessionID)
+		p.heldMu.Unlock()
+
+		run(ctx)
+		for i, next := range queued {
+			// failed again: the rest waits behind the new retry, ahead of anything newer
+			p.heldMu.Lock()
+			if newer, ok := p.held[sessionID]; ok {
+				p.held[sessionID] = append(queued[i:], newer...)
+				p.heldMu.Unlock()
+				return
+			}
+			p.heldMu.Unlock()
+			next(ctx)
+		}
+	}
+	time.AfterFunc(delay, func() {
+		select {
+		case p.shards[shardFor(sessionID, len(p.shards))] <- resume:
+		case <-ctx.Done():
+		}
+	})
+	return true
+}
+
+// holdBehindRetry queues run behind the session's pending retry, if it has one.
+func (p *AudioWorkerPool) holdBehindRetry(sessionID string, run func(context.Context)) bool {
+	p.heldMu.Lock()
+	defer p.heldMu.Unlock()
+	queued, ok := p.held[sessionID]
+	if !ok {
+		return false
+	}
+	p.held[sessionID] = append(queued, run)
+	return true
+}
+
+func (p *AudioWorkerPool) orderedLeaseKey() string { return p.Stream + ":" + p.Group + ":ordered" }
+
+// renewLeaseScript extends the lease only for its holder (ARGV[1]).
+var renewLeaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseLeaseScript drops the lease only for its holder (ARGV[1]).
+var releaseLeaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// runOrderedLease makes the ordered pool the group's only reader: the reader,
+// janitor and utterance flusher run only while this process holds the
+// group's lease. Other replicas stand by and take over once it expires (a
+// crashed holder) or is released (shutdown). Entries already queued in the
+// shards finish either way; runKeepAlive keeps them from being reclaimed.
+func (p *AudioWorkerPool) runOrderedLease(ctx context.Context) {
+	key := p.orderedLeaseKey()
+	defer func() {
+		_ = releaseLeaseScript.Run(context.Background(), p.Redis, []string{key}, p.InstanceID).Err()
+	}()
+
+	for ctx.Err() == nil {
+		ok, err := p.Redis.SetNX(ctx, key, p.InstanceID, p.leaseTTL).Result()
+		if err != nil || !ok {
+			sleepCtx(ctx, p.leaseTTL/3)
+			continue
+		}
+
+		p.Logger.WithField("instance", p.InstanceID).Info("ordered audio pool: lease acquired, reading")
+		lctx, cancel := context.WithCancel(ctx)
+		go p.runConsumer(lctx, p.consumerName("1"))
+		go p.runJanitor(lctx, p.consumerName("janitor"))
+		go p.runUtteranceFlusher(lctx)
+
+		p.holdLease(lctx, key)
+		cancel()
+		if ctx.Err() == nil {
+			p.Logger.WithField("instance", p.InstanceID).Warn("ordered audio pool: lease lost, standing by")
+		}
+	}
+}
+
+// holdLease renews the lease until ctx ends or a renewal finds it gone.
+func (p *AudioWorkerPool) holdLease(ctx context.Context, key string) {
+	for sleepCtx(ctx, p.leaseTTL/3) {
+		n, err := renewLeaseScript.Run(ctx, p.Redis, []string{key}, p.InstanceID, p.leaseTTL.Milliseconds()).Int()
+		if err == nil && n == 0 {
+			return
+		}
+		// a failed renewal is retried; the lease only lapses after leaseTTL
+	}
+}
@@ -0,0 +1,398 @@
+package workers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/yoockh/yoospeak/internal/audio"
+	"github.com/yoockh/yoospeak/internal/models"
+	"github.com/yoockh/yoospeak/internal/providers/llm"
+	"github.com/yoockh/yoospeak/internal/providers/stt"
+)
+
+type nopBuffers struct{}
+
+func (nopBuffers) InsertAudioChunk(ctx context.Context, sessionID string, chunkIndex int64, audioURL, audioBase64 *string) (*models.RealtimeBuffer, error) {
+	return &models.RealtimeBuffer{SessionID: sessionID, ChunkIndex: chunkIndex}, nil
+}
+func (nopBuffers) MarkSTT(ctx context.Context, sessionID string, chunkIndex int64, rawText string, confidence float64, status string) error {
+	return nil
+}
+func (nopBuffers) MarkLLM(ctx context.Context, sessionID string, chunkIndex int64, response string, status string, processingMS int64) error {
+	return nil
+}
+func (nopBuffers) MarkUtterance(ctx context.Context, sessionID string, chunkIndex int64, start, end int64) error {
+	return nil
+}
+func (nopBuffers) MarkVAD(ctx context.Context, sessionID string, chunkIndex int64, v models.VADDecision) error {
+	return nil
+}
+func (nopBuffers) MarkUsage(ctx context.Context, sessionID string, chunkIndex int64, u models.ChunkUsage) error {
+	return nil
+}
+func (nopBuffers) ListBySession(ctx context.Context, sessionID string, limit int64) ([]models.RealtimeBuffer, error) {
+	return nil, nil
+}
+func (nopBuffers) RecentTranscripts(ctx context.Context, sessionID string, beforeChunk int64, limit int64) ([]models.RealtimeBuffer, error) {
+	return nil, nil
+}
+
+// jitterSTT "transcribes" audio whose bytes are the session id, sleeping a random
+// while and tracking how many calls are in flight overall and per session.
+type jitterSTT struct {
+	mu         sync.Mutex
+	inFlight   map[string]int
+	total      int
+	maxTotal   int
+	overlapped []string
+}
+
+func (s *jitterSTT) Transcribe(ctx context.Context, data []byte, format audio.Format, language string) (stt.Result, error) {
+	sessionID := string(data)
+
+	s.mu.Lock()
+	s.inFlight[sessionID]++
+	if s.inFlight[sessionID] > 1 {
+		s.overlapped = append(s.overlapped, sessionID)
+	}
+	s.total++
+	if s.total > s.maxTotal {
+		s.maxTotal = s.total
+	}
+	s.mu.Unlock()
+
+	time.Sleep(time.Duration(rand.Intn(4)+1) * time.Millisecond)
+
+	s.mu.Lock()
+	s.inFlight[sessionID]--
+	s.total--
+	s.mu.Unlock()
+
+	return stt.Result{Text: "hello from " + sessionID, Confidence: 0.9, IsFinal: true}, nil
+}
+
+func (s *jitterSTT) Close() error { return nil }
+
+type jitterLLM struct{}
+
+func (jitterLLM) Stream(ctx context.Context, req llm.Request) (<-chan llm.Chunk, <-chan error) {
+	out := make(chan llm.Chunk, 2)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(out)
+		defer close(errs)
+		for _, part := range []string{"good ", "answer"} {
+			time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+			out <- llm.Chunk{Text: part}
+		}
+	}()
+	return out, errs
+}
+
+func (jitterLLM) Close() error { return nil }
+
+func TestOrderedPoolKeepsPerSessionOrder(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const sessions, chunks = 6, 8
+
+	sub := rdb.PSubscribe(ctx, "session:*:response")
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		t.Fatalf("psubscribe: %v", err)
+	}
+
+	sttP := &jitterSTT{inFlight: map[string]int{}}
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	pool := &AudioWorkerPool{
+		Redis:      rdb,
+		Buffers:    nopBuffers{},
+		NumWorkers: 4,
+		STT:        sttP,
+		LLM:        jitterLLM{},
+		Logger:     logger,
+		Stream:     "audio:stream",
+		Group:      "audio-workers",
+		Ordered:    true,
+	}
+	if err := pool.Start(ctx); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	// interleave sessions in the stream the way concurrent WS clients would
+	for c := 1; c <= chunks; c++ {
+		for s := 1; s <= sessions; s++ {
+			sessionID := "sess-" + strconv.Itoa(s)
+			if err := rdb.XAdd(ctx, &redis.XAddArgs{
+				Stream: "audio:stream",
+				Values: map[string]any{
+					"session_id":   sessionID,
+					"chunk_index":  strconv.Itoa(c),
+					"is_final":     "true",
+					"language":     "en",
+					"audio_base64": base64.StdEncoding.EncodeToString([]byte(sessionID)),
+				},
+			}).Err(); err != nil {
+				t.Fatalf("xadd: %v", err)
+			}
+		}
+	}
+
+	// per session: the sequence of (type, chunk_index) as published
+	seen := map[string][]string{}
+	completed := 0
+	deadline := time.After(10 * time.Second)
+	for completed < sessions*chunks {
+		select {
+		case m := <-sub.Channel():
+			sessionID := strings.TrimSuffix(strings.TrimPrefix(m.Channel, "session:"), ":response")
+			var ev struct {
+				Type       string `json:"type"`
+				ChunkIndex int64  `json:"chunk_index"`
+			}
+			if err := json.Unmarshal([]byte(m.Payload), &ev); err != nil {
+				t.Fatalf("bad payload %q: %v", m.Payload, err)
+			}
+			if ev.Type == "llm_chunk" {
+				continue
+			}
+			seen[sessionID] = append(seen[sessionID], fmt.Sprintf("%s:%d", ev.Type, ev.ChunkIndex))
+			if ev.Type == "llm_complete" {
+				completed++
+			}
+		case <-deadline:
+			t.Fatalf("timed out after %d/%d completions", completed, sessions*chunks)
+		}
+	}
+
+	for s := 1; s <= sessions; s++ {
+		sessionID := "sess-" + strconv.Itoa(s)
+		var want []string
+		for c := 1; c <= chunks; c++ {
+			want = append(want, fmt.Sprintf("stt_result:%d", c), fmt.Sprintf("llm_complete:%d", c))
+		}
+		if got := strings.Join(seen[sessionID], ","); got != strings.Join(want, ",") {
+			t.Errorf("%s out of order:\n got %s\nwant %s", sessionID, got, strings.Join(want, ","))
+		}
+	}
+
+	sttP.mu.Lock()
+	defer sttP.mu.Unlock()
+	if len(sttP.overlapped) > 0 {
+		t.Errorf("chunks of the same session were transcribed concurrently: %v", sttP.overlapped)
+	}
+	if sttP.maxTotal < 2 {
+		t.Errorf("expected sessions to be processed in parallel, max concurrency was %d", sttP.maxTotal)
+	}
+}
+
+func TestOrderedPoolsShareTheGroupLease(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub := rdb.PSubscribe(ctx, "session:*:response")
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		t.Fatalf("psubscribe: %v", err)
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	newPool := func(instance string) *AudioWorkerPool {
+		return &AudioWorkerPool{
+			Redis:      rdb,
+			Buffers:    nopBuffers{},
+			NumWorkers: 2,
+			STT:        &jitterSTT{inFlight: map[string]int{}},
+			LLM:        jitterLLM{},
+			Logger:     logger,
+			Ordered:    true,
+			InstanceID: instance,
+			leaseTTL:   150 * time.Millisecond,
+			// a stopped reader may still have taken an entry; the janitor recovers it
+			ClaimMinIdle:  300 * time.Millisecond,
+			ClaimInterval: 50 * time.Millisecond,
+		}
+	}
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	holder := func() string { v, _ := mr.Get("audio:stream:audio-workers:ordered"); return v }
+	answer := func(chunk int) {
+		t.Helper()
+		if err := rdb.XAdd(ctx, &redis.XAddArgs{Stream: "audio:stream", Values: map[string]any{
+			"session_id":   "sess-1",
+			"chunk_index":  strconv.Itoa(chunk),
+			"is_final":     "true",
+			"audio_base64": base64.StdEncoding.EncodeToString([]byte("sess-1")),
+		}}).Err(); err != nil {
+			t.Fatalf("xadd: %v", err)
+		}
+		deadline := time.After(5 * time.Second)
+		for {
+			select {
+			case m := <-sub.Channel():
+				if strings.Contains(m.Payload, `"llm_complete"`) {
+					return
+				}
+			case <-deadline:
+				t.Fatalf("chunk %d never answered", chunk)
+			}
+		}
+	}
+	readers := func() []string {
+		consumers, err := rdb.XInfoConsumers(ctx, "audio:stream", "audio-workers").Result()
+		if err != nil {
+			t.Fatalf("xinfo consumers: %v", err)
+		}
+		var names []string
+		for _, c := range consumers {
+			names = append(names, c.Name)
+		}
+		return names
+	}
+
+	ctxA, stopA := context.WithCancel(ctx)
+	if err := newPool("a").Start(ctxA); err != nil {
+		t.Fatalf("start a: %v", err)
+	}
+	waitFor("a to take the lease", func() bool { return holder() == "a" })
+	if err := newPool("b").Start(ctx); err != nil {
+		t.Fatalf("start b: %v", err)
+	}
+
+	answer(1)
+	for _, name := range readers() {
+		if strings.Contains(name, "-b-") {
+			t.Fatalf("standby pool b read the group: consumers %v", readers())
+		}
+	}
+
+	// a shuts down and releases the lease; b takes over
+	stopA()
+	waitFor("b to take the lease", func() bool { return holder() == "b" })
+	answer(2)
+	if got := strings.Join(readers(), ","); !strings.Contains(got, "c-b-") {
+		t.Errorf("consumers = %s, want b reading (or reclaiming) after takeover", got)
+	}
+}
+
+func TestKeepAliveKeepsQueuedEntriesFromTheJanitor(t *testing.T) {
+	sttP := &jitterSTT{inFlight: map[string]int{}}
+	p := newTestPool(t, sttP)
+	ctx := context.Background()
+
+	// read by a live process and still waiting in one of its shards
+	msg := deliver(t, p, "c-live-1", audioChunk("sess-1", "1"))
+	p.track(msg.ID, "c-live-1")
+
+	for i := 0; i < 4; i++ {
+		time.Sleep(p.ClaimMinIdle / 2)
+		p.touchInflight(ctx)
+	}
+	p.reclaim(ctx, "c-other-janitor")
+
+	pending, err := p.Redis.XPendingExt(ctx, &redis.XPendingExtArgs{Stream: p.Stream, Group: p.Group, Start: "-", End: "+", Count: 10}).Result()
+	if err != nil || len(pending) != 1 || pending[0].Consumer != "c-live-1" {
+		t.Fatalf("pending = %+v, %v; want the entry still owned by its live consumer", pending, err)
+	}
+
+	// once it is no longer tracked (its process died), the janitor takes it
+	p.untrack(msg.ID)
+	time.Sleep(2 * p.ClaimMinIdle)
+	p.reclaim(ctx, "c-other-janitor")
+	if n := pendingCount(t, p); n != 0 {
+		t.Errorf("%d entries pending, want the abandoned entry reclaimed and acked", n)
+	}
+}
+
+func TestRetryBackoffHoldsOnlyTheFailingSession(t *testing.T) {
+	p := newTestPool(t, nil)
+	p.retryBase, p.retryMax = 100*time.Millisecond, 100*time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// one shard, so both sessions share a goroutine
+	p.shards = []chan func(context.Context){make(chan func(context.Context), 16)}
+	go p.runShard(ctx, p.shards[0])
+
+	var mu sync.Mutex
+	var done []string
+	failed := false
+	finished := make(chan struct{}, 4)
+	p.handle = func(ctx context.Context, msg redis.XMessage) error {
+		name := msgField(msg, "session_id") + "/" + msgField(msg, "chunk_index")
+		mu.Lock()
+		defer mu.Unlock()
+		if name == "sess-a/1" && !failed {
+			failed = true
+			return retryable("stt failed", errors.New("unavailable"))
+		}
+		done = append(done, name)
+		finished <- struct{}{}
+		return nil
+	}
+
+	for _, m := range []map[string]any{audioChunk("sess-a", "1"), audioChunk("sess-a", "2"), audioChunk("sess-b", "1")} {
+		msg := deliver(t, p, "c-1", m)
+		p.track(msg.ID, "c-1")
+		p.run(ctx, msg, func(ctx context.Context) { p.process(ctx, "c-1", msg) })
+	}
+
+	select {
+	case <-finished:
+	case <-time.After(p.retryBase / 2):
+		t.Fatal("sess-b waited out sess-a's retry backoff")
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-finished:
+		case <-time.After(2 * time.Second):
+			t.Fatal("sess-a never retried")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(done, ","); got != "sess-b/1,sess-a/1,sess-a/2" {
+		t.Errorf("handled %s, want sess-b first and sess-a's chunks in order after the retry", got)
+	}
+	// acked right after handle returns
+	deadline := time.Now().Add(2 * time.Second)
+	for pendingCount(t, p) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d entries pending, want all acked", pendingCount(t, p))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
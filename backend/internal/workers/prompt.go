@@ -0,0 +1,314 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/yoockh/yoospeak/internal/models"
+	"github.com/yoockh/yoospeak/internal/providers/llm"
+)
+
+// turn is one finished exchange of the session: what the user said and the coach's answer.
+type turn struct {
+	user      string
+	assistant string
+}
+
+// promptContext is everything the coach prompt is assembled from.
+type promptContext struct {
+	session   *models.Session
+	profile   *models.Profile
+	history   []turn // oldest first
+	utterance string
+
+	// cvExcerpts are CV passages retrieved for this utterance, most relevant first.
+	// When empty the profile section falls back to the head of the full CV text.
+	cvExcerpts []string
+}
+
+// Budget split: the instructions, session context and current utterance are
+// always kept; the profile gets at most a quarter of the budget and history
+// fills whatever is left, dropping the oldest turns first.
+const (
+	maxUtteranceShare = 2 // utterance capped at budget/2
+	maxProfileShare   = 4 // profile capped at budget/4
+	maxTurnTokens     = 400
+
+	// retrieval must not hold up the answer; on timeout the prompt goes without excerpts
+	cvRetrievalTimeout = 1500 * time.Millisecond
+)
+
+// estimateTokens is a cheap approximation (~4 characters per token) that is good
+// enough for budgeting without a tokenizer round-trip.
+func estimateTokens(s string) int {
+	return (utf8.RuneCountInString(s) + 3) / 4
+}
+
+// truncateTokens cuts s to at most n estimated tokens, ellipsis included, on a
+// word boundary when possible.
+func truncateTokens(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	maxRunes := n * 4
+	if utf8.RuneCountInString(s) <= maxRunes {
+		return s
+	}
+	r := []rune(s)[:maxRunes-2] // room for " …"
+	cut := string(r)
+	if i := strings.LastIndexAny(cut, " \n\t"); i > len(cut)/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimSpace(cut) + " …"
+}
+
+func coachInstructions(s *models.Session) string {
+	var b strings.Builder
+	if s != nil && s.Type == "casual" {
+		b.WriteString("You are a friendly speaking partner helping the user practise conversational speaking. ")
+		b.WriteString("Keep the conversation going naturally and gently point out mistakes in what they just said.")
+	} else {
+		b.WriteString("You are an interview speaking coach. The user is practising spoken answers for a job interview. ")
+		b.WriteString("Give concise, constructive feedback on what they just said (content, structure, clarity, grammar) and suggest a stronger phrasing when useful.")
+	}
+	b.WriteString(" Build on earlier turns instead of repeating yourself. Reply concisely")
+	if s != nil && strings.HasPrefix(normalizeLanguage(s.Language), "id") {
+		b.WriteString(" in Indonesian.")
+	} else {
+		b.WriteString(" in English.")
+	}
+	return b.String()
+}
+
+func sessionSection(s *models.Session) string {
+	if s == nil {
+		return ""
+	}
+	md := s.Metadata
+	var lines []string
+	if md.InterviewType != "" {
+		lines = append(lines, "Interview type: "+md.InterviewType)
+	}
+	if md.CompanyName != "" {
+		lines = append(lines, "Company: "+md.CompanyName)
+	}
+	if md.Position != "" {
+		lines = append(lines, "Position: "+md.Position)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "Session context:\n" + strings.Join(lines, "\n")
+}
+
+// profileSection renders the profile in at most budget estimated tokens, header included.
+func profileSection(p *models.Profile, excerpts []string, budget int) string {
+	const header = "Candidate profile:\n"
+	budget -= estimateTokens(header)
+	if p == nil || budget <= 0 {
+		return ""
+	}
+
+	var lines []string
+	if p.FullName != "" {
+		lines = append(lines, "Name: "+p.FullName)
+	}
+	if len(p.Skills) > 0 {
+		skills := p.Skills
+		if len(skills) > 30 {
+			skills = skills[:30]
+		}
+		lines = append(lines, "Skills: "+strings.Join(skills, ", "))
+	}
+	if exp := compactJSON(p.Experience); exp != "" {
+		lines = append(lines, "Experience: "+exp)
+	}
+	if edu := compactJSON(p.Education); edu != "" {
+		lines = append(lines, "Education: "+edu)
+	}
+
+	body := truncateTokens(strings.Join(lines, "\n"), budget)
+	left := budget - estimateTokens(body)
+	sep := ""
+	if body != "" {
+		sep = "\n"
+		left-- // the separator
+	}
+	if len(excerpts) > 0 {
+		if cv := cvExcerptsBlock(excerpts, left); cv != "" {
+			body += sep + cv
+		}
+	} else if cv := strings.TrimSpace(p.CVText); cv != "" && left > 32 {
+		const label = "CV:\n"
+		body += sep + label + truncateTokens(cv, left-estimateTokens(label))
+	}
+	if body == "" {
+		return ""
+	}
+	return header + body
+}
+
+// cvExcerptsBlock lists retrieved passages in relevance order until budget runs out.
+func cvExcerptsBlock(excerpts []string, budget int) string {
+	const header = "Relevant CV excerpts:"
+	used := estimateTokens(header)
+	var kept []string
+	for _, e := range excerpts {
+		e = "- " + strings.Join(strings.Fields(e), " ")
+		cost := estimateTokens("\n" + e)
+		if used+cost > budget {
+			// the first passage is worth a truncated copy; later ones are not
+			if len(kept) == 0 && budget-used > 32 {
+				kept = append(kept, truncateTokens(e, budget-used-1))
+			}
+			break
+		}
+		used += cost
+		kept = append(kept, e)
+	}
+	if len(kept) == 0 {
+		return ""
+	}
+	return header + "\n" + strings.Join(kept, "\n")
+}
+
+func compactJSON(raw []byte) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil || v == nil {
+		return ""
+	}
+	if m, ok := v.(map[string]any); ok && len(m) == 0 {
+		return ""
+	}
+	if a, ok := v.([]any); ok && len(a) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// buildRequest assembles the coach request within roughly budget tokens: the
+// instructions, session and profile go into the system instruction, earlier
+// turns become user/assistant messages and the utterance is the final user message.
+func buildRequest(pc promptContext, budget int, opts llm.Options) llm.Request {
+	instructions := coachInstructions(pc.session)
+	session := sessionSection(pc.session)
+	utterance := truncateTokens(strings.TrimSpace(pc.utterance), budget/maxUtteranceShare)
+
+	used := estimateTokens(instructions) + estimateTokens(session) + estimateTokens(utterance) + 8
+
+	profile := profileSection(pc.profile, pc.cvExcerpts, min(budget/maxProfileShare, budget-used))
+	used += estimateTokens(profile)
+
+	// newest turns first until the budget runs out
+	var kept []turn
+	for i := len(pc.history) - 1; i >= 0; i-- {
+		t := turn{user: truncateTokens(pc.history[i].user, maxTurnTokens), assistant: truncateTokens(pc.history[i].assistant, maxTurnTokens)}
+		cost := estimateTokens(t.user) + estimateTokens(t.assistant) + 2
+		if used+cost > budget {
+			break
+		}
+		used += cost
+		kept = append(kept, t)
+	}
+
+	sections := []string{instructions}
+	if session != "" {
+		sections = append(sections, session)
+	}
+	if profile != "" {
+		sections = append(sections, profile)
+	}
+
+	msgs := make([]llm.Message, 0, 2*len(kept)+1)
+	for i := len(kept) - 1; i >= 0; i-- {
+		msgs = append(msgs,
+			llm.Message{Role: llm.RoleUser, Content: kept[i].user},
+			llm.Message{Role: llm.RoleAssistant, Content: kept[i].assistant},
+		)
+	}
+	msgs = append(msgs, llm.Message{Role: llm.RoleUser, Content: utterance})
+
+	return llm.Request{
+		System:   strings.Join(sections, "\n\n"),
+		Messages: msgs,
+		Options:  opts,
+	}
+}
+
+// turnsFromBuffers rebuilds finished turns from realtime buffer chunks (newest first,
+// as returned by RecentTranscripts): chunk transcripts accumulate until a chunk
+// carrying an LLM answer closes the turn.
+func turnsFromBuffers(rows []models.RealtimeBuffer) []turn {
+	var turns []turn
+	var parts []string
+	for i := len(rows) - 1; i >= 0; i-- {
+		r := rows[i]
+		if t := strings.TrimSpace(r.RawText); t != "" {
+			parts = append(parts, t)
+		}
+		if r.LLMStatus == "done" && r.LLMResponse != "" {
+			if len(parts) > 0 {
+				turns = append(turns, turn{user: strings.Join(parts, " "), assistant: r.LLMResponse})
+			}
+			parts = nil
+		}
+	}
+	return turns
+}
+
+// lookupSession is the session, or nil when it is unknown or the lookup fails.
+func (p *AudioWorkerPool) lookupSession(ctx context.Context, sessionID string) *models.Session {
+	if p.Sessions == nil {
+		return nil
+	}
+	sess, err := p.Sessions.Get(ctx, sessionID)
+	if err != nil {
+		p.Logger.WithError(err).WithField("session_id", sessionID).Debug("session lookup failed")
+		return nil
+	}
+	return sess
+}
+
+// loadPromptContext gathers session, profile and history for an utterance. Every
+// piece is optional: a lookup failure only makes the prompt less personalised.
+func (p *AudioWorkerPool) loadPromptContext(ctx context.Context, sessionID string, u *utterance) promptContext {
+	pc := promptContext{utterance: u.text, session: p.lookupSession(ctx, sessionID)}
+	log := p.Logger.WithField("session_id", sessionID)
+
+	if p.Profiles != nil && pc.session != nil {
+		prof, err := p.Profiles.GetMe(ctx, pc.session.UserID)
+		if err != nil {
+			log.WithError(err).Debug("prompt: profile lookup failed")
+		} else {
+			pc.profile = prof
+		}
+	}
+
+	if p.CVRetrieval != nil && pc.profile != nil && strings.TrimSpace(pc.profile.CVText) != "" {
+		rctx, cancel := context.WithTimeout(ctx, cvRetrievalTimeout)
+		matches, err := p.CVRetrieval.Retrieve(rctx, pc.session.UserID, u.text, p.CVTopK)
+		cancel()
+		if err != nil {
+			log.WithError(err).Debug("prompt: cv retrieval failed")
+		}
+		for _, m := range matches {
+			pc.cvExcerpts = append(pc.cvExcerpts, m.Content)
+		}
+	}
+
+	rows, err := p.Buffers.RecentTranscripts(ctx, sessionID, u.start, p.HistoryChunks)
+	if err != nil {
+		log.WithError(err).Debug("prompt: history lookup failed")
+	} else {
+		pc.history = turnsFromBuffers(rows)
+	}
+
+	return pc
+}
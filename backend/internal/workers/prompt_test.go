@@ -0,0 +1,158 @@
+package workers
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/yoockh/yoospeak/internal/models"
+	"github.com/yoockh/yoospeak/internal/providers/llm"
+)
+
+// words is n space-separated words, each prefix followed by its index.
+func words(prefix string, n int) string {
+	w := make([]string, n)
+	for i := range w {
+		w[i] = prefix + strconv.Itoa(i)
+	}
+	return strings.Join(w, " ")
+}
+
+// history is n turns, oldest first, each roughly perTurn tokens.
+func history(n, perTurn int) []turn {
+	turns := make([]turn, n)
+	for i := range turns {
+		tag := "t" + strconv.Itoa(i) + "-"
+		turns[i] = turn{user: words(tag, perTurn/4), assistant: words(tag, perTurn/4)}
+	}
+	return turns
+}
+
+// profileOf returns the profile section of the system instruction, "" when there is none.
+func profileOf(req llm.Request) string {
+	for _, s := range strings.Split(req.System, "\n\n") {
+		if strings.HasPrefix(s, "Candidate profile:") {
+			return s
+		}
+	}
+	return ""
+}
+
+// historyOf returns the user side of every earlier turn in the request, oldest first.
+func historyOf(req llm.Request) []string {
+	var out []string
+	for _, m := range req.Messages[:len(req.Messages)-1] {
+		if m.Role == llm.RoleUser {
+			out = append(out, m.Content)
+		}
+	}
+	return out
+}
+
+func TestBuildRequestStaysWithinBudget(t *testing.T) {
+	const budget = 1000
+	cases := []struct {
+		name string
+		pc   promptContext
+
+		utterance   string // the last message, when it must be kept whole
+		wantProfile bool
+		wantTurns   int // -1: as many as fit, newest first
+	}{
+		{
+			name:        "everything fits",
+			pc:          promptContext{profile: &models.Profile{FullName: "Ada", CVText: "Engineer."}, history: history(3, 40), utterance: "hello there"},
+			utterance:   "hello there",
+			wantProfile: true,
+			wantTurns:   3,
+		},
+		{
+			name:        "oversized profile",
+			pc:          promptContext{profile: &models.Profile{FullName: "Ada", CVText: words("cv", 4000)}, utterance: "hello there"},
+			utterance:   "hello there",
+			wantProfile: true,
+		},
+		{
+			name:        "oversized cv excerpts",
+			pc:          promptContext{profile: &models.Profile{FullName: "Ada"}, cvExcerpts: []string{words("a", 300), words("b", 300)}, utterance: "hello there"},
+			utterance:   "hello there",
+			wantProfile: true,
+		},
+		{
+			name:      "oversized utterance",
+			pc:        promptContext{utterance: words("u", 4000), history: history(3, 40)},
+			wantTurns: 3,
+		},
+		{
+			name:      "history truncated oldest first",
+			pc:        promptContext{history: history(40, 80), utterance: "hello there"},
+			utterance: "hello there",
+			wantTurns: -1,
+		},
+		{
+			name:        "history fills what the profile leaves",
+			pc:          promptContext{profile: &models.Profile{CVText: words("cv", 4000)}, history: history(40, 80), utterance: words("u", 4000)},
+			wantProfile: true,
+			wantTurns:   -1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := buildRequest(tc.pc, budget, llm.Options{})
+
+			total := estimateTokens(req.System)
+			for _, m := range req.Messages {
+				total += estimateTokens(m.Content)
+			}
+			if total > budget {
+				t.Errorf("request is %d tokens, budget %d", total, budget)
+			}
+
+			last := req.Messages[len(req.Messages)-1]
+			if last.Role != llm.RoleUser {
+				t.Fatalf("last message is %s, want the utterance", last.Role)
+			}
+			if n := estimateTokens(last.Content); n > budget/maxUtteranceShare {
+				t.Errorf("utterance is %d tokens, want at most %d", n, budget/maxUtteranceShare)
+			}
+			if tc.utterance != "" && last.Content != tc.utterance {
+				t.Errorf("utterance = %q, want %q kept whole", last.Content, tc.utterance)
+			}
+			if !strings.HasPrefix(tc.pc.utterance, strings.TrimSuffix(last.Content, " …")) {
+				t.Errorf("utterance is not a prefix of what was said")
+			}
+
+			profile := profileOf(req)
+			if (profile != "") != tc.wantProfile {
+				t.Errorf("profile section present = %v, want %v", profile != "", tc.wantProfile)
+			}
+			if n := estimateTokens(profile); n > budget/maxProfileShare {
+				t.Errorf("profile is %d tokens, want at most %d", n, budget/maxProfileShare)
+			}
+
+			kept := historyOf(req)
+			switch {
+			case tc.wantTurns >= 0 && len(kept) != tc.wantTurns:
+				t.Errorf("kept %d turns, want %d", len(kept), tc.wantTurns)
+			case tc.wantTurns < 0 && (len(kept) == 0 || len(kept) == len(tc.pc.history)):
+				t.Errorf("kept %d of %d turns, want history cut to the budget", len(kept), len(tc.pc.history))
+			}
+			// what is kept is the newest turns, in the order they happened
+			offset := len(tc.pc.history) - len(kept)
+			for i, u := range kept {
+				if want := tc.pc.history[offset+i].user; u != want {
+					t.Errorf("turn %d = %.20q…, want turn %d of the history", i, u, offset+i)
+					break
+				}
+			}
+			// and the next older turn would not have fit
+			if offset > 0 && len(kept) > 0 {
+				older := tc.pc.history[offset-1]
+				if cost := estimateTokens(older.user) + estimateTokens(older.assistant) + 2; total+cost <= budget-16 {
+					t.Errorf("dropped turn %d (%d tokens) with %d of %d tokens used", offset-1, cost, total, budget)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// failure classes reported by handleMsg
+type failureClass int
+
+const (
+	failRetryable failureClass = iota + 1 // transient (STT/LLM/network hiccup): retry with backoff
+	failPermanent                         // bad payload: retrying cannot help, dead-letter right away
+)
+
+// msgError is what handleMsg returns when a stream entry could not be processed.
+// Reason is short and client-safe; it is published on the status channel and
+// recorded on the dead-letter entry.
+type msgError struct {
+	class  failureClass
+	reason string
+	err    error
+}
+
+func (e *msgError) Error() string {
+	if e.err != nil {
+		return e.reason + ": " + e.err.Error()
+	}
+	return e.reason
+}
+
+func (e *msgError) Unwrap() error { return e.err }
+
+func retryable(reason string, err error) error {
+	return &msgError{class: failRetryable, reason: reason, err: err}
+}
+
+func permanent(reason string, err error) error {
+	return &msgError{class: failPermanent, reason: reason, err: err}
+}
+
+// classify splits an error into (class, reason). Unknown errors are treated as retryable.
+func classify(err error) (failureClass, string) {
+	var me *msgError
+	if errors.As(err, &me) {
+		return me.class, me.reason
+	}
+	return failRetryable, "processing failed"
+}
+
+// backoff returns the delay before the given retry attempt (1-based), doubling from base up to max.
+func backoff(attempt int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= max {
+			return max
+		}
+	}
+	return d
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func (p *AudioWorkerPool) publishStatus(ctx context.Context, msg redis.XMessage, status, message string) {
+	sessionID := msgField(msg, "session_id")
+	if sessionID == "" {
+		return
+	}
+	chunkIndex, _ := strconv.ParseInt(msgField(msg, "chunk_index"), 10, 64)
+	p.publishChunkStatus(ctx, sessionID, chunkIndex, status, message)
+}
@@ -0,0 +1,190 @@
+package workers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/yoockh/yoospeak/internal/providers/stt"
+	sttfake "github.com/yoockh/yoospeak/internal/providers/stt/fake"
+)
+
+// newTestPool is an unordered pool on miniredis with millisecond retries.
+// Nothing is started: tests drive process and reclaim directly.
+func newTestPool(t *testing.T, sttP stt.Provider) *AudioWorkerPool {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	p := &AudioWorkerPool{
+		Redis:          rdb,
+		Buffers:        nopBuffers{},
+		STT:            sttP,
+		LLM:            jitterLLM{},
+		Logger:         logger,
+		MaxAttempts:    3,
+		RetryBaseDelay: time.Millisecond,
+		RetryMaxDelay:  2 * time.Millisecond,
+		ClaimMinIdle:   20 * time.Millisecond,
+		MaxDeliveries:  2,
+	}
+	p.setDefaults()
+	if err := rdb.XGroupCreateMkStream(context.Background(), p.Stream, p.Group, "0").Err(); err != nil {
+		t.Fatalf("xgroup create: %v", err)
+	}
+	return p
+}
+
+func audioChunk(sessionID, chunkIndex string) map[string]any {
+	return map[string]any{
+		"session_id":   sessionID,
+		"chunk_index":  chunkIndex,
+		"is_final":     "true",
+		"language":     "en",
+		"audio_base64": base64.StdEncoding.EncodeToString([]byte("audio!")),
+	}
+}
+
+// deliver adds an entry to the stream and reads it as consumer, leaving it pending.
+func deliver(t *testing.T, p *AudioWorkerPool, consumer string, values map[string]any) redis.XMessage {
+	t.Helper()
+	ctx := context.Background()
+	if err := p.Redis.XAdd(ctx, &redis.XAddArgs{Stream: p.Stream, Values: values}).Err(); err != nil {
+		t.Fatalf("xadd: %v", err)
+	}
+	res, err := p.Redis.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    p.Group,
+		Consumer: consumer,
+		Streams:  []string{p.Stream, ">"},
+		Count:    1,
+	}).Result()
+	if err != nil || len(res) != 1 || len(res[0].Messages) != 1 {
+		t.Fatalf("xreadgroup = %v, %v", res, err)
+	}
+	return res[0].Messages[0]
+}
+
+func pendingCount(t *testing.T, p *AudioWorkerPool) int64 {
+	t.Helper()
+	pending, err := p.Redis.XPending(context.Background(), p.Stream, p.Group).Result()
+	if err != nil {
+		t.Fatalf("xpending: %v", err)
+	}
+	return pending.Count
+}
+
+func deadLetters(t *testing.T, p *AudioWorkerPool) []redis.XMessage {
+	t.Helper()
+	msgs, err := p.Redis.XRange(context.Background(), p.DeadLetterStream, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("xrange dlq: %v", err)
+	}
+	return msgs
+}
+
+func TestBackoffDoublesUpToMax(t *testing.T) {
+	for attempt, want := range map[int]time.Duration{1: 100, 2: 200, 3: 400, 4: 500, 10: 500} {
+		if got := backoff(attempt, 100, 500); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
+
+func TestProcessRetriesRetryableFailureUntilItSucceeds(t *testing.T) {
+	sttP := sttfake.New(
+		sttfake.Response{Err: errors.New("connection reset")},
+		sttfake.Response{Err: errors.New("connection reset")},
+	)
+	sttP.Default = sttfake.Response{Text: "hello", Confidence: 0.9}
+	p := newTestPool(t, sttP)
+
+	msg := deliver(t, p, "c-1", audioChunk("sess-1", "1"))
+	p.process(context.Background(), "c-1", msg)
+
+	if n := len(sttP.Calls()); n != 3 {
+		t.Errorf("stt called %d times, want 3", n)
+	}
+	if n := pendingCount(t, p); n != 0 {
+		t.Errorf("%d entries still pending, want the entry acked", n)
+	}
+	if dl := deadLetters(t, p); len(dl) != 0 {
+		t.Errorf("dead letters = %v", dl)
+	}
+	if n, _ := p.Redis.HLen(context.Background(), p.attemptsKey()).Result(); n != 0 {
+		t.Errorf("attempt counter left behind")
+	}
+}
+
+func TestProcessDeadLettersPermanentFailureOnFirstAttempt(t *testing.T) {
+	sttP := sttfake.New()
+	p := newTestPool(t, sttP)
+
+	values := audioChunk("sess-1", "1")
+	delete(values, "chunk_index")
+	msg := deliver(t, p, "c-1", values)
+	p.process(context.Background(), "c-1", msg)
+
+	dl := deadLetters(t, p)
+	if len(dl) != 1 {
+		t.Fatalf("dead letters = %v, want 1", dl)
+	}
+	if got := dl[0].Values; got["dlq_reason"] != "missing session_id or chunk_index" || got["dlq_attempts"] != "1" ||
+		got["dlq_original_id"] != msg.ID || got["session_id"] != "sess-1" {
+		t.Errorf("dead letter = %v", got)
+	}
+	if n := pendingCount(t, p); n != 0 {
+		t.Errorf("%d entries still pending, want the entry acked", n)
+	}
+	if n := len(sttP.Calls()); n != 0 {
+		t.Errorf("stt called %d times for a bad payload", n)
+	}
+}
+
+func TestProcessDeadLettersAfterMaxAttempts(t *testing.T) {
+	sttP := &sttfake.Provider{Default: sttfake.Response{Err: errors.New("upstream unavailable")}}
+	p := newTestPool(t, sttP)
+
+	msg := deliver(t, p, "c-1", audioChunk("sess-1", "1"))
+	p.process(context.Background(), "c-1", msg)
+
+	if n := len(sttP.Calls()); n != p.MaxAttempts {
+		t.Errorf("stt called %d times, want MaxAttempts (%d)", n, p.MaxAttempts)
+	}
+	dl := deadLetters(t, p)
+	if len(dl) != 1 {
+		t.Fatalf("dead letters = %v, want 1", dl)
+	}
+	if got := dl[0].Values; got["dlq_reason"] != "stt failed" || got["dlq_attempts"] != "3" ||
+		got["dlq_error"] != "stt failed: upstream unavailable" || got["dlq_original_id"] != msg.ID {
+		t.Errorf("dead letter = %v", got)
+	}
+	if n := pendingCount(t, p); n != 0 {
+		t.Errorf("%d entries still pending, want the entry acked", n)
+	}
+}
+
+func TestProcessLeavesEntryPendingWhenCancelled(t *testing.T) {
+	sttP := &sttfake.Provider{Default: sttfake.Response{Err: errors.New("upstream unavailable")}}
+	p := newTestPool(t, sttP)
+	p.retryBase, p.retryMax = time.Minute, time.Minute
+
+	msg := deliver(t, p, "c-1", audioChunk("sess-1", "1"))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	p.process(ctx, "c-1", msg)
+
+	if n := pendingCount(t, p); n != 1 {
+		t.Errorf("%d entries pending, want the entry left for another consumer", n)
+	}
+	if dl := deadLetters(t, p); len(dl) != 0 {
+		t.Errorf("dead letters = %v", dl)
+	}
+}
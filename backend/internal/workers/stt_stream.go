@@ -0,0 +1,299 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yoockh/yoospeak/internal/audio"
+	"github.com/yoockh/yoospeak/internal/providers/stt"
+)
+
+// sttFinishTimeout bounds how long closing an utterance waits for the last finals.
+const sttFinishTimeout = 5 * time.Second
+
+// sttKeepAliveFrame is how much silence one keep-alive send carries.
+const sttKeepAliveFrame = 100 * time.Millisecond
+
+var errSTTSendClosed = errors.New("stt stream already closed for sending")
+
+// sttOwnerField names the instance holding a session's open stream in its utterance hash.
+const sttOwnerField = "stt_owner"
+
+// sttSession is the open recognition stream of one session's current utterance.
+// Chunks are sent as they are processed; interim results are published straight
+// to the client, final results are collected and handed to the next chunk.
+type sttSession struct {
+	stream stt.Stream
+	format audio.Format
+
+	// sends are serialised: chunks and keep-alive silence share the stream
+	sendMu     sync.Mutex
+	sendClosed bool
+	lastSend   time.Time // any audio, keep-alive included
+	lastAudio  time.Time // chunk audio only
+
+	mu        sync.Mutex
+	lastChunk int64 // highest chunk sent; replays are not sent twice
+	lastText  string
+	final     []string
+	confSum   float64
+	confN     int
+	err       error
+
+	done chan struct{} // closed when the receive loop exits
+}
+
+// takeFinal returns (and forgets) the final text received since the last call.
+func (s *sttSession) takeFinal() (string, float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	text := strings.Join(s.final, " ")
+	conf := 0.0
+	if s.confN > 0 {
+		conf = s.confSum / float64(s.confN)
+	}
+	s.final, s.confSum, s.confN = nil, 0, 0
+	return text, conf
+}
+
+// send feeds chunk audio into the stream.
+func (s *sttSession) send(data []byte) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	if s.sendClosed {
+		return errSTTSendClosed
+	}
+	s.lastSend, s.lastAudio = time.Now(), time.Now()
+	return s.stream.Send(data)
+}
+
+// sendSilence sends frame if nothing was sent for idle. It reports false once
+// the stream is closed for sending or has had no chunk audio for maxIdle.
+func (s *sttSession) sendSilence(frame []byte, idle, maxIdle time.Duration) bool {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	if s.sendClosed || time.Since(s.lastAudio) > maxIdle {
+		return false
+	}
+	if time.Since(s.lastSend) < idle {
+		return true
+	}
+	s.lastSend = time.Now()
+	return s.stream.Send(frame) == nil
+}
+
+func (s *sttSession) closeSend() error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	s.sendClosed = true
+	return s.stream.CloseSend()
+}
+
+func (p *AudioWorkerPool) streamingSTT() (stt.StreamingProvider, bool) {
+	if !p.StreamingSTT || !p.Ordered {
+		return nil, false
+	}
+	sp, ok := p.STT.(stt.StreamingProvider)
+	return sp, ok
+}
+
+// openSTTSession returns the session's stream, opening one on the first chunk of an utterance.
+// The stream keeps the format of the utterance's first chunk. The utterance
+// records this instance as the stream's owner, so flushers elsewhere leave it
+// to this process, which alone can collect the stream's last finals.
+func (p *AudioWorkerPool) openSTTSession(ctx context.Context, sp stt.StreamingProvider, sessionID string, format audio.Format, language string) (*sttSession, error) {
+	p.sttMu.Lock()
+	defer p.sttMu.Unlock()
+
+	if s, ok := p.sttSessions[sessionID]; ok {
+		return s, nil
+	}
+	stream, err := sp.OpenStream(ctx, format, language)
+	if err != nil {
+		return nil, err
+	}
+	key := utteranceKey(sessionID)
+	if err := p.Redis.HSet(ctx, key, sttOwnerField, p.InstanceID).Err(); err != nil {
+		_ = stream.Close()
+		return nil, err
+	}
+	_ = p.Redis.Expire(ctx, key, time.Hour).Err()
+
+	now := time.Now()
+	s := &sttSession{stream: stream, format: format, lastSend: now, lastAudio: now, done: make(chan struct{})}
+	if p.sttSessions == nil {
+		p.sttSessions = map[string]*sttSession{}
+	}
+	p.sttSessions[sessionID] = s
+	go p.receiveSTT(ctx, sessionID, s)
+	go p.keepSTTAlive(ctx, s)
+	return s, nil
+}
+
+// keepSTTAlive sends silence while the stream has no audio to send (gaps
+// between chunks, silent chunks skipped by VAD), since providers end streams
+// that go quiet for a few seconds. It gives up once no chunk arrived for longer
+// than the utterance could stay open, so abandoned streams are not kept alive.
+func (p *AudioWorkerPool) keepSTTAlive(ctx context.Context, s *sttSession) {
+	frame := s.format.Silence(sttKeepAliveFrame)
+	if len(frame) == 0 {
+		return // compressed encodings: no silence without an encoder
+	}
+	maxIdle := p.UtteranceTimeout + p.sttOwnerGrace + sttFinishTimeout
+
+	t := time.NewTicker(p.sttKeepAlive / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.done:
+			return
+		case <-t.C:
+		}
+		if !s.sendSilence(frame, p.sttKeepAlive, maxIdle) {
+			return
+		}
+	}
+}
+
+func (p *AudioWorkerPool) receiveSTT(ctx context.Context, sessionID string, s *sttSession) {
+	defer close(s.done)
+	respCh := "session:" + sessionID + ":response"
+
+	for {
+		r, err := s.stream.Recv()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				s.mu.Lock()
+				s.err = err
+				s.mu.Unlock()
+			}
+			return
+		}
+
+		s.mu.Lock()
+		chunkIndex := s.lastChunk
+		if r.IsFinal {
+			if r.Text != "" {
+				s.final = append(s.final, r.Text)
+				s.confSum += r.Confidence
+				s.confN++
+			}
+			s.mu.Unlock()
+			continue
+		}
+		s.mu.Unlock()
+
+		// interim hypotheses replace each other on the client until the chunk's final stt_result
+		payload, _ := json.Marshal(map[string]any{
+			"type":        "stt_result",
+			"chunk_index": chunkIndex,
+			"text":        r.Text,
+			"confidence":  r.Confidence,
+			"is_final":    false,
+		})
+		_ = p.Redis.Publish(ctx, respCh, string(payload)).Err()
+	}
+}
+
+// dropSTTSession aborts and forgets a session's stream.
+func (p *AudioWorkerPool) dropSTTSession(sessionID string) {
+	p.sttMu.Lock()
+	s, ok := p.sttSessions[sessionID]
+	delete(p.sttSessions, sessionID)
+	p.sttMu.Unlock()
+	if ok {
+		_ = s.stream.Close()
+	}
+}
+
+// finishSTTSession ends a session's stream and returns the finals that arrived
+// after the last chunk took its share. ok is false when no stream was open.
+func (p *AudioWorkerPool) finishSTTSession(ctx context.Context, sessionID string) (text string, conf float64, lastText string, ok bool, err error) {
+	p.sttMu.Lock()
+	s, ok := p.sttSessions[sessionID]
+	delete(p.sttSessions, sessionID)
+	p.sttMu.Unlock()
+	if !ok {
+		return "", 0, "", false, nil
+	}
+	defer s.stream.Close()
+
+	_ = s.closeSend()
+	t := time.NewTimer(sttFinishTimeout)
+	defer t.Stop()
+	select {
+	case <-s.done:
+	case <-t.C:
+	case <-ctx.Done():
+	}
+
+	text, conf = s.takeFinal()
+	s.mu.Lock()
+	lastText, err = s.lastText, s.err
+	s.mu.Unlock()
+	return text, conf, lastText, true, err
+}
+
+// transcribeStreaming feeds one chunk into the session's stream. Non-final
+// chunks get whatever finals have arrived so far (words spanning chunk
+// boundaries land on a later chunk, whole); a final chunk closes the stream
+// and gets the rest. nil data sends nothing.
+func (p *AudioWorkerPool) transcribeStreaming(ctx context.Context, sp stt.StreamingProvider, sessionID string, chunkIndex int64, data []byte, format audio.Format, language string, isFinal bool) (string, float64, error) {
+	var s *sttSession
+	if data == nil {
+		// silent chunk: only collect finals, and don't open a stream just for that
+		p.sttMu.Lock()
+		s = p.sttSessions[sessionID]
+		p.sttMu.Unlock()
+		if s == nil {
+			return "", 0, nil
+		}
+	} else {
+		var err error
+		if s, err = p.openSTTSession(ctx, sp, sessionID, format, language); err != nil {
+			return "", 0, err
+		}
+	}
+
+	s.mu.Lock()
+	replay := chunkIndex <= s.lastChunk
+	s.mu.Unlock()
+	if !replay && data != nil {
+		if err := s.send(data); err != nil {
+			p.dropSTTSession(sessionID)
+			return "", 0, err
+		}
+		s.mu.Lock()
+		s.lastChunk = chunkIndex
+		s.mu.Unlock()
+	}
+
+	if isFinal {
+		text, conf, _, _, err := p.finishSTTSession(ctx, sessionID)
+		if err != nil {
+			return "", 0, err
+		}
+		return text, conf, nil
+	}
+
+	s.mu.Lock()
+	streamErr := s.err
+	s.mu.Unlock()
+	if streamErr != nil {
+		p.dropSTTSession(sessionID)
+		return "", 0, streamErr
+	}
+
+	text, conf := s.takeFinal()
+	s.mu.Lock()
+	s.lastText = text
+	s.mu.Unlock()
+	return text, conf, nil
+}
@@ -0,0 +1,183 @@
+package workers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yoockh/yoospeak/internal/audio"
+	llmfake "github.com/yoockh/yoospeak/internal/providers/llm/fake"
+	"github.com/yoockh/yoospeak/internal/providers/stt"
+	sttfake "github.com/yoockh/yoospeak/internal/providers/stt/fake"
+)
+
+// fakeStreamingSTT opens streams that recognise each non-silent send as one
+// final result whose text is the audio bytes.
+type fakeStreamingSTT struct {
+	sttfake.Provider
+
+	mu      sync.Mutex
+	streams []*fakeStream
+}
+
+func (f *fakeStreamingSTT) OpenStream(ctx context.Context, format audio.Format, language string) (stt.Stream, error) {
+	s := &fakeStream{results: make(chan stt.Result, 64)}
+	f.mu.Lock()
+	f.streams = append(f.streams, s)
+	f.mu.Unlock()
+	return s, nil
+}
+
+func (f *fakeStreamingSTT) stream(t *testing.T, i int) *fakeStream {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if i >= len(f.streams) {
+		t.Fatalf("%d streams opened, want at least %d", len(f.streams), i+1)
+	}
+	return f.streams[i]
+}
+
+type fakeStream struct {
+	mu         sync.Mutex
+	sends      [][]byte
+	sendClosed bool
+	results    chan stt.Result
+}
+
+func (s *fakeStream) Send(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sendClosed {
+		return io.ErrClosedPipe
+	}
+	s.sends = append(s.sends, append([]byte(nil), data...))
+	if bytes.Count(data, []byte{0}) != len(data) {
+		s.results <- stt.Result{Text: string(data), IsFinal: true, Confidence: 0.9}
+	}
+	return nil
+}
+
+func (s *fakeStream) Recv() (stt.Result, error) {
+	r, ok := <-s.results
+	if !ok {
+		return stt.Result{}, io.EOF
+	}
+	return r, nil
+}
+
+func (s *fakeStream) CloseSend() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.sendClosed {
+		s.sendClosed = true
+		close(s.results)
+	}
+	return nil
+}
+
+func (s *fakeStream) Close() error { return s.CloseSend() }
+
+// silentSends counts the all-zero (keep-alive) sends.
+func (s *fakeStream) silentSends() (n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range s.sends {
+		if len(d) > 0 && bytes.Count(d, []byte{0}) == len(d) {
+			n++
+		}
+	}
+	return n
+}
+
+func newStreamingPool(t *testing.T) (*AudioWorkerPool, *fakeStreamingSTT, *llmfake.Provider) {
+	t.Helper()
+	sp := &fakeStreamingSTT{}
+	p, _, llmP := newUtterancePool(t)
+	p.STT = sp
+	p.StreamingSTT, p.Ordered = true, true // shards are not started: dispatch runs inline
+	p.InstanceID = "a"
+	p.sttKeepAlive = 20 * time.Millisecond
+	return p, sp, llmP
+}
+
+func TestStreamingSTTSendsKeepAliveSilenceUntilTheUtteranceEnds(t *testing.T) {
+	p, sp, llmP := newStreamingPool(t)
+
+	handle(t, p, wordChunk("sess-1", 1, "good", false))
+	s := sp.stream(t, 0)
+
+	// the client pauses: the stream is fed silence meanwhile
+	time.Sleep(10 * p.sttKeepAlive)
+	if n := s.silentSends(); n < 3 {
+		t.Fatalf("%d keep-alive sends during a %v pause, want several", n, 10*p.sttKeepAlive)
+	}
+	s.mu.Lock()
+	for _, d := range s.sends {
+		if bytes.Count(d, []byte{0}) == len(d) && len(d) != len(audio.Default.Silence(sttKeepAliveFrame)) {
+			t.Errorf("keep-alive send of %d bytes, want %v of silence", len(d), sttKeepAliveFrame)
+		}
+	}
+	s.mu.Unlock()
+
+	handle(t, p, wordChunk("sess-1", 2, "team", true))
+
+	// closed for sending: keep-alive stops
+	n := s.silentSends()
+	time.Sleep(5 * p.sttKeepAlive)
+	if m := s.silentSends(); m != n {
+		t.Errorf("%d keep-alive sends after the utterance ended", m-n)
+	}
+	if got := answered(llmP); len(got) != 1 || got[0] != "good team" {
+		t.Errorf("answered %q, want the streamed finals \"good team\"", got)
+	}
+}
+
+func TestFlusherLeavesUtteranceStreamedByAnotherInstance(t *testing.T) {
+	p, _, llmP := newStreamingPool(t)
+	p.UtteranceTimeout = 20 * time.Millisecond
+	p.sttOwnerGrace = time.Hour
+	ctx := context.Background()
+
+	// instance b opened the stream for this utterance
+	if err := p.Redis.HSet(ctx, utteranceKey("sess-1"), "start", 1, "end", 1, "chunk:1", "good", sttOwnerField, "b").Err(); err != nil {
+		t.Fatalf("hset: %v", err)
+	}
+	p.scheduleFlushIn(ctx, "sess-1", 0)
+
+	fctx, cancel := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	go func() {
+		p.runUtteranceFlusher(fctx)
+		close(stopped)
+	}()
+	time.Sleep(500 * time.Millisecond)
+	cancel()
+	<-stopped
+
+	if got := answered(llmP); len(got) != 0 {
+		t.Fatalf("answered %q, want the owner left to flush it", got)
+	}
+	if n, _ := p.Redis.ZScore(ctx, p.utteranceDeadlinesKey(), "sess-1").Result(); n == 0 {
+		t.Fatalf("flush deadline dropped, want it kept for the owner")
+	}
+
+	// b never flushed it: once overdue past the grace, this instance answers it
+	p.sttOwnerGrace = 50 * time.Millisecond
+	fctx, cancel = context.WithCancel(ctx)
+	defer cancel()
+	go p.runUtteranceFlusher(fctx)
+	deadline := time.Now().Add(3 * time.Second)
+	for len(answered(llmP)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("orphaned utterance never flushed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := answered(llmP); got[0] != "good" {
+		t.Errorf("answered %q, want \"good\"", got)
+	}
+}
@@ -0,0 +1,129 @@
+package workers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yoockh/yoospeak/internal/models"
+	"github.com/yoockh/yoospeak/internal/providers/llm"
+)
+
+// Usage accounting never fails a chunk: the answer matters more to the user
+// than the ledger, so errors are logged and processing goes on.
+
+// recordSTTUsage charges one recognised chunk. billedSeconds is what the
+// provider reported; without it the audio's duration stands in (estimated).
+func (p *AudioWorkerPool) recordSTTUsage(ctx context.Context, sessionID, userID string, chunkIndex int64, billedSeconds float64, duration time.Duration) {
+	rec := &models.UsageRecord{
+		SessionID:    sessionID,
+		ChunkIndex:   chunkIndex,
+		Kind:         models.UsageKindSTT,
+		AudioSeconds: billedSeconds,
+	}
+	if rec.AudioSeconds <= 0 {
+		rec.AudioSeconds = duration.Seconds()
+		rec.Estimated = true
+	}
+	if (p.Usage != nil || p.Quota != nil) && userID == "" && p.Sessions != nil {
+		if sess, err := p.Sessions.Get(ctx, sessionID); err == nil {
+			userID = sess.UserID
+		}
+	}
+	rec.UserID = userID
+	p.chargeUsage(ctx, rec)
+
+	_ = p.Buffers.MarkUsage(ctx, sessionID, chunkIndex, models.ChunkUsage{STT: &models.STTUsage{
+		AudioSeconds: rec.AudioSeconds,
+		Estimated:    rec.Estimated,
+		CostMicroUSD: rec.CostMicroUSD,
+	}})
+}
+
+// recordLLMUsage charges one answer on the utterance's last chunk. Without
+// provider token counts, the request and answer are estimated like the prompt budget.
+func (p *AudioWorkerPool) recordLLMUsage(ctx context.Context, sess *models.Session, sessionID string, chunkIndex int64, req llm.Request, answer string, usage *llm.Usage) {
+	rec := &models.UsageRecord{
+		SessionID:  sessionID,
+		ChunkIndex: chunkIndex,
+		Kind:       models.UsageKindLLM,
+	}
+	if usage != nil {
+		rec.PromptTokens, rec.CompletionTokens = int64(usage.PromptTokens), int64(usage.CompletionTokens)
+	} else {
+		n := estimateTokens(req.System)
+		for _, m := range req.Messages {
+			n += estimateTokens(m.Content)
+		}
+		rec.PromptTokens, rec.CompletionTokens = int64(n), int64(estimateTokens(answer))
+		rec.Estimated = true
+	}
+	if sess != nil {
+		rec.UserID = sess.UserID
+	}
+	p.chargeUsage(ctx, rec)
+
+	_ = p.Buffers.MarkUsage(ctx, sessionID, chunkIndex, models.ChunkUsage{LLM: &models.LLMUsage{
+		PromptTokens:     rec.PromptTokens,
+		CompletionTokens: rec.CompletionTokens,
+		Estimated:        rec.Estimated,
+		CostMicroUSD:     rec.CostMicroUSD,
+	}})
+}
+
+// chargeUsage stores rec in the usage ledger, which also prices it, and
+// counts it against the user's quota, settling the audio the chunk reserved
+// when it was accepted. A retried chunk the ledger already has is not counted
+// again; one the ledger failed to store still is, so a ledger outage does not
+// lift the limits.
+func (p *AudioWorkerPool) chargeUsage(ctx context.Context, rec *models.UsageRecord) {
+	if p.Usage == nil && p.Quota == nil {
+		return
+	}
+	log := p.Logger.WithField("session_id", rec.SessionID).WithField("chunk_index", rec.ChunkIndex)
+	if rec.UserID == "" {
+		log.Warn("session unknown, usage not recorded")
+		return
+	}
+
+	recorded := true
+	if p.Usage != nil {
+		var err error
+		if recorded, err = p.Usage.Record(ctx, rec); err != nil {
+			log.WithError(err).Error("record usage failed")
+			recorded = true
+		}
+	}
+	if p.Quota == nil {
+		return
+	}
+
+	var err error
+	switch {
+	case rec.Kind == models.UsageKindSTT:
+		used := time.Duration(rec.AudioSeconds * float64(time.Second))
+		if !recorded {
+			used = 0 // counted already; only drop what a resent copy reserved
+		}
+		err = p.Quota.SettleAudio(ctx, rec.UserID, rec.SessionID, rec.ChunkIndex, used)
+	case rec.Kind == models.UsageKindLLM && recorded:
+		err = p.Quota.AddLLMTokens(ctx, rec.UserID, rec.PromptTokens+rec.CompletionTokens)
+	}
+	if err != nil {
+		log.WithError(err).Warn("quota count failed")
+	}
+}
+
+// releaseAudio drops the quota reservation of a chunk that will not be
+// transcribed: silent, already answered, or dead-lettered.
+func (p *AudioWorkerPool) releaseAudio(ctx context.Context, msg redis.XMessage) {
+	userID := msgField(msg, "user_id")
+	chunkIndex, err := strconv.ParseInt(msgField(msg, "chunk_index"), 10, 64)
+	if p.Quota == nil || userID == "" || err != nil {
+		return
+	}
+	if err := p.Quota.SettleAudio(ctx, userID, msgField(msg, "session_id"), chunkIndex, 0); err != nil {
+		p.Logger.WithError(err).WithField("redis_id", msg.ID).Warn("quota release failed")
+	}
+}
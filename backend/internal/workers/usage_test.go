@@ -0,0 +1,111 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yoockh/yoospeak/internal/audio"
+	"github.com/yoockh/yoospeak/internal/models"
+	"github.com/yoockh/yoospeak/internal/services"
+)
+
+// ledger is a UsageService whose Record answers with recorded and err.
+type ledger struct {
+	services.UsageService
+	recorded bool
+	err      error
+}
+
+func (l ledger) Record(context.Context, *models.UsageRecord) (bool, error) { return l.recorded, l.err }
+
+func TestChargeUsageCountsQuotaUnlessLedgerHasTheRecord(t *testing.T) {
+	cases := []struct {
+		name   string
+		ledger ledger
+		want   int64
+	}{
+		{"recorded", ledger{recorded: true}, 100},
+		{"already recorded", ledger{recorded: false}, 0},
+		{"ledger down", ledger{err: errors.New("connection refused")}, 100},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newTestPool(t, nil)
+			p.Usage = tc.ledger
+			p.Quota = services.NewQuotaService(p.Redis, services.QuotaConfig{
+				Plans:       services.QuotaPlans{"free": {LLMTokensPerDay: 1000}},
+				DefaultPlan: "free",
+			}, nil)
+
+			p.chargeUsage(context.Background(), &models.UsageRecord{
+				UserID: "user-1", SessionID: "sess-1", ChunkIndex: 1, Kind: models.UsageKindLLM,
+				PromptTokens: 80, CompletionTokens: 20,
+			})
+
+			st, err := p.Quota.Status(context.Background(), "user-1", "")
+			if err != nil {
+				t.Fatalf("Status: %v", err)
+			}
+			if st.Used.LLMTokens != tc.want {
+				t.Errorf("tokens counted = %d, want %d", st.Used.LLMTokens, tc.want)
+			}
+		})
+	}
+}
+
+func TestChunksThatAreNotTranscribedReleaseTheirReservation(t *testing.T) {
+	p, _, _ := newUtterancePool(t)
+	p.VAD = audio.NewVAD()
+	p.Quota = services.NewQuotaService(p.Redis, services.QuotaConfig{Plans: services.QuotaPlans{"free": {}}, DefaultPlan: "free"}, nil)
+	ctx := context.Background()
+
+	reserve := func(chunkIndex int64) {
+		t.Helper()
+		if err := p.Quota.AdmitAudio(ctx, "user-1", "", "sess-1", chunkIndex, 10*time.Second); err != nil {
+			t.Fatalf("AdmitAudio: %v", err)
+		}
+	}
+	chunk := func(chunkIndex int, pcm string, final bool) redis.XMessage {
+		msg := wordChunk("sess-1", chunkIndex, pcm, final)
+		msg.Values["user_id"] = "user-1"
+		return msg
+	}
+	audioUsed := func() float64 {
+		t.Helper()
+		st, err := p.Quota.Status(ctx, "user-1", "")
+		if err != nil {
+			t.Fatalf("Status: %v", err)
+		}
+		return st.Used.AudioMinutes
+	}
+
+	// a silent chunk is not transcribed
+	reserve(1)
+	handle(t, p, chunk(1, strings.Repeat("\x00", 3200), false))
+	if got := audioUsed(); got != 0 {
+		t.Errorf("silent chunk: used %v minutes, want its reservation released", got)
+	}
+
+	// an answered chunk resent by the client
+	handle(t, p, chunk(2, strings.Repeat("\x00\x20", 1600), true))
+	settled := audioUsed()
+	if settled <= 0 {
+		t.Fatalf("transcribed chunk was not counted")
+	}
+	reserve(2)
+	handle(t, p, chunk(2, strings.Repeat("\x00\x20", 1600), true))
+	if got := audioUsed(); got != settled {
+		t.Errorf("replayed chunk: used %v minutes, want %v", got, settled)
+	}
+
+	// a dead-lettered chunk
+	reserve(3)
+	p.onDeadLetter(ctx, chunk(3, "bad!", false), "stt failed")
+	if got := audioUsed(); got != settled {
+		t.Errorf("dead-lettered chunk: used %v minutes, want %v", got, settled)
+	}
+}
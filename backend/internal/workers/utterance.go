@@ -0,0 +1,543 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/yoockh/yoospeak/internal/audio"
+)
+
+// utterance is the transcript accumulated over consecutive chunks of a session
+// until an is_final chunk (or silence) closes it. State lives in Redis so a
+// reclaimed or retried chunk picks up where the previous consumer left off.
+type utterance struct {
+	start int64
+	end   int64
+	text  string
+
+	// transcript of every chunk folded in so far, joined in index order into text
+	chunks map[int64]string
+
+	// running STT confidence over the chunks that produced text
+	confSum float64
+	confN   int64
+
+	// VAD: speech heard so far and the silence since it (across chunks)
+	speechMS  int64
+	silenceMS int64
+
+	// when the last chunk was folded in (unix ms)
+	touchedMS int64
+
+	// owner names a closed utterance (see closeUtterance); empty while open
+	owner string
+
+	// the coach answer once the LLM produced it (see keepAnswer), with its time
+	answer    string
+	answerMS  int64
+	hasAnswer bool
+}
+
+func (u *utterance) confidence() float64 {
+	if u.confN == 0 {
+		return 0
+	}
+	return u.confSum / float64(u.confN)
+}
+
+func utteranceKey(sessionID string) string { return "session:" + sessionID + ":utterance" }
+
+// answeredKey holds the last chunk index of the session's most recent closed
+// utterance; foldedKey is the set of every chunk index folded into one. A chunk
+// at or below the answered index can no longer join an utterance.
+func answeredKey(sessionID string) string { return "session:" + sessionID + ":answered" }
+func foldedKey(sessionID string) string   { return "session:" + sessionID + ":folded" }
+
+// closedKey holds a closed utterance until its answer is saved. owner is the
+// chunk whose processing closed it ("chunk-<index>"), whose retries resume the
+// answer, or a flush ("flush-..."), listed in flushingKey for the flusher.
+func closedKey(sessionID, owner string) string { return "session:" + sessionID + ":closed:" + owner }
+func flushingKey(sessionID string) string      { return "session:" + sessionID + ":flushing" }
+
+func chunkOwner(chunkIndex int64) string { return "chunk-" + strconv.FormatInt(chunkIndex, 10) }
+
+const (
+	chunkFieldPrefix = "chunk:"
+	utteranceTTL     = time.Hour
+)
+
+var (
+	// errChunkReplayed: the chunk was already folded into an utterance that has been answered.
+	errChunkReplayed = errors.New("chunk already answered")
+	// errChunkLate: the chunk arrived after the utterance covering its index was answered.
+	errChunkLate = errors.New("chunk arrived after its utterance was answered")
+)
+
+// utteranceDeadlinesKey is a ZSET of session ids scored by the unix-ms time at
+// which their open utterance should be flushed for silence.
+func (p *AudioWorkerPool) utteranceDeadlinesKey() string { return p.Stream + ":utterances" }
+
+// foldScript changes a session's utterance in one step, so chunks of a session
+// handled concurrently cannot overwrite each other's state, and a chunk cannot
+// slip into an utterance between the snapshot it is answered from and its close.
+//
+// KEYS: utterance, answered, folded, flushing, closed.
+// ARGV[1] is the mode: "fold" adds chunk ARGV[2] with text ARGV[3] and STT
+// confidence ARGV[4], and VAD verdict ARGV[5] ("", "speech" or "silence") with
+// speech, trailing and total ms ARGV[6..8], at ARGV[9] (unix ms); a chunk at or
+// below the answered index is refused ("replayed" or "late"), one already in
+// the utterance is left as is. "tail" appends text ARGV[3] to the last chunk.
+// "close" only closes.
+// A non-empty ARGV[10] then closes the utterance: it moves to the closed key
+// with owner ARGV[10] (listed in flushing when ARGV[11] is "1") and its last
+// chunk becomes the answered index. ARGV[12] is the TTL of every key.
+//
+// Returns the status ("open", "closed", "empty", "replayed" or "late")
+// followed by the utterance's fields.
+var foldScript = redis.NewScript(`
+local ukey, akey, fkey, flushing, ckey = KEYS[1], KEYS[2], KEYS[3], KEYS[4], KEYS[5]
+local mode, ttl = ARGV[1], ARGV[12]
+
+if mode == 'fold' then
+  local idx = tonumber(ARGV[2])
+  if idx <= tonumber(redis.call('GET', akey) or '0') then
+    if redis.call('SISMEMBER', fkey, ARGV[2]) == 1 then
+      return {'replayed'}
+    end
+    return {'late'}
+  end
+  local field = 'chunk:' .. ARGV[2]
+  if redis.call('HEXISTS', ukey, field) == 0 then
+    local start = tonumber(redis.call('HGET', ukey, 'start') or '0')
+    if start == 0 or idx < start then
+      redis.call('HSET', ukey, 'start', idx)
+    end
+    if idx > tonumber(redis.call('HGET', ukey, 'end') or '0') then
+      redis.call('HSET', ukey, 'end', idx)
+    end
+    redis.call('HSET', ukey, field, ARGV[3], 'touched_ms', ARGV[9])
+    if ARGV[3] ~= '' then
+      redis.call('HINCRBYFLOAT', ukey, 'conf_sum', ARGV[4])
+      redis.call('HINCRBY', ukey, 'conf_n', 1)
+    end
+    if ARGV[5] == 'speech' then
+      redis.call('HINCRBY', ukey, 'speech_ms', ARGV[6])
+      redis.call('HSET', ukey, 'silence_ms', ARGV[7])
+    elseif ARGV[5] == 'silence' then
+      redis.call('HINCRBY', ukey, 'silence_ms', ARGV[8])
+    end
+    redis.call('EXPIRE', ukey, ttl)
+    redis.call('SADD', fkey, ARGV[2])
+    redis.call('EXPIRE', fkey, ttl)
+  end
+elseif mode == 'tail' then
+  local last = redis.call('HGET', ukey, 'end')
+  if last and ARGV[3] ~= '' then
+    local field = 'chunk:' .. last
+    local cur = redis.call('HGET', ukey, field) or ''
+    if cur ~= '' then
+      cur = cur .. ' '
+    end
+    redis.call('HSET', ukey, field, cur .. ARGV[3])
+    redis.call('HINCRBYFLOAT', ukey, 'conf_sum', ARGV[4])
+    redis.call('HINCRBY', ukey, 'conf_n', 1)
+  end
+end
+
+if ARGV[10] == '' then
+  return {'open', unpack(redis.call('HGETALL', ukey))}
+end
+local last = tonumber(redis.call('HGET', ukey, 'end') or '0')
+if last == 0 then
+  redis.call('DEL', ukey)
+  return {'empty'}
+end
+redis.call('SET', akey, last, 'EX', ttl)
+redis.call('EXPIRE', fkey, ttl)
+redis.call('HSET', ukey, 'owner', ARGV[10])
+redis.call('RENAME', ukey, ckey)
+redis.call('EXPIRE', ckey, ttl)
+if ARGV[11] == '1' then
+  redis.call('SADD', flushing, ARGV[10])
+  redis.call('EXPIRE', flushing, ttl)
+end
+return {'closed', unpack(redis.call('HGETALL', ckey))}
+`)
+
+// foldArgs is one run of foldScript; see there.
+type foldArgs struct {
+	mode       string
+	chunkIndex int64
+	text       string
+	conf       float64
+	act        *audio.Activity
+	closeAs    string // owner of the closed utterance, "" to leave it open
+	flush      bool   // closed by the flusher
+}
+
+func (p *AudioWorkerPool) runFold(ctx context.Context, sessionID string, a foldArgs) (*utterance, error) {
+	vad, speechMS, trailingMS, durationMS := "", 0, 0, 0
+	if a.act != nil {
+		vad, speechMS, trailingMS, durationMS = "silence", a.act.SpeechMS, a.act.TrailingMS, a.act.DurationMS
+		if a.act.Speech {
+			vad = "speech"
+		}
+	}
+	flush := "0"
+	if a.flush {
+		flush = "1"
+	}
+	owner := a.closeAs
+	if owner == "" {
+		owner = "none" // the closed key is unused while the utterance stays open
+	}
+	res, err := foldScript.Run(ctx, p.Redis,
+		[]string{utteranceKey(sessionID), answeredKey(sessionID), foldedKey(sessionID), flushingKey(sessionID), closedKey(sessionID, owner)},
+		a.mode, a.chunkIndex, strings.TrimSpace(a.text), a.conf, vad, speechMS, trailingMS, durationMS,
+		time.Now().UnixMilli(), a.closeAs, flush, int64(utteranceTTL/time.Second),
+	).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	switch res[0] {
+	case "replayed":
+		return nil, errChunkReplayed
+	case "late":
+		return nil, errChunkLate
+	case "empty":
+		return nil, nil
+	}
+	return parseUtterance(res[1:]), nil
+}
+
+// parseUtterance reads an utterance hash returned as alternating field names and values.
+func parseUtterance(kv []string) *utterance {
+	m := make(map[string]string, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		m[kv[i]] = kv[i+1]
+	}
+	u := &utterance{chunks: map[int64]string{}, owner: m["owner"]}
+	u.start, _ = strconv.ParseInt(m["start"], 10, 64)
+	u.end, _ = strconv.ParseInt(m["end"], 10, 64)
+	u.confSum, _ = strconv.ParseFloat(m["conf_sum"], 64)
+	u.confN, _ = strconv.ParseInt(m["conf_n"], 10, 64)
+	u.speechMS, _ = strconv.ParseInt(m["speech_ms"], 10, 64)
+	u.silenceMS, _ = strconv.ParseInt(m["silence_ms"], 10, 64)
+	u.touchedMS, _ = strconv.ParseInt(m["touched_ms"], 10, 64)
+	u.answer, u.hasAnswer = m["answer"]
+	u.answerMS, _ = strconv.ParseInt(m["answer_ms"], 10, 64)
+	for k, v := range m {
+		if idx, err := strconv.ParseInt(strings.TrimPrefix(k, chunkFieldPrefix), 10, 64); err == nil && strings.HasPrefix(k, chunkFieldPrefix) {
+			u.chunks[idx] = v
+		}
+	}
+	u.join()
+	return u
+}
+
+// loadUtterance reads the utterance hash at key (open or closed); a missing
+// one comes back empty (end 0).
+func (p *AudioWorkerPool) loadUtterance(ctx context.Context, key string) (*utterance, error) {
+	m, err := p.Redis.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	kv := make([]string, 0, 2*len(m))
+	for k, v := range m {
+		kv = append(kv, k, v)
+	}
+	return parseUtterance(kv), nil
+}
+
+// checkChunkOpen reports whether chunkIndex may still join an utterance: it
+// returns errChunkReplayed or errChunkLate for chunks at or below the session's
+// last answered index.
+func (p *AudioWorkerPool) checkChunkOpen(ctx context.Context, sessionID string, chunkIndex int64) error {
+	answered, err := p.Redis.Get(ctx, answeredKey(sessionID)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if chunkIndex > answered {
+		return nil
+	}
+	folded, err := p.Redis.SIsMember(ctx, foldedKey(sessionID), strconv.FormatInt(chunkIndex, 10)).Result()
+	if err != nil {
+		return err
+	}
+	if folded {
+		return errChunkReplayed
+	}
+	return errChunkLate
+}
+
+// chunkFolded reports whether chunkIndex is already in the session's open utterance.
+func (p *AudioWorkerPool) chunkFolded(ctx context.Context, sessionID string, chunkIndex int64) (bool, error) {
+	return p.Redis.HExists(ctx, utteranceKey(sessionID), chunkFieldPrefix+strconv.FormatInt(chunkIndex, 10)).Result()
+}
+
+// appendUtterance folds a chunk transcript into the session's open utterance,
+// and with closes set closes it in the same step (the chunk ends it). A chunk
+// already in the open utterance (retry/replay) leaves it unchanged; chunks
+// arriving out of order are joined in index order. Chunks of an already
+// answered utterance are refused with errChunkReplayed or errChunkLate.
+func (p *AudioWorkerPool) appendUtterance(ctx context.Context, sessionID string, chunkIndex int64, text string, conf float64, act *audio.Activity, closes bool) (*utterance, error) {
+	a := foldArgs{mode: "fold", chunkIndex: chunkIndex, text: text, conf: conf, act: act}
+	if closes {
+		a.closeAs = chunkOwner(chunkIndex)
+	}
+	return p.runFold(ctx, sessionID, a)
+}
+
+// closeUtterance closes the session's open utterance as owner: it moves to
+// closedKey until answered, and its last chunk becomes the answered index so
+// chunks of it arriving later are refused. nil means there was nothing to close.
+func (p *AudioWorkerPool) closeUtterance(ctx context.Context, sessionID, owner string, flush bool) (*utterance, error) {
+	return p.runFold(ctx, sessionID, foldArgs{mode: "close", closeAs: owner, flush: flush})
+}
+
+// closedUtterance is the utterance owner closed and has not answered yet, or nil.
+func (p *AudioWorkerPool) closedUtterance(ctx context.Context, sessionID, owner string) (*utterance, error) {
+	u, err := p.loadUtterance(ctx, closedKey(sessionID, owner))
+	if err != nil || u.end == 0 {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (u *utterance) join() {
+	idx := make([]int64, 0, len(u.chunks))
+	for i := range u.chunks {
+		idx = append(idx, i)
+	}
+	sort.Slice(idx, func(a, b int) bool { return idx[a] < idx[b] })
+	parts := make([]string, 0, len(idx))
+	for _, i := range idx {
+		if t := u.chunks[i]; t != "" {
+			parts = append(parts, t)
+		}
+	}
+	u.text = strings.Join(parts, " ")
+}
+
+// foldStreamTail closes the session's STT stream, if one is open, and adds the
+// finals that arrived after the last chunk to the open utterance and that chunk.
+func (p *AudioWorkerPool) foldStreamTail(ctx context.Context, sessionID string) {
+	text, conf, lastText, ok, err := p.finishSTTSession(ctx, sessionID)
+	if !ok || err != nil || text == "" {
+		return
+	}
+	u, err := p.runFold(ctx, sessionID, foldArgs{mode: "tail", text: text, conf: conf})
+	if err != nil || u == nil || u.end == 0 {
+		return
+	}
+	_ = p.Buffers.MarkSTT(ctx, sessionID, u.end, strings.TrimSpace(lastText+" "+text), conf, "done")
+	payload, _ := json.Marshal(map[string]any{
+		"type":        "stt_result",
+		"chunk_index": u.end,
+		"text":        text,
+		"confidence":  conf,
+		"is_final":    true,
+	})
+	_ = p.Redis.Publish(ctx, "session:"+sessionID+":response", string(payload)).Err()
+}
+
+// finishUtterance drops a closed utterance once its answer is saved (or given up on).
+func (p *AudioWorkerPool) finishUtterance(ctx context.Context, sessionID string, u *utterance) {
+	_, _ = p.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, closedKey(sessionID, u.owner))
+		pipe.SRem(ctx, flushingKey(sessionID), u.owner)
+		return nil
+	})
+}
+
+// keepAnswer stores the answer with the closed utterance until it is saved.
+// Best-effort: if it is lost, a retry asks the LLM again.
+func (p *AudioWorkerPool) keepAnswer(ctx context.Context, sessionID string, u *utterance, answer string, procMS int64) {
+	key := closedKey(sessionID, u.owner)
+	_, _ = p.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, "answer", answer, "answer_ms", procMS)
+		pipe.Expire(ctx, key, utteranceTTL)
+		return nil
+	})
+}
+
+// dropClosedUtterance gives up on the utterance a dead-lettered chunk closed.
+func (p *AudioWorkerPool) dropClosedUtterance(ctx context.Context, msg redis.XMessage) {
+	chunkIndex, err := strconv.ParseInt(msgField(msg, "chunk_index"), 10, 64)
+	if err != nil {
+		return
+	}
+	_ = p.Redis.Del(ctx, closedKey(msgField(msg, "session_id"), chunkOwner(chunkIndex))).Err()
+}
+
+func (p *AudioWorkerPool) scheduleFlush(ctx context.Context, sessionID string) {
+	p.scheduleFlushIn(ctx, sessionID, p.UtteranceTimeout)
+}
+
+// scheduleFlushIn wakes the flusher for the session in d, unless it is due
+// sooner already; flushUtterance works out what is actually due then.
+func (p *AudioWorkerPool) scheduleFlushIn(ctx context.Context, sessionID string, d time.Duration) {
+	_ = p.Redis.ZAddLT(ctx, p.utteranceDeadlinesKey(), redis.Z{
+		Score:  float64(time.Now().Add(d).UnixMilli()),
+		Member: sessionID,
+	}).Err()
+}
+
+func (p *AudioWorkerPool) runUtteranceFlusher(ctx context.Context) {
+	tick := p.UtteranceTimeout / 4
+	if tick < 200*time.Millisecond {
+		tick = 200 * time.Millisecond
+	}
+	t := time.NewTicker(tick)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		due, err := p.Redis.ZRangeByScoreWithScores(ctx, p.utteranceDeadlinesKey(), &redis.ZRangeBy{
+			Min: "-inf",
+			Max: strconv.FormatInt(time.Now().UnixMilli(), 10),
+		}).Result()
+		if err != nil {
+			continue
+		}
+
+		for _, z := range due {
+			sessionID, _ := z.Member.(string)
+			if !p.flushableHere(ctx, sessionID, time.Since(time.UnixMilli(int64(z.Score)))) {
+				continue
+			}
+			// ZREM doubles as a claim: only the pool that removes the member flushes it
+			if n, err := p.Redis.ZRem(ctx, p.utteranceDeadlinesKey(), sessionID).Result(); err != nil || n == 0 {
+				continue
+			}
+			if !p.dispatch(ctx, sessionID, func(ctx context.Context) { p.flushUtterance(ctx, sessionID) }) {
+				// shutting down: leave the flush to the next flusher
+				p.scheduleFlushIn(context.Background(), sessionID, 0)
+			}
+		}
+	}
+}
+
+// flushableHere reports whether this instance should flush the session's
+// utterance. One streamed by another instance is left to that instance (only
+// it holds the stream's last finals) until overdue exceeds sttOwnerGrace,
+// after which the owner is presumed gone and the utterance is answered here
+// without the stream's tail.
+func (p *AudioWorkerPool) flushableHere(ctx context.Context, sessionID string, overdue time.Duration) bool {
+	owner, err := p.Redis.HGet(ctx, utteranceKey(sessionID), sttOwnerField).Result()
+	if err != nil || owner == "" || owner == p.InstanceID {
+		return true
+	}
+	if overdue < p.sttOwnerGrace {
+		return false
+	}
+	p.Logger.WithFields(logrus.Fields{"session_id": sessionID, "stt_owner": owner}).
+		Warn("flushing utterance streamed by another instance; its last stt finals are lost")
+	return true
+}
+
+// flushUtterance answers what is due for the session: answers owed by earlier
+// flushes whose retry backoff is over, then the open utterance once it has
+// been quiet for UtteranceTimeout. Whatever is not due yet is rescheduled.
+func (p *AudioWorkerPool) flushUtterance(ctx context.Context, sessionID string) {
+	owners, err := p.Redis.SMembers(ctx, flushingKey(sessionID)).Result()
+	if err != nil {
+		p.scheduleFlushIn(ctx, sessionID, p.RetryBaseDelay)
+		return
+	}
+	for _, owner := range owners {
+		u, err := p.closedUtterance(ctx, sessionID, owner)
+		if err != nil {
+			p.scheduleFlushIn(ctx, sessionID, p.RetryBaseDelay)
+			continue
+		}
+		if u == nil {
+			_ = p.Redis.SRem(ctx, flushingKey(sessionID), owner).Err() // expired
+			continue
+		}
+		retryAt, _ := p.Redis.HGet(ctx, closedKey(sessionID, owner), "retry_at_ms").Int64()
+		if wait := time.Until(time.UnixMilli(retryAt)); wait > 0 {
+			p.scheduleFlushIn(ctx, sessionID, wait)
+			continue
+		}
+		p.answerFlushed(ctx, sessionID, u)
+	}
+
+	u, err := p.loadUtterance(ctx, utteranceKey(sessionID))
+	if err != nil {
+		p.scheduleFlushIn(ctx, sessionID, p.RetryBaseDelay)
+		return
+	}
+	if u.end == 0 {
+		// already closed by an is_final chunk
+		return
+	}
+	if wait := p.UtteranceTimeout - time.Since(time.UnixMilli(u.touchedMS)); u.touchedMS > 0 && wait > 0 {
+		p.scheduleFlushIn(ctx, sessionID, wait)
+		return
+	}
+
+	p.foldStreamTail(ctx, sessionID)
+	u, err = p.closeUtterance(ctx, sessionID, "flush-"+uuid.NewString(), true)
+	if err != nil {
+		p.scheduleFlushIn(ctx, sessionID, p.RetryBaseDelay)
+		return
+	}
+	if u != nil {
+		p.answerFlushed(ctx, sessionID, u)
+	}
+}
+
+// answerFlushed answers an utterance the flusher closed, retrying with backoff
+// through the flusher and dead-lettering it after MaxAttempts.
+func (p *AudioWorkerPool) answerFlushed(ctx context.Context, sessionID string, u *utterance) {
+	err := p.answerUtterance(ctx, sessionID, u)
+	if err == nil || ctx.Err() != nil {
+		return
+	}
+
+	key := closedKey(sessionID, u.owner)
+	attempt, _ := p.Redis.HIncrBy(ctx, key, "flush_attempts", 1).Result()
+	_, reason := classify(err)
+
+	if int(attempt) >= p.MaxAttempts {
+		p.Logger.WithError(err).WithField("session_id", sessionID).Error("utterance flush dead-lettered")
+		_ = p.Redis.XAdd(ctx, &redis.XAddArgs{
+			Stream: p.DeadLetterStream,
+			Values: map[string]any{
+				"session_id":    sessionID,
+				"chunk_start":   strconv.FormatInt(u.start, 10),
+				"chunk_end":     strconv.FormatInt(u.end, 10),
+				"text":          u.text,
+				"dlq_reason":    reason,
+				"dlq_error":     err.Error(),
+				"dlq_attempts":  strconv.FormatInt(attempt, 10),
+				"dlq_failed_at": strconv.FormatInt(time.Now().UTC().Unix(), 10),
+			},
+		}).Err()
+		p.finishUtterance(ctx, sessionID, u)
+		p.publishChunkStatus(ctx, sessionID, u.end, "failed", reason)
+		return
+	}
+
+	delay := backoff(int(attempt), p.RetryBaseDelay, p.RetryMaxDelay)
+	_ = p.Redis.HSet(ctx, key, "retry_at_ms", time.Now().Add(delay).UnixMilli()).Err()
+	p.publishChunkStatus(ctx, sessionID, u.end, "retrying", reason)
+	p.scheduleFlushIn(ctx, sessionID, delay)
+}
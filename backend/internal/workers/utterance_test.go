@@ -0,0 +1,247 @@
+package workers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	llmfake "github.com/yoockh/yoospeak/internal/providers/llm/fake"
+	sttfake "github.com/yoockh/yoospeak/internal/providers/stt/fake"
+)
+
+// newUtterancePool is a test pool whose STT "transcribes" a chunk to its audio
+// bytes and whose LLM records the utterances it is asked to answer.
+func newUtterancePool(t *testing.T) (*AudioWorkerPool, *sttfake.Provider, *llmfake.Provider) {
+	t.Helper()
+	sttP := &sttfake.Provider{Respond: func(c sttfake.Call) sttfake.Response {
+		return sttfake.Response{Text: string(c.Audio), Confidence: 0.9}
+	}}
+	llmP := &llmfake.Provider{Default: llmfake.Response{Chunks: []string{"ok"}}}
+	p := newTestPool(t, sttP)
+	p.LLM = llmP
+	return p, sttP, llmP
+}
+
+// wordChunk is a chunk whose audio is word; words must have an even length to be valid 16-bit PCM.
+func wordChunk(sessionID string, chunkIndex int, word string, final bool) redis.XMessage {
+	return redis.XMessage{
+		ID: strconv.Itoa(chunkIndex) + "-0",
+		Values: map[string]any{
+			"session_id":   sessionID,
+			"chunk_index":  strconv.Itoa(chunkIndex),
+			"is_final":     strconv.FormatBool(final),
+			"audio_base64": base64.StdEncoding.EncodeToString([]byte(word)),
+		},
+	}
+}
+
+func handle(t *testing.T, p *AudioWorkerPool, msgs ...redis.XMessage) {
+	t.Helper()
+	for _, msg := range msgs {
+		if err := p.handleMsg(context.Background(), msg); err != nil {
+			t.Fatalf("chunk %s: %v", msg.ID, err)
+		}
+	}
+}
+
+// answered lists the utterance each LLM request answered.
+func answered(llmP *llmfake.Provider) []string {
+	var out []string
+	for _, req := range llmP.Requests() {
+		out = append(out, req.Messages[len(req.Messages)-1].Content)
+	}
+	return out
+}
+
+func TestUtteranceJoinsChunksInIndexOrderUntilFinal(t *testing.T) {
+	p, sttP, llmP := newUtterancePool(t)
+
+	// chunk 2 overtakes chunk 1, and chunk 1 is retried (not transcribed again) before the final chunk
+	handle(t, p,
+		wordChunk("sess-1", 2, "team", false),
+		wordChunk("sess-1", 1, "good", false),
+		wordChunk("sess-1", 1, "good", false),
+	)
+	if got := answered(llmP); len(got) != 0 {
+		t.Fatalf("answered %q before is_final", got)
+	}
+
+	handle(t, p, wordChunk("sess-1", 3, "okay", true))
+
+	got := answered(llmP)
+	if len(got) != 1 || got[0] != "good team okay" {
+		t.Errorf("answered %q, want one answer for \"good team okay\"", got)
+	}
+	if n := len(sttP.Calls()); n != 3 {
+		t.Errorf("stt called %d times, want 3", n)
+	}
+	if n, _ := p.Redis.Exists(context.Background(), utteranceKey("sess-1")).Result(); n != 0 {
+		t.Errorf("utterance left open after it was answered")
+	}
+	if keys, _ := p.Redis.Keys(context.Background(), closedKey("sess-1", "*")).Result(); len(keys) != 0 {
+		t.Errorf("closed utterance %v kept after its answer was saved", keys)
+	}
+}
+
+func TestUtteranceFlushedAfterSilenceTimeout(t *testing.T) {
+	p, _, llmP := newUtterancePool(t)
+	p.UtteranceTimeout = 20 * time.Millisecond
+
+	handle(t, p,
+		wordChunk("sess-1", 1, "good", false),
+		wordChunk("sess-1", 2, "team", false),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.runUtteranceFlusher(ctx)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for len(answered(llmP)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("utterance never flushed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := answered(llmP); len(got) != 1 || got[0] != "good team" {
+		t.Errorf("answered %q, want one answer for \"good team\"", got)
+	}
+}
+
+func TestReplayedChunksDoNotReopenAnsweredUtterance(t *testing.T) {
+	p, sttP, llmP := newUtterancePool(t)
+	ctx := context.Background()
+
+	handle(t, p,
+		wordChunk("sess-1", 1, "good", false),
+		wordChunk("sess-1", 2, "team", true),
+	)
+	calls := len(sttP.Calls())
+
+	// a reclaimed copy of each chunk arrives after the answer
+	handle(t, p,
+		wordChunk("sess-1", 1, "good", false),
+		wordChunk("sess-1", 2, "team", true),
+	)
+
+	if got := answered(llmP); len(got) != 1 {
+		t.Errorf("answered %q, want the replays ignored", got)
+	}
+	if n := len(sttP.Calls()); n != calls {
+		t.Errorf("stt called %d more times for replays", n-calls)
+	}
+	if n, _ := p.Redis.Exists(ctx, utteranceKey("sess-1")).Result(); n != 0 {
+		t.Errorf("replayed chunk opened a new utterance")
+	}
+
+	// the next utterance still works
+	handle(t, p, wordChunk("sess-1", 3, "okay", true))
+	if got := answered(llmP); len(got) != 2 || got[1] != "okay" {
+		t.Errorf("answered %q, want a second answer for \"okay\"", got)
+	}
+}
+
+func TestLateChunkIsReportedNotFolded(t *testing.T) {
+	p, _, llmP := newUtterancePool(t)
+	ctx := context.Background()
+
+	sub := p.Redis.Subscribe(ctx, "session:sess-1:status")
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	// chunk 2 is answered as final before chunk 1 shows up
+	handle(t, p, wordChunk("sess-1", 2, "team", true))
+	handle(t, p, wordChunk("sess-1", 1, "good", false))
+
+	if got := answered(llmP); len(got) != 1 || got[0] != "team" {
+		t.Errorf("answered %q, want only \"team\"", got)
+	}
+	if n, _ := p.Redis.Exists(ctx, utteranceKey("sess-1")).Result(); n != 0 {
+		t.Errorf("late chunk opened a new utterance")
+	}
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case m := <-sub.Channel():
+			if m.Payload == `{"chunk_index":1,"message":"chunk arrived after its utterance was answered","status":"late","type":"status"}` {
+				return
+			}
+		case <-timeout:
+			t.Fatal("no late status published for chunk 1")
+		}
+	}
+}
+
+func TestUnorderedChunksAreFoldedOrReportedLate(t *testing.T) {
+	p, sttP, llmP := newUtterancePool(t)
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(1))
+	sttP.Respond = func(c sttfake.Call) sttfake.Response {
+		// called under the fake's lock, so rng needs no lock of its own
+		return sttfake.Response{Text: string(c.Audio), Confidence: 0.9, Latency: time.Duration(rng.Intn(20)) * time.Millisecond}
+	}
+
+	for round := 0; round < 5; round++ {
+		sessionID := "sess-" + strconv.Itoa(round)
+		sub := p.Redis.Subscribe(ctx, "session:"+sessionID+":status")
+		if _, err := sub.Receive(ctx); err != nil {
+			t.Fatalf("subscribe: %v", err)
+		}
+
+		// chunks of one session run concurrently, as in non-ordered mode
+		const n = 12
+		var wg sync.WaitGroup
+		for i := 1; i <= n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if err := p.handleMsg(ctx, wordChunk(sessionID, i, fmt.Sprintf("w%03d", i), i == n)); err != nil {
+					t.Errorf("chunk %d: %v", i, err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		got := answered(llmP)
+		if len(got) != round+1 {
+			t.Fatalf("round %d: answered %q, want one answer per round", round, got)
+		}
+		text := got[round]
+		late := map[int]bool{}
+		timeout := time.After(200 * time.Millisecond)
+	drain:
+		for {
+			select {
+			case m := <-sub.Channel():
+				var st struct {
+					ChunkIndex int    `json:"chunk_index"`
+					Status     string `json:"status"`
+				}
+				if json.Unmarshal([]byte(m.Payload), &st) == nil && st.Status == "late" {
+					late[st.ChunkIndex] = true
+				}
+			case <-timeout:
+				break drain
+			}
+		}
+		sub.Close()
+
+		for i := 1; i <= n; i++ {
+			word := fmt.Sprintf("w%03d", i)
+			if strings.Contains(text, word) == late[i] {
+				t.Errorf("round %d: chunk %d in answer=%v, reported late=%v; want exactly one", round, i, strings.Contains(text, word), late[i])
+			}
+		}
+	}
+}
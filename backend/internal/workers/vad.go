@@ -0,0 +1,42 @@
+package workers
+
+import (
+	"time"
+
+	"github.com/yoockh/yoospeak/internal/audio"
+	"github.com/yoockh/yoospeak/internal/models"
+)
+
+// detectVoice runs the VAD over a prepared chunk. nil means no verdict: VAD is
+// off or the chunk is compressed audio the server cannot inspect.
+func (p *AudioWorkerPool) detectVoice(format audio.Format, data []byte) *audio.Activity {
+	if p.VAD == nil || format.Encoding != audio.Linear16 || format.Channels != 1 {
+		return nil
+	}
+	act := p.VAD.Analyze(data, format.SampleRateHz)
+	return &act
+}
+
+// endOfUtterance reports whether the utterance had speech followed by at
+// least EndOfUtteranceSilence of silence.
+func (p *AudioWorkerPool) endOfUtterance(u *utterance) bool {
+	if p.VAD == nil || p.EndOfUtteranceSilence <= 0 || u.speechMS == 0 {
+		return false
+	}
+	return time.Duration(u.silenceMS)*time.Millisecond >= p.EndOfUtteranceSilence
+}
+
+func vadDecision(act *audio.Activity, trimmed, eou bool) models.VADDecision {
+	d := models.VADDecision{
+		Decision:       "silence",
+		SpeechMS:       int64(act.SpeechMS),
+		EndOfUtterance: eou,
+	}
+	if act.Speech {
+		d.Decision = "speech"
+		if trimmed {
+			d.TrimmedMS = int64(act.TrimmedMS())
+		}
+	}
+	return d
+}